@@ -0,0 +1,442 @@
+// Code generated by protoc-gen-go-grpc. DO NOT EDIT.
+// versions:
+// - protoc-gen-go-grpc v1.3.0
+// - protoc             (unknown)
+// source: adspb/ads.proto
+
+package adspb
+
+import (
+	context "context"
+	grpc "google.golang.org/grpc"
+	codes "google.golang.org/grpc/codes"
+	status "google.golang.org/grpc/status"
+)
+
+// This is a compile-time assertion to ensure that this generated file
+// is compatible with the grpc package it is being compiled against.
+// Requires gRPC-Go v1.32.0 or later.
+const _ = grpc.SupportPackageIsVersion7
+
+const (
+	AdService_CreateAd_FullMethodName          = "/ads.v1.AdService/CreateAd"
+	AdService_GetAd_FullMethodName             = "/ads.v1.AdService/GetAd"
+	AdService_UpdateAd_FullMethodName          = "/ads.v1.AdService/UpdateAd"
+	AdService_DeleteAd_FullMethodName          = "/ads.v1.AdService/DeleteAd"
+	AdService_SetAdStatus_FullMethodName       = "/ads.v1.AdService/SetAdStatus"
+	AdService_ListAdRevisions_FullMethodName   = "/ads.v1.AdService/ListAdRevisions"
+	AdService_DiffAdRevisions_FullMethodName   = "/ads.v1.AdService/DiffAdRevisions"
+	AdService_RestoreAdRevision_FullMethodName = "/ads.v1.AdService/RestoreAdRevision"
+	AdService_RestoreAd_FullMethodName         = "/ads.v1.AdService/RestoreAd"
+	AdService_ListActiveAds_FullMethodName     = "/ads.v1.AdService/ListActiveAds"
+)
+
+// AdServiceClient is the client API for AdService service.
+//
+// For semantics around ctx use and closing/ending streaming RPCs, please refer to https://pkg.go.dev/google.golang.org/grpc/?tab=doc#ClientConn.NewStream.
+type AdServiceClient interface {
+	CreateAd(ctx context.Context, in *CreateAdRequest, opts ...grpc.CallOption) (*CreateAdResponse, error)
+	GetAd(ctx context.Context, in *GetAdRequest, opts ...grpc.CallOption) (*Advertisement, error)
+	UpdateAd(ctx context.Context, in *UpdateAdRequest, opts ...grpc.CallOption) (*UpdateAdResponse, error)
+	DeleteAd(ctx context.Context, in *DeleteAdRequest, opts ...grpc.CallOption) (*DeleteAdResponse, error)
+	SetAdStatus(ctx context.Context, in *SetAdStatusRequest, opts ...grpc.CallOption) (*SetAdStatusResponse, error)
+	ListAdRevisions(ctx context.Context, in *ListAdRevisionsRequest, opts ...grpc.CallOption) (*ListAdRevisionsResponse, error)
+	DiffAdRevisions(ctx context.Context, in *DiffAdRevisionsRequest, opts ...grpc.CallOption) (*DiffAdRevisionsResponse, error)
+	RestoreAdRevision(ctx context.Context, in *RestoreAdRevisionRequest, opts ...grpc.CallOption) (*RestoreAdRevisionResponse, error)
+	RestoreAd(ctx context.Context, in *RestoreAdRequest, opts ...grpc.CallOption) (*RestoreAdResponse, error)
+	ListActiveAds(ctx context.Context, in *ListActiveAdsRequest, opts ...grpc.CallOption) (*ListActiveAdsResponse, error)
+}
+
+type adServiceClient struct {
+	cc grpc.ClientConnInterface
+}
+
+func NewAdServiceClient(cc grpc.ClientConnInterface) AdServiceClient {
+	return &adServiceClient{cc}
+}
+
+func (c *adServiceClient) CreateAd(ctx context.Context, in *CreateAdRequest, opts ...grpc.CallOption) (*CreateAdResponse, error) {
+	out := new(CreateAdResponse)
+	err := c.cc.Invoke(ctx, AdService_CreateAd_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adServiceClient) GetAd(ctx context.Context, in *GetAdRequest, opts ...grpc.CallOption) (*Advertisement, error) {
+	out := new(Advertisement)
+	err := c.cc.Invoke(ctx, AdService_GetAd_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adServiceClient) UpdateAd(ctx context.Context, in *UpdateAdRequest, opts ...grpc.CallOption) (*UpdateAdResponse, error) {
+	out := new(UpdateAdResponse)
+	err := c.cc.Invoke(ctx, AdService_UpdateAd_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adServiceClient) DeleteAd(ctx context.Context, in *DeleteAdRequest, opts ...grpc.CallOption) (*DeleteAdResponse, error) {
+	out := new(DeleteAdResponse)
+	err := c.cc.Invoke(ctx, AdService_DeleteAd_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adServiceClient) SetAdStatus(ctx context.Context, in *SetAdStatusRequest, opts ...grpc.CallOption) (*SetAdStatusResponse, error) {
+	out := new(SetAdStatusResponse)
+	err := c.cc.Invoke(ctx, AdService_SetAdStatus_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adServiceClient) ListAdRevisions(ctx context.Context, in *ListAdRevisionsRequest, opts ...grpc.CallOption) (*ListAdRevisionsResponse, error) {
+	out := new(ListAdRevisionsResponse)
+	err := c.cc.Invoke(ctx, AdService_ListAdRevisions_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adServiceClient) DiffAdRevisions(ctx context.Context, in *DiffAdRevisionsRequest, opts ...grpc.CallOption) (*DiffAdRevisionsResponse, error) {
+	out := new(DiffAdRevisionsResponse)
+	err := c.cc.Invoke(ctx, AdService_DiffAdRevisions_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adServiceClient) RestoreAdRevision(ctx context.Context, in *RestoreAdRevisionRequest, opts ...grpc.CallOption) (*RestoreAdRevisionResponse, error) {
+	out := new(RestoreAdRevisionResponse)
+	err := c.cc.Invoke(ctx, AdService_RestoreAdRevision_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adServiceClient) RestoreAd(ctx context.Context, in *RestoreAdRequest, opts ...grpc.CallOption) (*RestoreAdResponse, error) {
+	out := new(RestoreAdResponse)
+	err := c.cc.Invoke(ctx, AdService_RestoreAd_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func (c *adServiceClient) ListActiveAds(ctx context.Context, in *ListActiveAdsRequest, opts ...grpc.CallOption) (*ListActiveAdsResponse, error) {
+	out := new(ListActiveAdsResponse)
+	err := c.cc.Invoke(ctx, AdService_ListActiveAds_FullMethodName, in, out, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// AdServiceServer is the server API for AdService service.
+// All implementations must embed UnimplementedAdServiceServer
+// for forward compatibility
+type AdServiceServer interface {
+	CreateAd(context.Context, *CreateAdRequest) (*CreateAdResponse, error)
+	GetAd(context.Context, *GetAdRequest) (*Advertisement, error)
+	UpdateAd(context.Context, *UpdateAdRequest) (*UpdateAdResponse, error)
+	DeleteAd(context.Context, *DeleteAdRequest) (*DeleteAdResponse, error)
+	SetAdStatus(context.Context, *SetAdStatusRequest) (*SetAdStatusResponse, error)
+	ListAdRevisions(context.Context, *ListAdRevisionsRequest) (*ListAdRevisionsResponse, error)
+	DiffAdRevisions(context.Context, *DiffAdRevisionsRequest) (*DiffAdRevisionsResponse, error)
+	RestoreAdRevision(context.Context, *RestoreAdRevisionRequest) (*RestoreAdRevisionResponse, error)
+	RestoreAd(context.Context, *RestoreAdRequest) (*RestoreAdResponse, error)
+	ListActiveAds(context.Context, *ListActiveAdsRequest) (*ListActiveAdsResponse, error)
+	mustEmbedUnimplementedAdServiceServer()
+}
+
+// UnimplementedAdServiceServer must be embedded to have forward compatible implementations.
+type UnimplementedAdServiceServer struct {
+}
+
+func (UnimplementedAdServiceServer) CreateAd(context.Context, *CreateAdRequest) (*CreateAdResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method CreateAd not implemented")
+}
+func (UnimplementedAdServiceServer) GetAd(context.Context, *GetAdRequest) (*Advertisement, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method GetAd not implemented")
+}
+func (UnimplementedAdServiceServer) UpdateAd(context.Context, *UpdateAdRequest) (*UpdateAdResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method UpdateAd not implemented")
+}
+func (UnimplementedAdServiceServer) DeleteAd(context.Context, *DeleteAdRequest) (*DeleteAdResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DeleteAd not implemented")
+}
+func (UnimplementedAdServiceServer) SetAdStatus(context.Context, *SetAdStatusRequest) (*SetAdStatusResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method SetAdStatus not implemented")
+}
+func (UnimplementedAdServiceServer) ListAdRevisions(context.Context, *ListAdRevisionsRequest) (*ListAdRevisionsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListAdRevisions not implemented")
+}
+func (UnimplementedAdServiceServer) DiffAdRevisions(context.Context, *DiffAdRevisionsRequest) (*DiffAdRevisionsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method DiffAdRevisions not implemented")
+}
+func (UnimplementedAdServiceServer) RestoreAdRevision(context.Context, *RestoreAdRevisionRequest) (*RestoreAdRevisionResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RestoreAdRevision not implemented")
+}
+func (UnimplementedAdServiceServer) RestoreAd(context.Context, *RestoreAdRequest) (*RestoreAdResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method RestoreAd not implemented")
+}
+func (UnimplementedAdServiceServer) ListActiveAds(context.Context, *ListActiveAdsRequest) (*ListActiveAdsResponse, error) {
+	return nil, status.Errorf(codes.Unimplemented, "method ListActiveAds not implemented")
+}
+func (UnimplementedAdServiceServer) mustEmbedUnimplementedAdServiceServer() {}
+
+// UnsafeAdServiceServer may be embedded to opt out of forward compatibility for this service.
+// Use of this interface is not recommended, as added methods to AdServiceServer will
+// result in compilation errors.
+type UnsafeAdServiceServer interface {
+	mustEmbedUnimplementedAdServiceServer()
+}
+
+func RegisterAdServiceServer(s grpc.ServiceRegistrar, srv AdServiceServer) {
+	s.RegisterService(&AdService_ServiceDesc, srv)
+}
+
+func _AdService_CreateAd_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(CreateAdRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdServiceServer).CreateAd(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: AdService_CreateAd_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdServiceServer).CreateAd(ctx, req.(*CreateAdRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AdService_GetAd_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(GetAdRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdServiceServer).GetAd(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: AdService_GetAd_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdServiceServer).GetAd(ctx, req.(*GetAdRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AdService_UpdateAd_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(UpdateAdRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdServiceServer).UpdateAd(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: AdService_UpdateAd_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdServiceServer).UpdateAd(ctx, req.(*UpdateAdRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AdService_DeleteAd_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DeleteAdRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdServiceServer).DeleteAd(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: AdService_DeleteAd_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdServiceServer).DeleteAd(ctx, req.(*DeleteAdRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AdService_SetAdStatus_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(SetAdStatusRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdServiceServer).SetAdStatus(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: AdService_SetAdStatus_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdServiceServer).SetAdStatus(ctx, req.(*SetAdStatusRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AdService_ListAdRevisions_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListAdRevisionsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdServiceServer).ListAdRevisions(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: AdService_ListAdRevisions_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdServiceServer).ListAdRevisions(ctx, req.(*ListAdRevisionsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AdService_DiffAdRevisions_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(DiffAdRevisionsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdServiceServer).DiffAdRevisions(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: AdService_DiffAdRevisions_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdServiceServer).DiffAdRevisions(ctx, req.(*DiffAdRevisionsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AdService_RestoreAdRevision_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RestoreAdRevisionRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdServiceServer).RestoreAdRevision(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: AdService_RestoreAdRevision_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdServiceServer).RestoreAdRevision(ctx, req.(*RestoreAdRevisionRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AdService_RestoreAd_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(RestoreAdRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdServiceServer).RestoreAd(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: AdService_RestoreAd_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdServiceServer).RestoreAd(ctx, req.(*RestoreAdRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+func _AdService_ListActiveAds_Handler(srv interface{}, ctx context.Context, dec func(interface{}) error, interceptor grpc.UnaryServerInterceptor) (interface{}, error) {
+	in := new(ListActiveAdsRequest)
+	if err := dec(in); err != nil {
+		return nil, err
+	}
+	if interceptor == nil {
+		return srv.(AdServiceServer).ListActiveAds(ctx, in)
+	}
+	info := &grpc.UnaryServerInfo{
+		Server:     srv,
+		FullMethod: AdService_ListActiveAds_FullMethodName,
+	}
+	handler := func(ctx context.Context, req interface{}) (interface{}, error) {
+		return srv.(AdServiceServer).ListActiveAds(ctx, req.(*ListActiveAdsRequest))
+	}
+	return interceptor(ctx, in, info, handler)
+}
+
+// AdService_ServiceDesc is the grpc.ServiceDesc for AdService service.
+// It's only intended for direct use with grpc.RegisterService,
+// and not to be introspected or modified (even as a copy)
+var AdService_ServiceDesc = grpc.ServiceDesc{
+	ServiceName: "ads.v1.AdService",
+	HandlerType: (*AdServiceServer)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "CreateAd",
+			Handler:    _AdService_CreateAd_Handler,
+		},
+		{
+			MethodName: "GetAd",
+			Handler:    _AdService_GetAd_Handler,
+		},
+		{
+			MethodName: "UpdateAd",
+			Handler:    _AdService_UpdateAd_Handler,
+		},
+		{
+			MethodName: "DeleteAd",
+			Handler:    _AdService_DeleteAd_Handler,
+		},
+		{
+			MethodName: "SetAdStatus",
+			Handler:    _AdService_SetAdStatus_Handler,
+		},
+		{
+			MethodName: "ListAdRevisions",
+			Handler:    _AdService_ListAdRevisions_Handler,
+		},
+		{
+			MethodName: "DiffAdRevisions",
+			Handler:    _AdService_DiffAdRevisions_Handler,
+		},
+		{
+			MethodName: "RestoreAdRevision",
+			Handler:    _AdService_RestoreAdRevision_Handler,
+		},
+		{
+			MethodName: "RestoreAd",
+			Handler:    _AdService_RestoreAd_Handler,
+		},
+		{
+			MethodName: "ListActiveAds",
+			Handler:    _AdService_ListActiveAds_Handler,
+		},
+	},
+	Streams:  []grpc.StreamDesc{},
+	Metadata: "adspb/ads.proto",
+}
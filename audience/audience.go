@@ -0,0 +1,166 @@
+// Package audience holds sets of SHA-256 hashed user IDs in memory so that
+// the audiences of a user are found without querying the database.
+package audience
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Hash is the SHA-256 digest of a user ID.
+type Hash [sha256.Size]byte
+
+// HashUserID returns the hash of a user ID as given, without normalizing it.
+func HashUserID(userID string) Hash {
+	return sha256.Sum256([]byte(userID))
+}
+
+// Set is an immutable set of hashes, kept sorted in one packed slice so that
+// a million members take 32 MB and a lookup is a binary search.
+type Set struct {
+	packed []byte
+}
+
+var errUnsorted = errors.New("audience: hashes are not sorted")
+
+// NewSet returns the set of hashes. Duplicates are dropped and hashes is
+// sorted in place.
+func NewSet(hashes []Hash) *Set {
+	sort.Slice(hashes, func(i, j int) bool {
+		return bytes.Compare(hashes[i][:], hashes[j][:]) < 0
+	})
+	packed := make([]byte, 0, len(hashes)*sha256.Size)
+	for i, h := range hashes {
+		if i > 0 && h == hashes[i-1] {
+			continue
+		}
+		packed = append(packed, h[:]...)
+	}
+	return &Set{packed: packed}
+}
+
+// SetFromBytes returns the set stored as Bytes returned it.
+func SetFromBytes(packed []byte) (*Set, error) {
+	if len(packed)%sha256.Size != 0 {
+		return nil, fmt.Errorf("audience: %d bytes are not a whole number of hashes", len(packed))
+	}
+	for i := sha256.Size; i < len(packed); i += sha256.Size {
+		if bytes.Compare(packed[i-sha256.Size:i], packed[i:i+sha256.Size]) >= 0 {
+			return nil, errUnsorted
+		}
+	}
+	return &Set{packed: packed}, nil
+}
+
+// Len returns the number of members.
+func (s *Set) Len() int {
+	return len(s.packed) / sha256.Size
+}
+
+// Bytes returns the members sorted and concatenated. It must not be modified.
+func (s *Set) Bytes() []byte {
+	return s.packed
+}
+
+// Contains reports whether h is a member.
+func (s *Set) Contains(h Hash) bool {
+	n := s.Len()
+	i := sort.Search(n, func(i int) bool {
+		return bytes.Compare(s.member(i), h[:]) >= 0
+	})
+	return i < n && bytes.Equal(s.member(i), h[:])
+}
+
+func (s *Set) member(i int) []byte {
+	return s.packed[i*sha256.Size : (i+1)*sha256.Size]
+}
+
+// ReadHashes reads one hex encoded hash per line. Blank lines are skipped.
+// The error of a malformed line tells its number.
+func ReadHashes(r io.Reader) ([]Hash, error) {
+	var hashes []Hash
+	scanner := bufio.NewScanner(r)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		var h Hash
+		if len(text) != hex.EncodedLen(len(h)) {
+			return nil, fmt.Errorf("line %d: not a hex encoded SHA-256 hash", line)
+		}
+		if _, err := hex.Decode(h[:], []byte(text)); err != nil {
+			return nil, fmt.Errorf("line %d: not a hex encoded SHA-256 hash", line)
+		}
+		hashes = append(hashes, h)
+	}
+	return hashes, scanner.Err()
+}
+
+// Registry holds the set of each audience with the version it was loaded
+// at. It is safe for concurrent use.
+type Registry struct {
+	mu   sync.RWMutex
+	sets map[int]versionedSet
+}
+
+type versionedSet struct {
+	version int
+	set     *Set
+}
+
+// NewRegistry returns an empty registry.
+func NewRegistry() *Registry {
+	return &Registry{sets: map[int]versionedSet{}}
+}
+
+// Store sets the members of audience id, unless a later version is held.
+func (r *Registry) Store(id, version int, set *Set) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if held, ok := r.sets[id]; ok && held.version > version {
+		return
+	}
+	r.sets[id] = versionedSet{version: version, set: set}
+}
+
+// Delete forgets audience id.
+func (r *Registry) Delete(id int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.sets, id)
+}
+
+// Versions returns the version held of each audience.
+func (r *Registry) Versions() map[int]int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	versions := make(map[int]int, len(r.sets))
+	for id, held := range r.sets {
+		versions[id] = held.version
+	}
+	return versions
+}
+
+// Matching returns the audiences with member h in ascending order. It is
+// empty but not nil when h belongs to none.
+func (r *Registry) Matching(h Hash) []int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	ids := []int{}
+	for id, held := range r.sets {
+		if held.set.Contains(h) {
+			ids = append(ids, id)
+		}
+	}
+	sort.Ints(ids)
+	return ids
+}
@@ -0,0 +1,69 @@
+package audience
+
+import (
+	"encoding/hex"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHashUserID(t *testing.T) {
+	h := HashUserID("customer-1")
+	assert.Equal(t, "e83f10dcd2c68747c3f3ba14a54258d5c1843a8d75b0f5cb52c6f3df052a72d1", hex.EncodeToString(h[:]))
+	assert.NotEqual(t, h, HashUserID("Customer-1"))
+}
+
+func TestSet(t *testing.T) {
+	a, b, c := HashUserID("a"), HashUserID("b"), HashUserID("c")
+	set := NewSet([]Hash{c, a, c, b})
+	assert.Equal(t, 3, set.Len())
+	for _, h := range []Hash{a, b, c} {
+		assert.True(t, set.Contains(h))
+	}
+	assert.False(t, set.Contains(HashUserID("d")))
+	assert.False(t, NewSet(nil).Contains(a))
+
+	loaded, err := SetFromBytes(set.Bytes())
+	assert.NoError(t, err)
+	assert.True(t, loaded.Contains(b))
+
+	_, err = SetFromBytes(set.Bytes()[1:])
+	assert.Error(t, err)
+	packed := set.Bytes()
+	_, err = SetFromBytes(append(append([]byte{}, packed[64:]...), packed[:32]...))
+	assert.ErrorIs(t, err, errUnsorted)
+}
+
+func TestReadHashes(t *testing.T) {
+	a, b := HashUserID("a"), HashUserID("b")
+	hashes, err := ReadHashes(strings.NewReader(hex.EncodeToString(a[:]) + "\n\n" +
+		strings.ToUpper(hex.EncodeToString(b[:])) + "\r\n"))
+	assert.NoError(t, err)
+	assert.Equal(t, []Hash{a, b}, hashes)
+
+	_, err = ReadHashes(strings.NewReader(hex.EncodeToString(a[:]) + "\ncustomer-1\n"))
+	assert.EqualError(t, err, "line 2: not a hex encoded SHA-256 hash")
+	_, err = ReadHashes(strings.NewReader(strings.Repeat("zz", 32)))
+	assert.EqualError(t, err, "line 1: not a hex encoded SHA-256 hash")
+}
+
+func TestRegistry(t *testing.T) {
+	a, b := HashUserID("a"), HashUserID("b")
+	r := NewRegistry()
+	assert.Equal(t, []int{}, r.Matching(a))
+
+	r.Store(2, 1, NewSet([]Hash{a, b}))
+	r.Store(1, 1, NewSet([]Hash{a}))
+	assert.Equal(t, []int{1, 2}, r.Matching(a))
+	assert.Equal(t, []int{2}, r.Matching(b))
+
+	// An older version does not replace a newer one.
+	r.Store(1, 3, NewSet([]Hash{b}))
+	r.Store(1, 2, NewSet([]Hash{a}))
+	assert.Equal(t, []int{2}, r.Matching(a))
+	assert.Equal(t, map[int]int{1: 3, 2: 1}, r.Versions())
+
+	r.Delete(2)
+	assert.Equal(t, []int{1}, r.Matching(b))
+}
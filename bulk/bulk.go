@@ -0,0 +1,309 @@
+// Package bulk reads and writes advertisements in the line-oriented formats
+// used for bulk import and export: newline-delimited JSON and CSV.
+package bulk
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jjshen2000/simple-ads/models"
+)
+
+type Format string
+
+const (
+	JSONL Format = "jsonl"
+	CSV   Format = "csv"
+)
+
+// maxLineSize bounds a single NDJSON record.
+const maxLineSize = 1 << 20
+
+// csvHeader lists the CSV columns written by Writer. The conditions, video
+// and localizations columns hold the JSON encoding of the conditions list,
+// the video creative and the localizations list.
+var csvHeader = []string{"id", "title", "startAt", "endAt", "conditions", "video", "locale", "description", "localizations"}
+
+// ParseFormat returns the format named by a query value ("jsonl", "ndjson" or "csv").
+func ParseFormat(name string) (Format, error) {
+	switch strings.ToLower(name) {
+	case "jsonl", "ndjson":
+		return JSONL, nil
+	case "csv":
+		return CSV, nil
+	}
+	return "", fmt.Errorf("unsupported format %q", name)
+}
+
+// FormatFromContentType returns the format matching a request Content-Type.
+func FormatFromContentType(contentType string) (Format, error) {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return "", fmt.Errorf("unsupported content type %q", contentType)
+	}
+
+	switch mediaType {
+	case "application/x-ndjson", "application/jsonl":
+		return JSONL, nil
+	case "text/csv":
+		return CSV, nil
+	}
+	return "", fmt.Errorf("unsupported content type %q", contentType)
+}
+
+// ContentType returns the media type used when writing f.
+func (f Format) ContentType() string {
+	if f == CSV {
+		return "text/csv; charset=utf-8"
+	}
+	return "application/x-ndjson"
+}
+
+// Reader decodes advertisements one record at a time.
+type Reader struct {
+	format  Format
+	scanner *bufio.Scanner
+	csv     *csv.Reader
+	columns map[string]int
+	line    int
+}
+
+// NewReader returns a Reader decoding r in the given format.
+func NewReader(r io.Reader, format Format) *Reader {
+	reader := &Reader{format: format}
+	if format == CSV {
+		reader.csv = csv.NewReader(r)
+		reader.csv.FieldsPerRecord = -1
+	} else {
+		reader.scanner = bufio.NewScanner(r)
+		reader.scanner.Buffer(make([]byte, 0, 64*1024), maxLineSize)
+	}
+	return reader
+}
+
+// Read returns the next advertisement and the line it starts on.
+//
+// A malformed record yields a non-nil error together with its line; reading
+// may continue afterwards. io.EOF is returned once the input is exhausted,
+// and any other error without a line number is fatal.
+func (r *Reader) Read() (line int, ad models.Advertisement, err error) {
+	if r.format == CSV {
+		return r.readCSV()
+	}
+	return r.readJSONL()
+}
+
+func (r *Reader) readJSONL() (line int, ad models.Advertisement, err error) {
+	for r.scanner.Scan() {
+		r.line++
+		text := strings.TrimSpace(r.scanner.Text())
+		if text == "" {
+			continue
+		}
+		if err := json.Unmarshal([]byte(text), &ad); err != nil {
+			return r.line, ad, err
+		}
+		return r.line, ad, nil
+	}
+
+	if err := r.scanner.Err(); err != nil {
+		return 0, ad, err
+	}
+	return 0, ad, io.EOF
+}
+
+func (r *Reader) readCSV() (line int, ad models.Advertisement, err error) {
+	if r.columns == nil {
+		header, err := r.csv.Read()
+		if err != nil {
+			if err == io.EOF {
+				return 0, ad, err
+			}
+			return 0, ad, fmt.Errorf("read header: %w", err)
+		}
+		if err := r.setColumns(header); err != nil {
+			return 0, ad, err
+		}
+	}
+
+	record, err := r.csv.Read()
+	if err == io.EOF {
+		return 0, ad, err
+	}
+	if err != nil {
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			return parseErr.StartLine, ad, err
+		}
+		return 0, ad, err
+	}
+	line, _ = r.csv.FieldPos(0)
+
+	ad, err = r.decodeRecord(record)
+	return line, ad, err
+}
+
+func (r *Reader) setColumns(header []string) error {
+	r.columns = make(map[string]int, len(header))
+	for i, name := range header {
+		r.columns[strings.TrimSpace(name)] = i
+	}
+
+	for _, required := range []string{"title", "startAt", "endAt"} {
+		if _, ok := r.columns[required]; !ok {
+			return fmt.Errorf("missing column %q", required)
+		}
+	}
+	return nil
+}
+
+func (r *Reader) field(record []string, name string) string {
+	i, ok := r.columns[name]
+	if !ok || i >= len(record) {
+		return ""
+	}
+	return record[i]
+}
+
+func (r *Reader) decodeRecord(record []string) (ad models.Advertisement, err error) {
+	if id := r.field(record, "id"); id != "" {
+		ad.ID, err = strconv.Atoi(id)
+		if err != nil {
+			return ad, fmt.Errorf("invalid id: %w", err)
+		}
+	}
+
+	ad.Title = r.field(record, "title")
+
+	ad.StartAt, err = time.Parse(time.RFC3339, r.field(record, "startAt"))
+	if err != nil {
+		return ad, fmt.Errorf("invalid startAt: %w", err)
+	}
+
+	ad.EndAt, err = time.Parse(time.RFC3339, r.field(record, "endAt"))
+	if err != nil {
+		return ad, fmt.Errorf("invalid endAt: %w", err)
+	}
+
+	if conditions := r.field(record, "conditions"); conditions != "" {
+		if err := json.Unmarshal([]byte(conditions), &ad.Conditions); err != nil {
+			return ad, fmt.Errorf("invalid conditions: %w", err)
+		}
+	}
+
+	if video := r.field(record, "video"); video != "" {
+		if err := json.Unmarshal([]byte(video), &ad.Video); err != nil {
+			return ad, fmt.Errorf("invalid video: %w", err)
+		}
+	}
+
+	ad.Locale = r.field(record, "locale")
+	ad.Description = r.field(record, "description")
+	if localizations := r.field(record, "localizations"); localizations != "" {
+		if err := json.Unmarshal([]byte(localizations), &ad.Localizations); err != nil {
+			return ad, fmt.Errorf("invalid localizations: %w", err)
+		}
+	}
+	return ad, nil
+}
+
+// Writer encodes advertisements one record at a time.
+type Writer struct {
+	format Format
+	w      io.Writer
+	csv    *csv.Writer
+	header bool
+}
+
+// NewWriter returns a Writer encoding to w in the given format.
+func NewWriter(w io.Writer, format Format) *Writer {
+	writer := &Writer{format: format, w: w}
+	if format == CSV {
+		writer.csv = csv.NewWriter(w)
+	}
+	return writer
+}
+
+// Write encodes a single advertisement.
+func (w *Writer) Write(ad models.Advertisement) error {
+	if w.format != CSV {
+		data, err := json.Marshal(ad)
+		if err != nil {
+			return err
+		}
+		_, err = w.w.Write(append(data, '\n'))
+		return err
+	}
+
+	if err := w.writeHeader(); err != nil {
+		return err
+	}
+
+	conditions := ""
+	if len(ad.Conditions) > 0 {
+		data, err := json.Marshal(ad.Conditions)
+		if err != nil {
+			return err
+		}
+		conditions = string(data)
+	}
+
+	video := ""
+	if ad.Video != nil {
+		data, err := json.Marshal(ad.Video)
+		if err != nil {
+			return err
+		}
+		video = string(data)
+	}
+
+	localizations := ""
+	if len(ad.Localizations) > 0 {
+		data, err := json.Marshal(ad.Localizations)
+		if err != nil {
+			return err
+		}
+		localizations = string(data)
+	}
+
+	return w.csv.Write([]string{
+		strconv.Itoa(ad.ID),
+		ad.Title,
+		ad.StartAt.UTC().Format(time.RFC3339),
+		ad.EndAt.UTC().Format(time.RFC3339),
+		conditions,
+		video,
+		ad.Locale,
+		ad.Description,
+		localizations,
+	})
+}
+
+func (w *Writer) writeHeader() error {
+	if w.header {
+		return nil
+	}
+	w.header = true
+	return w.csv.Write(csvHeader)
+}
+
+// Flush writes any buffered data to the underlying writer. A CSV export
+// without records still gets its header.
+func (w *Writer) Flush() error {
+	if w.csv == nil {
+		return nil
+	}
+	if err := w.writeHeader(); err != nil {
+		return err
+	}
+	w.csv.Flush()
+	return w.csv.Error()
+}
@@ -0,0 +1,153 @@
+package bulk
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jjshen2000/simple-ads/models"
+	"github.com/stretchr/testify/assert"
+)
+
+type readResult struct {
+	line  int
+	title string
+	err   bool
+}
+
+func readAll(t *testing.T, r *Reader) []readResult {
+	var results []readResult
+	for {
+		line, ad, err := r.Read()
+		if err == io.EOF {
+			return results
+		}
+		if err != nil && line == 0 {
+			t.Fatalf("fatal read error: %v", err)
+		}
+		results = append(results, readResult{line: line, title: ad.Title, err: err != nil})
+	}
+}
+
+func TestReadJSONL(t *testing.T) {
+	input := `{"title":"AD 1","startAt":"2023-12-10T03:00:00Z","endAt":"2024-12-31T16:00:00Z"}
+
+{"title":"AD 2","startAt":"2023-12-10T03:00:00Z","endAt":"2024-12-31T16:00:00Z","conditions":[{"country":["TW"]}]}
+{"title":
+`
+	results := readAll(t, NewReader(strings.NewReader(input), JSONL))
+
+	assert.Equal(t, []readResult{
+		{line: 1, title: "AD 1"},
+		{line: 3, title: "AD 2"},
+		{line: 4, err: true},
+	}, results)
+}
+
+func TestReadCSV(t *testing.T) {
+	input := `title,startAt,endAt,conditions
+AD 1,2023-12-10T03:00:00Z,2024-12-31T16:00:00Z,
+"AD, 2",2023-12-10T03:00:00Z,2024-12-31T16:00:00Z,"[{""country"":[""TW""]}]"
+AD 3,yesterday,2024-12-31T16:00:00Z,
+`
+	reader := NewReader(strings.NewReader(input), CSV)
+	results := readAll(t, reader)
+
+	assert.Equal(t, []readResult{
+		{line: 2, title: "AD 1"},
+		{line: 3, title: "AD, 2"},
+		{line: 4, title: "AD 3", err: true},
+	}, results)
+}
+
+func TestReadCSVMissingColumn(t *testing.T) {
+	reader := NewReader(strings.NewReader("title,startAt\n"), CSV)
+
+	line, _, err := reader.Read()
+	assert.Equal(t, 0, line)
+	assert.EqualError(t, err, `missing column "endAt"`)
+}
+
+func TestRoundTrip(t *testing.T) {
+	ads := []models.Advertisement{
+		{
+			ID:      1,
+			Title:   "AD 1",
+			StartAt: time.Date(2023, 12, 10, 3, 0, 0, 0, time.UTC),
+			EndAt:   time.Date(2024, 12, 31, 16, 0, 0, 0, time.UTC),
+			Conditions: []models.Conditions{
+				{AgeStart: 20, AgeEnd: 30, Country: []string{"TW", "JP"}, Platform: []string{"ios"}},
+			},
+		},
+		{
+			ID:      2,
+			Title:   "AD 2",
+			StartAt: time.Date(2023, 12, 10, 3, 0, 0, 0, time.UTC),
+			EndAt:   time.Date(2024, 12, 31, 16, 0, 0, 0, time.UTC),
+			Video: &models.Video{
+				Duration:    15,
+				MediaFiles:  []models.MediaFile{{URL: "https://cdn.example.com/2.mp4", Type: "video/mp4", Width: 640, Height: 360}},
+				Impressions: []string{"https://track.example.com/imp"},
+			},
+		},
+		{
+			ID:          3,
+			Title:       "AD 3",
+			StartAt:     time.Date(2023, 12, 10, 3, 0, 0, 0, time.UTC),
+			EndAt:       time.Date(2024, 12, 31, 16, 0, 0, 0, time.UTC),
+			Locale:      "en",
+			Description: "Summer sale, up to 50% off",
+			Localizations: []models.Localization{
+				{Locale: "zh-TW", Title: "廣告 3", Description: "夏季特賣，最低五折"},
+				{Locale: "ja", Title: "広告 3"},
+			},
+		},
+	}
+
+	for _, format := range []Format{JSONL, CSV} {
+		t.Run(string(format), func(t *testing.T) {
+			var buf bytes.Buffer
+			writer := NewWriter(&buf, format)
+			for _, ad := range ads {
+				assert.NoError(t, writer.Write(ad))
+			}
+			assert.NoError(t, writer.Flush())
+
+			reader := NewReader(&buf, format)
+			for _, want := range ads {
+				_, got, err := reader.Read()
+				assert.NoError(t, err)
+				assert.Equal(t, want, got)
+			}
+			_, _, err := reader.Read()
+			assert.Equal(t, io.EOF, err)
+		})
+	}
+}
+
+func TestFormatFromContentType(t *testing.T) {
+	testCases := []struct {
+		contentType string
+		format      Format
+		err         bool
+	}{
+		{contentType: "application/x-ndjson", format: JSONL},
+		{contentType: "text/csv; charset=utf-8", format: CSV},
+		// RFC 7464 frames records with RS bytes, which Reader does not.
+		{contentType: "application/json-seq", err: true},
+		{contentType: "application/json", err: true},
+		{contentType: "", err: true},
+	}
+
+	for _, tc := range testCases {
+		format, err := FormatFromContentType(tc.contentType)
+		if tc.err {
+			assert.Error(t, err, tc.contentType)
+		} else {
+			assert.NoError(t, err, tc.contentType)
+			assert.Equal(t, tc.format, format)
+		}
+	}
+}
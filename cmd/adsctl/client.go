@@ -0,0 +1,104 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// client talks to the HTTP API of the ad placement service.
+type client struct {
+	baseURL string
+	apiKey  string
+	http    *http.Client
+}
+
+func newClient(baseURL, apiKey string) *client {
+	return &client{
+		baseURL: strings.TrimRight(baseURL, "/"),
+		apiKey:  apiKey,
+		http:    &http.Client{Timeout: 5 * time.Minute},
+	}
+}
+
+// apiError is an error response of the service.
+type apiError struct {
+	status  int
+	message string
+}
+
+func (e *apiError) Error() string {
+	return fmt.Sprintf("%d %s: %s", e.status, http.StatusText(e.status), e.message)
+}
+
+// send issues a request and returns the response once its status is checked.
+// The caller closes the body.
+func (c *client) send(method, path string, body io.Reader, contentType string) (*http.Response, error) {
+	req, err := http.NewRequest(method, c.baseURL+path, body)
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if c.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+c.apiKey)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode >= http.StatusBadRequest {
+		defer resp.Body.Close()
+		data, _ := io.ReadAll(resp.Body)
+		return nil, &apiError{status: resp.StatusCode, message: errorMessage(data)}
+	}
+	return resp, nil
+}
+
+// errorMessage extracts the message of an error response.
+// Handlers report errors under "error" or "error(<step>)".
+func errorMessage(data []byte) string {
+	var body map[string]interface{}
+	if err := json.Unmarshal(data, &body); err == nil {
+		for key, value := range body {
+			if key == "error" || strings.HasPrefix(key, "error(") {
+				return fmt.Sprint(value)
+			}
+		}
+	}
+	return strings.TrimSpace(string(data))
+}
+
+// do sends a JSON request and decodes the JSON response into out, if given.
+func (c *client) do(method, path string, in, out interface{}) (*http.Response, error) {
+	var body io.Reader
+	contentType := ""
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return nil, err
+		}
+		body = bytes.NewReader(data)
+		contentType = "application/json"
+	}
+
+	resp, err := c.send(method, path, body, contentType)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if out != nil {
+		if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+			return resp, fmt.Errorf("decode response: %w", err)
+		}
+	}
+	return resp, nil
+}
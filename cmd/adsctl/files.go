@@ -0,0 +1,86 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/go-yaml/yaml"
+
+	"github.com/jjshen2000/simple-ads/models"
+)
+
+// readAdvertisementFile reads an advertisement from a YAML or JSON file,
+// picked by the file extension, and validates it.
+func readAdvertisementFile(path string) (ad models.Advertisement, err error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return ad, err
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		data, err = yamlToJSON(data)
+		if err != nil {
+			return ad, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+
+	if err := json.Unmarshal(data, &ad); err != nil {
+		return ad, fmt.Errorf("%s: %w", path, err)
+	}
+
+	if err := models.ValidateAdvertisement(ad); err != nil {
+		return ad, fmt.Errorf("%s: %w", path, err)
+	}
+	return ad, nil
+}
+
+// yamlToJSON converts a YAML document to JSON so that it decodes through the
+// json tags of the models.
+func yamlToJSON(data []byte) ([]byte, error) {
+	var doc interface{}
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return nil, err
+	}
+
+	converted, err := jsonValue(doc)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(converted)
+}
+
+func jsonValue(v interface{}) (interface{}, error) {
+	switch v := v.(type) {
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, value := range v {
+			k, ok := key.(string)
+			if !ok {
+				return nil, fmt.Errorf("unsupported key %v", key)
+			}
+			converted, err := jsonValue(value)
+			if err != nil {
+				return nil, err
+			}
+			m[k] = converted
+		}
+		return m, nil
+	case []interface{}:
+		for i, value := range v {
+			converted, err := jsonValue(value)
+			if err != nil {
+				return nil, err
+			}
+			v[i] = converted
+		}
+		return v, nil
+	case time.Time:
+		return v.Format(time.RFC3339Nano), nil
+	}
+	return v, nil
+}
@@ -0,0 +1,613 @@
+// Command adsctl administers the ad placement service through its HTTP API.
+//
+// Usage:
+//
+//	adsctl [-url URL] [-key KEY] [-o table|json] <command> [arguments]
+//
+// The base URL and API key default to $ADSCTL_URL and $ADSCTL_API_KEY.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/jjshen2000/simple-ads/models"
+)
+
+const usage = `Usage: adsctl [flags] <command> [arguments]
+
+Commands:
+  create -f FILE            create an advertisement from a YAML or JSON file
+  get ID                    show an advertisement
+  update -f FILE ID         replace an advertisement
+  delete ID                 delete an advertisement, which restore brings back
+  status ID STATUS          change the status of an advertisement, e.g. approved
+  revisions ID              list the revisions of an advertisement
+  diff ID FROM TO           compare two revisions of an advertisement
+  restore ID [REVISION]     restore a deleted advertisement, or a revision
+  list [filters]            list active advertisements
+  import [-mode M] -f FILE  import a .jsonl or .csv file
+  export [-format F] [-out FILE]
+                            export all advertisements
+  migrate [-status]         apply pending schema migrations
+  keys mint NAME            mint an API key
+  report                    summarize advertisements
+  audit [filters]           show the audit log, newest first
+  webhooks list             list webhooks
+  webhooks add [-secret S] URL EVENT...
+                            register a webhook for events, e.g. ad.created
+  webhooks delete ID        delete a webhook
+  webhooks dead [-webhook ID]
+                            list deliveries that failed every attempt
+  webhooks replay ID        queue a dead letter again
+
+Flags:
+`
+
+// app holds what every command needs.
+type app struct {
+	client *client
+	out    *printer
+	stdout io.Writer
+}
+
+func main() {
+	if err := run(os.Args[1:], os.Stdout, os.Stderr); err != nil {
+		fmt.Fprintln(os.Stderr, "adsctl:", err)
+		os.Exit(1)
+	}
+}
+
+func run(args []string, stdout, stderr io.Writer) error {
+	fs := flag.NewFlagSet("adsctl", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	baseURL := fs.String("url", envOr("ADSCTL_URL", "http://localhost:8080"), "base URL of the service")
+	apiKey := fs.String("key", os.Getenv("ADSCTL_API_KEY"), "API key for the admin API")
+	output := fs.String("o", "table", "output format: table or json")
+	fs.Usage = func() {
+		fmt.Fprint(stderr, usage)
+		fs.PrintDefaults()
+	}
+
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *output != "table" && *output != "json" {
+		return fmt.Errorf("unknown output format %q", *output)
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return errors.New("missing command")
+	}
+
+	a := &app{
+		client: newClient(*baseURL, *apiKey),
+		out:    &printer{w: stdout, json: *output == "json"},
+		stdout: stdout,
+	}
+
+	command, rest := fs.Arg(0), fs.Args()[1:]
+	switch command {
+	case "create":
+		return a.create(rest)
+	case "get":
+		return a.get(rest)
+	case "update":
+		return a.update(rest)
+	case "delete":
+		return a.delete(rest)
+	case "status":
+		return a.status(rest)
+	case "revisions":
+		return a.revisions(rest)
+	case "diff":
+		return a.diff(rest)
+	case "restore":
+		return a.restore(rest)
+	case "list":
+		return a.list(rest)
+	case "import":
+		return a.importFile(rest)
+	case "export":
+		return a.export(rest)
+	case "migrate":
+		return a.migrate(rest)
+	case "keys":
+		return a.keys(rest)
+	case "report":
+		return a.report(rest)
+	case "audit":
+		return a.audit(rest)
+	case "webhooks":
+		return a.webhooks(rest)
+	}
+	return fmt.Errorf("unknown command %q", command)
+}
+
+func envOr(name, fallback string) string {
+	if value := os.Getenv(name); value != "" {
+		return value
+	}
+	return fallback
+}
+
+// parseID parses the single ID argument of a command.
+func parseID(args []string) (int, error) {
+	if len(args) != 1 {
+		return 0, errors.New("expected exactly one advertisement ID")
+	}
+	id, err := strconv.Atoi(args[0])
+	if err != nil || id < 1 {
+		return 0, fmt.Errorf("invalid advertisement ID %q", args[0])
+	}
+	return id, nil
+}
+
+func (a *app) create(args []string) error {
+	fs := flag.NewFlagSet("create", flag.ContinueOnError)
+	file := fs.String("f", "", "YAML or JSON file with the advertisement")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *file == "" {
+		return errors.New("create: -f is required")
+	}
+
+	ad, err := readAdvertisementFile(*file)
+	if err != nil {
+		return err
+	}
+
+	var result map[string]interface{}
+	resp, err := a.client.do("POST", "/api/v1/ad", ad, &result)
+	if err != nil {
+		return err
+	}
+
+	location := resp.Header.Get("Location")
+	if id := location[strings.LastIndex(location, "/")+1:]; id != "" {
+		result["id"], _ = strconv.Atoi(id)
+	}
+	return a.out.object(result)
+}
+
+func (a *app) get(args []string) error {
+	id, err := parseID(args)
+	if err != nil {
+		return err
+	}
+
+	var ad models.Advertisement
+	if _, err := a.client.do("GET", fmt.Sprintf("/api/v1/ad/%d", id), nil, &ad); err != nil {
+		return err
+	}
+	return a.out.advertisements([]models.Advertisement{ad})
+}
+
+func (a *app) update(args []string) error {
+	fs := flag.NewFlagSet("update", flag.ContinueOnError)
+	file := fs.String("f", "", "YAML or JSON file with the advertisement")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *file == "" {
+		return errors.New("update: -f is required")
+	}
+	id, err := parseID(fs.Args())
+	if err != nil {
+		return err
+	}
+
+	ad, err := readAdvertisementFile(*file)
+	if err != nil {
+		return err
+	}
+
+	var result map[string]interface{}
+	if _, err := a.client.do("PUT", fmt.Sprintf("/api/v1/ad/%d", id), ad, &result); err != nil {
+		return err
+	}
+	return a.out.object(result)
+}
+
+func (a *app) delete(args []string) error {
+	id, err := parseID(args)
+	if err != nil {
+		return err
+	}
+
+	var result map[string]interface{}
+	if _, err := a.client.do("DELETE", fmt.Sprintf("/api/v1/ad/%d", id), nil, &result); err != nil {
+		return err
+	}
+	return a.out.object(result)
+}
+
+func (a *app) status(args []string) error {
+	if len(args) != 2 {
+		return errors.New("usage: adsctl status ID STATUS")
+	}
+	id, err := parseID(args[:1])
+	if err != nil {
+		return err
+	}
+	if !models.IsValidStatus(args[1]) {
+		return fmt.Errorf("invalid status %q", args[1])
+	}
+
+	var result map[string]interface{}
+	path := fmt.Sprintf("/api/v1/ad/%d/status", id)
+	if _, err := a.client.do("POST", path, map[string]string{"status": args[1]}, &result); err != nil {
+		return err
+	}
+	return a.out.object(result)
+}
+
+func (a *app) revisions(args []string) error {
+	id, err := parseID(args)
+	if err != nil {
+		return err
+	}
+
+	var page struct {
+		Items []models.Revision `json:"items"`
+	}
+	if _, err := a.client.do("GET", fmt.Sprintf("/api/v1/ad/%d/revisions", id), nil, &page); err != nil {
+		return err
+	}
+	return a.out.revisions(page.Items)
+}
+
+// parseRevision parses a revision number argument.
+func parseRevision(arg string) (int, error) {
+	revision, err := strconv.Atoi(arg)
+	if err != nil || revision < 1 {
+		return 0, fmt.Errorf("invalid revision %q", arg)
+	}
+	return revision, nil
+}
+
+func (a *app) diff(args []string) error {
+	if len(args) != 3 {
+		return errors.New("usage: adsctl diff ID FROM TO")
+	}
+	id, err := parseID(args[:1])
+	if err != nil {
+		return err
+	}
+	query := url.Values{}
+	for i, name := range []string{"from", "to"} {
+		revision, err := parseRevision(args[1+i])
+		if err != nil {
+			return err
+		}
+		query.Set(name, strconv.Itoa(revision))
+	}
+
+	var result map[string]interface{}
+	path := fmt.Sprintf("/api/v1/ad/%d/revisions/diff?%s", id, query.Encode())
+	if _, err := a.client.do("GET", path, nil, &result); err != nil {
+		return err
+	}
+	return a.out.object(result["changes"])
+}
+
+func (a *app) restore(args []string) error {
+	if len(args) != 1 && len(args) != 2 {
+		return errors.New("usage: adsctl restore ID [REVISION]")
+	}
+	id, err := parseID(args[:1])
+	if err != nil {
+		return err
+	}
+	path := fmt.Sprintf("/api/v1/ad/%d/restore", id)
+	if len(args) == 2 {
+		revision, err := parseRevision(args[1])
+		if err != nil {
+			return err
+		}
+		path = fmt.Sprintf("/api/v1/ad/%d/revisions/%d/restore", id, revision)
+	}
+
+	var result map[string]interface{}
+	if _, err := a.client.do("POST", path, nil, &result); err != nil {
+		return err
+	}
+	return a.out.object(result)
+}
+
+func (a *app) list(args []string) error {
+	fs := flag.NewFlagSet("list", flag.ContinueOnError)
+	limit := fs.Int("limit", 5, "advertisements per page")
+	all := fs.Bool("all", false, "follow nextCursor through every page")
+	filters := map[string]*string{}
+	for _, name := range []string{"age", "gender", "country", "platform"} {
+		filters[name] = fs.String(name, "", "filter by "+name)
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	query := url.Values{}
+	query.Set("limit", strconv.Itoa(*limit))
+	for name, value := range filters {
+		if *value != "" {
+			query.Set(name, *value)
+		}
+	}
+
+	var items []listItem
+	for {
+		var page struct {
+			Items      []listItem `json:"items"`
+			NextCursor string     `json:"nextCursor"`
+		}
+		if _, err := a.client.do("GET", "/api/v1/ad?"+query.Encode(), nil, &page); err != nil {
+			return err
+		}
+		items = append(items, page.Items...)
+
+		if !*all || page.NextCursor == "" {
+			break
+		}
+		query.Set("cursor", page.NextCursor)
+	}
+	return a.out.listItems(items)
+}
+
+func (a *app) importFile(args []string) error {
+	fs := flag.NewFlagSet("import", flag.ContinueOnError)
+	file := fs.String("f", "", ".jsonl or .csv file")
+	mode := fs.String("mode", "atomic", "atomic or bestEffort")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if *file == "" {
+		return errors.New("import: -f is required")
+	}
+
+	contentType := "application/x-ndjson"
+	if strings.EqualFold(filepath.Ext(*file), ".csv") {
+		contentType = "text/csv"
+	}
+
+	f, err := os.Open(*file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	resp, err := a.client.send("POST", "/api/v1/ad/bulk?mode="+url.QueryEscape(*mode), f, contentType)
+	var apiErr *apiError
+	if errors.As(err, &apiErr) && apiErr.status == 400 && strings.HasPrefix(apiErr.message, "{") {
+		// A rejected atomic import still carries the per-line report.
+		return a.out.raw([]byte(apiErr.message))
+	}
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	return a.out.raw(data)
+}
+
+func (a *app) export(args []string) error {
+	fs := flag.NewFlagSet("export", flag.ContinueOnError)
+	format := fs.String("format", "jsonl", "jsonl or csv")
+	out := fs.String("out", "", "write to FILE instead of stdout")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	resp, err := a.client.send("GET", "/api/v1/ad/export?format="+url.QueryEscape(*format), nil, "")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	w := a.stdout
+	if *out != "" {
+		f, err := os.Create(*out)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		w = f
+	}
+
+	_, err = io.Copy(w, resp.Body)
+	return err
+}
+
+func (a *app) migrate(args []string) error {
+	fs := flag.NewFlagSet("migrate", flag.ContinueOnError)
+	status := fs.Bool("status", false, "only show the schema version")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	method := "POST"
+	if *status {
+		method = "GET"
+	}
+
+	var result map[string]interface{}
+	if _, err := a.client.do(method, "/api/v1/admin/migrations", nil, &result); err != nil {
+		return err
+	}
+	return a.out.object(result)
+}
+
+func (a *app) keys(args []string) error {
+	if len(args) != 2 || args[0] != "mint" {
+		return errors.New("usage: adsctl keys mint NAME")
+	}
+
+	var result map[string]interface{}
+	if _, err := a.client.do("POST", "/api/v1/admin/keys", map[string]string{"name": args[1]}, &result); err != nil {
+		return err
+	}
+	return a.out.object(result)
+}
+
+func (a *app) report(args []string) error {
+	if len(args) != 0 {
+		return errors.New("report takes no arguments")
+	}
+
+	var result map[string]interface{}
+	if _, err := a.client.do("GET", "/api/v1/admin/report", nil, &result); err != nil {
+		return err
+	}
+	return a.out.object(result)
+}
+
+func (a *app) audit(args []string) error {
+	fs := flag.NewFlagSet("audit", flag.ContinueOnError)
+	limit := fs.Int("limit", 20, "records per page")
+	all := fs.Bool("all", false, "follow nextCursor through every page")
+	filters := map[string]*string{
+		"adId":  fs.String("ad", "", "filter by advertisement ID"),
+		"actor": fs.String("actor", "", "filter by actor"),
+		"from":  fs.String("from", "", "only records at or after this RFC 3339 time"),
+		"to":    fs.String("to", "", "only records before this RFC 3339 time"),
+	}
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	query := url.Values{}
+	query.Set("limit", strconv.Itoa(*limit))
+	for name, value := range filters {
+		if *value != "" {
+			query.Set(name, *value)
+		}
+	}
+
+	var records []models.AuditRecord
+	for {
+		var page struct {
+			Items      []models.AuditRecord `json:"items"`
+			NextCursor string               `json:"nextCursor"`
+		}
+		if _, err := a.client.do("GET", "/api/v1/audit?"+query.Encode(), nil, &page); err != nil {
+			return err
+		}
+		records = append(records, page.Items...)
+
+		if !*all || page.NextCursor == "" {
+			break
+		}
+		query.Set("cursor", page.NextCursor)
+	}
+	return a.out.auditRecords(records)
+}
+
+func (a *app) webhooks(args []string) error {
+	if len(args) == 0 {
+		return errors.New("usage: adsctl webhooks list|add|delete|dead|replay")
+	}
+	switch args[0] {
+	case "list":
+		var page struct {
+			Items []models.Webhook `json:"items"`
+		}
+		if _, err := a.client.do("GET", "/api/v1/webhook", nil, &page); err != nil {
+			return err
+		}
+		return a.out.webhooks(page.Items)
+	case "add":
+		return a.addWebhook(args[1:])
+	case "delete":
+		id, err := parseOtherID("webhook", args[1:])
+		if err != nil {
+			return err
+		}
+		var result map[string]interface{}
+		if _, err := a.client.do("DELETE", fmt.Sprintf("/api/v1/webhook/%d", id), nil, &result); err != nil {
+			return err
+		}
+		return a.out.object(result)
+	case "dead":
+		return a.deadLetters(args[1:])
+	case "replay":
+		id, err := parseOtherID("dead letter", args[1:])
+		if err != nil {
+			return err
+		}
+		var result map[string]interface{}
+		path := fmt.Sprintf("/api/v1/webhook/dead-letter/%d/replay", id)
+		if _, err := a.client.do("POST", path, nil, &result); err != nil {
+			return err
+		}
+		return a.out.object(result)
+	}
+	return fmt.Errorf("unknown webhooks command %q", args[0])
+}
+
+// parseOtherID parses the single ID argument of a command about something
+// other than an advertisement.
+func parseOtherID(what string, args []string) (int, error) {
+	if len(args) != 1 {
+		return 0, fmt.Errorf("expected exactly one %s ID", what)
+	}
+	id, err := strconv.Atoi(args[0])
+	if err != nil || id < 1 {
+		return 0, fmt.Errorf("invalid %s ID %q", what, args[0])
+	}
+	return id, nil
+}
+
+func (a *app) addWebhook(args []string) error {
+	fs := flag.NewFlagSet("webhooks add", flag.ContinueOnError)
+	secret := fs.String("secret", "", "secret signing the deliveries; generated when empty")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+	if fs.NArg() < 2 {
+		return errors.New("usage: adsctl webhooks add [-secret S] URL EVENT...")
+	}
+
+	body := map[string]interface{}{"url": fs.Arg(0), "events": fs.Args()[1:]}
+	if *secret != "" {
+		body["secret"] = *secret
+	}
+	var result map[string]interface{}
+	if _, err := a.client.do("POST", "/api/v1/webhook", body, &result); err != nil {
+		return err
+	}
+	return a.out.object(result)
+}
+
+func (a *app) deadLetters(args []string) error {
+	fs := flag.NewFlagSet("webhooks dead", flag.ContinueOnError)
+	webhookID := fs.Int("webhook", 0, "only dead letters of this webhook")
+	limit := fs.Int("limit", 20, "dead letters to show")
+	if err := fs.Parse(args); err != nil {
+		return err
+	}
+
+	query := url.Values{}
+	query.Set("limit", strconv.Itoa(*limit))
+	if *webhookID != 0 {
+		query.Set("webhookId", strconv.Itoa(*webhookID))
+	}
+	var page struct {
+		Items []models.DeadLetter `json:"items"`
+	}
+	if _, err := a.client.do("GET", "/api/v1/webhook/dead-letter?"+query.Encode(), nil, &page); err != nil {
+		return err
+	}
+	return a.out.deadLetters(page.Items)
+}
@@ -0,0 +1,265 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/jjshen2000/simple-ads/models"
+	"github.com/stretchr/testify/assert"
+)
+
+func runWith(t *testing.T, handler http.HandlerFunc, args ...string) (string, error) {
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+
+	var stdout, stderr bytes.Buffer
+	err := run(append([]string{"-url", server.URL, "-key", "secret"}, args...), &stdout, &stderr)
+	return stdout.String(), err
+}
+
+func writeFile(t *testing.T, name, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	assert.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func TestCreateFromYAML(t *testing.T) {
+	file := writeFile(t, "ad.yaml", `
+title: AD 56
+startAt: 2023-12-10T03:00:00Z
+endAt: 2024-12-31T16:00:00Z
+conditions:
+  - ageStart: 20
+    ageEnd: 30
+    country: [TW, JP]
+`)
+
+	var received models.Advertisement
+	out, err := runWith(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "POST", r.Method)
+		assert.Equal(t, "/api/v1/ad", r.URL.Path)
+		assert.Equal(t, "Bearer secret", r.Header.Get("Authorization"))
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&received))
+
+		w.Header().Set("Location", "/api/v1/ad/12")
+		w.WriteHeader(http.StatusCreated)
+		io.WriteString(w, `{"message":"Advertisement created successfully"}`)
+	}, "-o", "json", "create", "-f", file)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "AD 56", received.Title)
+	assert.Equal(t, []string{"TW", "JP"}, received.Conditions[0].Country)
+	assert.JSONEq(t, `{"id":12,"message":"Advertisement created successfully"}`, out)
+}
+
+func TestCreateInvalidFile(t *testing.T) {
+	file := writeFile(t, "ad.json", `{"title":"AD 56"}`)
+
+	_, err := runWith(t, func(w http.ResponseWriter, r *http.Request) {
+		t.Error("unexpected request")
+	}, "create", "-f", file)
+
+	assert.ErrorContains(t, err, "'StartAt' failed on the 'required' tag")
+}
+
+func TestGetTable(t *testing.T) {
+	out, err := runWith(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/v1/ad/3", r.URL.Path)
+		io.WriteString(w, `{"id":3,"title":"AD 3","status":"approved","startAt":"2023-12-10T03:00:00Z","endAt":"2024-12-31T16:00:00Z",
+			"conditions":[{"ageStart":20,"ageEnd":30,"country":["TW"]},{"ageStart":65,"platform":["ios"]},{"ageStart":1,"gender":["F"]}]}`)
+	}, "get", "3")
+
+	assert.NoError(t, err)
+	assert.Equal(t, `ID  TITLE  STATUS    START AT              END AT                CONDITIONS
+3   AD 3   approved  2023-12-10T03:00:00Z  2024-12-31T16:00:00Z  age=20-30 country=TW | age=65+ platform=ios | gender=F
+`, out)
+}
+
+func TestListAllPages(t *testing.T) {
+	out, err := runWith(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "TW", r.URL.Query().Get("country"))
+		switch r.URL.Query().Get("cursor") {
+		case "":
+			io.WriteString(w, `{"items":[{"title":"AD 1","endAt":"2024-01-01T00:00:00Z"}],"nextCursor":"next"}`)
+		case "next":
+			io.WriteString(w, `{"items":[{"title":"AD 2","endAt":"2024-02-01T00:00:00Z"}]}`)
+		default:
+			t.Errorf("unexpected cursor %q", r.URL.Query().Get("cursor"))
+		}
+	}, "list", "-country", "TW", "-all")
+
+	assert.NoError(t, err)
+	assert.Equal(t, `TITLE  END AT
+AD 1   2024-01-01T00:00:00Z
+AD 2   2024-02-01T00:00:00Z
+`, out)
+}
+
+func TestImportRejected(t *testing.T) {
+	file := writeFile(t, "ads.csv", "title,startAt,endAt\n")
+
+	out, err := runWith(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "text/csv", r.Header.Get("Content-Type"))
+		assert.Equal(t, "bestEffort", r.URL.Query().Get("mode"))
+		w.WriteHeader(http.StatusBadRequest)
+		io.WriteString(w, `{"mode":"bestEffort","created":0,"failed":1,"errors":[{"line":2,"error":"bad"}]}`)
+	}, "-o", "json", "import", "-mode", "bestEffort", "-f", file)
+
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"mode":"bestEffort","created":0,"failed":1,"errors":[{"line":2,"error":"bad"}]}`, out)
+}
+
+func TestAPIError(t *testing.T) {
+	_, err := runWith(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		io.WriteString(w, `{"error":"advertisement not found"}`)
+	}, "delete", "9")
+
+	assert.EqualError(t, err, "404 Not Found: advertisement not found")
+}
+
+func TestStatus(t *testing.T) {
+	out, err := runWith(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "POST", r.Method)
+		assert.Equal(t, "/api/v1/ad/4/status", r.URL.Path)
+		var body map[string]string
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		assert.Equal(t, "paused", body["status"])
+		io.WriteString(w, `{"status":"paused"}`)
+	}, "status", "4", "paused")
+
+	assert.NoError(t, err)
+	assert.Equal(t, "STATUS  paused\n", out)
+
+	_, err = runWith(t, func(w http.ResponseWriter, r *http.Request) {
+		t.Error("unexpected request")
+	}, "status", "4", "live")
+	assert.EqualError(t, err, `invalid status "live"`)
+}
+
+func TestKeysMint(t *testing.T) {
+	out, err := runWith(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/v1/admin/keys", r.URL.Path)
+		var body map[string]string
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		assert.Equal(t, "ci", body["name"])
+		w.WriteHeader(http.StatusCreated)
+		io.WriteString(w, `{"id":1,"name":"ci","actor":"key:1","key":"abc"}`)
+	}, "keys", "mint", "ci")
+
+	assert.NoError(t, err)
+	assert.Equal(t, "ACTOR  key:1\nID     1\nKEY    abc\nNAME   ci\n", out)
+}
+
+func TestAudit(t *testing.T) {
+	out, err := runWith(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/v1/audit", r.URL.Path)
+		assert.Equal(t, "7", r.URL.Query().Get("adId"))
+		assert.Equal(t, "ops", r.URL.Query().Get("actor"))
+		io.WriteString(w, `{"items":[{"id":2,"at":"2024-01-02T00:00:00Z","actor":"ops","requestId":"r2",
+			"action":"ad.update","entity":"advertisement","entityId":7,
+			"changes":{"title":{"before":"A","after":"B"},"endAt":{"before":"2024-02-01T00:00:00Z","after":"2024-03-01T00:00:00Z"}}},
+			{"id":1,"at":"2024-01-01T00:00:00Z","actor":"ops","requestId":"r1",
+			"action":"ad.create","entity":"advertisement","entityId":7,"changes":{"title":{"after":"A"}}}],"nextCursor":""}`)
+	}, "audit", "-ad", "7", "-actor", "ops")
+
+	assert.NoError(t, err)
+	assert.Equal(t, `AT                    ACTOR  ACTION     ID  REQUEST ID  CHANGED
+2024-01-02T00:00:00Z  ops    ad.update  7   r2          endAt,title
+2024-01-01T00:00:00Z  ops    ad.create  7   r1          title
+`, out)
+}
+
+func TestRevisions(t *testing.T) {
+	out, err := runWith(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/v1/ad/3/revisions", r.URL.Path)
+		io.WriteString(w, `{"items":[
+			{"revision":2,"createdAt":"2024-01-02T00:00:00Z","actor":"ops","action":"ad.update",
+			"advertisement":{"id":3,"title":"AD B","status":"draft"}},
+			{"revision":1,"createdAt":"2024-01-01T00:00:00Z","actor":"ops","action":"ad.create",
+			"advertisement":{"id":3,"title":"AD A","status":"draft"}}]}`)
+	}, "revisions", "3")
+
+	assert.NoError(t, err)
+	assert.Equal(t, `REVISION  CREATED AT            ACTOR  ACTION     TITLE  STATUS
+2         2024-01-02T00:00:00Z  ops    ad.update  AD B   draft
+1         2024-01-01T00:00:00Z  ops    ad.create  AD A   draft
+`, out)
+}
+
+func TestDiff(t *testing.T) {
+	out, err := runWith(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/v1/ad/3/revisions/diff", r.URL.Path)
+		assert.Equal(t, "from=1&to=2", r.URL.RawQuery)
+		io.WriteString(w, `{"changes":{"title":{"before":"AD A","after":"AD B"}}}`)
+	}, "diff", "3", "1", "2")
+
+	assert.NoError(t, err)
+	assert.Equal(t, `TITLE  {"after":"AD B","before":"AD A"}`+"\n", out)
+}
+
+func TestRestore(t *testing.T) {
+	for _, tc := range []struct {
+		args []string
+		path string
+	}{
+		{[]string{"restore", "3"}, "/api/v1/ad/3/restore"},
+		{[]string{"restore", "3", "1"}, "/api/v1/ad/3/revisions/1/restore"},
+	} {
+		_, err := runWith(t, func(w http.ResponseWriter, r *http.Request) {
+			assert.Equal(t, "POST", r.Method)
+			assert.Equal(t, tc.path, r.URL.Path)
+			io.WriteString(w, `{"message":"Advertisement restored successfully"}`)
+		}, tc.args...)
+		assert.NoError(t, err)
+	}
+
+	_, err := runWith(t, func(w http.ResponseWriter, r *http.Request) {
+		t.Error("unexpected request")
+	}, "restore", "3", "0")
+	assert.EqualError(t, err, `invalid revision "0"`)
+}
+
+func TestWebhooks(t *testing.T) {
+	out, err := runWith(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "POST", r.Method)
+		assert.Equal(t, "/api/v1/webhook", r.URL.Path)
+		var body map[string]interface{}
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&body))
+		assert.Equal(t, map[string]interface{}{"url": "https://example.com/hook",
+			"events": []interface{}{"ad.created", "ad.expired"}}, body)
+		w.WriteHeader(http.StatusCreated)
+		io.WriteString(w, `{"id":4,"url":"https://example.com/hook","events":["ad.created","ad.expired"],"secret":"abc"}`)
+	}, "webhooks", "add", "https://example.com/hook", "ad.created", "ad.expired")
+	assert.NoError(t, err)
+	assert.Contains(t, out, "SECRET  abc\n")
+
+	out, err = runWith(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/api/v1/webhook/dead-letter", r.URL.Path)
+		assert.Equal(t, "4", r.URL.Query().Get("webhookId"))
+		io.WriteString(w, `{"items":[{"id":9,"deliveryId":"d9","webhookId":4,"event":"ad.expired","payload":{},
+			"attempts":8,"lastError":"503 Service Unavailable: busy","failedAt":"2024-01-02T00:00:00Z"}]}`)
+	}, "webhooks", "dead", "-webhook", "4")
+	assert.NoError(t, err)
+	assert.Equal(t, `ID  WEBHOOK  EVENT       ATTEMPTS  FAILED AT             LAST ERROR
+9   4        ad.expired  8         2024-01-02T00:00:00Z  503 Service Unavailable: busy
+`, out)
+
+	_, err = runWith(t, func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "POST", r.Method)
+		assert.Equal(t, "/api/v1/webhook/dead-letter/9/replay", r.URL.Path)
+		io.WriteString(w, `{"message":"Dead letter queued again"}`)
+	}, "webhooks", "replay", "9")
+	assert.NoError(t, err)
+
+	_, err = runWith(t, func(w http.ResponseWriter, r *http.Request) {
+		t.Error("unexpected request")
+	}, "webhooks", "delete", "x")
+	assert.EqualError(t, err, `invalid webhook ID "x"`)
+}
@@ -0,0 +1,219 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/jjshen2000/simple-ads/models"
+)
+
+// listItem is an entry of the public list endpoint.
+type listItem struct {
+	Title string    `json:"title"`
+	EndAt time.Time `json:"endAt"`
+}
+
+// printer writes command results as aligned tables or as JSON.
+type printer struct {
+	w    io.Writer
+	json bool
+}
+
+func (p *printer) writeJSON(v interface{}) error {
+	enc := json.NewEncoder(p.w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// raw prints a JSON response body as it is.
+func (p *printer) raw(data []byte) error {
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		_, err := p.w.Write(data)
+		return err
+	}
+	return p.object(v)
+}
+
+// object prints a generic JSON object as KEY VALUE rows.
+func (p *printer) object(v interface{}) error {
+	m, ok := v.(map[string]interface{})
+	if p.json || !ok {
+		return p.writeJSON(v)
+	}
+
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	tw := tabwriter.NewWriter(p.w, 0, 4, 2, ' ', 0)
+	for _, key := range keys {
+		fmt.Fprintf(tw, "%s\t%s\n", strings.ToUpper(key), formatValue(m[key]))
+	}
+	return tw.Flush()
+}
+
+// formatValue renders nested values compactly on one line.
+func formatValue(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return v
+	case map[string]interface{}, []interface{}:
+		var buf bytes.Buffer
+		enc := json.NewEncoder(&buf)
+		enc.SetEscapeHTML(false)
+		enc.Encode(v)
+		return strings.TrimSpace(buf.String())
+	}
+	return fmt.Sprint(v)
+}
+
+func (p *printer) advertisements(ads []models.Advertisement) error {
+	if p.json {
+		if len(ads) == 1 {
+			return p.writeJSON(ads[0])
+		}
+		return p.writeJSON(ads)
+	}
+
+	tw := tabwriter.NewWriter(p.w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tTITLE\tSTATUS\tSTART AT\tEND AT\tCONDITIONS")
+	for _, ad := range ads {
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\t%s\n", ad.ID, ad.Title, ad.Status,
+			ad.StartAt.Format(time.RFC3339), ad.EndAt.Format(time.RFC3339),
+			formatConditions(ad.Conditions))
+	}
+	return tw.Flush()
+}
+
+// formatConditions summarizes conditions as "age=20-30 country=TW,JP | ...",
+// open-ended ages as "age=65+". An age from 1 without an end targets everyone
+// and is left out.
+func formatConditions(conditions []models.Conditions) string {
+	if len(conditions) == 0 {
+		return "-"
+	}
+
+	parts := make([]string, 0, len(conditions))
+	for _, c := range conditions {
+		var fields []string
+		switch {
+		case c.AgeEnd != 0:
+			fields = append(fields, fmt.Sprintf("age=%d-%d", c.AgeStart, c.AgeEnd))
+		case c.AgeStart > 1:
+			fields = append(fields, fmt.Sprintf("age=%d+", c.AgeStart))
+		}
+		for _, f := range []struct {
+			name   string
+			values []string
+		}{{"gender", c.Gender}, {"country", c.Country}, {"platform", c.Platform}} {
+			if len(f.values) > 0 {
+				fields = append(fields, f.name+"="+strings.Join(f.values, ","))
+			}
+		}
+		if len(fields) == 0 {
+			fields = append(fields, "any")
+		}
+		parts = append(parts, strings.Join(fields, " "))
+	}
+	return strings.Join(parts, " | ")
+}
+
+func (p *printer) listItems(items []listItem) error {
+	if p.json {
+		if items == nil {
+			items = []listItem{}
+		}
+		return p.writeJSON(items)
+	}
+
+	tw := tabwriter.NewWriter(p.w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "TITLE\tEND AT")
+	for _, item := range items {
+		fmt.Fprintf(tw, "%s\t%s\n", item.Title, item.EndAt.Format(time.RFC3339))
+	}
+	return tw.Flush()
+}
+
+func (p *printer) revisions(revisions []models.Revision) error {
+	if p.json {
+		if revisions == nil {
+			revisions = []models.Revision{}
+		}
+		return p.writeJSON(revisions)
+	}
+
+	tw := tabwriter.NewWriter(p.w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "REVISION\tCREATED AT\tACTOR\tACTION\tTITLE\tSTATUS")
+	for _, r := range revisions {
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\t%s\t%s\n", r.Revision, r.CreatedAt.Format(time.RFC3339),
+			r.Actor, r.Action, r.Advertisement.Title, r.Advertisement.Status)
+	}
+	return tw.Flush()
+}
+
+// auditRecords prints the names of the changed fields; -o json has their values.
+func (p *printer) auditRecords(records []models.AuditRecord) error {
+	if p.json {
+		if records == nil {
+			records = []models.AuditRecord{}
+		}
+		return p.writeJSON(records)
+	}
+
+	tw := tabwriter.NewWriter(p.w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "AT\tACTOR\tACTION\tID\tREQUEST ID\tCHANGED")
+	for _, r := range records {
+		fields := make([]string, 0, len(r.Changes))
+		for name := range r.Changes {
+			fields = append(fields, name)
+		}
+		sort.Strings(fields)
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%d\t%s\t%s\n", r.At.Format(time.RFC3339), r.Actor, r.Action,
+			r.EntityID, r.RequestID, strings.Join(fields, ","))
+	}
+	return tw.Flush()
+}
+
+func (p *printer) webhooks(webhooks []models.Webhook) error {
+	if p.json {
+		if webhooks == nil {
+			webhooks = []models.Webhook{}
+		}
+		return p.writeJSON(webhooks)
+	}
+
+	tw := tabwriter.NewWriter(p.w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tURL\tEVENTS\tCREATED AT")
+	for _, w := range webhooks {
+		fmt.Fprintf(tw, "%d\t%s\t%s\t%s\n", w.ID, w.URL, strings.Join(w.Events, ","),
+			w.CreatedAt.Format(time.RFC3339))
+	}
+	return tw.Flush()
+}
+
+// deadLetters leaves out the payloads; -o json has them.
+func (p *printer) deadLetters(letters []models.DeadLetter) error {
+	if p.json {
+		if letters == nil {
+			letters = []models.DeadLetter{}
+		}
+		return p.writeJSON(letters)
+	}
+
+	tw := tabwriter.NewWriter(p.w, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tWEBHOOK\tEVENT\tATTEMPTS\tFAILED AT\tLAST ERROR")
+	for _, d := range letters {
+		fmt.Fprintf(tw, "%d\t%d\t%s\t%d\t%s\t%s\n", d.ID, d.WebhookID, d.Event, d.Attempts,
+			d.FailedAt.Format(time.RFC3339), d.LastError)
+	}
+	return tw.Flush()
+}
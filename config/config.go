@@ -13,6 +13,11 @@ type Config struct {
 	Server struct {
 		IP   string `yaml:"IP"`
 		Port int    `yaml:"Port"`
+		// GRPCPort serves the gRPC API when non-zero.
+		GRPCPort int `yaml:"GRPCPort"`
+		// TrustedProxies lists the addresses or CIDRs whose X-Forwarded-For
+		// header is believed. No proxy is trusted when empty.
+		TrustedProxies []string `yaml:"TrustedProxies"`
 	} `yaml:"server"`
 
 	Database struct {
@@ -22,7 +27,72 @@ type Config struct {
 		Server   string `yaml:"Server"`
 		Port     int    `yaml:"Port"`
 		Database string `yaml:"Database"`
+		// AutoMigrate applies pending schema migrations on startup.
+		AutoMigrate bool `yaml:"AutoMigrate"`
 	} `yaml:"database"`
+
+	Auth struct {
+		// Enabled requires an API key on the admin API.
+		Enabled bool `yaml:"Enabled"`
+		// AdminKey is always accepted, so the first keys can be minted.
+		AdminKey string `yaml:"AdminKey"`
+	} `yaml:"auth"`
+
+	OpenRTB struct {
+		// BidPrice is the CPM bid in USD; impressions floored above it are skipped.
+		BidPrice float64 `yaml:"BidPrice"`
+		// Seat identifies the service in bid responses.
+		Seat string `yaml:"Seat"`
+	} `yaml:"openrtb"`
+
+	GeoIP struct {
+		// Database is the path of an mmdb file such as GeoLite2-City.mmdb.
+		// Clients are only located by IP when it is set.
+		Database string `yaml:"Database"`
+	} `yaml:"geoip"`
+
+	Audience struct {
+		// RefreshSeconds is how often audiences changed by other instances are
+		// reloaded into memory; 60 when zero.
+		RefreshSeconds int `yaml:"RefreshSeconds"`
+	} `yaml:"audience"`
+
+	Targeting struct {
+		// Unknown maps dimensions such as age or gender to how requests
+		// leaving them unknown match: "matchAll" conditions, the default, or
+		// only "untargeted" ones.
+		Unknown map[string]string `yaml:"Unknown"`
+		// RefreshSeconds is how often conditions changed by other instances
+		// are reloaded into memory; 60 when zero.
+		RefreshSeconds int `yaml:"RefreshSeconds"`
+	} `yaml:"targeting"`
+
+	Moderation struct {
+		// BannedWords lists words and phrases that flag titles and
+		// descriptions however obfuscated, BannedPatterns regular expressions.
+		BannedWords    []string `yaml:"BannedWords"`
+		BannedPatterns []string `yaml:"BannedPatterns"`
+		// AllowedDomains, when set, and DeniedDomains restrict the domains of
+		// landing pages, including subdomains.
+		AllowedDomains []string `yaml:"AllowedDomains"`
+		DeniedDomains  []string `yaml:"DeniedDomains"`
+	} `yaml:"moderation"`
+
+	Webhook struct {
+		// PollSeconds is how often queued deliveries are sent and start and
+		// end times checked; 5 when zero.
+		PollSeconds int `yaml:"PollSeconds"`
+		// MaxAttempts is how many times a delivery is tried before it moves
+		// to the dead-letter table; 8 when zero.
+		MaxAttempts int `yaml:"MaxAttempts"`
+		// BackoffSeconds is the delay after the first failed attempt, which
+		// doubles after each one up to MaxBackoffSeconds; 10 and 3600 when
+		// zero.
+		BackoffSeconds    int `yaml:"BackoffSeconds"`
+		MaxBackoffSeconds int `yaml:"MaxBackoffSeconds"`
+		// TimeoutSeconds bounds each attempt; 10 when zero.
+		TimeoutSeconds int `yaml:"TimeoutSeconds"`
+	} `yaml:"webhook"`
 }
 
 var config Config
@@ -0,0 +1,127 @@
+package controller
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	dbpkg "github.com/jjshen2000/simple-ads/db"
+)
+
+// Handler for showing the schema version
+func GetMigrations(c *gin.Context) {
+	current, err := dbpkg.CurrentVersion()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"current": current, "latest": dbpkg.LatestVersion()})
+}
+
+// Handler for applying pending migrations
+func ApplyMigrations(c *gin.Context) {
+	applied, err := dbpkg.Migrate()
+	if applied == nil {
+		applied = []int{}
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"applied": applied, "error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"applied": applied, "current": dbpkg.LatestVersion()})
+}
+
+type report struct {
+	Total      int            `json:"total"`
+	Active     int            `json:"active"`
+	Scheduled  int            `json:"scheduled"`
+	Expired    int            `json:"expired"`
+	ByPlatform map[string]int `json:"byPlatform"`
+	ByCountry  map[string]int `json:"byCountry"`
+	ByStatus   map[string]int `json:"byStatus"`
+}
+
+// Handler for summarizing advertisements
+//
+// byPlatform and byCountry count active advertisements with a condition
+// targeting the platform or country, byStatus every advertisement by status.
+func GetReport(c *gin.Context) {
+	db := dbpkg.GetDB()
+	r := report{ByPlatform: map[string]int{}, ByCountry: map[string]int{}, ByStatus: map[string]int{}}
+
+	summary := `
+	SELECT
+		COUNT(*),
+		COALESCE(SUM(? > start_at AND ? < end_at), 0),
+		COALESCE(SUM(? <= start_at), 0),
+		COALESCE(SUM(? >= end_at), 0)
+	FROM advertisement
+	WHERE deleted_at IS NULL
+	`
+	at := now()
+	if err := db.QueryRow(summary, at, at, at, at).Scan(&r.Total, &r.Active, &r.Scheduled, &r.Expired); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to summarize advertisements"})
+		return
+	}
+
+	for platform, bit := range platformMap {
+		byPlatform := `
+		SELECT COUNT(DISTINCT a.id) FROM advertisement AS a
+		INNER JOIN advertisement_condition AS ac ON a.id = ac.advertisement_id
+		WHERE a.deleted_at IS NULL AND ? < a.end_at AND ? > a.start_at AND (ac.platform & ?) = ?
+		`
+		var count int
+		if err := db.Get(&count, byPlatform, at, at, bit, bit); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to summarize advertisements"})
+			return
+		}
+		r.ByPlatform[platform] = count
+	}
+
+	byCountry := `
+	SELECT cc.country_code, COUNT(DISTINCT a.id) FROM advertisement AS a
+	INNER JOIN advertisement_condition AS ac ON a.id = ac.advertisement_id
+	INNER JOIN condition_country AS cc ON ac.id = cc.condition_id
+	WHERE a.deleted_at IS NULL AND ? < a.end_at AND ? > a.start_at
+	GROUP BY cc.country_code
+	`
+	rows, err := db.Query(byCountry, at, at)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to summarize advertisements"})
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var country string
+		var count int
+		if err := rows.Scan(&country, &count); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to summarize advertisements"})
+			return
+		}
+		r.ByCountry[country] = count
+	}
+	rows.Close()
+
+	byStatus := `SELECT status, COUNT(*) FROM advertisement WHERE deleted_at IS NULL GROUP BY status`
+	rows, err = db.Query(byStatus)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to summarize advertisements"})
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var status string
+		var count int
+		if err := rows.Scan(&status, &count); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to summarize advertisements"})
+			return
+		}
+		r.ByStatus[status] = count
+	}
+
+	c.JSON(http.StatusOK, r)
+}
@@ -0,0 +1,74 @@
+package controller
+
+import (
+	"database/sql"
+	"errors"
+	"net/url"
+	"strconv"
+
+	"github.com/jjshen2000/simple-ads/models"
+)
+
+// ageDimension targets conditions by the age of the user, between AgeStart
+// and AgeEnd inclusive. A NULL age_end has no upper bound.
+type ageDimension struct{}
+
+func init() {
+	registerDimension(ageDimension{})
+}
+
+func (ageDimension) name() string {
+	return "age"
+}
+
+func (ageDimension) parse(q url.Values) (interface{}, error) {
+	age, err := strconv.Atoi(defaultQuery(q, "age", "0"))
+	if err != nil || (q.Get("age") != "" && (age < 1 || age > models.MaxAge)) {
+		return nil, errors.New("invalid age")
+	}
+	if age == 0 {
+		return nil, nil
+	}
+	return age, nil
+}
+
+func (ageDimension) validate(condition models.Conditions) error {
+	if condition.AgeEnd != 0 && condition.AgeStart > condition.AgeEnd {
+		return errors.New("ageStart is above ageEnd")
+	}
+	return nil
+}
+
+func (ageDimension) columns(condition models.Conditions) []column {
+	start := condition.AgeStart
+	if start == 0 {
+		start = 1
+	}
+	var end interface{}
+	if condition.AgeEnd != 0 {
+		end = condition.AgeEnd
+	}
+	return []column{{"age_start", start}, {"age_end", end}}
+}
+
+func (ageDimension) selects() []string {
+	return []string{"ac.age_start", "ac.age_end"}
+}
+
+func (ageDimension) load(condition *models.Conditions, values []sql.NullString) (err error) {
+	if condition.AgeStart, err = strconv.Atoi(values[0].String); err != nil {
+		return err
+	}
+	if values[1].Valid {
+		condition.AgeEnd, err = strconv.Atoi(values[1].String)
+	}
+	return err
+}
+
+func (ageDimension) match(value interface{}) (string, []interface{}) {
+	return "ac.age_start <= ? AND (ac.age_end IS NULL OR ac.age_end >= ?)", []interface{}{value, value}
+}
+
+func (ageDimension) untargeted() string {
+	return "ac.age_start <= 1 AND ac.age_end IS NULL"
+}
@@ -0,0 +1,349 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+
+	"github.com/jjshen2000/simple-ads/audience"
+	dbpkg "github.com/jjshen2000/simple-ads/db"
+	"github.com/jjshen2000/simple-ads/models"
+)
+
+// audienceChunkSize is the number of hashes stored per audience_chunk row,
+// 1 MiB, well below the default max_allowed_packet of MySQL.
+const audienceChunkSize = 1 << 15
+
+var (
+	errAudienceNotFound = errors.New("audience not found")
+	errUnknownAudience  = errors.New("unknown audience")
+	errAudienceInUse    = errors.New("audience is targeted by a condition")
+)
+
+// audiences holds the members of every audience, so that ListActiveAdvertisements
+// tests membership without querying the database.
+var audiences = audience.NewRegistry()
+
+// Handler for creating an audience from a file of hashed user IDs
+func CreateAudience(c *gin.Context) {
+	name := c.Query("name")
+	if name == "" || utf8.RuneCountInString(name) > 255 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid name"})
+		return
+	}
+	hashes, err := audience.ReadHashes(c.Request.Body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	set := audience.NewSet(hashes)
+	updatedAt := now().Truncate(time.Second)
+
+	tx := dbpkg.GetDB().MustBegin()
+	defer tx.Rollback()
+
+	result, err := tx.Exec("INSERT INTO audience (name, size, version, updated_at) VALUES (?, ?, 1, ?)",
+		name, set.Len(), updatedAt)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error(insert audience)": err.Error()})
+		return
+	}
+	id, _ := result.LastInsertId()
+	if err := insertAudienceChunks(tx, int(id), set); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error(insert members)": err.Error()})
+		return
+	}
+	created := models.Audience{ID: int(id), Name: name, Size: set.Len(), UpdatedAt: updatedAt}
+	if err := writeAudit(tx, ginOrigin(c), auditAudienceCreate, auditEntityAudience, int(id), nil, created); err != nil {
+		c.JSON(errorResponse(err))
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error(commit)": err.Error()})
+		return
+	}
+	audiences.Store(int(id), 1, set)
+
+	c.JSON(http.StatusCreated, created)
+}
+
+// Handler for getting an audience without its members
+func GetAudience(c *gin.Context) {
+	id, ok := parseAdID(c)
+	if !ok {
+		return
+	}
+
+	var a models.Audience
+	err := dbpkg.GetDB().Get(&a, "SELECT id, name, size, updated_at FROM audience WHERE id = ?", id)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": errAudienceNotFound.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch audience"})
+		return
+	}
+	c.JSON(http.StatusOK, a)
+}
+
+// Handler for replacing the members of an audience with a new file
+func ReplaceAudience(c *gin.Context) {
+	id, ok := parseAdID(c)
+	if !ok {
+		return
+	}
+	hashes, err := audience.ReadHashes(c.Request.Body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	set := audience.NewSet(hashes)
+	updatedAt := now().Truncate(time.Second)
+
+	tx := dbpkg.GetDB().MustBegin()
+	defer tx.Rollback()
+
+	var before models.Audience
+	var version int
+	err = tx.QueryRow("SELECT id, name, size, updated_at, version FROM audience WHERE id = ? FOR UPDATE", id).
+		Scan(&before.ID, &before.Name, &before.Size, &before.UpdatedAt, &version)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": errAudienceNotFound.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch audience"})
+		return
+	}
+	version++
+
+	if _, err := tx.Exec("DELETE FROM audience_chunk WHERE audience_id = ?", id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error(delete members)": err.Error()})
+		return
+	}
+	if err := insertAudienceChunks(tx, id, set); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error(insert members)": err.Error()})
+		return
+	}
+	if _, err := tx.Exec("UPDATE audience SET size = ?, version = ?, updated_at = ? WHERE id = ?",
+		set.Len(), version, updatedAt, id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error(update audience)": err.Error()})
+		return
+	}
+	after := before
+	after.Size, after.UpdatedAt = set.Len(), updatedAt
+	if err := writeAudit(tx, ginOrigin(c), auditAudienceReplace, auditEntityAudience, id, before, after); err != nil {
+		c.JSON(errorResponse(err))
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error(commit)": err.Error()})
+		return
+	}
+	audiences.Store(id, version, set)
+
+	c.JSON(http.StatusOK, after)
+}
+
+// Handler for deleting an audience no condition targets
+func DeleteAudience(c *gin.Context) {
+	id, ok := parseAdID(c)
+	if !ok {
+		return
+	}
+
+	tx := dbpkg.GetDB().MustBegin()
+	defer tx.Rollback()
+
+	var inUse bool
+	if err := tx.Get(&inUse, "SELECT EXISTS(SELECT 1 FROM condition_audience WHERE audience_id = ?)", id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch audience"})
+		return
+	}
+	if inUse {
+		c.JSON(http.StatusConflict, gin.H{"error": errAudienceInUse.Error()})
+		return
+	}
+
+	var before models.Audience
+	err := tx.Get(&before, "SELECT id, name, size, updated_at FROM audience WHERE id = ? FOR UPDATE", id)
+	if err == sql.ErrNoRows {
+		c.JSON(http.StatusNotFound, gin.H{"error": errAudienceNotFound.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch audience"})
+		return
+	}
+
+	if _, err := tx.Exec("DELETE FROM audience_chunk WHERE audience_id = ?", id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error(delete members)": err.Error()})
+		return
+	}
+	if _, err := tx.Exec("DELETE FROM audience WHERE id = ?", id); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error(delete audience)": err.Error()})
+		return
+	}
+	if err := writeAudit(tx, ginOrigin(c), auditAudienceDelete, auditEntityAudience, id, before, nil); err != nil {
+		c.JSON(errorResponse(err))
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error(commit)": err.Error()})
+		return
+	}
+	audiences.Delete(id)
+
+	c.JSON(http.StatusOK, gin.H{"message": "Audience deleted successfully"})
+}
+
+// insertAudienceChunks stores the members of audience id in chunks.
+func insertAudienceChunks(tx *sqlx.Tx, id int, set *audience.Set) error {
+	packed := set.Bytes()
+	for seq := 0; len(packed) > 0; seq++ {
+		n := audienceChunkSize * sha256.Size
+		if n > len(packed) {
+			n = len(packed)
+		}
+		if _, err := tx.Exec("INSERT INTO audience_chunk (audience_id, seq, hashes) VALUES (?, ?, ?)",
+			id, seq, packed[:n]); err != nil {
+			return err
+		}
+		packed = packed[n:]
+	}
+	return nil
+}
+
+// loadAudience reads the version and members of audience id from one
+// snapshot.
+func loadAudience(id int) (version int, set *audience.Set, err error) {
+	tx, err := dbpkg.GetDB().BeginTxx(context.Background(), &sql.TxOptions{ReadOnly: true})
+	if err != nil {
+		return 0, nil, err
+	}
+	defer tx.Rollback()
+
+	if err := tx.Get(&version, "SELECT version FROM audience WHERE id = ?", id); err != nil {
+		return 0, nil, err
+	}
+	var chunks [][]byte
+	if err := tx.Select(&chunks, "SELECT hashes FROM audience_chunk WHERE audience_id = ? ORDER BY seq", id); err != nil {
+		return 0, nil, err
+	}
+	set, err = audience.SetFromBytes(bytes.Join(chunks, nil))
+	return version, set, err
+}
+
+// SyncAudiences loads the audiences created or replaced by any instance into
+// memory and forgets the deleted ones.
+func SyncAudiences() error {
+	held := audiences.Versions()
+
+	var stored []struct {
+		ID      int `db:"id"`
+		Version int `db:"version"`
+	}
+	if err := dbpkg.GetDB().Select(&stored, "SELECT id, version FROM audience"); err != nil {
+		return err
+	}
+
+	for _, a := range stored {
+		version, ok := held[a.ID]
+		delete(held, a.ID)
+		if ok && version >= a.Version {
+			continue
+		}
+		version, set, err := loadAudience(a.ID)
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		audiences.Store(a.ID, version, set)
+	}
+	for id := range held {
+		audiences.Delete(id)
+	}
+	return nil
+}
+
+// WatchAudiences syncs the audiences now and then every interval in the
+// background, until ctx is cancelled.
+func WatchAudiences(ctx context.Context, interval time.Duration) error {
+	if err := SyncAudiences(); err != nil {
+		return err
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			if err := SyncAudiences(); err != nil {
+				log.Println("Failed to sync audiences:", err)
+			}
+		}
+	}()
+	return nil
+}
+
+// checkAudiences returns errUnknownAudience unless every audience ID exists.
+func checkAudiences(tx *sqlx.Tx, ids []int) error {
+	if len(ids) == 0 {
+		return nil
+	}
+	query, args, err := sqlx.In("SELECT COUNT(*) FROM audience WHERE id IN (?)", ids)
+	if err != nil {
+		return err
+	}
+	var count int
+	if err := tx.Get(&count, tx.Rebind(query), args...); err != nil {
+		return &stepError{"check audience", err}
+	}
+	if count != len(ids) {
+		return errUnknownAudience
+	}
+	return nil
+}
+
+// uniqueInts returns ids without repetitions, in their first order.
+func uniqueInts(ids []int) []int {
+	var unique []int
+	seen := map[int]bool{}
+	for _, id := range ids {
+		if !seen[id] {
+			seen[id] = true
+			unique = append(unique, id)
+		}
+	}
+	return unique
+}
+
+// splitInts parses a GROUP_CONCAT of integers.
+func splitInts(concat string) ([]int, error) {
+	var ints []int
+	for _, s := range strings.Split(concat, ",") {
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			return nil, err
+		}
+		ints = append(ints, n)
+	}
+	return ints, nil
+}
@@ -0,0 +1,107 @@
+package controller
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jjshen2000/simple-ads/audience"
+	"github.com/jjshen2000/simple-ads/models"
+)
+
+func hashLine(userID string) string {
+	h := audience.HashUserID(userID)
+	return hex.EncodeToString(h[:]) + "\n"
+}
+
+func TestAudienceLifecycle(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/api/v1/audience", CreateAudience)
+	router.GET("/api/v1/audience/:id", GetAudience)
+	router.PUT("/api/v1/audience/:id", ReplaceAudience)
+	router.DELETE("/api/v1/audience/:id", DeleteAudience)
+	router.POST("/api/v1/ad", CreateAdvertisement)
+	router.GET("/api/v1/ad", ListActiveAdvertisements)
+
+	serve := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := serve("POST", "/api/v1/audience?name=customers", hashLine("alice")+"customer-1\n")
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, `{"error":"line 2: not a hex encoded SHA-256 hash"}`, w.Body.String())
+
+	w = serve("POST", "/api/v1/audience", hashLine("alice"))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = serve("POST", "/api/v1/audience?name=customers", hashLine("alice")+hashLine("bob")+hashLine("alice"))
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var customers models.Audience
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &customers))
+	assert.Equal(t, 2, customers.Size)
+
+	w = serve("GET", fmt.Sprintf("/api/v1/audience/%d", customers.ID), "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	var loaded models.Audience
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &loaded))
+	assert.Equal(t, customers, loaded)
+
+	// Advertisements for customers except bob.
+	w = serve("POST", "/api/v1/audience?name=churned", hashLine("bob"))
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var churned models.Audience
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &churned))
+
+	title := fmt.Sprintf("AD audience %d", customers.ID)
+	start := time.Now().UTC().Add(-time.Hour).Format(time.RFC3339)
+	end := time.Now().UTC().Add(time.Hour).Format(time.RFC3339)
+	w = serve("POST", "/api/v1/ad", fmt.Sprintf(`{"title":%q,"startAt":%q,"endAt":%q,
+		"conditions":[{"audience":[%d],"excludeAudience":[%d]}]}`, title, start, end, customers.ID, churned.ID))
+	assert.Equal(t, http.StatusCreated, w.Code)
+	approveAdvertisement(t, createdID(t, w))
+
+	w = serve("POST", "/api/v1/ad", fmt.Sprintf(`{"title":%q,"startAt":%q,"endAt":%q,
+		"conditions":[{"audience":[2147483647]}]}`, title, start, end))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, `{"error":"unknown audience"}`, w.Body.String())
+
+	for userID, eligible := range map[string]bool{"alice": true, "bob": false, "carol": false} {
+		w = serve("GET", "/api/v1/ad?limit=100&userId="+userID, "")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, eligible, strings.Contains(w.Body.String(), title), userID)
+	}
+
+	w = serve("PUT", fmt.Sprintf("/api/v1/audience/%d", customers.ID), hashLine("carol"))
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = serve("GET", "/api/v1/ad?limit=100&userId=carol", "")
+	assert.Contains(t, w.Body.String(), title)
+
+	w = serve("DELETE", fmt.Sprintf("/api/v1/audience/%d", customers.ID), "")
+	assert.Equal(t, http.StatusConflict, w.Code)
+	w = serve("PUT", "/api/v1/audience/2147483647", hashLine("carol"))
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	w = serve("DELETE", "/api/v1/audience/2147483647", "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestSplitInts(t *testing.T) {
+	ints, err := splitInts("3,1,2")
+	assert.NoError(t, err)
+	assert.Equal(t, []int{3, 1, 2}, ints)
+
+	_, err = splitInts("1,a")
+	assert.Error(t, err)
+	assert.Equal(t, []int{3, 1, 2}, uniqueInts([]int{3, 1, 3, 2, 1}))
+}
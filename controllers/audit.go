@@ -0,0 +1,262 @@
+package controller
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"regexp"
+	"strconv"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+
+	dbpkg "github.com/jjshen2000/simple-ads/db"
+	"github.com/jjshen2000/simple-ads/models"
+)
+
+// Actions of the audit log.
+const (
+	auditAdCreate        = "ad.create"
+	auditAdUpdate        = "ad.update"
+	auditAdDelete        = "ad.delete"
+	auditAdStatus        = "ad.status"
+	auditAdRestore       = "ad.restore"
+	auditAdRevert        = "ad.revert"
+	auditAudienceCreate  = "audience.create"
+	auditAudienceReplace = "audience.replace"
+	auditAudienceDelete  = "audience.delete"
+	auditKeyMint         = "key.mint"
+	auditWebhookCreate   = "webhook.create"
+	auditWebhookDelete   = "webhook.delete"
+	auditWebhookReplay   = "webhook.replay"
+)
+
+// Entities of the audit log, named after their tables.
+const (
+	auditEntityAd       = "advertisement"
+	auditEntityAudience = "audience"
+	auditEntityKey      = "api_key"
+	auditEntityWebhook  = "webhook"
+)
+
+const requestIDHeader = "X-Request-ID"
+
+// requestIDKey is the context key holding the ID of the request.
+const requestIDKey = "requestID"
+
+// requestIDRegexp bounds the request IDs accepted from callers, which end up
+// in the audit log and in responses.
+var requestIDRegexp = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,64}$`)
+
+// origin is who made a change and in which request, as the audit log records it.
+type origin struct {
+	actor     string
+	requestID string
+}
+
+// requestID returns incoming when it is a valid request ID, or a new random one.
+func requestID(incoming string) string {
+	if requestIDRegexp.MatchString(incoming) {
+		return incoming
+	}
+	raw := make([]byte, 16)
+	rand.Read(raw)
+	return hex.EncodeToString(raw)
+}
+
+// RequestID tags each request with the ID in its X-Request-ID header, or a
+// new one, and echoes it in the response.
+func RequestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := requestID(c.GetHeader(requestIDHeader))
+		c.Set(requestIDKey, id)
+		c.Header(requestIDHeader, id)
+	}
+}
+
+// ginOrigin returns the origin of a request gone through RequestID and RequireAPIKey.
+func ginOrigin(c *gin.Context) origin {
+	return origin{actor: c.GetString(actorKey), requestID: c.GetString(requestIDKey)}
+}
+
+// auditDiff returns the top-level fields of the JSON encodings of before and
+// after that differ. Either may be nil, for an entity created or deleted.
+func auditDiff(before, after interface{}) (map[string]models.AuditChange, error) {
+	fields := func(v interface{}) (map[string]json.RawMessage, error) {
+		m := map[string]json.RawMessage{}
+		if v == nil {
+			return m, nil
+		}
+		data, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		return m, json.Unmarshal(data, &m)
+	}
+
+	b, err := fields(before)
+	if err != nil {
+		return nil, err
+	}
+	a, err := fields(after)
+	if err != nil {
+		return nil, err
+	}
+
+	changes := map[string]models.AuditChange{}
+	for name, value := range b {
+		if !bytes.Equal(value, a[name]) {
+			changes[name] = models.AuditChange{Before: value, After: a[name]}
+		}
+	}
+	for name, value := range a {
+		if _, ok := b[name]; !ok {
+			changes[name] = models.AuditChange{After: value}
+		}
+	}
+	return changes, nil
+}
+
+// writeAudit appends the change of entity id from before to after to the
+// audit log inside tx, the transaction making the change.
+func writeAudit(tx *sqlx.Tx, o origin, action, entity string, id int, before, after interface{}) error {
+	changes, err := auditDiff(before, after)
+	if err != nil {
+		return &stepError{"encode audit", err}
+	}
+	data, err := json.Marshal(changes)
+	if err != nil {
+		return &stepError{"encode audit", err}
+	}
+	if _, err := tx.Exec(`INSERT INTO audit_log (at, actor, request_id, action, entity, entity_id, changes)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`, now(), o.actor, o.requestID, action, entity, id, data); err != nil {
+		return &stepError{"insert audit", err}
+	}
+	return nil
+}
+
+// auditQuery is the filter of a page of the audit log.
+type auditQuery struct {
+	adID     int
+	actor    string
+	from, to time.Time
+	limit    int
+	// before is the ID of the last record of the previous page.
+	before int64
+}
+
+// parseAuditQuery parses the query parameters of GET /api/v1/audit.
+func parseAuditQuery(q url.Values) (aq auditQuery, err error) {
+	if s := q.Get("adId"); s != "" {
+		if aq.adID, err = strconv.Atoi(s); err != nil || aq.adID < 1 {
+			return aq, errors.New("invalid adId")
+		}
+	}
+	aq.actor = q.Get("actor")
+	if utf8.RuneCountInString(aq.actor) > 255 {
+		return aq, errors.New("invalid actor")
+	}
+	for _, t := range []struct {
+		param string
+		dest  *time.Time
+	}{{"from", &aq.from}, {"to", &aq.to}} {
+		if s := q.Get(t.param); s != "" {
+			if *t.dest, err = time.Parse(time.RFC3339, s); err != nil {
+				return aq, errors.New("invalid " + t.param)
+			}
+			*t.dest = t.dest.UTC()
+		}
+	}
+	if aq.limit, err = strconv.Atoi(defaultQuery(q, "limit", "20")); err != nil || aq.limit < 1 || aq.limit > 100 {
+		return aq, errors.New("invalid limit")
+	}
+	if token := q.Get("cursor"); token != "" {
+		raw, err := base64.RawURLEncoding.DecodeString(token)
+		if err != nil {
+			return aq, errInvalidCursor
+		}
+		if aq.before, err = strconv.ParseInt(string(raw), 10, 64); err != nil || aq.before < 1 {
+			return aq, errInvalidCursor
+		}
+	}
+	return aq, nil
+}
+
+// buildAuditQuery returns the query of a page of aq, newest first, with one
+// record more than the page to tell whether another follows.
+func buildAuditQuery(aq auditQuery) (query string, args []interface{}) {
+	query = "SELECT id, at, actor, request_id, action, entity, entity_id, changes FROM audit_log WHERE TRUE"
+	if aq.adID != 0 {
+		query += " AND entity = ? AND entity_id = ?"
+		args = append(args, auditEntityAd, aq.adID)
+	}
+	if aq.actor != "" {
+		query += " AND actor = ?"
+		args = append(args, aq.actor)
+	}
+	if !aq.from.IsZero() {
+		query += " AND at >= ?"
+		args = append(args, aq.from)
+	}
+	if !aq.to.IsZero() {
+		query += " AND at < ?"
+		args = append(args, aq.to)
+	}
+	if aq.before != 0 {
+		query += " AND id < ?"
+		args = append(args, aq.before)
+	}
+	query += " ORDER BY id DESC LIMIT ?"
+	args = append(args, aq.limit+1)
+	return query, args
+}
+
+// Handler for listing the audit log, newest first
+//
+// The log can be filtered by advertisement, actor and a time range from
+// inclusive to exclusive.
+func GetAuditLog(c *gin.Context) {
+	aq, err := parseAuditQuery(c.Request.URL.Query())
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	query, args := buildAuditQuery(aq)
+	rows, err := dbpkg.GetDB().Query(query, args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch audit log"})
+		return
+	}
+	defer rows.Close()
+
+	items := []models.AuditRecord{}
+	nextCursor := ""
+	for rows.Next() {
+		if len(items) == aq.limit {
+			last := strconv.FormatInt(items[len(items)-1].ID, 10)
+			nextCursor = base64.RawURLEncoding.EncodeToString([]byte(last))
+			break
+		}
+		var r models.AuditRecord
+		var changes []byte
+		if err := rows.Scan(&r.ID, &r.At, &r.Actor, &r.RequestID, &r.Action, &r.Entity, &r.EntityID, &changes); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse audit log"})
+			return
+		}
+		if err := json.Unmarshal(changes, &r.Changes); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse audit log"})
+			return
+		}
+		items = append(items, r)
+	}
+
+	c.JSON(http.StatusOK, gin.H{"items": items, "nextCursor": nextCursor})
+}
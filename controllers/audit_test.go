@@ -0,0 +1,157 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jjshen2000/simple-ads/models"
+)
+
+// testOrigin is the origin of the changes tests make without a request.
+var testOrigin = origin{actor: "test", requestID: "test"}
+
+func TestRequestID(t *testing.T) {
+	assert.Equal(t, "req-1.a:b_C", requestID("req-1.a:b_C"))
+	for _, incoming := range []string{"", "with space", "x\n", strings.Repeat("x", 65)} {
+		id := requestID(incoming)
+		assert.Len(t, id, 32, incoming)
+		assert.NotEqual(t, id, requestID(incoming))
+	}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(RequestID())
+	router.GET("/", func(c *gin.Context) { c.String(http.StatusOK, ginOrigin(c).requestID) })
+
+	req := httptest.NewRequest("GET", "/", nil)
+	req.Header.Set("X-Request-ID", "abc")
+	w := httptest.NewRecorder()
+	router.ServeHTTP(w, req)
+	assert.Equal(t, "abc", w.Header().Get("X-Request-ID"))
+	assert.Equal(t, "abc", w.Body.String())
+}
+
+func TestAuditDiff(t *testing.T) {
+	before := models.Audience{ID: 1, Name: "buyers", Size: 10}
+	after := before
+	after.Size = 12
+
+	changes, err := auditDiff(before, after)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]models.AuditChange{"size": {Before: json.RawMessage("10"), After: json.RawMessage("12")}}, changes)
+
+	changes, err = auditDiff(nil, gin.H{"status": "draft"})
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]models.AuditChange{"status": {After: json.RawMessage(`"draft"`)}}, changes)
+
+	changes, err = auditDiff(gin.H{"status": "draft"}, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]models.AuditChange{"status": {Before: json.RawMessage(`"draft"`)}}, changes)
+
+	data, _ := json.Marshal(changes)
+	assert.Equal(t, `{"status":{"before":"draft"}}`, string(data))
+}
+
+func TestParseAuditQuery(t *testing.T) {
+	aq, err := parseAuditQuery(url.Values{"adId": {"7"}, "actor": {"ops"}, "from": {"2024-01-01T09:00:00+09:00"}})
+	assert.NoError(t, err)
+	assert.Equal(t, auditQuery{adID: 7, actor: "ops", from: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), limit: 20}, aq)
+
+	query, args := buildAuditQuery(aq)
+	assert.Equal(t, "SELECT id, at, actor, request_id, action, entity, entity_id, changes FROM audit_log "+
+		"WHERE TRUE AND entity = ? AND entity_id = ? AND actor = ? AND at >= ? ORDER BY id DESC LIMIT ?", query)
+	assert.Equal(t, []interface{}{"advertisement", 7, "ops", aq.from, 21}, args)
+
+	aq, err = parseAuditQuery(url.Values{"cursor": {"MTI"}, "limit": {"5"}})
+	assert.NoError(t, err)
+	assert.Equal(t, auditQuery{limit: 5, before: 12}, aq)
+
+	for param, value := range map[string]string{"adId": "0", "to": "yesterday", "limit": "101", "cursor": "!"} {
+		_, err := parseAuditQuery(url.Values{param: {value}})
+		assert.Error(t, err, param)
+	}
+}
+
+func TestAuditLog(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(RequestID(), func(c *gin.Context) { c.Set(actorKey, "auditor") })
+	router.POST("/api/v1/ad", CreateAdvertisement)
+	router.PUT("/api/v1/ad/:id", UpdateAdvertisement)
+	router.DELETE("/api/v1/ad/:id", DeleteAdvertisement)
+	router.POST("/api/v1/ad/:id/status", SetAdvertisementStatus)
+	router.GET("/api/v1/audit", GetAuditLog)
+
+	serve := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("X-Request-ID", method+"-audit")
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	since := time.Now().UTC().Add(-time.Second).Format(time.RFC3339)
+	start := time.Now().UTC().Add(-time.Hour).Format(time.RFC3339)
+	end := time.Now().UTC().Add(time.Hour).Format(time.RFC3339)
+	w := serve("POST", "/api/v1/ad", fmt.Sprintf(`{"title":"AD audit","startAt":%q,"endAt":%q}`, start, end))
+	assert.Equal(t, http.StatusCreated, w.Code)
+	id := createdID(t, w)
+	path := fmt.Sprintf("/api/v1/ad/%d", id)
+
+	w = serve("PUT", path, fmt.Sprintf(`{"title":"AD audited","startAt":%q,"endAt":%q}`, start, end))
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = serve("POST", path+"/status", `{"status":"pending_review"}`)
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = serve("DELETE", path, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = serve("GET", fmt.Sprintf("/api/v1/audit?adId=%d&actor=auditor&from=%s", id, since), "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	var page struct {
+		Items      []models.AuditRecord
+		NextCursor string
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &page))
+	if !assert.Len(t, page.Items, 4) {
+		return
+	}
+	assert.Empty(t, page.NextCursor)
+
+	var actions, requestIDs []string
+	for _, r := range page.Items {
+		assert.Equal(t, "auditor", r.Actor)
+		assert.Equal(t, id, r.EntityID)
+		actions = append(actions, r.Action)
+		requestIDs = append(requestIDs, r.RequestID)
+	}
+	assert.Equal(t, []string{"ad.delete", "ad.status", "ad.update", "ad.create"}, actions)
+	assert.Equal(t, []string{"DELETE-audit", "POST-audit", "PUT-audit", "POST-audit"}, requestIDs)
+
+	deleted, status, updated, created := page.Items[0], page.Items[1], page.Items[2], page.Items[3]
+	assert.Equal(t, `"AD audited"`, string(deleted.Changes["title"].Before))
+	assert.Nil(t, deleted.Changes["title"].After)
+	assert.Equal(t, models.AuditChange{Before: json.RawMessage(`"draft"`), After: json.RawMessage(`"pending_review"`)},
+		status.Changes["status"])
+	assert.Equal(t, models.AuditChange{Before: json.RawMessage(`"AD audit"`), After: json.RawMessage(`"AD audited"`)},
+		updated.Changes["title"])
+	assert.Len(t, updated.Changes, 1)
+	assert.Equal(t, `"draft"`, string(created.Changes["status"].After))
+
+	w = serve("GET", fmt.Sprintf("/api/v1/audit?adId=%d&limit=3", id), "")
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &page))
+	assert.Len(t, page.Items, 3)
+	w = serve("GET", fmt.Sprintf("/api/v1/audit?adId=%d&limit=3&cursor=%s", id, page.NextCursor), "")
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &page))
+	if assert.Len(t, page.Items, 1) {
+		assert.Equal(t, "ad.create", page.Items[0].Action)
+	}
+}
@@ -0,0 +1,148 @@
+package controller
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/jjshen2000/simple-ads/config"
+	dbpkg "github.com/jjshen2000/simple-ads/db"
+)
+
+// actorKey is the context key holding the name of the authenticated caller.
+const actorKey = "actor"
+
+var (
+	errMissingAPIKey = errors.New("missing API key")
+	errInvalidAPIKey = errors.New("invalid API key")
+	errNotBearer     = errors.New("API key must be sent as Bearer")
+)
+
+// authenticate returns the name of the caller presenting the Authorization
+// header authorization, "Bearer <key>".
+//
+// The key is either the configured admin key, whose caller is "admin", or
+// one minted through MintAPIKey, whose caller is "key:<id>": key names are
+// labels that anyone minting a key may repeat. When auth is disabled every
+// caller is "anonymous".
+func authenticate(authorization string) (actor string, err error) {
+	cfg := config.GetConfig()
+	if !cfg.Auth.Enabled {
+		return "anonymous", nil
+	}
+
+	key, err := bearerKey(authorization)
+	if err != nil {
+		return "", err
+	}
+
+	if cfg.Auth.AdminKey != "" && subtle.ConstantTimeCompare([]byte(key), []byte(cfg.Auth.AdminKey)) == 1 {
+		return "admin", nil
+	}
+
+	var id int
+	err = dbpkg.GetDB().Get(&id, "SELECT id FROM api_key WHERE key_hash = ?", hashAPIKey(key))
+	if err == sql.ErrNoRows {
+		return "", errInvalidAPIKey
+	}
+	if err != nil {
+		return "", errors.New("Failed to verify API key")
+	}
+	return keyActor(id), nil
+}
+
+// bearerKey returns the key of the Authorization header authorization,
+// rejecting schemes other than Bearer.
+func bearerKey(authorization string) (string, error) {
+	if authorization == "" {
+		return "", errMissingAPIKey
+	}
+	if !strings.HasPrefix(authorization, "Bearer ") {
+		return "", errNotBearer
+	}
+	key := strings.TrimPrefix(authorization, "Bearer ")
+	if key == "" {
+		return "", errMissingAPIKey
+	}
+	return key, nil
+}
+
+// keyActor returns the actor of the API key id.
+func keyActor(id int) string {
+	return "key:" + strconv.Itoa(id)
+}
+
+// RequireAPIKey guards the admin API.
+//
+// Callers present "Authorization: Bearer <key>".
+func RequireAPIKey() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		actor, err := authenticate(c.GetHeader("Authorization"))
+		if err == errMissingAPIKey || err == errInvalidAPIKey || err == errNotBearer {
+			c.AbortWithStatusJSON(http.StatusUnauthorized, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+			return
+		}
+		c.Set(actorKey, actor)
+	}
+}
+
+// hashAPIKey returns the hex SHA-256 digest stored in place of a key.
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// Handler for minting an API key
+//
+// The key itself is only returned once; the database keeps its hash.
+func MintAPIKey(c *gin.Context) {
+	var body struct {
+		Name string `json:"name" binding:"required,max=255"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	raw := make([]byte, 32)
+	if _, err := rand.Read(raw); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate API key"})
+		return
+	}
+	key := hex.EncodeToString(raw)
+
+	tx := dbpkg.GetDB().MustBegin()
+	defer tx.Rollback()
+
+	result, err := tx.Exec("INSERT INTO api_key (name, key_hash, created_at) VALUES (?, ?, ?)",
+		body.Name, hashAPIKey(key), now())
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error(insert api key)": err.Error()})
+		return
+	}
+	id, _ := result.LastInsertId()
+	// The audit log never holds the key or its hash.
+	if err := writeAudit(tx, ginOrigin(c), auditKeyMint, auditEntityKey, int(id), nil,
+		gin.H{"id": id, "name": body.Name}); err != nil {
+		c.JSON(errorResponse(err))
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error(commit)": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"id": id, "name": body.Name, "actor": keyActor(int(id)), "key": key})
+}
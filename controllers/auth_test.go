@@ -0,0 +1,27 @@
+package controller
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBearerKey(t *testing.T) {
+	tests := []struct {
+		authorization string
+		key           string
+		err           error
+	}{
+		{"Bearer abc", "abc", nil},
+		{"", "", errMissingAPIKey},
+		{"Bearer ", "", errMissingAPIKey},
+		{"abc", "", errNotBearer},
+		{"Basic YWJjOg==", "", errNotBearer},
+		{"bearer abc", "", errNotBearer},
+	}
+	for _, test := range tests {
+		key, err := bearerKey(test.authorization)
+		assert.Equal(t, test.err, err, test.authorization)
+		assert.Equal(t, test.key, key, test.authorization)
+	}
+}
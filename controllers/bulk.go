@@ -0,0 +1,177 @@
+package controller
+
+import (
+	"io"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+
+	"github.com/jjshen2000/simple-ads/bulk"
+	dbpkg "github.com/jjshen2000/simple-ads/db"
+	"github.com/jjshen2000/simple-ads/models"
+)
+
+const (
+	importAtomic     = "atomic"
+	importBestEffort = "bestEffort"
+)
+
+type importError struct {
+	Line  int    `json:"line"`
+	Error string `json:"error"`
+}
+
+type importReport struct {
+	Mode    string        `json:"mode"`
+	Created int           `json:"created"`
+	Failed  int           `json:"failed"`
+	Errors  []importError `json:"errors"`
+}
+
+func (r *importReport) fail(line int, err error) {
+	r.Failed++
+	r.Errors = append(r.Errors, importError{Line: line, Error: err.Error()})
+}
+
+// Handler for importing advertisements in bulk
+//
+// In atomic mode nothing is created unless every record is valid and
+// inserted; in bestEffort mode each record is inserted on its own.
+func ImportAdvertisements(c *gin.Context) {
+	format, err := bulk.FormatFromContentType(c.ContentType())
+	if err != nil {
+		c.JSON(http.StatusUnsupportedMediaType, gin.H{"error": err.Error()})
+		return
+	}
+
+	mode := c.DefaultQuery("mode", importAtomic)
+	if mode != importAtomic && mode != importBestEffort {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid mode"})
+		return
+	}
+
+	db := dbpkg.GetDB()
+	o := ginOrigin(c)
+	report := importReport{Mode: mode, Errors: []importError{}}
+
+	var atomicTx *sqlx.Tx
+	if mode == importAtomic {
+		atomicTx = db.MustBegin()
+		defer atomicTx.Rollback()
+	}
+
+	reader := bulk.NewReader(c.Request.Body, format)
+	for {
+		line, ad, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil && line == 0 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if err != nil {
+			report.fail(line, err)
+			continue
+		}
+
+		if err := validateAdvertisement(ad); err != nil {
+			report.fail(line, err)
+			continue
+		}
+
+		if atomicTx != nil {
+			if report.Failed > 0 {
+				// The batch is already doomed; keep validating for the report.
+				continue
+			}
+			if err := importAdvertisement(atomicTx, o, ad); err != nil {
+				report.fail(line, err)
+				continue
+			}
+			report.Created++
+			continue
+		}
+
+		tx := db.MustBegin()
+		if err := importAdvertisement(tx, o, ad); err != nil {
+			tx.Rollback()
+			report.fail(line, err)
+			continue
+		}
+		if err := tx.Commit(); err != nil {
+			report.fail(line, err)
+			continue
+		}
+		report.Created++
+	}
+
+	if atomicTx != nil {
+		if report.Failed > 0 {
+			report.Created = 0
+			c.JSON(http.StatusBadRequest, report)
+			return
+		}
+		if err := atomicTx.Commit(); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error(commit)": err.Error()})
+			return
+		}
+		syncTargetingAfterWrite()
+		c.JSON(http.StatusCreated, report)
+		return
+	}
+
+	if report.Created > 0 {
+		syncTargetingAfterWrite()
+	}
+	c.JSON(http.StatusOK, report)
+}
+
+// importAdvertisement inserts a validated advertisement inside tx and
+// audits its creation.
+func importAdvertisement(tx *sqlx.Tx, o origin, ad models.Advertisement) error {
+	id, err := insertAdvertisement(tx, ad)
+	if err != nil {
+		return err
+	}
+	return recordAdvertisementChange(tx, o, auditAdCreate, int(id), nil)
+}
+
+// Handler for exporting all advertisements with their conditions
+func ExportAdvertisements(c *gin.Context) {
+	format, err := bulk.ParseFormat(c.DefaultQuery("format", string(bulk.JSONL)))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	db := dbpkg.GetDB()
+	rows, err := db.Query(selectAdvertisements("a.deleted_at IS NULL"))
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch advertisements"})
+		return
+	}
+	defer rows.Close()
+
+	c.Header("Content-Type", format.ContentType())
+	c.Header("Content-Disposition", "attachment; filename=advertisements."+string(format))
+	c.Status(http.StatusOK)
+
+	writer := bulk.NewWriter(c.Writer, format)
+	err = scanAdvertisements(rows, func(ad models.Advertisement) error {
+		if err := writer.Write(ad); err != nil {
+			return err
+		}
+		c.Writer.Flush()
+		return nil
+	})
+	if err != nil {
+		c.Error(err)
+		return
+	}
+
+	if err := writer.Flush(); err != nil {
+		c.Error(err)
+	}
+}
@@ -0,0 +1,10 @@
+package controller
+
+import "time"
+
+// now returns the current time in UTC. Every "active" comparison uses it
+// instead of the database's NOW(), so results do not depend on the timezone
+// of the MySQL server and tests can pin the time.
+var now = func() time.Time {
+	return time.Now().UTC()
+}
@@ -1,31 +1,35 @@
 package controller
 
 import (
+	"database/sql"
+	"encoding/json"
 	"errors"
+	"fmt"
 	"net/http"
+	"net/url"
 	"strconv"
 	"strings"
 	"time"
-
-	"github.com/biter777/countries"
+	"unicode/utf8"
 
 	"github.com/gin-gonic/gin"
 	_ "github.com/go-sql-driver/mysql"
+	"github.com/jmoiron/sqlx"
+	"golang.org/x/text/language"
 
-	dbpkg "github.com/jjshen2000/simple-ads/db"
+	"github.com/jjshen2000/simple-ads/expr"
 	"github.com/jjshen2000/simple-ads/models"
 )
 
-var platformMap = map[string]uint8{
-	"android": 1,
-	"ios":     2,
-	"web":     4,
+var deviceMap = map[string]uint8{
+	"phone":   1,
+	"tablet":  2,
+	"desktop": 4,
+	"tv":      8,
 }
 
 // Handler for creating advertisement
 func CreateAdvertisement(c *gin.Context) {
-	db := dbpkg.GetDB()
-	validate := models.GetValidate()
 	var ad models.Advertisement
 
 	if err := c.BindJSON(&ad); err != nil {
@@ -33,249 +37,931 @@ func CreateAdvertisement(c *gin.Context) {
 		return
 	}
 
-	// Validate the advertisement data
-	if err := validate.Struct(ad); err != nil {
+	adID, err := createAdvertisement(ginOrigin(c), ad)
+	if err != nil {
+		c.JSON(errorResponse(err))
+		return
+	}
+
+	c.Header("Location", fmt.Sprintf("/api/v1/ad/%d", adID))
+	c.JSON(http.StatusCreated, gin.H{"message": "Advertisement created successfully"})
+}
+
+// parseAdID parses the :id path parameter.
+func parseAdID(c *gin.Context) (int, bool) {
+	id, err := strconv.Atoi(c.Param("id"))
+	if err != nil || id < 1 {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid id"})
+		return 0, false
+	}
+	return id, true
+}
+
+// Handler for getting an advertisement with its conditions
+func GetAdvertisement(c *gin.Context) {
+	id, ok := parseAdID(c)
+	if !ok {
+		return
+	}
+
+	ad, err := getAdvertisement(id)
+	if err != nil {
+		c.JSON(errorResponse(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, ad)
+}
+
+// Handler for replacing an advertisement and its conditions
+func UpdateAdvertisement(c *gin.Context) {
+	id, ok := parseAdID(c)
+	if !ok {
+		return
+	}
+
+	var ad models.Advertisement
+	if err := c.BindJSON(&ad); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	// Start a transaction
-	tx := db.MustBegin()
+	if err := updateAdvertisement(ginOrigin(c), id, ad); err != nil {
+		c.JSON(errorResponse(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Advertisement updated successfully"})
+}
 
+// Handler for deleting an advertisement, which can be restored
+func DeleteAdvertisement(c *gin.Context) {
+	id, ok := parseAdID(c)
+	if !ok {
+		return
+	}
+
+	if err := deleteAdvertisement(ginOrigin(c), id); err != nil {
+		c.JSON(errorResponse(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Advertisement deleted successfully"})
+}
+
+// insertAdvertisement inserts a validated advertisement with its conditions
+// inside tx and returns the ID of the new advertisement. It is a draft unless
+// moderation flags it for review.
+func insertAdvertisement(tx *sqlx.Tx, ad models.Advertisement) (int64, error) {
 	// Insert advertisement
-	insertAd := `INSERT INTO advertisement (title, start_at, end_at) VALUES (?, ?, ?)`
-	result, err := tx.Exec(insertAd, ad.Title, ad.StartAt, ad.EndAt)
+	video, err := encodeVideo(ad.Video)
 	if err != nil {
-		tx.Rollback()
-		c.JSON(http.StatusInternalServerError, gin.H{"error(insert advertisement)": err.Error()})
-		return
+		return 0, &stepError{"encode video", err}
+	}
+
+	localizations, err := encodeLocalizations(ad.Localizations)
+	if err != nil {
+		return 0, &stepError{"encode localizations", err}
+	}
+
+	reasons := moderator.Check(ad)
+	status := models.StatusDraft
+	if len(reasons) > 0 {
+		status = models.StatusPendingReview
+	}
+	moderationReasons, err := encodeModerationReasons(reasons)
+	if err != nil {
+		return 0, &stepError{"encode moderation reasons", err}
+	}
+
+	insertAd := `INSERT INTO advertisement (title, start_at, end_at, video, locale, description, localizations,
+		status, moderation_reasons) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)`
+	result, err := tx.Exec(insertAd, ad.Title, ad.StartAt, ad.EndAt, video,
+		nullString(ad.Locale), nullString(ad.Description), localizations, status, moderationReasons)
+	if err != nil {
+		return 0, &stepError{"insert advertisement", err}
 	}
 
 	// Get ID of the inserted advertisement
 	adID, _ := result.LastInsertId()
 
+	if err := insertConditions(tx, adID, ad.Conditions); err != nil {
+		return 0, err
+	}
+
+	return adID, nil
+}
+
+// insertConditions inserts the targeting conditions of advertisement adID inside tx.
+func insertConditions(tx *sqlx.Tx, adID int64, conditions []models.Conditions) error {
+	if err := bumpTargeting(tx); err != nil {
+		return &stepError{"bump targeting", err}
+	}
+
 	// Insert advertisement conditions
-	for _, condition := range ad.Conditions {
-		genderVal := strings.Join(condition.Gender, "")
-		if genderVal == "FM" || len(condition.Gender) == 0 {
-			genderVal = "MF"
+	for _, condition := range conditions {
+		unlimited_language := len(condition.Language) == 0
+		unlimited_keyword := len(condition.Keywords) == 0
+		unlimited_category := len(condition.Category) == 0
+		unlimited_audience := len(condition.Audience) == 0
+
+		deviceBits := getDeviceBits(condition.Device)
+
+		minOSVersion, maxOSVersion, err := encodeOSVersions(condition)
+		if err != nil {
+			return err
 		}
 
-		unlimited_country := false
-		if len(condition.Country) == 0 {
-			unlimited_country = true
+		var timezone *string
+		if condition.Schedule != nil {
+			timezone = &condition.Schedule.Timezone
 		}
 
-		platformBits := getPlatformBits(condition.Platform)
+		// The registered dimensions store their own columns.
+		columns := append([]column{{"advertisement_id", adID}}, dimensionColumns(condition)...)
+		columns = append(columns,
+			column{"timezone", timezone},
+			column{"min_os_version", minOSVersion},
+			column{"max_os_version", maxOSVersion},
+			column{"device", deviceBits},
+			column{"unlimited_language", unlimited_language},
+			column{"unlimited_keyword", unlimited_keyword},
+			column{"unlimited_category", unlimited_category},
+			column{"unlimited_audience", unlimited_audience},
+			column{"expr", nullString(condition.Expr)},
+		)
+		names := make([]string, len(columns))
+		args := make([]interface{}, len(columns))
+		for i, c := range columns {
+			names[i], args[i] = c.name, c.value
+		}
 
-		insertCondition := `
-		INSERT INTO advertisement_condition 
-			(advertisement_id, age_start, age_end, gender, unlimited_country, platform) 
-		VALUES 
-			(?, ?, ?, ?, ?, ?)
-		`
+		insertCondition := `INSERT INTO advertisement_condition (` + strings.Join(names, ", ") + `)
+		VALUES (?` + strings.Repeat(", ?", len(columns)-1) + `)`
 
-		_, err := tx.Exec(insertCondition, adID, condition.AgeStart, condition.AgeEnd, genderVal, unlimited_country, platformBits)
+		conditionResult, err := tx.Exec(insertCondition, args...)
 		if err != nil {
-			tx.Rollback()
-			c.JSON(http.StatusInternalServerError, gin.H{"error(insert condition)": err.Error()})
-			return
+			return &stepError{"insert condition", err}
 		}
 
 		// Get ID of the inserted condition
-		conditionID, _ := result.LastInsertId()
+		conditionID, _ := conditionResult.LastInsertId()
+
+		if err := indexCondition(tx, conditionID, condition); err != nil {
+			return err
+		}
 
-		// Insert condition countries
-		for _, country := range condition.Country {
-			insertCountry := `
-				INSERT INTO condition_country (condition_id, country_code) VALUES (?, ?)
+		// Insert condition languages
+		for _, tag := range condition.Language {
+			insertLanguage := `
+				INSERT INTO condition_language (condition_id, language_tag) VALUES (?, ?)
 			`
-			_, err := tx.Exec(insertCountry, conditionID, country)
+			_, err := tx.Exec(insertLanguage, conditionID, language.Make(tag).String())
 			if err != nil {
-				tx.Rollback()
-				c.JSON(http.StatusInternalServerError, gin.H{"error(insert country)": err.Error()})
-				return
+				return &stepError{"insert language", err}
+			}
+		}
+
+		// Insert condition keywords, once per normalized form
+		for _, excluded := range []bool{false, true} {
+			keywords := condition.Keywords
+			if excluded {
+				keywords = condition.ExcludeKeywords
+			}
+			seen := make(map[string]bool, len(keywords))
+			for _, keyword := range keywords {
+				normalized := models.NormalizeKeyword(keyword)
+				if seen[normalized] {
+					continue
+				}
+				seen[normalized] = true
+				insertKeyword := `
+					INSERT INTO condition_keyword (condition_id, keyword, normalized, excluded) VALUES (?, ?, ?, ?)
+				`
+				_, err := tx.Exec(insertKeyword, conditionID, strings.TrimSpace(keyword), normalized, excluded)
+				if err != nil {
+					return &stepError{"insert keyword", err}
+				}
+			}
+		}
+
+		// Insert condition categories
+		for _, category := range condition.Category {
+			insertCategory := `
+				INSERT INTO condition_category (condition_id, category) VALUES (?, ?)
+			`
+			_, err := tx.Exec(insertCategory, conditionID, category)
+			if err != nil {
+				return &stepError{"insert category", err}
+			}
+		}
+
+		// Insert condition audiences
+		for _, excluded := range []bool{false, true} {
+			ids := condition.Audience
+			if excluded {
+				ids = condition.ExcludeAudience
+			}
+			ids = uniqueInts(ids)
+			if err := checkAudiences(tx, ids); err != nil {
+				return err
+			}
+			for _, id := range ids {
+				insertAudience := `
+					INSERT INTO condition_audience (condition_id, audience_id, excluded) VALUES (?, ?, ?)
+				`
+				_, err := tx.Exec(insertAudience, conditionID, id, excluded)
+				if err != nil {
+					return &stepError{"insert audience", err}
+				}
+			}
+		}
+
+		// Insert condition schedule windows
+		if condition.Schedule != nil {
+			for _, window := range condition.Schedule.Windows {
+				insertWindow := `
+					INSERT INTO condition_schedule (condition_id, days, start_hour, end_hour) VALUES (?, ?, ?, ?)
+				`
+				_, err := tx.Exec(insertWindow, conditionID, models.DayBits(window.Days), window.StartHour, window.EndHour)
+				if err != nil {
+					return &stepError{"insert schedule", err}
+				}
 			}
 		}
 	}
 
-	// Commit the transaction
-	if err := tx.Commit(); err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error(commit)": err.Error()})
-		return
+	return nil
+}
+
+// deleteConditions removes every targeting condition of advertisement adID inside tx.
+func deleteConditions(tx *sqlx.Tx, adID int) error {
+	if err := bumpTargeting(tx); err != nil {
+		return err
 	}
 
-	c.JSON(http.StatusCreated, gin.H{"message": "Advertisement created successfully"})
+	tables := append(indexTables(), "condition_language",
+		"condition_keyword", "condition_category", "condition_audience")
+	for _, table := range tables {
+		deleteGeo := `
+		DELETE g FROM ` + table + ` AS g
+		INNER JOIN advertisement_condition AS ac ON ac.id = g.condition_id
+		WHERE ac.advertisement_id = ?
+		`
+		if _, err := tx.Exec(deleteGeo, adID); err != nil {
+			return err
+		}
+	}
+
+	deleteSchedules := `
+	DELETE cs FROM condition_schedule AS cs
+	INNER JOIN advertisement_condition AS ac ON ac.id = cs.condition_id
+	WHERE ac.advertisement_id = ?
+	`
+	if _, err := tx.Exec(deleteSchedules, adID); err != nil {
+		return err
+	}
+
+	_, err := tx.Exec("DELETE FROM advertisement_condition WHERE advertisement_id = ?", adID)
+	return err
 }
 
-// getPlatformBits returns bits value mapping from slice of platforms.
-//
-// If no platform is indicated in the slice, return 7 (111 in binary).
-// If the slice contains an invalid platform, return 0.
-func getPlatformBits(platforms []string) uint8 {
-	var platformBits uint8
-	for _, p := range platforms {
-		bit, found := platformMap[p]
-		if !found { // invalid
-			return 0
+// selectAdvertisements returns a query reading advertisements with their
+// conditions and schedules, one row per condition, ordered by advertisement.
+// The schedule windows of a condition are concatenated as
+// "days:start-end,...", and its languages, keywords, categories and
+// audiences are comma separated. The columns of the registered dimensions
+// follow the condition ID.
+// The optional where clause filters advertisements.
+func selectAdvertisements(where string) string {
+	query := `
+	SELECT a.id, a.title, a.start_at, a.end_at, a.video,
+		a.locale, a.description, a.localizations, a.status, a.moderation_reasons,
+		ac.id, ` + strings.Join(dimensionSelects(), ", ") + `, ac.timezone,
+		ac.min_os_version, ac.max_os_version, ac.device, ac.expr,
+		(SELECT GROUP_CONCAT(CONCAT(cs.days, ':', cs.start_hour, '-', cs.end_hour))
+			FROM condition_schedule AS cs WHERE cs.condition_id = ac.id),
+		(SELECT GROUP_CONCAT(cl.language_tag) FROM condition_language AS cl WHERE cl.condition_id = ac.id),
+		(SELECT GROUP_CONCAT(ck.keyword) FROM condition_keyword AS ck WHERE ck.condition_id = ac.id AND NOT ck.excluded),
+		(SELECT GROUP_CONCAT(ck.keyword) FROM condition_keyword AS ck WHERE ck.condition_id = ac.id AND ck.excluded),
+		(SELECT GROUP_CONCAT(cg.category) FROM condition_category AS cg WHERE cg.condition_id = ac.id),
+		(SELECT GROUP_CONCAT(ca.audience_id) FROM condition_audience AS ca WHERE ca.condition_id = ac.id AND NOT ca.excluded),
+		(SELECT GROUP_CONCAT(ca.audience_id) FROM condition_audience AS ca WHERE ca.condition_id = ac.id AND ca.excluded)
+	FROM advertisement AS a
+	LEFT JOIN advertisement_condition AS ac ON a.id = ac.advertisement_id
+	`
+	if where != "" {
+		query += " WHERE " + where
+	}
+	return query + " ORDER BY a.id, ac.id"
+}
+
+// scanAdvertisements folds the rows of a selectAdvertisements query back into
+// advertisements and calls fn with each one in order.
+func scanAdvertisements(rows *sql.Rows, fn func(models.Advertisement) error) error {
+	var current *models.Advertisement
+	dimensionValues := make([]sql.NullString, len(dimensionSelects()))
+
+	for rows.Next() {
+		var (
+			adID              int
+			title             string
+			startAt, endAt    time.Time
+			video             []byte
+			locale            sql.NullString
+			description       sql.NullString
+			localizations     []byte
+			status            string
+			moderationReasons []byte
+			condID            sql.NullInt64
+			timezone, windows sql.NullString
+			minOS, maxOS      sql.NullInt64
+			device            sql.NullInt64
+			languages         sql.NullString
+			keywords, exclude sql.NullString
+			categories        sql.NullString
+			audienceIDs       sql.NullString
+			excludeIDs        sql.NullString
+			expression        sql.NullString
+		)
+		dest := []interface{}{&adID, &title, &startAt, &endAt, &video,
+			&locale, &description, &localizations, &status, &moderationReasons, &condID}
+		for i := range dimensionValues {
+			dest = append(dest, &dimensionValues[i])
+		}
+		dest = append(dest, &timezone, &minOS, &maxOS, &device, &expression,
+			&windows, &languages,
+			&keywords, &exclude, &categories, &audienceIDs, &excludeIDs)
+		err := rows.Scan(dest...)
+		if err != nil {
+			return err
+		}
+
+		if current == nil || current.ID != adID {
+			if current != nil {
+				if err := fn(*current); err != nil {
+					return err
+				}
+			}
+
+			current = &models.Advertisement{
+				ID:          adID,
+				Title:       title,
+				StartAt:     startAt,
+				EndAt:       endAt,
+				Locale:      locale.String,
+				Description: description.String,
+				Status:      status,
+			}
+			current.Video, err = decodeVideo(video)
+			if err != nil {
+				return err
+			}
+			current.Localizations, err = decodeLocalizations(localizations)
+			if err != nil {
+				return err
+			}
+			current.ModerationReasons, err = decodeModerationReasons(moderationReasons)
+			if err != nil {
+				return err
+			}
+		}
+
+		if !condID.Valid {
+			continue
+		}
+
+		condition := models.Conditions{
+			Device: getDevices(uint8(device.Int64)),
+			Expr:   expression.String,
+		}
+		if err := loadDimensions(&condition, dimensionValues); err != nil {
+			return err
+		}
+		if minOS.Valid {
+			condition.MinOSVersion = models.DecodeOSVersion(uint64(minOS.Int64), 0)
+		}
+		if maxOS.Valid {
+			condition.MaxOSVersion = models.DecodeOSVersion(uint64(maxOS.Int64), 999)
+		}
+		if languages.Valid {
+			condition.Language = strings.Split(languages.String, ",")
+		}
+		if keywords.Valid {
+			condition.Keywords = strings.Split(keywords.String, ",")
+		}
+		if exclude.Valid {
+			condition.ExcludeKeywords = strings.Split(exclude.String, ",")
+		}
+		if categories.Valid {
+			condition.Category = strings.Split(categories.String, ",")
+		}
+		if audienceIDs.Valid {
+			if condition.Audience, err = splitInts(audienceIDs.String); err != nil {
+				return err
+			}
+		}
+		if excludeIDs.Valid {
+			if condition.ExcludeAudience, err = splitInts(excludeIDs.String); err != nil {
+				return err
+			}
+		}
+		if timezone.Valid {
+			condition.Schedule = &models.Schedule{Timezone: timezone.String}
+			condition.Schedule.Windows, err = parseWindows(windows.String)
+			if err != nil {
+				return err
+			}
+		}
+		current.Conditions = append(current.Conditions, condition)
+	}
+
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if current != nil {
+		return fn(*current)
+	}
+	return nil
+}
+
+// loadAdvertisement reads a single advertisement with its conditions.
+// It returns sql.ErrNoRows if the advertisement does not exist or is deleted.
+func loadAdvertisement(q sqlx.Queryer, id int) (ad models.Advertisement, err error) {
+	rows, err := q.Query(selectAdvertisements("a.id = ? AND a.deleted_at IS NULL"), id)
+	if err != nil {
+		return ad, err
+	}
+	defer rows.Close()
+
+	found := false
+	err = scanAdvertisements(rows, func(loaded models.Advertisement) error {
+		ad, found = loaded, true
+		return nil
+	})
+	if err == nil && !found {
+		err = sql.ErrNoRows
+	}
+	return ad, err
+}
+
+// encodeVideo converts a video creative to the value of the video column.
+func encodeVideo(video *models.Video) (interface{}, error) {
+	if video == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(video)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+// decodeVideo converts a stored video column back to the video creative.
+func decodeVideo(data []byte) (*models.Video, error) {
+	if data == nil {
+		return nil, nil
+	}
+	var video models.Video
+	if err := json.Unmarshal(data, &video); err != nil {
+		return nil, err
+	}
+	return &video, nil
+}
+
+// parseWindows converts the concatenated schedule windows of
+// selectAdvertisements back to windows.
+func parseWindows(concat string) ([]models.Window, error) {
+	var windows []models.Window
+	if concat == "" {
+		return windows, nil
+	}
+	for _, part := range strings.Split(concat, ",") {
+		var days uint8
+		var window models.Window
+		if _, err := fmt.Sscanf(part, "%d:%d-%d", &days, &window.StartHour, &window.EndHour); err != nil {
+			return nil, fmt.Errorf("invalid schedule window %q", part)
 		}
-		platformBits |= bit
+		window.Days = models.Days(days)
+		windows = append(windows, window)
+	}
+	return windows, nil
+}
+
+// getDeviceBits returns bits value mapping from slice of device types.
+//
+// If no device type is indicated in the slice, return 15 (1111 in binary).
+func getDeviceBits(devices []string) uint8 {
+	var deviceBits uint8
+	for _, d := range devices {
+		deviceBits |= deviceMap[d]
 	}
-	if platformBits == 0 { // no specific platform is indicated
-		platformBits = 7
+	if deviceBits == 0 { // no specific device type is indicated
+		deviceBits = 15
 	}
-	return platformBits
+	return deviceBits
 }
 
-// isValidPlatform checks if the given platform is valid.
-// It returns true if the platform is empty (indicating no platform specified),
-// or if the platform exists in the platformMap; otherwise, it returns false.
-func isValidPlatform(platform string) bool {
-	return platform == "" || platformMap[platform] != 0
+// getDevices is the inverse of getDeviceBits.
+//
+// If every device type is set, return nil since the condition does not restrict device types.
+func getDevices(deviceBits uint8) []string {
+	if deviceBits == 15 {
+		return nil
+	}
+
+	var devices []string
+	for _, d := range []string{"phone", "tablet", "desktop", "tv"} {
+		if deviceBits&deviceMap[d] != 0 {
+			devices = append(devices, d)
+		}
+	}
+	return devices
+}
+
+// encodeOSVersions returns the values of the min_os_version and
+// max_os_version columns, nil when unbounded.
+func encodeOSVersions(condition models.Conditions) (min, max interface{}, err error) {
+	if condition.MinOSVersion != "" {
+		if min, err = models.EncodeOSVersion(condition.MinOSVersion); err != nil {
+			return nil, nil, &stepError{"encode OS version", err}
+		}
+	}
+	if condition.MaxOSVersion != "" {
+		if max, err = models.EncodeMaxOSVersion(condition.MaxOSVersion); err != nil {
+			return nil, nil, &stepError{"encode OS version", err}
+		}
+	}
+	return min, max, nil
 }
 
 type listParams struct {
-	offset   int
-	limit    int
-	age      int
-	gender   string
-	country  string
-	platform string
+	// at is the instant advertisements must be active at; now() when zero.
+	at           time.Time
+	cursor       *cursor
+	limit        int
+	includeTotal bool
+	// targets holds the values of the registered dimensions the request
+	// targets; nil when it targets none.
+	targets targets
+	// unknown names the dimensions the request leaves unknown whose policy
+	// only matches conditions not targeting them.
+	unknown []string
+	// osVersion is the encoded OS version of the target; 0 when unknown.
+	osVersion uint64
+	device    string
+	// languages holds the preferred languages of the target, most preferred first.
+	languages []language.Tag
+	// keywords holds the normalized keywords of the content; advertisements
+	// matching more of them come first.
+	keywords   []string
+	categories []string
+	userID     string
+	// audiences holds the audiences userID belongs to; nil when the user
+	// is unknown.
+	audiences []int
+	// kv holds the kv.* parameters targeting expressions refer to.
+	kv expr.Env
+	// expressions is set when a condition has a targeting expression. The
+	// query then selects exprColumns, and the expressions are evaluated
+	// against kv on the rows it returns.
+	expressions bool
+	// video restricts the list to advertisements with a video creative.
+	video bool
+	// withVideo loads the video creatives without restricting the list to
+	// advertisements with one.
+	withVideo bool
+	// slots holds the local time in every timezone used by a schedule; nil
+	// when no condition is scheduled.
+	slots []localTime
+}
+
+// localTime is the weekday and hour of an instant in a timezone.
+type localTime struct {
+	timezone string
+	weekday  time.Weekday
+	hour     int
+}
+
+// localTimes returns the local time of now in each of timezones.
+func localTimes(now time.Time, timezones []string) []localTime {
+	var slots []localTime
+	for _, timezone := range timezones {
+		loc, err := time.LoadLocation(timezone)
+		if err != nil {
+			continue
+		}
+		local := now.In(loc)
+		slots = append(slots, localTime{timezone: timezone, weekday: local.Weekday(), hour: local.Hour()})
+	}
+	return slots
+}
+
+// scheduleClause matches conditions without a schedule or with a window
+// covering the local time of their timezone.
+func scheduleClause(slots []localTime) (clause string, args []interface{}) {
+	var windows []string
+	for _, slot := range slots {
+		windows = append(windows, "(ac.timezone = ? AND (cs.days & ?) != 0 AND cs.start_hour <= ? AND cs.end_hour > ?)")
+		args = append(args, slot.timezone, uint8(1)<<slot.weekday, slot.hour, slot.hour)
+	}
+	if len(windows) == 0 {
+		return "ac.timezone IS NULL", nil
+	}
+
+	clause = "(ac.timezone IS NULL OR EXISTS (SELECT 1 FROM condition_schedule AS cs" +
+		" WHERE cs.condition_id = ac.id AND (" + strings.Join(windows, " OR ") + ")))"
+	return clause, args
 }
 
 // Parse request parameters for listing active advertisements
 func parseListParams(c *gin.Context) (params listParams, err error) {
-	offsetStr := c.DefaultQuery("offset", "1")
-	params.offset, err = strconv.Atoi(offsetStr)
-	if err != nil || params.offset < 1 {
-		err = errors.New("invalid offset")
+	q := c.Request.URL.Query()
+	locateClient(c, q)
+	acceptLanguage(c, q)
+	if err = detectDevice(c, q); err != nil {
 		return
 	}
-	params.offset -= 1
+	return parseListQuery(q)
+}
+
+// parseListQuery parses the query parameters for listing active advertisements.
+func parseListQuery(q url.Values) (params listParams, err error) {
+	if token := q.Get("cursor"); token != "" {
+		var cur cursor
+		cur, err = decodeCursor(token)
+		if err != nil {
+			return
+		}
+		params.cursor = &cur
+	}
 
-	limitStr := c.DefaultQuery("limit", "5")
+	limitStr := defaultQuery(q, "limit", "5")
 	params.limit, err = strconv.Atoi(limitStr)
 	if err != nil || params.limit < 1 || params.limit > 100 {
 		err = errors.New("invalid limit")
 		return
 	}
 
-	ageStr := c.DefaultQuery("age", "0")
-	params.age, err = strconv.Atoi(ageStr)
-	if err != nil || (c.Query("age") != "" && (params.age < 1 || params.age > 100)) {
-		err = errors.New("invalid age")
+	includeTotalStr := defaultQuery(q, "includeTotal", "false")
+	params.includeTotal, err = strconv.ParseBool(includeTotalStr)
+	if err != nil {
+		err = errors.New("invalid includeTotal")
 		return
 	}
 
-	params.gender = c.Query("gender")
-	if params.gender != "" && params.gender != "M" && params.gender != "F" {
-		err = errors.New("invalid gender")
+	if params.targets, params.unknown, err = parseTargets(q); err != nil {
 		return
 	}
 
-	params.country = c.Query("country")
-	if params.country != "" && countries.ByName(params.country) == countries.Unknown {
-		err = errors.New("invalid country")
+	if v := q.Get("osVersion"); v != "" {
+		params.osVersion, err = models.EncodeOSVersion(v)
+		if err != nil {
+			err = errors.New("invalid osVersion")
+			return
+		}
+	}
+
+	params.device = q.Get("device")
+	if params.device != "" && deviceMap[params.device] == 0 {
+		err = errors.New("invalid device")
 		return
 	}
 
-	params.platform = c.Query("platform")
-	if params.platform != "" && !isValidPlatform(params.platform) {
-		err = errors.New("invalid platform")
+	if lang := q.Get("lang"); lang != "" {
+		params.languages, err = parseLanguages(lang)
+		if err != nil || len(params.languages) == 0 {
+			err = errors.New("invalid lang")
+			return
+		}
+	}
+
+	if keywords := q.Get("keywords"); keywords != "" {
+		params.keywords, err = parseKeywords(keywords)
+		if err != nil {
+			return
+		}
+	}
+
+	if category := q.Get("category"); category != "" {
+		params.categories, err = parseCategories(category)
+		if err != nil {
+			return
+		}
+	}
+
+	params.userID = q.Get("userId")
+	if utf8.RuneCountInString(params.userID) > 256 {
+		err = errors.New("invalid userId")
+		return
+	}
+
+	if params.kv, err = parseKV(q); err != nil {
 		return
 	}
+
+	if atStr := q.Get("at"); atStr != "" {
+		params.at, err = time.Parse(time.RFC3339, atStr)
+		if err != nil {
+			err = errors.New("invalid at")
+			return
+		}
+		params.at = params.at.UTC()
+	}
 	return
 }
 
-// buildQuery constructs a SQL query string and its corresponding arguments based on provided parameters.
-func buildQuery(params listParams) (query string, args []interface{}) {
-	query = "SELECT a.title, a.end_at FROM advertisement AS a\n"
+// defaultQuery returns the value of key, or def if the key is absent.
+func defaultQuery(q url.Values, key, def string) string {
+	if values, ok := q[key]; ok && len(values) > 0 {
+		return values[0]
+	}
+	return def
+}
 
-	if params.age != 0 || params.gender != "" || params.country != "" || params.platform != "" {
+// buildFilter constructs the FROM and WHERE clauses shared by the list and count queries.
+// Only approved advertisements are listed; paused and deleted ones are not.
+func buildFilter(params listParams) (query string, args []interface{}) {
+	query = " FROM advertisement AS a\n"
+
+	targeted := params.targets != nil || params.osVersion != 0 || params.device != "" || params.languages != nil ||
+		params.keywords != nil || params.categories != nil || params.audiences != nil
+	if targeted {
 		query += " INNER JOIN advertisement_condition AS ac ON a.id = ac.advertisement_id\n"
+	} else if params.unknown != nil || params.slots != nil || params.expressions {
+		// Advertisements without conditions stay eligible.
+		query += " LEFT JOIN advertisement_condition AS ac ON a.id = ac.advertisement_id\n"
+	}
+
+	query += " WHERE a.status = '" + models.StatusApproved + "' AND a.deleted_at IS NULL AND ? < a.end_at AND ? > a.start_at"
+	args = append(args, params.at, params.at)
+	if params.video {
+		query += " AND a.video IS NOT NULL"
+	}
+	targetsQuery, targetsArgs := targetsClause(params.targets)
+	query += targetsQuery
+	args = append(args, targetsArgs...)
+
+	if params.unknown != nil {
+		clause := untargetedClause(params.unknown)
+		if targeted {
+			query += " AND " + clause
+		} else {
+			query += " AND (ac.id IS NULL OR " + clause + ")"
+		}
+	}
+
+	if params.osVersion != 0 {
+		query += " AND (ac.min_os_version IS NULL OR ac.min_os_version <= ?)" +
+			" AND (ac.max_os_version IS NULL OR ac.max_os_version >= ?)"
+		args = append(args, params.osVersion, params.osVersion)
+	}
+
+	if params.device != "" {
+		query += " AND (ac.device & ?) = ?"
+		deviceMask := deviceMap[params.device]
+		args = append(args, deviceMask, deviceMask)
 	}
 
-	if params.country != "" {
-		query += " INNER JOIN condition_country AS cc ON ac.id = cc.condition_id\n"
+	if params.languages != nil {
+		candidates := languageCandidates(params.languages)
+		query += " AND (ac.unlimited_language OR EXISTS (SELECT 1 FROM condition_language AS cl" +
+			" WHERE cl.condition_id = ac.id AND cl.language_tag IN (?" + strings.Repeat(", ?", len(candidates)-1) + ")))"
+		for _, candidate := range candidates {
+			args = append(args, candidate)
+		}
 	}
 
-	query += " WHERE NOW() < a.end_at AND NOW() > a.start_at"
-	if params.age != 0 {
-		query += " AND ? BETWEEN ac.age_start AND ac.age_end"
-		args = append(args, params.age)
+	if params.keywords != nil {
+		include, includeArgs := keywordSubquery("1", params.keywords, false)
+		exclude, excludeArgs := keywordSubquery("1", params.keywords, true)
+		query += " AND (ac.unlimited_keyword OR EXISTS (" + include + ")) AND NOT EXISTS (" + exclude + ")"
+		args = append(args, includeArgs...)
+		args = append(args, excludeArgs...)
 	}
 
-	if params.gender != "" {
-		if params.gender == "M" {
-			query += " AND ac.gender != ?"
-			args = append(args, "F")
-		} else if params.gender == "F" {
-			query += " AND ac.gender != ?"
-			args = append(args, "M")
+	if params.categories != nil {
+		candidates := categoryCandidates(params.categories)
+		query += " AND (ac.unlimited_category OR EXISTS (SELECT 1 FROM condition_category AS cg" +
+			" WHERE cg.condition_id = ac.id AND cg.category IN (?" + strings.Repeat(", ?", len(candidates)-1) + ")))"
+		for _, candidate := range candidates {
+			args = append(args, candidate)
 		}
 	}
 
-	if params.country != "" {
-		query += " AND cc.country_code = ?"
-		args = append(args, params.country)
+	if params.audiences != nil {
+		if len(params.audiences) == 0 {
+			query += " AND ac.unlimited_audience"
+		} else {
+			in := " AND ca.audience_id IN (?" + strings.Repeat(", ?", len(params.audiences)-1) + ")"
+			query += " AND (ac.unlimited_audience OR EXISTS (SELECT 1 FROM condition_audience AS ca" +
+				" WHERE ca.condition_id = ac.id AND NOT ca.excluded" + in + "))" +
+				" AND NOT EXISTS (SELECT 1 FROM condition_audience AS ca WHERE ca.condition_id = ac.id AND ca.excluded" + in + ")"
+			for i := 0; i < 2; i++ {
+				for _, id := range params.audiences {
+					args = append(args, id)
+				}
+			}
+		}
 	}
 
-	if params.platform != "" {
-		query += " AND (platform & ?) = ?"
-		platformMask := platformMap[params.platform]
-		args = append(args, platformMask, platformMask)
+	if params.slots != nil {
+		clause, scheduleArgs := scheduleClause(params.slots)
+		if targeted {
+			query += " AND " + clause
+		} else {
+			query += " AND (ac.id IS NULL OR " + clause + ")"
+		}
+		args = append(args, scheduleArgs...)
 	}
 
-	query += " ORDER BY end_at ASC LIMIT ? OFFSET ?"
-	args = append(args, params.limit, params.offset)
+	return query, args
+}
+
+// buildQuery constructs a SQL query string and its corresponding arguments based on provided parameters.
+//
+// Advertisements are ordered by (end_at, id) and paged by keyset, so a page
+// starts right after params.cursor. One extra row is requested to tell
+// whether a next page exists.
+//
+// With keywords, advertisements are first ordered by score, the most
+// keywords any of their conditions includes, and the score is selected as a
+// fourth column.
+//
+// With expressions, exprColumns are selected last, and the rows returned
+// are candidates that listActiveAdvertisements still has to filter.
+func buildQuery(params listParams) (query string, args []interface{}) {
+	filter, filterArgs := buildFilter(params)
+
+	if params.keywords == nil {
+		if params.expressions {
+			query = "SELECT a.id, a.title, a.end_at, " + exprColumns + filter
+		} else {
+			query = "SELECT DISTINCT a.id, a.title, a.end_at" + filter
+		}
+		args = filterArgs
+		if params.cursor != nil {
+			query += " AND (a.end_at > ? OR (a.end_at = ? AND a.id > ?))"
+			args = append(args, params.cursor.endAt, params.cursor.endAt, params.cursor.id)
+		}
+		if params.expressions {
+			query += " GROUP BY a.id, a.title, a.end_at"
+		}
+		query += " ORDER BY a.end_at ASC, a.id ASC LIMIT ?"
+		args = append(args, params.limit+1)
+		return query, args
+	}
 
+	score, args := keywordSubquery("COUNT(*)", params.keywords, false)
+	query = "SELECT a.id, a.title, a.end_at, MAX((" + score + ")) AS score"
+	if params.expressions {
+		query += ", " + exprColumns
+	}
+	query += filter + " GROUP BY a.id, a.title, a.end_at"
+	args = append(args, filterArgs...)
+	if params.cursor != nil {
+		query += " HAVING score < ? OR (score = ? AND (a.end_at > ? OR (a.end_at = ? AND a.id > ?)))"
+		args = append(args, params.cursor.score, params.cursor.score,
+			params.cursor.endAt, params.cursor.endAt, params.cursor.id)
+	}
+	query += " ORDER BY score DESC, a.end_at ASC, a.id ASC LIMIT ?"
+	args = append(args, params.limit+1)
 	return query, args
 }
 
+// buildCountQuery constructs a SQL query counting every advertisement matching the filter.
+// With expressions, it selects exprColumns per candidate instead, which the
+// caller counts.
+func buildCountQuery(params listParams) (query string, args []interface{}) {
+	filter, args := buildFilter(params)
+	if params.expressions {
+		return "SELECT " + exprColumns + filter + " GROUP BY a.id", args
+	}
+	return "SELECT COUNT(DISTINCT a.id)" + filter, args
+}
+
 // Handler for listing active advertisements
 func ListActiveAdvertisements(c *gin.Context) {
-	// Parse parameters *******************************************************************
 	params, err := parseListParams(c)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	// Build query *******************************************************************
-	query, args := buildQuery(params)
-
-	// Execute query
-	db := dbpkg.GetDB()
-	rows, err := db.Queryx(query, args...)
+	page, err := listActiveAdvertisements(params)
 	if err != nil {
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch advertisements"})
+		c.JSON(errorResponse(err))
 		return
 	}
-	defer rows.Close()
 
-	// results
-	type retAd struct {
-		Title string    `json:"title"`
-		EndAt time.Time `json:"endAt"`
+	resp := gin.H{"items": page.Items}
+	if page.NextCursor != "" {
+		resp["nextCursor"] = page.NextCursor
 	}
-	var ads []retAd
-
-	for rows.Next() {
-		var ad retAd
-		var endAtStr string
-		err := rows.Scan(&ad.Title, &endAtStr)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse advertisement"})
-			return
-		}
-
-		ad.EndAt, err = time.Parse("2006-01-02 15:04:05", endAtStr)
-		if err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse endAt timestamp"})
-			return
-		}
-		ads = append(ads, ad)
+	if page.Total != nil {
+		resp["total"] = *page.Total
 	}
 
-	c.JSON(http.StatusOK, gin.H{"items": ads})
+	c.JSON(http.StatusOK, resp)
 }
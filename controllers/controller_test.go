@@ -5,13 +5,17 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"reflect"
+	"strings"
 	"testing"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	"github.com/jjshen2000/simple-ads/expr"
 	"github.com/jjshen2000/simple-ads/models"
 	"github.com/stretchr/testify/assert"
+	"golang.org/x/text/language"
 )
 
 func TestCreateAdvertisement(t *testing.T) {
@@ -166,6 +170,19 @@ func TestGetPlatformBits(t *testing.T) {
 	}
 }
 
+func TestGetPlatforms(t *testing.T) {
+	for _, platforms := range [][]string{nil, {"android"}, {"ios", "web"}, {"android", "ios"}} {
+		assert.Equal(t, platforms, getPlatforms(getPlatformBits(platforms)))
+	}
+}
+
+func TestGetDevices(t *testing.T) {
+	for _, devices := range [][]string{nil, {"phone"}, {"phone", "tablet"}, {"desktop", "tv"}} {
+		assert.Equal(t, devices, getDevices(getDeviceBits(devices)))
+	}
+	assert.Equal(t, uint8(15), getDeviceBits(nil))
+}
+
 func TestIsValidPlatform(t *testing.T) {
 	testCases := []struct {
 		name           string
@@ -198,15 +215,6 @@ func TestIsValidPlatform(t *testing.T) {
 }
 
 func TestParseListParams(t *testing.T) {
-	// type expected struct {
-	// 	offset   int
-	// 	limit    int
-	// 	age      int
-	// 	gender   string
-	// 	country  string
-	// 	platform string
-	// }
-
 	testCases := []struct {
 		name         string
 		queryParams  map[string]string
@@ -216,21 +224,22 @@ func TestParseListParams(t *testing.T) {
 		{
 			name: "ValidParams",
 			queryParams: map[string]string{
-				"offset":   "1",
-				"limit":    "5",
-				"age":      "20",
-				"gender":   "M",
-				"country":  "US",
-				"platform": "android",
+				"cursor":       encodeCursor(cursor{endAt: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC), id: 7}),
+				"limit":        "5",
+				"includeTotal": "true",
+				"age":          "20",
+				"gender":       "M",
+				"country":      "US",
+				"platform":     "android",
+				"at":           "2024-06-01T20:00:00+08:00",
 			},
 			expectedErr: "",
 			expectedData: listParams{
-				offset:   0,
-				limit:    5,
-				age:      20,
-				gender:   "M",
-				country:  "US",
-				platform: "android",
+				at:           time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC),
+				cursor:       &cursor{endAt: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC), id: 7},
+				limit:        5,
+				includeTotal: true,
+				targets:      targets{"age": 20, "gender": "M", "geo": geoTarget{country: "US"}, "platform": "android"},
 			},
 		},
 		{
@@ -238,36 +247,38 @@ func TestParseListParams(t *testing.T) {
 			queryParams: map[string]string{},
 			expectedErr: "",
 			expectedData: listParams{
-				offset:   0,
-				limit:    5,
-				age:      0,
-				gender:   "",
-				country:  "",
-				platform: "",
+				limit: 5,
 			},
 		},
 		{
-			name: "Invalid Offset",
+			name: "Invalid Cursor",
 			queryParams: map[string]string{
-				"offset":   "0",
+				"cursor":   "not-a-cursor",
 				"limit":    "5",
 				"age":      "20",
 				"gender":   "M",
 				"country":  "US",
 				"platform": "android",
 			},
-			expectedErr:  "invalid offset",
+			expectedErr:  "invalid cursor",
 			expectedData: listParams{},
 		},
 		{
 			name: "Invalid limit",
 			queryParams: map[string]string{
-				"offset": "1",
-				"limit":  "0",
+				"limit": "0",
 			},
 			expectedErr:  "invalid limit",
 			expectedData: listParams{},
 		},
+		{
+			name: "Invalid includeTotal",
+			queryParams: map[string]string{
+				"includeTotal": "maybe",
+			},
+			expectedErr:  "invalid includeTotal",
+			expectedData: listParams{},
+		},
 		{
 			name: "Invalid age(-1)",
 			queryParams: map[string]string{
@@ -284,6 +295,25 @@ func TestParseListParams(t *testing.T) {
 			expectedErr:  "invalid age",
 			expectedData: listParams{},
 		},
+		{
+			name: "Oldest age and other gender",
+			queryParams: map[string]string{
+				"age":    "120",
+				"gender": "O",
+			},
+			expectedData: listParams{
+				limit:   5,
+				targets: targets{"age": 120, "gender": "O"},
+			},
+		},
+		{
+			name: "Invalid age(121)",
+			queryParams: map[string]string{
+				"age": "121",
+			},
+			expectedErr:  "invalid age",
+			expectedData: listParams{},
+		},
 		{
 			name: "Invalid gender",
 			queryParams: map[string]string{
@@ -300,6 +330,14 @@ func TestParseListParams(t *testing.T) {
 			expectedErr:  "invalid country",
 			expectedData: listParams{},
 		},
+		{
+			name: "Alpha-3 country",
+			queryParams: map[string]string{
+				"country": "TWN",
+			},
+			expectedErr:  "invalid country",
+			expectedData: listParams{},
+		},
 		{
 			name: "Invalid platform",
 			queryParams: map[string]string{
@@ -308,6 +346,153 @@ func TestParseListParams(t *testing.T) {
 			expectedErr:  "invalid platform",
 			expectedData: listParams{},
 		},
+		{
+			name: "Invalid at",
+			queryParams: map[string]string{
+				"at": "2024-06-01 12:00:00",
+			},
+			expectedErr:  "invalid at",
+			expectedData: listParams{},
+		},
+		{
+			name: "Region implies country",
+			queryParams: map[string]string{
+				"region": "US-CA",
+				"city":   "5391959",
+			},
+			expectedData: listParams{
+				limit:   5,
+				targets: targets{"geo": geoTarget{country: "US", region: "US-CA", city: "5391959"}},
+			},
+		},
+		{
+			name: "Region outside country",
+			queryParams: map[string]string{
+				"country": "TW",
+				"region":  "US-CA",
+			},
+			expectedErr:  "invalid region",
+			expectedData: listParams{},
+		},
+		{
+			name: "Unknown region",
+			queryParams: map[string]string{
+				"region": "US-XX",
+			},
+			expectedErr:  "invalid region",
+			expectedData: listParams{},
+		},
+		{
+			name: "OS version and device",
+			queryParams: map[string]string{
+				"platform":  "ios",
+				"osVersion": "16.4",
+				"device":    "phone",
+			},
+			expectedData: listParams{
+				limit:     5,
+				targets:   targets{"platform": "ios"},
+				osVersion: 16004000,
+				device:    "phone",
+			},
+		},
+		{
+			name: "Invalid osVersion",
+			queryParams: map[string]string{
+				"osVersion": "sixteen",
+			},
+			expectedErr:  "invalid osVersion",
+			expectedData: listParams{},
+		},
+		{
+			name: "Invalid device",
+			queryParams: map[string]string{
+				"device": "watch",
+			},
+			expectedErr:  "invalid device",
+			expectedData: listParams{},
+		},
+		{
+			name: "Invalid city",
+			queryParams: map[string]string{
+				"city": "San Francisco",
+			},
+			expectedErr:  "invalid city",
+			expectedData: listParams{},
+		},
+		{
+			name: "Keywords and category",
+			queryParams: map[string]string{
+				"keywords": "Café, electric  vehicles,cafe",
+				"category": "IAB2,IAB3-1",
+			},
+			expectedData: listParams{
+				limit:      5,
+				keywords:   []string{"cafe", "electric vehicles"},
+				categories: []string{"IAB2", "IAB3-1"},
+			},
+		},
+		{
+			name: "Empty keywords",
+			queryParams: map[string]string{
+				"keywords": " , ",
+			},
+			expectedErr:  "invalid keywords",
+			expectedData: listParams{},
+		},
+		{
+			name: "User ID",
+			queryParams: map[string]string{
+				"userId": "customer-1",
+			},
+			expectedData: listParams{
+				limit:  5,
+				userID: "customer-1",
+			},
+		},
+		{
+			name: "Invalid userId",
+			queryParams: map[string]string{
+				"userId": strings.Repeat("x", 257),
+			},
+			expectedErr:  "invalid userId",
+			expectedData: listParams{},
+		},
+		{
+			name: "Key-value pairs",
+			queryParams: map[string]string{
+				"kv.app_version": "5.10",
+				"kv.tier":        "gold",
+			},
+			expectedData: listParams{
+				limit: 5,
+				kv:    expr.Env{"app_version": "5.10", "tier": "gold"},
+			},
+		},
+		{
+			name: "Invalid kv key",
+			queryParams: map[string]string{
+				"kv.app-version": "5.10",
+			},
+			expectedErr:  "invalid kv",
+			expectedData: listParams{},
+		},
+		{
+			name: "Too long kv value",
+			queryParams: map[string]string{
+				"kv.tier": strings.Repeat("x", 257),
+			},
+			expectedErr:  "invalid kv",
+			expectedData: listParams{},
+		},
+		{
+			name: "Invalid category",
+			queryParams: map[string]string{
+				"category": "IAB2,sports",
+			},
+			expectedErr:  "invalid category",
+			expectedData: listParams{},
+		},
 	}
 
 	// Iterate over test cases
@@ -338,6 +523,8 @@ func TestParseListParams(t *testing.T) {
 }
 
 func TestBuildQuery(t *testing.T) {
+	at := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+
 	testCases := []struct {
 		name         string
 		params       listParams
@@ -347,92 +534,266 @@ func TestBuildQuery(t *testing.T) {
 		{
 			name: "NoFilters",
 			params: listParams{
-				offset:   0,
-				limit:    10,
-				age:      0,
-				gender:   "",
-				country:  "",
-				platform: "",
+				at:    at,
+				limit: 10,
 			},
-			expectedSQL: `SELECT a.title, a.end_at FROM advertisement AS a
- WHERE NOW() < a.end_at AND NOW() > a.start_at ORDER BY end_at ASC LIMIT ? OFFSET ?`,
-			expectedArgs: []interface{}{10, 0},
+			expectedSQL: `SELECT DISTINCT a.id, a.title, a.end_at FROM advertisement AS a
+ WHERE a.status = 'approved' AND a.deleted_at IS NULL AND ? < a.end_at AND ? > a.start_at ORDER BY a.end_at ASC, a.id ASC LIMIT ?`,
+			expectedArgs: []interface{}{at, at, 11},
 		},
 		{
 			name: "Age 20",
 			params: listParams{
-				offset:   0,
-				limit:    10,
-				age:      20,
-				gender:   "",
-				country:  "",
-				platform: "",
-			},
-			expectedSQL: `SELECT a.title, a.end_at FROM advertisement AS a
+				at:      at,
+				limit:   10,
+				targets: targets{"age": 20},
+			},
+			expectedSQL: `SELECT DISTINCT a.id, a.title, a.end_at FROM advertisement AS a
  INNER JOIN advertisement_condition AS ac ON a.id = ac.advertisement_id
- WHERE NOW() < a.end_at AND NOW() > a.start_at AND ? BETWEEN ac.age_start AND ac.age_end ORDER BY end_at ASC LIMIT ? OFFSET ?`,
-			expectedArgs: []interface{}{20, 10, 0},
+ WHERE a.status = 'approved' AND a.deleted_at IS NULL AND ? < a.end_at AND ? > a.start_at AND ac.age_start <= ? AND (ac.age_end IS NULL OR ac.age_end >= ?) ORDER BY a.end_at ASC, a.id ASC LIMIT ?`,
+			expectedArgs: []interface{}{at, at, 20, 20, 11},
 		},
 		{
 			name: "gender F",
 			params: listParams{
-				offset:   0,
-				limit:    10,
-				age:      0,
-				gender:   "F",
-				country:  "",
-				platform: "",
-			},
-			expectedSQL: `SELECT a.title, a.end_at FROM advertisement AS a
+				at:      at,
+				limit:   10,
+				targets: targets{"gender": "F"},
+			},
+			expectedSQL: `SELECT DISTINCT a.id, a.title, a.end_at FROM advertisement AS a
  INNER JOIN advertisement_condition AS ac ON a.id = ac.advertisement_id
- WHERE NOW() < a.end_at AND NOW() > a.start_at AND ac.gender != ? ORDER BY end_at ASC LIMIT ? OFFSET ?`,
-			expectedArgs: []interface{}{"M", 10, 0},
+ WHERE a.status = 'approved' AND a.deleted_at IS NULL AND ? < a.end_at AND ? > a.start_at AND (ac.genders & ?) != 0 ORDER BY a.end_at ASC, a.id ASC LIMIT ?`,
+			expectedArgs: []interface{}{at, at, uint8(2), 11},
 		},
 		{
 			name: "gender M",
 			params: listParams{
-				offset:   0,
-				limit:    10,
-				age:      0,
-				gender:   "M",
-				country:  "",
-				platform: "",
-			},
-			expectedSQL: `SELECT a.title, a.end_at FROM advertisement AS a
+				at:      at,
+				limit:   10,
+				targets: targets{"gender": "M"},
+			},
+			expectedSQL: `SELECT DISTINCT a.id, a.title, a.end_at FROM advertisement AS a
  INNER JOIN advertisement_condition AS ac ON a.id = ac.advertisement_id
- WHERE NOW() < a.end_at AND NOW() > a.start_at AND ac.gender != ? ORDER BY end_at ASC LIMIT ? OFFSET ?`,
-			expectedArgs: []interface{}{"F", 10, 0},
+ WHERE a.status = 'approved' AND a.deleted_at IS NULL AND ? < a.end_at AND ? > a.start_at AND (ac.genders & ?) != 0 ORDER BY a.end_at ASC, a.id ASC LIMIT ?`,
+			expectedArgs: []interface{}{at, at, uint8(1), 11},
 		},
 		{
 			name: "country TW",
 			params: listParams{
-				offset:   0,
-				limit:    10,
-				age:      0,
-				gender:   "",
-				country:  "TW",
-				platform: "",
-			},
-			expectedSQL: `SELECT a.title, a.end_at FROM advertisement AS a
+				at:      at,
+				limit:   10,
+				targets: targets{"geo": geoTarget{country: "TW"}},
+			},
+			expectedSQL: `SELECT DISTINCT a.id, a.title, a.end_at FROM advertisement AS a
  INNER JOIN advertisement_condition AS ac ON a.id = ac.advertisement_id
- INNER JOIN condition_country AS cc ON ac.id = cc.condition_id
- WHERE NOW() < a.end_at AND NOW() > a.start_at AND cc.country_code = ? ORDER BY end_at ASC LIMIT ? OFFSET ?`,
-			expectedArgs: []interface{}{"TW", 10, 0},
+ WHERE a.status = 'approved' AND a.deleted_at IS NULL AND ? < a.end_at AND ? > a.start_at AND (ac.unlimited_country OR EXISTS (SELECT 1 FROM condition_country AS cc WHERE cc.condition_id = ac.id AND cc.country_code = ?)) ORDER BY a.end_at ASC, a.id ASC LIMIT ?`,
+			expectedArgs: []interface{}{at, at, "TW", 11},
+		},
+		{
+			name: "region and city",
+			params: listParams{
+				at:      at,
+				limit:   10,
+				targets: targets{"geo": geoTarget{country: "TW", region: "TW-TPE", city: "1668341"}},
+			},
+			expectedSQL: `SELECT DISTINCT a.id, a.title, a.end_at FROM advertisement AS a
+ INNER JOIN advertisement_condition AS ac ON a.id = ac.advertisement_id
+ WHERE a.status = 'approved' AND a.deleted_at IS NULL AND ? < a.end_at AND ? > a.start_at AND (ac.unlimited_country OR EXISTS (SELECT 1 FROM condition_country AS cc WHERE cc.condition_id = ac.id AND cc.country_code = ?) OR EXISTS (SELECT 1 FROM condition_region AS cr WHERE cr.condition_id = ac.id AND cr.region_code = ?) OR EXISTS (SELECT 1 FROM condition_city AS ci WHERE ci.condition_id = ac.id AND ci.city_id = ?)) ORDER BY a.end_at ASC, a.id ASC LIMIT ?`,
+			expectedArgs: []interface{}{at, at, "TW", "TW-TPE", "1668341", 11},
+		},
+		{
+			name: "city only",
+			params: listParams{
+				at:      at,
+				limit:   10,
+				targets: targets{"geo": geoTarget{city: "5391959"}},
+			},
+			expectedSQL: `SELECT DISTINCT a.id, a.title, a.end_at FROM advertisement AS a
+ INNER JOIN advertisement_condition AS ac ON a.id = ac.advertisement_id
+ WHERE a.status = 'approved' AND a.deleted_at IS NULL AND ? < a.end_at AND ? > a.start_at AND (ac.unlimited_country OR EXISTS (SELECT 1 FROM condition_city AS ci WHERE ci.condition_id = ac.id AND ci.city_id = ?)) ORDER BY a.end_at ASC, a.id ASC LIMIT ?`,
+			expectedArgs: []interface{}{at, at, "5391959", 11},
 		},
 		{
 			name: "platform ios",
 			params: listParams{
-				offset:   0,
-				limit:    10,
-				age:      0,
-				gender:   "",
-				country:  "",
-				platform: "ios",
-			},
-			expectedSQL: `SELECT a.title, a.end_at FROM advertisement AS a
+				at:      at,
+				limit:   10,
+				targets: targets{"platform": "ios"},
+			},
+			expectedSQL: `SELECT DISTINCT a.id, a.title, a.end_at FROM advertisement AS a
+ INNER JOIN advertisement_condition AS ac ON a.id = ac.advertisement_id
+ WHERE a.status = 'approved' AND a.deleted_at IS NULL AND ? < a.end_at AND ? > a.start_at AND (ac.platform & ?) = ? ORDER BY a.end_at ASC, a.id ASC LIMIT ?`,
+			expectedArgs: []interface{}{at, at, uint8(2), uint8(2), 11},
+		},
+		{
+			name: "os version and device",
+			params: listParams{
+				at:        at,
+				limit:     10,
+				osVersion: 16004001,
+				device:    "tablet",
+			},
+			expectedSQL: `SELECT DISTINCT a.id, a.title, a.end_at FROM advertisement AS a
+ INNER JOIN advertisement_condition AS ac ON a.id = ac.advertisement_id
+ WHERE a.status = 'approved' AND a.deleted_at IS NULL AND ? < a.end_at AND ? > a.start_at AND (ac.min_os_version IS NULL OR ac.min_os_version <= ?) AND (ac.max_os_version IS NULL OR ac.max_os_version >= ?) AND (ac.device & ?) = ? ORDER BY a.end_at ASC, a.id ASC LIMIT ?`,
+			expectedArgs: []interface{}{at, at, uint64(16004001), uint64(16004001), uint8(2), uint8(2), 11},
+		},
+		{
+			name: "languages",
+			params: listParams{
+				at:        at,
+				limit:     10,
+				languages: []language.Tag{language.MustParse("zh-TW")},
+			},
+			expectedSQL: `SELECT DISTINCT a.id, a.title, a.end_at FROM advertisement AS a
+ INNER JOIN advertisement_condition AS ac ON a.id = ac.advertisement_id
+ WHERE a.status = 'approved' AND a.deleted_at IS NULL AND ? < a.end_at AND ? > a.start_at AND (ac.unlimited_language OR EXISTS (SELECT 1 FROM condition_language AS cl WHERE cl.condition_id = ac.id AND cl.language_tag IN (?, ?, ?))) ORDER BY a.end_at ASC, a.id ASC LIMIT ?`,
+			expectedArgs: []interface{}{at, at, "zh-TW", "zh", "zh-Hant", 11},
+		},
+		{
+			name: "after cursor",
+			params: listParams{
+				at:     at,
+				cursor: &cursor{endAt: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC), id: 7},
+				limit:  10,
+			},
+			expectedSQL: `SELECT DISTINCT a.id, a.title, a.end_at FROM advertisement AS a
+ WHERE a.status = 'approved' AND a.deleted_at IS NULL AND ? < a.end_at AND ? > a.start_at AND (a.end_at > ? OR (a.end_at = ? AND a.id > ?)) ORDER BY a.end_at ASC, a.id ASC LIMIT ?`,
+			expectedArgs: []interface{}{
+				at,
+				at,
+				time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+				time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+				7,
+				11,
+			},
+		},
+		{
+			name: "scheduled",
+			params: listParams{
+				at:    at,
+				limit: 10,
+				slots: []localTime{{timezone: "Asia/Taipei", weekday: time.Monday, hour: 12}},
+			},
+			expectedSQL: `SELECT DISTINCT a.id, a.title, a.end_at FROM advertisement AS a
+ LEFT JOIN advertisement_condition AS ac ON a.id = ac.advertisement_id
+ WHERE a.status = 'approved' AND a.deleted_at IS NULL AND ? < a.end_at AND ? > a.start_at AND (ac.id IS NULL OR (ac.timezone IS NULL OR EXISTS (SELECT 1 FROM condition_schedule AS cs WHERE cs.condition_id = ac.id AND ((ac.timezone = ? AND (cs.days & ?) != 0 AND cs.start_hour <= ? AND cs.end_hour > ?))))) ORDER BY a.end_at ASC, a.id ASC LIMIT ?`,
+			expectedArgs: []interface{}{at, at, "Asia/Taipei", uint8(2), 12, 12, 11},
+		},
+		{
+			name: "scheduled with age",
+			params: listParams{
+				at:      at,
+				limit:   10,
+				targets: targets{"age": 20},
+				slots: []localTime{
+					{timezone: "Asia/Taipei", weekday: time.Saturday, hour: 0},
+					{timezone: "America/New_York", weekday: time.Friday, hour: 12},
+				},
+			},
+			expectedSQL: `SELECT DISTINCT a.id, a.title, a.end_at FROM advertisement AS a
+ INNER JOIN advertisement_condition AS ac ON a.id = ac.advertisement_id
+ WHERE a.status = 'approved' AND a.deleted_at IS NULL AND ? < a.end_at AND ? > a.start_at AND ac.age_start <= ? AND (ac.age_end IS NULL OR ac.age_end >= ?) AND (ac.timezone IS NULL OR EXISTS (SELECT 1 FROM condition_schedule AS cs WHERE cs.condition_id = ac.id AND ((ac.timezone = ? AND (cs.days & ?) != 0 AND cs.start_hour <= ? AND cs.end_hour > ?) OR (ac.timezone = ? AND (cs.days & ?) != 0 AND cs.start_hour <= ? AND cs.end_hour > ?)))) ORDER BY a.end_at ASC, a.id ASC LIMIT ?`,
+			expectedArgs: []interface{}{at, at, 20, 20, "Asia/Taipei", uint8(64), 0, 0, "America/New_York", uint8(32), 12, 12, 11},
+		},
+		{
+			name: "user in no audience",
+			params: listParams{
+				at:        at,
+				limit:     10,
+				audiences: []int{},
+			},
+			expectedSQL: `SELECT DISTINCT a.id, a.title, a.end_at FROM advertisement AS a
+ INNER JOIN advertisement_condition AS ac ON a.id = ac.advertisement_id
+ WHERE a.status = 'approved' AND a.deleted_at IS NULL AND ? < a.end_at AND ? > a.start_at AND ac.unlimited_audience ORDER BY a.end_at ASC, a.id ASC LIMIT ?`,
+			expectedArgs: []interface{}{at, at, 11},
+		},
+		{
+			name: "user in audiences",
+			params: listParams{
+				at:        at,
+				limit:     10,
+				audiences: []int{3, 8},
+			},
+			expectedSQL: `SELECT DISTINCT a.id, a.title, a.end_at FROM advertisement AS a
  INNER JOIN advertisement_condition AS ac ON a.id = ac.advertisement_id
- WHERE NOW() < a.end_at AND NOW() > a.start_at AND (platform & ?) = ? ORDER BY end_at ASC LIMIT ? OFFSET ?`,
-			expectedArgs: []interface{}{uint8(2), uint8(2), 10, 0},
+ WHERE a.status = 'approved' AND a.deleted_at IS NULL AND ? < a.end_at AND ? > a.start_at AND (ac.unlimited_audience OR EXISTS (SELECT 1 FROM condition_audience AS ca WHERE ca.condition_id = ac.id AND NOT ca.excluded AND ca.audience_id IN (?, ?))) AND NOT EXISTS (SELECT 1 FROM condition_audience AS ca WHERE ca.condition_id = ac.id AND ca.excluded AND ca.audience_id IN (?, ?)) ORDER BY a.end_at ASC, a.id ASC LIMIT ?`,
+			expectedArgs: []interface{}{at, at, 3, 8, 3, 8, 11},
+		},
+		{
+			name: "expressions",
+			params: listParams{
+				at:          at,
+				limit:       10,
+				expressions: true,
+			},
+			expectedSQL: `SELECT a.id, a.title, a.end_at, MAX(ac.id IS NULL OR ac.expr IS NULL), GROUP_CONCAT(IF(ac.expr IS NULL, NULL, ac.id)) FROM advertisement AS a
+ LEFT JOIN advertisement_condition AS ac ON a.id = ac.advertisement_id
+ WHERE a.status = 'approved' AND a.deleted_at IS NULL AND ? < a.end_at AND ? > a.start_at GROUP BY a.id, a.title, a.end_at ORDER BY a.end_at ASC, a.id ASC LIMIT ?`,
+			expectedArgs: []interface{}{at, at, 11},
+		},
+		{
+			name: "expressions with age",
+			params: listParams{
+				at:          at,
+				limit:       10,
+				targets:     targets{"age": 20},
+				expressions: true,
+			},
+			expectedSQL: `SELECT a.id, a.title, a.end_at, MAX(ac.id IS NULL OR ac.expr IS NULL), GROUP_CONCAT(IF(ac.expr IS NULL, NULL, ac.id)) FROM advertisement AS a
+ INNER JOIN advertisement_condition AS ac ON a.id = ac.advertisement_id
+ WHERE a.status = 'approved' AND a.deleted_at IS NULL AND ? < a.end_at AND ? > a.start_at AND ac.age_start <= ? AND (ac.age_end IS NULL OR ac.age_end >= ?) GROUP BY a.id, a.title, a.end_at ORDER BY a.end_at ASC, a.id ASC LIMIT ?`,
+			expectedArgs: []interface{}{at, at, 20, 20, 11},
+		},
+		{
+			name: "unknown age and gender only match untargeted conditions",
+			params: listParams{
+				at:      at,
+				limit:   10,
+				unknown: []string{"age", "gender"},
+			},
+			expectedSQL: `SELECT DISTINCT a.id, a.title, a.end_at FROM advertisement AS a
+ LEFT JOIN advertisement_condition AS ac ON a.id = ac.advertisement_id
+ WHERE a.status = 'approved' AND a.deleted_at IS NULL AND ? < a.end_at AND ? > a.start_at AND (ac.id IS NULL OR ac.age_start <= 1 AND ac.age_end IS NULL AND ac.genders = 7) ORDER BY a.end_at ASC, a.id ASC LIMIT ?`,
+			expectedArgs: []interface{}{at, at, 11},
+		},
+		{
+			name: "unknown age with gender",
+			params: listParams{
+				at:      at,
+				limit:   10,
+				targets: targets{"gender": "O"},
+				unknown: []string{"age"},
+			},
+			expectedSQL: `SELECT DISTINCT a.id, a.title, a.end_at FROM advertisement AS a
+ INNER JOIN advertisement_condition AS ac ON a.id = ac.advertisement_id
+ WHERE a.status = 'approved' AND a.deleted_at IS NULL AND ? < a.end_at AND ? > a.start_at AND (ac.genders & ?) != 0 AND ac.age_start <= 1 AND ac.age_end IS NULL ORDER BY a.end_at ASC, a.id ASC LIMIT ?`,
+			expectedArgs: []interface{}{at, at, uint8(4), 11},
+		},
+		{
+			name: "keywords and category after cursor",
+			params: listParams{
+				at:         at,
+				cursor:     &cursor{endAt: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC), id: 7, score: 2},
+				limit:      10,
+				keywords:   []string{"sedan", "suv"},
+				categories: []string{"IAB2-2"},
+			},
+			expectedSQL: `SELECT a.id, a.title, a.end_at, MAX((SELECT COUNT(*) FROM condition_keyword AS ck WHERE ck.condition_id = ac.id AND NOT ck.excluded AND ck.normalized IN (?, ?))) AS score FROM advertisement AS a
+ INNER JOIN advertisement_condition AS ac ON a.id = ac.advertisement_id
+ WHERE a.status = 'approved' AND a.deleted_at IS NULL AND ? < a.end_at AND ? > a.start_at AND (ac.unlimited_keyword OR EXISTS (SELECT 1 FROM condition_keyword AS ck WHERE ck.condition_id = ac.id AND NOT ck.excluded AND ck.normalized IN (?, ?))) AND NOT EXISTS (SELECT 1 FROM condition_keyword AS ck WHERE ck.condition_id = ac.id AND ck.excluded AND ck.normalized IN (?, ?)) AND (ac.unlimited_category OR EXISTS (SELECT 1 FROM condition_category AS cg WHERE cg.condition_id = ac.id AND cg.category IN (?, ?))) GROUP BY a.id, a.title, a.end_at HAVING score < ? OR (score = ? AND (a.end_at > ? OR (a.end_at = ? AND a.id > ?))) ORDER BY score DESC, a.end_at ASC, a.id ASC LIMIT ?`,
+			expectedArgs: []interface{}{
+				"sedan", "suv",
+				at, at,
+				"sedan", "suv",
+				"sedan", "suv",
+				"IAB2-2", "IAB2",
+				2, 2,
+				time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+				time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+				7,
+				11,
+			},
 		},
 	}
 
@@ -449,6 +810,181 @@ func TestBuildQuery(t *testing.T) {
 	}
 }
 
+func TestBuildCountQuery(t *testing.T) {
+	at := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	params := listParams{
+		at:      at,
+		cursor:  &cursor{endAt: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC), id: 7},
+		limit:   10,
+		targets: targets{"geo": geoTarget{country: "TW"}},
+	}
+
+	query, args := buildCountQuery(params)
+
+	assert.Equal(t, `SELECT COUNT(DISTINCT a.id) FROM advertisement AS a
+ INNER JOIN advertisement_condition AS ac ON a.id = ac.advertisement_id
+ WHERE a.status = 'approved' AND a.deleted_at IS NULL AND ? < a.end_at AND ? > a.start_at AND (ac.unlimited_country OR EXISTS (SELECT 1 FROM condition_country AS cc WHERE cc.condition_id = ac.id AND cc.country_code = ?))`, query)
+	assert.Equal(t, []interface{}{at, at, "TW"}, args)
+
+	params.expressions = true
+	query, args = buildCountQuery(params)
+
+	assert.Equal(t, `SELECT MAX(ac.id IS NULL OR ac.expr IS NULL), GROUP_CONCAT(IF(ac.expr IS NULL, NULL, ac.id)) FROM advertisement AS a
+ INNER JOIN advertisement_condition AS ac ON a.id = ac.advertisement_id
+ WHERE a.status = 'approved' AND a.deleted_at IS NULL AND ? < a.end_at AND ? > a.start_at AND (ac.unlimited_country OR EXISTS (SELECT 1 FROM condition_country AS cc WHERE cc.condition_id = ac.id AND cc.country_code = ?)) GROUP BY a.id`, query)
+	assert.Equal(t, []interface{}{at, at, "TW"}, args)
+}
+
+func TestLocalTimes(t *testing.T) {
+	timezones := []string{"America/New_York", "Asia/Taipei", "Invalid/Zone"}
+
+	testCases := []struct {
+		name     string
+		now      time.Time
+		expected []localTime
+	}{
+		{
+			// 01:59 EST, the last minute before clocks spring forward.
+			name: "Before spring forward",
+			now:  time.Date(2024, 3, 10, 6, 59, 0, 0, time.UTC),
+			expected: []localTime{
+				{timezone: "America/New_York", weekday: time.Sunday, hour: 1},
+				{timezone: "Asia/Taipei", weekday: time.Sunday, hour: 14},
+			},
+		},
+		{
+			// 03:00 EDT, 02:00 does not exist on this day.
+			name: "After spring forward",
+			now:  time.Date(2024, 3, 10, 7, 0, 0, 0, time.UTC),
+			expected: []localTime{
+				{timezone: "America/New_York", weekday: time.Sunday, hour: 3},
+				{timezone: "Asia/Taipei", weekday: time.Sunday, hour: 15},
+			},
+		},
+		{
+			// 01:30 EST, the second 01:30 after clocks fall back.
+			name: "After fall back",
+			now:  time.Date(2024, 11, 3, 6, 30, 0, 0, time.UTC),
+			expected: []localTime{
+				{timezone: "America/New_York", weekday: time.Sunday, hour: 1},
+				{timezone: "Asia/Taipei", weekday: time.Sunday, hour: 14},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, localTimes(tc.now, timezones))
+		})
+	}
+	assert.Nil(t, localTimes(time.Now(), nil))
+}
+
+// newYorkMeals is a schedule of weekday lunches and dinners, and of early
+// Sundays, in New York.
+var newYorkMeals = models.Schedule{
+	Timezone: "America/New_York",
+	Windows: []models.Window{
+		{Days: []string{"mon", "tue", "wed", "thu", "fri"}, StartHour: 11, EndHour: 14},
+		{Days: []string{"mon", "tue", "wed", "thu", "fri"}, StartHour: 17, EndHour: 21},
+		{Days: []string{"sun"}, StartHour: 1, EndHour: 3},
+	},
+}
+
+// scheduleCases are instants around DST changes in New York, with whether
+// newYorkMeals covers them and the local time a schedule is matched at.
+var scheduleCases = []struct {
+	name    string
+	at      time.Time
+	active  bool
+	weekday time.Weekday
+	hour    int
+}{
+	{"Weekday lunch in EST", time.Date(2024, 1, 15, 16, 0, 0, 0, time.UTC), true, time.Monday, 11},
+	{"Weekday lunch in EDT", time.Date(2024, 7, 15, 15, 0, 0, 0, time.UTC), true, time.Monday, 11},
+	// 16:00 UTC is 12:00 EDT but 11:00 EST; two hours later it is 14:00 EDT.
+	{"After lunch in EDT", time.Date(2024, 7, 15, 18, 0, 0, 0, time.UTC), false, time.Monday, 14},
+	{"Between meals", time.Date(2024, 1, 15, 20, 0, 0, 0, time.UTC), false, time.Monday, 15},
+	{"Weekend lunch", time.Date(2024, 1, 13, 16, 0, 0, 0, time.UTC), false, time.Saturday, 11},
+	// Friday 20:30 EST is already Saturday in UTC.
+	{"Friday dinner across UTC midnight", time.Date(2024, 1, 20, 1, 30, 0, 0, time.UTC), true, time.Friday, 20},
+	// 01:59 EST, just before clocks spring forward to 03:00 EDT.
+	{"Before spring forward", time.Date(2024, 3, 10, 6, 59, 0, 0, time.UTC), true, time.Sunday, 1},
+	{"After spring forward", time.Date(2024, 3, 10, 7, 0, 0, 0, time.UTC), false, time.Sunday, 3},
+	// 01:30 occurs twice when clocks fall back; both are in the window.
+	{"First 01:30 when falling back", time.Date(2024, 11, 3, 5, 30, 0, 0, time.UTC), true, time.Sunday, 1},
+	{"Second 01:30 when falling back", time.Date(2024, 11, 3, 6, 30, 0, 0, time.UTC), true, time.Sunday, 1},
+	{"03:00 EST after falling back", time.Date(2024, 11, 3, 8, 0, 0, 0, time.UTC), false, time.Sunday, 3},
+}
+
+func TestScheduleClauseDST(t *testing.T) {
+	for _, tc := range scheduleCases {
+		t.Run(tc.name, func(t *testing.T) {
+			_, args := scheduleClause(localTimes(tc.at, []string{newYorkMeals.Timezone}))
+			assert.Equal(t, []interface{}{newYorkMeals.Timezone, uint8(1) << tc.weekday, tc.hour, tc.hour}, args)
+		})
+	}
+}
+
+func TestScheduledAdvertisements(t *testing.T) {
+	schedule := newYorkMeals
+	id, err := createAdvertisement(testOrigin, models.Advertisement{
+		Title:      "AD on schedule",
+		StartAt:    time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		EndAt:      time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC),
+		Conditions: []models.Conditions{{Schedule: &schedule}},
+	})
+	assert.NoError(t, err)
+	defer deleteAdvertisement(testOrigin, int(id))
+	approveAdvertisement(t, int(id))
+
+	for _, tc := range scheduleCases {
+		t.Run(tc.name, func(t *testing.T) {
+			params, err := parseListQuery(url.Values{"limit": {"100"}, "at": {tc.at.Format(time.RFC3339)}})
+			assert.NoError(t, err)
+
+			page, err := listActiveAdvertisements(params)
+			assert.NoError(t, err)
+
+			found := false
+			for _, ad := range page.Items {
+				found = found || ad.ID == int(id)
+			}
+			assert.Equal(t, tc.active, found)
+		})
+	}
+}
+
+func TestParseWindows(t *testing.T) {
+	windows, err := parseWindows("62:11-14,62:17-21,65:10-22")
+	assert.NoError(t, err)
+	assert.Equal(t, []models.Window{
+		{Days: []string{"mon", "tue", "wed", "thu", "fri"}, StartHour: 11, EndHour: 14},
+		{Days: []string{"mon", "tue", "wed", "thu", "fri"}, StartHour: 17, EndHour: 21},
+		{Days: []string{"sun", "sat"}, StartHour: 10, EndHour: 22},
+	}, windows)
+
+	_, err = parseWindows("62:11")
+	assert.Error(t, err)
+}
+
+func TestCursor(t *testing.T) {
+	for _, c := range []cursor{
+		{endAt: time.Date(2024, 12, 31, 16, 0, 0, 0, time.UTC), id: 42},
+		{endAt: time.Date(2024, 12, 31, 16, 0, 0, 0, time.UTC), id: 42, score: 3},
+	} {
+		decoded, err := decodeCursor(encodeCursor(c))
+		assert.NoError(t, err)
+		assert.Equal(t, c, decoded)
+	}
+
+	// "123:1:0" and "123:1:2:3" are malformed too.
+	for _, token := range []string{"", "!!", "MTIz", "YWJjOjE", "MTIzOjA", "MTIzOjE6MA", "MTIzOjE6Mjoz"} {
+		_, err := decodeCursor(token)
+		assert.ErrorIs(t, err, errInvalidCursor, token)
+	}
+}
+
 func TestListActiveAdvertisements(t *testing.T) {
 	testCases := []struct {
 		name       string
@@ -463,8 +999,8 @@ func TestListActiveAdvertisements(t *testing.T) {
 			response:   `{"items":null}`,
 		},
 		{
-			name:       "Invalid offset",
-			request:    "?offset=0",
+			name:       "Invalid cursor",
+			request:    "?cursor=abc",
 			statusCode: http.StatusBadRequest,
 			response:   "",
 		},
@@ -474,6 +1010,12 @@ func TestListActiveAdvertisements(t *testing.T) {
 			statusCode: http.StatusBadRequest,
 			response:   "",
 		},
+		{
+			name:       "Invalid at",
+			request:    "?at=tomorrow",
+			statusCode: http.StatusBadRequest,
+			response:   `{"error":"invalid at"}`,
+		},
 	}
 
 	gin.SetMode(gin.TestMode)
@@ -499,3 +1041,175 @@ func TestListActiveAdvertisements(t *testing.T) {
 		})
 	}
 }
+
+func TestListActiveAdvertisementsAt(t *testing.T) {
+	pinned := time.Date(2031, 1, 1, 0, 0, 0, 0, time.UTC)
+	defer func(restore func() time.Time) { now = restore }(now)
+	now = func() time.Time { return pinned }
+
+	taipei := time.FixedZone("UTC+8", 8*60*60)
+	id, err := createAdvertisement(testOrigin, models.Advertisement{
+		Title:   "AD at 2031",
+		StartAt: pinned.Add(-time.Hour).In(taipei),
+		EndAt:   pinned.Add(time.Hour).In(taipei),
+	})
+	assert.NoError(t, err)
+	defer deleteAdvertisement(testOrigin, int(id))
+	approveAdvertisement(t, int(id))
+
+	testCases := []struct {
+		name   string
+		at     string
+		active bool
+	}{
+		{name: "Pinned clock", at: "", active: true},
+		{name: "Same instant in another zone", at: "2031-01-01T08:30:00+08:00", active: true},
+		{name: "After endAt", at: "2031-01-01T01:00:00Z", active: false},
+		{name: "Before startAt", at: "2030-12-31T22:59:59Z", active: false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			params, err := parseListQuery(url.Values{"limit": {"100"}, "at": {tc.at}})
+			assert.NoError(t, err)
+
+			page, err := listActiveAdvertisements(params)
+			assert.NoError(t, err)
+
+			found := false
+			for _, ad := range page.Items {
+				if ad.ID == int(id) {
+					found = true
+					assert.True(t, pinned.Add(time.Hour).Equal(ad.EndAt))
+				}
+			}
+			assert.Equal(t, tc.active, found)
+		})
+	}
+}
+
+func TestImportAdvertisements(t *testing.T) {
+	testCases := []struct {
+		name        string
+		request     string
+		contentType string
+		payload     string
+		statusCode  int
+		response    string
+	}{
+		{
+			name:        "Unsupported content type",
+			contentType: "application/json",
+			payload:     `{}`,
+			statusCode:  http.StatusUnsupportedMediaType,
+		},
+		{
+			name:        "Invalid mode",
+			request:     "?mode=some",
+			contentType: "application/x-ndjson",
+			statusCode:  http.StatusBadRequest,
+			response:    `{"error":"invalid mode"}`,
+		},
+		{
+			name:        "Atomic with invalid line",
+			contentType: "application/x-ndjson",
+			payload: `{"title":"AD 1","startAt":"2023-12-10T03:00:00Z","endAt":"2024-12-31T16:00:00Z"}
+{"startAt":"2023-12-10T03:00:00Z","endAt":"2024-12-31T16:00:00Z"}
+`,
+			statusCode: http.StatusBadRequest,
+			response:   `{"mode":"atomic","created":0,"failed":1,"errors":[{"line":2,"error":"Key: 'Advertisement.Title' Error:Field validation for 'Title' failed on the 'required' tag"}]}`,
+		},
+		{
+			name:        "Best effort CSV",
+			request:     "?mode=bestEffort",
+			contentType: "text/csv",
+			payload: `title,startAt,endAt,conditions
+AD 1,2023-12-10T03:00:00Z,2024-12-31T16:00:00Z,"[{""country"":[""TW""]}]"
+AD 2,2024-12-31T16:00:00Z,2023-12-10T03:00:00Z,
+`,
+			statusCode: http.StatusOK,
+			response:   `{"mode":"bestEffort","created":1,"failed":1,"errors":[{"line":3,"error":"Key: 'Advertisement.EndAt' Error:Field validation for 'EndAt' failed on the 'gtfield' tag"}]}`,
+		},
+	}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+
+	router.POST("/api/v1/ad/bulk", ImportAdvertisements)
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req, err := http.NewRequest("POST", "/api/v1/ad/bulk"+tc.request, bytes.NewReader([]byte(tc.payload)))
+			assert.NoError(t, err)
+			req.Header.Set("Content-Type", tc.contentType)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tc.statusCode, w.Code)
+
+			if tc.response != "" {
+				assert.Equal(t, tc.response, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestAdvertisementByID(t *testing.T) {
+	testCases := []struct {
+		name       string
+		method     string
+		path       string
+		statusCode int
+		response   string
+	}{
+		{
+			name:       "Get invalid id",
+			method:     "GET",
+			path:       "/api/v1/ad/abc",
+			statusCode: http.StatusBadRequest,
+			response:   `{"error":"invalid id"}`,
+		},
+		{
+			name:       "Get missing",
+			method:     "GET",
+			path:       "/api/v1/ad/2147483647",
+			statusCode: http.StatusNotFound,
+			response:   `{"error":"advertisement not found"}`,
+		},
+		{
+			name:       "Update invalid id",
+			method:     "PUT",
+			path:       "/api/v1/ad/0",
+			statusCode: http.StatusBadRequest,
+			response:   `{"error":"invalid id"}`,
+		},
+		{
+			name:       "Delete missing",
+			method:     "DELETE",
+			path:       "/api/v1/ad/2147483647",
+			statusCode: http.StatusNotFound,
+			response:   `{"error":"advertisement not found"}`,
+		},
+	}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+
+	router.GET("/api/v1/ad/:id", GetAdvertisement)
+	router.PUT("/api/v1/ad/:id", UpdateAdvertisement)
+	router.DELETE("/api/v1/ad/:id", DeleteAdvertisement)
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req, err := http.NewRequest(tc.method, tc.path, http.NoBody)
+			assert.NoError(t, err)
+
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tc.statusCode, w.Code)
+			assert.Equal(t, tc.response, w.Body.String())
+		})
+	}
+}
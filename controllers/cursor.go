@@ -0,0 +1,62 @@
+package controller
+
+import (
+	"encoding/base64"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cursor marks the last advertisement of a page. Pages are ordered by
+// (end_at, id), or (score DESC, end_at, id) when listing by keywords, so the
+// next page starts right after this position.
+type cursor struct {
+	endAt time.Time
+	id    int
+	score int
+}
+
+var errInvalidCursor = errors.New("invalid cursor")
+
+// encodeCursor returns an opaque token for the given position.
+func encodeCursor(c cursor) string {
+	raw := strconv.FormatInt(c.endAt.Unix(), 10) + ":" + strconv.Itoa(c.id)
+	if c.score != 0 {
+		raw += ":" + strconv.Itoa(c.score)
+	}
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// decodeCursor parses a token produced by encodeCursor.
+func decodeCursor(token string) (c cursor, err error) {
+	raw, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return c, errInvalidCursor
+	}
+
+	parts := strings.Split(string(raw), ":")
+	if len(parts) != 2 && len(parts) != 3 {
+		return c, errInvalidCursor
+	}
+
+	sec, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return c, errInvalidCursor
+	}
+
+	c.id, err = strconv.Atoi(parts[1])
+	if err != nil || c.id < 1 {
+		return c, errInvalidCursor
+	}
+
+	if len(parts) == 3 {
+		c.score, err = strconv.Atoi(parts[2])
+		if err != nil || c.score < 1 {
+			return c, errInvalidCursor
+		}
+	}
+
+	c.endAt = time.Unix(sec, 0).UTC()
+	return c, nil
+}
@@ -0,0 +1,54 @@
+package controller
+
+import (
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/jjshen2000/simple-ads/models"
+	"github.com/jjshen2000/simple-ads/useragent"
+)
+
+// clientHints lists the request headers the device is inferred from.
+const clientHints = "Sec-CH-UA-Platform, Sec-CH-UA-Platform-Version, Sec-CH-UA-Mobile"
+
+// detectDevice fills the platform, osVersion and device parameters of q from
+// the User-Agent and client hints headers, unless the caller set any of them
+// or passed inferDevice=false.
+func detectDevice(c *gin.Context, q url.Values) error {
+	infer, err := strconv.ParseBool(defaultQuery(q, "inferDevice", "true"))
+	if err != nil {
+		return errors.New("invalid inferDevice")
+	}
+	if !infer || q.Get("platform") != "" || q.Get("osVersion") != "" || q.Get("device") != "" {
+		return nil
+	}
+
+	// Ask browsers for the high entropy hints on later requests.
+	c.Header("Accept-CH", clientHints)
+	c.Writer.Header().Add("Vary", "User-Agent, "+clientHints)
+
+	info := useragent.FromHeader(c.Request.Header)
+	if info.Platform != "" {
+		q.Set("platform", info.Platform)
+	}
+	if version := truncateVersion(info.OSVersion); models.IsValidOSVersion(version) {
+		q.Set("osVersion", version)
+	}
+	if info.Device != "" {
+		q.Set("device", string(info.Device))
+	}
+	return nil
+}
+
+// truncateVersion keeps the major, minor and patch components of version.
+func truncateVersion(version string) string {
+	parts := strings.SplitN(version, ".", 4)
+	if len(parts) > 3 {
+		parts = parts[:3]
+	}
+	return strings.Join(parts, ".")
+}
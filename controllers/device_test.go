@@ -0,0 +1,72 @@
+package controller
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseListParamsDevice(t *testing.T) {
+	const iPhone = "Mozilla/5.0 (iPhone; CPU iPhone OS 17_1_2 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.1.2 Mobile/15E148 Safari/604.1"
+
+	testCases := []struct {
+		name            string
+		query           string
+		header          map[string]string
+		expectPlatform  string
+		expectOSVersion uint64
+		expectDevice    string
+		expectErr       string
+		expectAcceptCH  bool
+	}{
+		{name: "User-Agent", header: map[string]string{"User-Agent": iPhone}, expectPlatform: "ios", expectOSVersion: 17001002, expectDevice: "phone", expectAcceptCH: true},
+		{
+			name: "Client hints",
+			header: map[string]string{
+				"User-Agent":                 "Mozilla/5.0 (Linux; Android 10; K) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Mobile Safari/537.36",
+				"Sec-CH-UA-Platform":         `"Android"`,
+				"Sec-CH-UA-Platform-Version": `"14.0.0"`,
+				"Sec-CH-UA-Mobile":           "?0",
+			},
+			expectPlatform:  "android",
+			expectOSVersion: 14000000,
+			expectDevice:    "tablet",
+			expectAcceptCH:  true,
+		},
+		{name: "Desktop", header: map[string]string{"User-Agent": "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36"}, expectPlatform: "web", expectOSVersion: 10000000, expectDevice: "desktop", expectAcceptCH: true},
+		{name: "Crawler", header: map[string]string{"User-Agent": "Mozilla/5.0 (compatible; bingbot/2.0; +http://www.bing.com/bingbot.htm)"}, expectAcceptCH: true},
+		{name: "No header", expectAcceptCH: true},
+		{name: "Explicit platform", query: "platform=android", header: map[string]string{"User-Agent": iPhone}, expectPlatform: "android"},
+		{name: "Explicit device", query: "device=tablet", header: map[string]string{"User-Agent": iPhone}, expectDevice: "tablet"},
+		{name: "Disabled", query: "inferDevice=false", header: map[string]string{"User-Agent": iPhone}},
+		{name: "Invalid inferDevice", query: "inferDevice=maybe", header: map[string]string{"User-Agent": iPhone}, expectErr: "invalid inferDevice"},
+	}
+
+	gin.SetMode(gin.TestMode)
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodGet, "/api/v1/ad?"+tc.query, nil)
+			for key, value := range tc.header {
+				c.Request.Header.Set(key, value)
+			}
+
+			params, err := parseListParams(c)
+			if tc.expectErr != "" {
+				assert.EqualError(t, err, tc.expectErr)
+				return
+			}
+			assert.NoError(t, err)
+			platform, _ := params.targets["platform"].(string)
+			assert.Equal(t, tc.expectPlatform, platform)
+			assert.Equal(t, tc.expectOSVersion, params.osVersion)
+			assert.Equal(t, tc.expectDevice, params.device)
+			assert.Equal(t, tc.expectAcceptCH, w.Header().Get("Accept-CH") != "")
+		})
+	}
+}
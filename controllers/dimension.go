@@ -0,0 +1,241 @@
+package controller
+
+import (
+	"database/sql"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+
+	"github.com/jjshen2000/simple-ads/models"
+)
+
+// A dimension targets conditions by one attribute of the request, such as
+// the age of the user. Each dimension lives in a file of its own and
+// registers itself from init with registerDimension; the handlers, the
+// storage of conditions and buildFilter go through the registry.
+//
+// A dimension reads its configuration from fields of models.Conditions and
+// stores it in columns of advertisement_condition, or in tables of its own
+// by implementing indexer.
+type dimension interface {
+	// name identifies the dimension in listParams.targets.
+	name() string
+	// parse returns the value the request targets from its query
+	// parameters, nil when it does not target the dimension.
+	parse(q url.Values) (interface{}, error)
+	// validate checks the configuration of condition beyond its struct tags.
+	validate(condition models.Conditions) error
+	// columns returns the advertisement_condition columns storing condition.
+	columns(condition models.Conditions) []column
+	// selects returns the expressions over ac reading the configuration
+	// back, which load sets on condition.
+	selects() []string
+	load(condition *models.Conditions, values []sql.NullString) error
+	// match returns the clause over ac a condition must satisfy for the value
+	// returned by parse.
+	match(value interface{}) (clause string, args []interface{})
+	// untargeted returns the clause over ac of conditions not targeting the
+	// dimension, which requests leaving it unknown match under the
+	// untargeted policy.
+	untargeted() string
+}
+
+// An indexer is a dimension storing the values a condition targets in
+// tables keyed by condition_id, so that match looks them up.
+type indexer interface {
+	dimension
+	// tables lists the tables, which are emptied with the conditions.
+	tables() []string
+	index(tx *sqlx.Tx, conditionID int64, condition models.Conditions) error
+}
+
+// column is a column of advertisement_condition and its value.
+type column struct {
+	name  string
+	value interface{}
+}
+
+// dimensions holds the registered dimensions. Their clauses are applied in
+// registration order, the order of their files.
+var dimensions []dimension
+
+func registerDimension(d dimension) {
+	for _, registered := range dimensions {
+		if registered.name() == d.name() {
+			panic("dimension registered twice: " + d.name())
+		}
+	}
+	dimensions = append(dimensions, d)
+}
+
+// Policies for dimensions a request leaves unknown, such as a request
+// without age.
+const (
+	// unknownMatchAll matches every condition, as if the request did not
+	// care about the dimension.
+	unknownMatchAll = "matchAll"
+	// unknownUntargeted only matches conditions not targeting the dimension.
+	unknownUntargeted = "untargeted"
+)
+
+// unknownPolicy holds the policy of each dimension by name; matchAll when absent.
+var unknownPolicy = map[string]string{}
+
+// SetUnknownPolicy sets the policy of requests leaving dimensions unknown,
+// "matchAll" or "untargeted" by dimension name.
+func SetUnknownPolicy(policy map[string]string) error {
+	names := map[string]bool{}
+	for _, d := range dimensions {
+		names[d.name()] = true
+	}
+	for name, p := range policy {
+		if !names[name] {
+			return fmt.Errorf("unknown dimension %q", name)
+		}
+		if p != unknownMatchAll && p != unknownUntargeted {
+			return fmt.Errorf("invalid policy %q for %s", p, name)
+		}
+	}
+	unknownPolicy = policy
+	return nil
+}
+
+// targets holds the values parsed by each dimension the request targets, by name.
+type targets map[string]interface{}
+
+// parseTargets parses the value of every dimension from q. It also returns
+// the names of the dimensions q leaves unknown whose policy is untargeted.
+func parseTargets(q url.Values) (t targets, unknown []string, err error) {
+	for _, d := range dimensions {
+		value, err := d.parse(q)
+		if err != nil {
+			return nil, nil, err
+		}
+		if value == nil {
+			if unknownPolicy[d.name()] == unknownUntargeted {
+				unknown = append(unknown, d.name())
+			}
+			continue
+		}
+		if t == nil {
+			t = targets{}
+		}
+		t[d.name()] = value
+	}
+	return t, unknown, nil
+}
+
+// targetsClause returns the clause of each dimension in t, each preceded by
+// " AND ".
+func targetsClause(t targets) (query string, args []interface{}) {
+	for _, d := range dimensions {
+		value, ok := t[d.name()]
+		if !ok {
+			continue
+		}
+		clause, clauseArgs := d.match(value)
+		query += " AND " + clause
+		args = append(args, clauseArgs...)
+	}
+	return query, args
+}
+
+// untargetedClause returns the untargeted clause of each dimension in
+// unknown, joined by " AND ".
+func untargetedClause(unknown []string) string {
+	var clauses []string
+	for _, d := range dimensions {
+		for _, name := range unknown {
+			if d.name() == name {
+				clauses = append(clauses, d.untargeted())
+			}
+		}
+	}
+	return strings.Join(clauses, " AND ")
+}
+
+// conditionError is a condition rejected by a dimension.
+type conditionError struct {
+	condition int // index in Conditions
+	err       error
+}
+
+func (e *conditionError) Error() string {
+	return fmt.Sprintf("conditions[%d]: %v", e.condition, e.err)
+}
+
+func (e *conditionError) Unwrap() error {
+	return e.err
+}
+
+// validateAdvertisement validates ad as models.ValidateAdvertisement does,
+// then checks each condition with every dimension.
+func validateAdvertisement(ad models.Advertisement) error {
+	if err := models.ValidateAdvertisement(ad); err != nil {
+		return err
+	}
+	for i, condition := range ad.Conditions {
+		for _, d := range dimensions {
+			if err := d.validate(condition); err != nil {
+				return &conditionError{condition: i, err: err}
+			}
+		}
+	}
+	return nil
+}
+
+// dimensionColumns returns the advertisement_condition columns of every
+// dimension with their values for condition.
+func dimensionColumns(condition models.Conditions) []column {
+	var columns []column
+	for _, d := range dimensions {
+		columns = append(columns, d.columns(condition)...)
+	}
+	return columns
+}
+
+// indexCondition stores the indexed values of the condition inserted as conditionID.
+func indexCondition(tx *sqlx.Tx, conditionID int64, condition models.Conditions) error {
+	for _, d := range dimensions {
+		if ix, ok := d.(indexer); ok {
+			if err := ix.index(tx, conditionID, condition); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// indexTables lists the tables of every indexer.
+func indexTables() []string {
+	var tables []string
+	for _, d := range dimensions {
+		if ix, ok := d.(indexer); ok {
+			tables = append(tables, ix.tables()...)
+		}
+	}
+	return tables
+}
+
+// dimensionSelects returns the select expressions of every dimension.
+func dimensionSelects() []string {
+	var selects []string
+	for _, d := range dimensions {
+		selects = append(selects, d.selects()...)
+	}
+	return selects
+}
+
+// loadDimensions sets the dimensions of condition from the values of dimensionSelects.
+func loadDimensions(condition *models.Conditions, values []sql.NullString) error {
+	for _, d := range dimensions {
+		n := len(d.selects())
+		if err := d.load(condition, values[:n]); err != nil {
+			return err
+		}
+		values = values[n:]
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package controller
+
+import (
+	"database/sql"
+	"fmt"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jjshen2000/simple-ads/models"
+)
+
+func TestDimensionsOrder(t *testing.T) {
+	var names []string
+	for _, d := range dimensions {
+		names = append(names, d.name())
+	}
+	assert.Equal(t, []string{"age", "gender", "geo", "platform"}, names)
+	assert.Panics(t, func() { registerDimension(ageDimension{}) })
+}
+
+func TestParseTargets(t *testing.T) {
+	parsed, unknown, err := parseTargets(url.Values{"keywords": {"suv"}})
+	assert.NoError(t, err)
+	assert.Nil(t, parsed)
+	assert.Nil(t, unknown)
+
+	parsed, _, err = parseTargets(url.Values{"age": {"30"}, "region": {"JP-13"}})
+	assert.NoError(t, err)
+	assert.Equal(t, targets{"age": 30, "geo": geoTarget{country: "JP", region: "JP-13"}}, parsed)
+
+	_, _, err = parseTargets(url.Values{"gender": {"X"}})
+	assert.EqualError(t, err, "invalid gender")
+}
+
+func TestSetUnknownPolicy(t *testing.T) {
+	defer func(restore map[string]string) { unknownPolicy = restore }(unknownPolicy)
+
+	assert.EqualError(t, SetUnknownPolicy(map[string]string{"income": "untargeted"}), `unknown dimension "income"`)
+	assert.EqualError(t, SetUnknownPolicy(map[string]string{"age": "none"}), `invalid policy "none" for age`)
+
+	assert.NoError(t, SetUnknownPolicy(map[string]string{"age": "untargeted", "gender": "matchAll"}))
+	parsed, unknown, err := parseTargets(url.Values{"platform": {"ios"}})
+	assert.NoError(t, err)
+	assert.Equal(t, targets{"platform": "ios"}, parsed)
+	assert.Equal(t, []string{"age"}, unknown)
+
+	_, unknown, err = parseTargets(url.Values{"age": {"70"}})
+	assert.NoError(t, err)
+	assert.Nil(t, unknown)
+}
+
+// TestDimensionColumns checks that load reads back what columns stores for
+// the dimensions without an index.
+func TestDimensionColumns(t *testing.T) {
+	condition := models.Conditions{AgeStart: 65, Gender: []string{"F", "O"}, Platform: []string{"ios", "web"}}
+
+	assert.Equal(t, []column{{"age_start", 65}, {"age_end", nil}, {"genders", uint8(6)},
+		{"unlimited_country", true}, {"platform", uint8(6)}}, dimensionColumns(condition))
+
+	stored := map[string]interface{}{"ac.age_start": 65, "ac.age_end": nil, "ac.genders": uint8(6), "ac.platform": uint8(6)}
+	var loaded models.Conditions
+	for _, d := range dimensions {
+		if _, ok := d.(indexer); ok {
+			continue
+		}
+		var selected []sql.NullString
+		for _, column := range d.selects() {
+			value := stored[column]
+			selected = append(selected, sql.NullString{String: fmt.Sprint(value), Valid: value != nil})
+		}
+		assert.NoError(t, d.load(&loaded, selected), d.name())
+	}
+	assert.Equal(t, condition, loaded)
+
+	assert.Equal(t, []column{{"age_start", 1}, {"age_end", nil}, {"genders", uint8(7)},
+		{"unlimited_country", true}, {"platform", uint8(7)}}, dimensionColumns(models.Conditions{}))
+}
+
+func TestValidateAdvertisementDimensions(t *testing.T) {
+	ad := models.Advertisement{
+		Title:      "AD",
+		StartAt:    time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		EndAt:      time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC),
+		Conditions: []models.Conditions{{AgeStart: 20, AgeEnd: 30}, {AgeStart: 40, AgeEnd: 30}},
+	}
+
+	err := validateAdvertisement(ad)
+	assert.EqualError(t, err, "conditions[1]: ageStart is above ageEnd")
+	assert.True(t, isInvalid(err))
+
+	ad.Conditions[1].AgeEnd = 0
+	assert.NoError(t, validateAdvertisement(ad))
+}
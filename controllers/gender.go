@@ -0,0 +1,102 @@
+package controller
+
+import (
+	"database/sql"
+	"errors"
+	"net/url"
+	"strconv"
+
+	"github.com/jjshen2000/simple-ads/models"
+)
+
+// genderMap holds the bit of each gender in the genders column; "O" stands
+// for any other gender.
+var genderMap = map[string]uint8{
+	"M": 1,
+	"F": 2,
+	"O": 4,
+}
+
+// allGenders is the genders value of conditions not targeting gender.
+const allGenders = 7
+
+// genderDimension targets conditions by the gender of the user.
+type genderDimension struct{}
+
+func init() {
+	registerDimension(genderDimension{})
+}
+
+func (genderDimension) name() string {
+	return "gender"
+}
+
+func (genderDimension) parse(q url.Values) (interface{}, error) {
+	gender := q.Get("gender")
+	if gender == "" {
+		return nil, nil
+	}
+	if genderMap[gender] == 0 {
+		return nil, errors.New("invalid gender")
+	}
+	return gender, nil
+}
+
+func (genderDimension) validate(models.Conditions) error {
+	return nil
+}
+
+func (genderDimension) columns(condition models.Conditions) []column {
+	return []column{{"genders", getGenderBits(condition.Gender)}}
+}
+
+func (genderDimension) selects() []string {
+	return []string{"ac.genders"}
+}
+
+func (genderDimension) load(condition *models.Conditions, values []sql.NullString) error {
+	bits, err := strconv.ParseUint(values[0].String, 10, 8)
+	if err != nil {
+		return err
+	}
+	condition.Gender = getGenders(uint8(bits))
+	return nil
+}
+
+func (genderDimension) match(value interface{}) (string, []interface{}) {
+	return "(ac.genders & ?) != 0", []interface{}{genderMap[value.(string)]}
+}
+
+func (genderDimension) untargeted() string {
+	return "ac.genders = " + strconv.Itoa(allGenders)
+}
+
+// getGenderBits returns the genders column of a list of genders; every
+// gender when the list is empty.
+func getGenderBits(genders []string) uint8 {
+	var bits uint8
+	for _, g := range genders {
+		bits |= genderMap[g]
+	}
+	if bits == 0 {
+		bits = allGenders
+	}
+	return bits
+}
+
+// getGenders is the inverse of getGenderBits.
+//
+// If every gender is set, return nil since the condition does not restrict gender.
+func getGenders(bits uint8) []string {
+	if bits == allGenders {
+		return nil
+	}
+
+	var genders []string
+	for _, g := range []string{"M", "F", "O"} {
+		if bits&genderMap[g] != 0 {
+			genders = append(genders, g)
+		}
+	}
+	return genders
+}
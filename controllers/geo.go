@@ -0,0 +1,196 @@
+package controller
+
+import (
+	"database/sql"
+	"errors"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/biter777/countries"
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+
+	"github.com/jjshen2000/simple-ads/geoip"
+	"github.com/jjshen2000/simple-ads/models"
+)
+
+// GeoResolver locates an IP address.
+type GeoResolver interface {
+	Lookup(ip net.IP) (geoip.Location, error)
+}
+
+// geoResolver locates clients that omit the geo parameters; nil disables it.
+var geoResolver GeoResolver
+
+// SetGeoResolver enables locating clients by IP with r.
+func SetGeoResolver(r GeoResolver) {
+	geoResolver = r
+}
+
+// locateClient fills the country, region and city parameters of q from the
+// client IP, unless the caller set any of them. The client IP honors
+// X-Forwarded-For only from the trusted proxies of the engine.
+func locateClient(c *gin.Context, q url.Values) {
+	if geoResolver == nil || q.Get("country") != "" || q.Get("region") != "" || q.Get("city") != "" {
+		return
+	}
+
+	ip := net.ParseIP(c.ClientIP())
+	if ip == nil {
+		return
+	}
+	loc, err := geoResolver.Lookup(ip)
+	if err != nil || loc.Country == "" {
+		return
+	}
+
+	q.Set("country", loc.Country)
+	// The database may know subdivisions the bundled dataset does not.
+	if loc.Region != "" && models.IsValidSubdivision(loc.Region) {
+		q.Set("region", loc.Region)
+	}
+	if loc.City != "" {
+		q.Set("city", loc.City)
+	}
+}
+
+// geoDimension targets conditions by country, ISO 3166-2 region and GeoNames
+// city. A condition targeting a country also matches any of its regions and
+// cities, and one without geo targeting matches everywhere.
+type geoDimension struct{}
+
+// geoTarget is the location of the request; a region implies its country.
+type geoTarget struct {
+	country string
+	region  string
+	city    string
+}
+
+func init() {
+	registerDimension(geoDimension{})
+}
+
+func (geoDimension) name() string {
+	return "geo"
+}
+
+func (geoDimension) parse(q url.Values) (interface{}, error) {
+	target := geoTarget{country: q.Get("country"), region: q.Get("region"), city: q.Get("city")}
+	if target.country != "" && !models.IsValidCountry(target.country) {
+		return nil, errors.New("invalid country")
+	}
+
+	if target.region != "" {
+		regionCountry := countries.SubdivisionCode(target.region).Country().Alpha2()
+		if !models.IsValidSubdivision(target.region) || (target.country != "" && target.country != regionCountry) {
+			return nil, errors.New("invalid region")
+		}
+		target.country = regionCountry
+	}
+
+	if target.city != "" {
+		if _, err := strconv.ParseUint(target.city, 10, 64); err != nil {
+			return nil, errors.New("invalid city")
+		}
+	}
+
+	if target == (geoTarget{}) {
+		return nil, nil
+	}
+	return target, nil
+}
+
+func (geoDimension) validate(models.Conditions) error {
+	return nil
+}
+
+func (geoDimension) columns(condition models.Conditions) []column {
+	unlimited := len(condition.Country) == 0 && len(condition.Region) == 0 && len(condition.City) == 0
+	return []column{{"unlimited_country", unlimited}}
+}
+
+func (geoDimension) tables() []string {
+	return []string{"condition_country", "condition_region", "condition_city"}
+}
+
+func (geoDimension) index(tx *sqlx.Tx, conditionID int64, condition models.Conditions) error {
+	// Insert condition countries
+	for _, country := range condition.Country {
+		insertCountry := `
+			INSERT INTO condition_country (condition_id, country_code) VALUES (?, ?)
+		`
+		_, err := tx.Exec(insertCountry, conditionID, country)
+		if err != nil {
+			return &stepError{"insert country", err}
+		}
+	}
+
+	// Insert condition regions
+	for _, region := range condition.Region {
+		insertRegion := `
+			INSERT INTO condition_region (condition_id, region_code) VALUES (?, ?)
+		`
+		_, err := tx.Exec(insertRegion, conditionID, region)
+		if err != nil {
+			return &stepError{"insert region", err}
+		}
+	}
+
+	// Insert condition cities
+	for _, city := range condition.City {
+		insertCity := `
+			INSERT INTO condition_city (condition_id, city_id) VALUES (?, ?)
+		`
+		_, err := tx.Exec(insertCity, conditionID, city)
+		if err != nil {
+			return &stepError{"insert city", err}
+		}
+	}
+	return nil
+}
+
+func (geoDimension) selects() []string {
+	return []string{
+		"(SELECT GROUP_CONCAT(cc.country_code) FROM condition_country AS cc WHERE cc.condition_id = ac.id)",
+		"(SELECT GROUP_CONCAT(cr.region_code) FROM condition_region AS cr WHERE cr.condition_id = ac.id)",
+		"(SELECT GROUP_CONCAT(ci.city_id) FROM condition_city AS ci WHERE ci.condition_id = ac.id)",
+	}
+}
+
+func (geoDimension) load(condition *models.Conditions, values []sql.NullString) error {
+	if values[0].Valid {
+		condition.Country = strings.Split(values[0].String, ",")
+	}
+	if values[1].Valid {
+		condition.Region = strings.Split(values[1].String, ",")
+	}
+	if values[2].Valid {
+		condition.City = strings.Split(values[2].String, ",")
+	}
+	return nil
+}
+
+func (geoDimension) match(value interface{}) (string, []interface{}) {
+	target := value.(geoTarget)
+	clauses := []string{"ac.unlimited_country"}
+	var args []interface{}
+	if target.country != "" {
+		clauses = append(clauses, "EXISTS (SELECT 1 FROM condition_country AS cc WHERE cc.condition_id = ac.id AND cc.country_code = ?)")
+		args = append(args, target.country)
+	}
+	if target.region != "" {
+		clauses = append(clauses, "EXISTS (SELECT 1 FROM condition_region AS cr WHERE cr.condition_id = ac.id AND cr.region_code = ?)")
+		args = append(args, target.region)
+	}
+	if target.city != "" {
+		clauses = append(clauses, "EXISTS (SELECT 1 FROM condition_city AS ci WHERE ci.condition_id = ac.id AND ci.city_id = ?)")
+		args = append(args, target.city)
+	}
+	return "(" + strings.Join(clauses, " OR ") + ")", args
+}
+
+func (geoDimension) untargeted() string {
+	return "ac.unlimited_country"
+}
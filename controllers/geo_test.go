@@ -0,0 +1,84 @@
+package controller
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jjshen2000/simple-ads/geoip"
+)
+
+type fakeResolver map[string]geoip.Location
+
+func (r fakeResolver) Lookup(ip net.IP) (geoip.Location, error) {
+	loc, ok := r[ip.String()]
+	if !ok {
+		return geoip.Location{}, errors.New("not found")
+	}
+	return loc, nil
+}
+
+func TestParseListParamsGeo(t *testing.T) {
+	resolver := fakeResolver{
+		"1.160.0.1":     {Country: "TW", Region: "TW-TPE", City: "1668341"},
+		"216.160.83.57": {Country: "US", Region: "US-WA", City: "5803556"},
+		"2.125.160.217": {Country: "GB"},
+		"10.0.0.9":      {Country: "JP", Region: "JP-99"},
+	}
+
+	testCases := []struct {
+		name          string
+		query         string
+		remoteAddr    string
+		forwardedFor  string
+		noResolver    bool
+		expectCountry string
+		expectRegion  string
+		expectCity    string
+	}{
+		{name: "Client IP", remoteAddr: "1.160.0.1:1234", expectCountry: "TW", expectRegion: "TW-TPE", expectCity: "1668341"},
+		{name: "Country only", remoteAddr: "2.125.160.217:1234", expectCountry: "GB"},
+		{name: "Unknown region", remoteAddr: "10.0.0.9:1234", expectCountry: "JP"},
+		{name: "Unknown IP", remoteAddr: "192.0.2.1:1234"},
+		{name: "Explicit country", query: "country=JP", remoteAddr: "1.160.0.1:1234", expectCountry: "JP"},
+		{name: "Explicit region", query: "region=US-CA", remoteAddr: "1.160.0.1:1234", expectCountry: "US", expectRegion: "US-CA"},
+		{name: "Explicit city", query: "city=1850147", remoteAddr: "1.160.0.1:1234", expectCity: "1850147"},
+		{name: "Trusted proxy", remoteAddr: "10.0.0.1:1234", forwardedFor: "216.160.83.57", expectCountry: "US", expectRegion: "US-WA", expectCity: "5803556"},
+		{name: "Untrusted proxy", remoteAddr: "1.160.0.1:1234", forwardedFor: "216.160.83.57", expectCountry: "TW", expectRegion: "TW-TPE", expectCity: "1668341"},
+		{name: "Disabled", remoteAddr: "1.160.0.1:1234", noResolver: true},
+	}
+
+	gin.SetMode(gin.TestMode)
+	defer SetGeoResolver(nil)
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if tc.noResolver {
+				SetGeoResolver(nil)
+			} else {
+				SetGeoResolver(resolver)
+			}
+
+			w := httptest.NewRecorder()
+			c, engine := gin.CreateTestContext(w)
+			assert.NoError(t, engine.SetTrustedProxies([]string{"10.0.0.0/24"}))
+			c.Request = httptest.NewRequest(http.MethodGet, "/api/v1/ad?"+tc.query, nil)
+			c.Request.RemoteAddr = tc.remoteAddr
+			if tc.forwardedFor != "" {
+				c.Request.Header.Set("X-Forwarded-For", tc.forwardedFor)
+			}
+
+			params, err := parseListParams(c)
+			assert.NoError(t, err)
+			geo, _ := params.targets["geo"].(geoTarget)
+			assert.Equal(t, tc.expectCountry, geo.country)
+			assert.Equal(t, tc.expectRegion, geo.region)
+			assert.Equal(t, tc.expectCity, geo.city)
+		})
+	}
+}
@@ -0,0 +1,493 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/jjshen2000/simple-ads/adspb"
+	"github.com/jjshen2000/simple-ads/models"
+)
+
+// AdServiceServer serves adspb.AdService with the same operations as the
+// REST handlers.
+type AdServiceServer struct {
+	adspb.UnimplementedAdServiceServer
+}
+
+func NewAdServiceServer() *AdServiceServer {
+	return &AdServiceServer{}
+}
+
+type originContextKey struct{}
+
+// AuthInterceptor requires an API key in the "authorization" metadata for
+// every RPC of the admin API, mirroring RequireAPIKey. Like RequestID, it
+// tags each RPC with the ID in its "x-request-id" metadata, or a new one,
+// and echoes it in the response header.
+func AuthInterceptor(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	first := func(key string) string {
+		if values := md.Get(key); len(values) > 0 {
+			return values[0]
+		}
+		return ""
+	}
+
+	id := requestID(first("x-request-id"))
+	grpc.SetHeader(ctx, metadata.Pairs("x-request-id", id))
+	if info.FullMethod == adspb.AdService_ListActiveAds_FullMethodName {
+		return handler(ctx, req)
+	}
+
+	actor, err := authenticate(first("authorization"))
+	if err == errMissingAPIKey || err == errInvalidAPIKey || err == errNotBearer {
+		return nil, status.Error(codes.Unauthenticated, err.Error())
+	}
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	return handler(context.WithValue(ctx, originContextKey{}, origin{actor: actor, requestID: id}), req)
+}
+
+// grpcOrigin returns the origin stored by AuthInterceptor.
+func grpcOrigin(ctx context.Context) origin {
+	o, _ := ctx.Value(originContextKey{}).(origin)
+	return o
+}
+
+// grpcError maps an error of the shared operations to a gRPC status.
+func grpcError(err error) error {
+	switch {
+	case isInvalid(err):
+		return status.Error(codes.InvalidArgument, err.Error())
+	case errors.Is(err, errNotFound) || errors.Is(err, errRevisionNotFound):
+		return status.Error(codes.NotFound, err.Error())
+	case errors.As(err, new(*transitionError)) || errors.Is(err, errNotDeleted):
+		return status.Error(codes.FailedPrecondition, err.Error())
+	}
+	return status.Error(codes.Internal, err.Error())
+}
+
+func grpcAdID(id int64) (int, error) {
+	if id < 1 || id > int64(^uint32(0)>>1) {
+		return 0, status.Error(codes.InvalidArgument, "invalid id")
+	}
+	return int(id), nil
+}
+
+func adFromProto(pb *adspb.Advertisement) models.Advertisement {
+	ad := models.Advertisement{Title: pb.GetTitle()}
+	if pb.GetStartAt() != nil {
+		ad.StartAt = pb.GetStartAt().AsTime()
+	}
+	if pb.GetEndAt() != nil {
+		ad.EndAt = pb.GetEndAt().AsTime()
+	}
+	for _, c := range pb.GetConditions() {
+		condition := models.Conditions{
+			AgeStart: int(c.GetAgeStart()),
+			AgeEnd:   int(c.GetAgeEnd()),
+			Gender:   c.GetGender(),
+			Country:  c.GetCountry(),
+			Region:   c.GetRegion(),
+			City:     c.GetCity(),
+			Platform: c.GetPlatform(),
+
+			MinOSVersion: c.GetMinOsVersion(),
+			MaxOSVersion: c.GetMaxOsVersion(),
+			Device:       c.GetDevice(),
+			Language:     c.GetLanguage(),
+
+			Keywords:        c.GetKeywords(),
+			ExcludeKeywords: c.GetExcludeKeywords(),
+			Category:        c.GetCategory(),
+			Audience:        intsFromProto(c.GetAudience()),
+			ExcludeAudience: intsFromProto(c.GetExcludeAudience()),
+			Expr:            c.GetExpr(),
+		}
+		if s := c.GetSchedule(); s != nil {
+			condition.Schedule = &models.Schedule{Timezone: s.GetTimezone()}
+			for _, w := range s.GetWindows() {
+				condition.Schedule.Windows = append(condition.Schedule.Windows, models.Window{
+					Days:      w.GetDays(),
+					StartHour: int(w.GetStartHour()),
+					EndHour:   int(w.GetEndHour()),
+				})
+			}
+		}
+		ad.Conditions = append(ad.Conditions, condition)
+	}
+	ad.Video = videoFromProto(pb.GetVideo())
+	ad.Locale = pb.GetLocale()
+	ad.Description = pb.GetDescription()
+	ad.Status = pb.GetStatus()
+	for _, r := range pb.GetModerationReasons() {
+		ad.ModerationReasons = append(ad.ModerationReasons, models.ModerationReason{
+			Check:   r.GetCheck(),
+			Field:   r.GetField(),
+			Message: r.GetMessage(),
+		})
+	}
+	for _, l := range pb.GetLocalizations() {
+		ad.Localizations = append(ad.Localizations, models.Localization{
+			Locale:      l.GetLocale(),
+			Title:       l.GetTitle(),
+			Description: l.GetDescription(),
+			Video:       videoFromProto(l.GetVideo()),
+		})
+	}
+	return ad
+}
+
+func intsFromProto(pb []int32) []int {
+	var ints []int
+	for _, n := range pb {
+		ints = append(ints, int(n))
+	}
+	return ints
+}
+
+func intsToProto(ints []int) []int32 {
+	var pb []int32
+	for _, n := range ints {
+		pb = append(pb, int32(n))
+	}
+	return pb
+}
+
+func videoFromProto(v *adspb.Video) *models.Video {
+	if v == nil {
+		return nil
+	}
+	video := &models.Video{
+		Duration:     int(v.GetDuration()),
+		ClickThrough: v.GetClickThrough(),
+		Impressions:  v.GetImpressions(),
+	}
+	for _, f := range v.GetMediaFiles() {
+		video.MediaFiles = append(video.MediaFiles, models.MediaFile{
+			URL:      f.GetUrl(),
+			Type:     f.GetType(),
+			Width:    int(f.GetWidth()),
+			Height:   int(f.GetHeight()),
+			Bitrate:  int(f.GetBitrate()),
+			Delivery: f.GetDelivery(),
+		})
+	}
+	for _, e := range v.GetTracking() {
+		video.Tracking = append(video.Tracking, models.TrackingEvent{Event: e.GetEvent(), URL: e.GetUrl()})
+	}
+	return video
+}
+
+func adToProto(ad models.Advertisement) *adspb.Advertisement {
+	pb := &adspb.Advertisement{
+		Id:      int64(ad.ID),
+		Title:   ad.Title,
+		StartAt: timestamppb.New(ad.StartAt),
+		EndAt:   timestamppb.New(ad.EndAt),
+	}
+	for _, c := range ad.Conditions {
+		condition := &adspb.Conditions{
+			AgeStart: int32(c.AgeStart),
+			AgeEnd:   int32(c.AgeEnd),
+			Gender:   c.Gender,
+			Country:  c.Country,
+			Region:   c.Region,
+			City:     c.City,
+			Platform: c.Platform,
+
+			MinOsVersion: c.MinOSVersion,
+			MaxOsVersion: c.MaxOSVersion,
+			Device:       c.Device,
+			Language:     c.Language,
+
+			Keywords:        c.Keywords,
+			ExcludeKeywords: c.ExcludeKeywords,
+			Category:        c.Category,
+			Audience:        intsToProto(c.Audience),
+			ExcludeAudience: intsToProto(c.ExcludeAudience),
+			Expr:            c.Expr,
+		}
+		if s := c.Schedule; s != nil {
+			condition.Schedule = &adspb.Schedule{Timezone: s.Timezone}
+			for _, w := range s.Windows {
+				condition.Schedule.Windows = append(condition.Schedule.Windows, &adspb.Window{
+					Days:      w.Days,
+					StartHour: int32(w.StartHour),
+					EndHour:   int32(w.EndHour),
+				})
+			}
+		}
+		pb.Conditions = append(pb.Conditions, condition)
+	}
+	pb.Video = videoToProto(ad.Video)
+	pb.Locale = ad.Locale
+	pb.Description = ad.Description
+	pb.Status = ad.Status
+	for _, r := range ad.ModerationReasons {
+		pb.ModerationReasons = append(pb.ModerationReasons, &adspb.ModerationReason{
+			Check:   r.Check,
+			Field:   r.Field,
+			Message: r.Message,
+		})
+	}
+	for _, l := range ad.Localizations {
+		pb.Localizations = append(pb.Localizations, &adspb.Localization{
+			Locale:      l.Locale,
+			Title:       l.Title,
+			Description: l.Description,
+			Video:       videoToProto(l.Video),
+		})
+	}
+	return pb
+}
+
+func videoToProto(v *models.Video) *adspb.Video {
+	if v == nil {
+		return nil
+	}
+	video := &adspb.Video{
+		Duration:     int32(v.Duration),
+		ClickThrough: v.ClickThrough,
+		Impressions:  v.Impressions,
+	}
+	for _, f := range v.MediaFiles {
+		video.MediaFiles = append(video.MediaFiles, &adspb.MediaFile{
+			Url:      f.URL,
+			Type:     f.Type,
+			Width:    int32(f.Width),
+			Height:   int32(f.Height),
+			Bitrate:  int32(f.Bitrate),
+			Delivery: f.Delivery,
+		})
+	}
+	for _, e := range v.Tracking {
+		video.Tracking = append(video.Tracking, &adspb.TrackingEvent{Event: e.Event, Url: e.URL})
+	}
+	return video
+}
+
+func (s *AdServiceServer) CreateAd(ctx context.Context, req *adspb.CreateAdRequest) (*adspb.CreateAdResponse, error) {
+	id, err := createAdvertisement(grpcOrigin(ctx), adFromProto(req.GetAd()))
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return &adspb.CreateAdResponse{Id: id}, nil
+}
+
+func (s *AdServiceServer) GetAd(ctx context.Context, req *adspb.GetAdRequest) (*adspb.Advertisement, error) {
+	id, err := grpcAdID(req.GetId())
+	if err != nil {
+		return nil, err
+	}
+
+	ad, err := getAdvertisement(id)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	return adToProto(ad), nil
+}
+
+func (s *AdServiceServer) UpdateAd(ctx context.Context, req *adspb.UpdateAdRequest) (*adspb.UpdateAdResponse, error) {
+	id, err := grpcAdID(req.GetId())
+	if err != nil {
+		return nil, err
+	}
+
+	if err := updateAdvertisement(grpcOrigin(ctx), id, adFromProto(req.GetAd())); err != nil {
+		return nil, grpcError(err)
+	}
+	return &adspb.UpdateAdResponse{}, nil
+}
+
+func (s *AdServiceServer) DeleteAd(ctx context.Context, req *adspb.DeleteAdRequest) (*adspb.DeleteAdResponse, error) {
+	id, err := grpcAdID(req.GetId())
+	if err != nil {
+		return nil, err
+	}
+
+	if err := deleteAdvertisement(grpcOrigin(ctx), id); err != nil {
+		return nil, grpcError(err)
+	}
+	return &adspb.DeleteAdResponse{}, nil
+}
+
+func (s *AdServiceServer) SetAdStatus(ctx context.Context, req *adspb.SetAdStatusRequest) (*adspb.SetAdStatusResponse, error) {
+	id, err := grpcAdID(req.GetId())
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := setAdvertisementStatus(grpcOrigin(ctx), id, req.GetStatus()); err != nil {
+		return nil, grpcError(err)
+	}
+	return &adspb.SetAdStatusResponse{}, nil
+}
+
+func revisionToProto(r models.Revision) *adspb.Revision {
+	return &adspb.Revision{
+		Revision:  int32(r.Revision),
+		CreatedAt: timestamppb.New(r.CreatedAt),
+		Actor:     r.Actor,
+		Action:    r.Action,
+		Ad:        adToProto(r.Advertisement),
+	}
+}
+
+func grpcRevision(revision int32) (int, error) {
+	if revision < 1 {
+		return 0, status.Error(codes.InvalidArgument, "invalid revision")
+	}
+	return int(revision), nil
+}
+
+func (s *AdServiceServer) ListAdRevisions(ctx context.Context, req *adspb.ListAdRevisionsRequest) (*adspb.ListAdRevisionsResponse, error) {
+	id, err := grpcAdID(req.GetId())
+	if err != nil {
+		return nil, err
+	}
+
+	revisions, err := listRevisions(id)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	resp := &adspb.ListAdRevisionsResponse{}
+	for _, r := range revisions {
+		resp.Revisions = append(resp.Revisions, revisionToProto(r))
+	}
+	return resp, nil
+}
+
+func (s *AdServiceServer) DiffAdRevisions(ctx context.Context, req *adspb.DiffAdRevisionsRequest) (*adspb.DiffAdRevisionsResponse, error) {
+	id, err := grpcAdID(req.GetId())
+	if err != nil {
+		return nil, err
+	}
+	from, err := grpcRevision(req.GetFrom())
+	if err != nil {
+		return nil, err
+	}
+	to, err := grpcRevision(req.GetTo())
+	if err != nil {
+		return nil, err
+	}
+
+	changes, err := diffRevisions(id, from, to)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+	resp := &adspb.DiffAdRevisionsResponse{Changes: map[string]*adspb.FieldChange{}}
+	for name, change := range changes {
+		resp.Changes[name] = &adspb.FieldChange{Before: string(change.Before), After: string(change.After)}
+	}
+	return resp, nil
+}
+
+func (s *AdServiceServer) RestoreAdRevision(ctx context.Context, req *adspb.RestoreAdRevisionRequest) (*adspb.RestoreAdRevisionResponse, error) {
+	id, err := grpcAdID(req.GetId())
+	if err != nil {
+		return nil, err
+	}
+	revision, err := grpcRevision(req.GetRevision())
+	if err != nil {
+		return nil, err
+	}
+
+	if err := restoreRevision(grpcOrigin(ctx), id, revision); err != nil {
+		return nil, grpcError(err)
+	}
+	return &adspb.RestoreAdRevisionResponse{}, nil
+}
+
+func (s *AdServiceServer) RestoreAd(ctx context.Context, req *adspb.RestoreAdRequest) (*adspb.RestoreAdResponse, error) {
+	id, err := grpcAdID(req.GetId())
+	if err != nil {
+		return nil, err
+	}
+
+	if err := restoreAdvertisement(grpcOrigin(ctx), id); err != nil {
+		return nil, grpcError(err)
+	}
+	return &adspb.RestoreAdResponse{}, nil
+}
+
+// listQueryFromProto converts a request to the query parameters of
+// GET /api/v1/ad so that it is parsed and validated by parseListQuery.
+func listQueryFromProto(req *adspb.ListActiveAdsRequest) url.Values {
+	q := url.Values{}
+	for key, value := range req.GetParams() {
+		q.Set(key, value)
+	}
+
+	set := func(key, value string) {
+		if value != "" {
+			q.Set(key, value)
+		}
+	}
+	set("cursor", req.GetCursor())
+	set("gender", req.GetGender())
+	set("country", req.GetCountry())
+	set("region", req.GetRegion())
+	set("city", req.GetCity())
+	set("platform", req.GetPlatform())
+	set("osVersion", req.GetOsVersion())
+	set("device", req.GetDevice())
+	set("lang", req.GetLang())
+	set("keywords", strings.Join(req.GetKeywords(), ","))
+	set("category", strings.Join(req.GetCategory(), ","))
+	set("userId", req.GetUserId())
+	for key, value := range req.GetKv() {
+		q.Set("kv."+key, value)
+	}
+	if req.GetLimit() != 0 {
+		q.Set("limit", strconv.Itoa(int(req.GetLimit())))
+	}
+	if req.GetIncludeTotal() {
+		q.Set("includeTotal", "true")
+	}
+	if req.GetAge() != 0 {
+		q.Set("age", strconv.Itoa(int(req.GetAge())))
+	}
+	if req.GetAt() != nil {
+		q.Set("at", req.GetAt().AsTime().Format(time.RFC3339Nano))
+	}
+	return q
+}
+
+func (s *AdServiceServer) ListActiveAds(ctx context.Context, req *adspb.ListActiveAdsRequest) (*adspb.ListActiveAdsResponse, error) {
+	params, err := parseListQuery(listQueryFromProto(req))
+	if err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+
+	page, err := listActiveAdvertisements(params)
+	if err != nil {
+		return nil, grpcError(err)
+	}
+
+	resp := &adspb.ListActiveAdsResponse{NextCursor: page.NextCursor}
+	for _, ad := range page.Items {
+		resp.Items = append(resp.Items, &adspb.ActiveAd{
+			Title:       ad.Title,
+			EndAt:       timestamppb.New(ad.EndAt),
+			Locale:      ad.Locale,
+			Description: ad.Description,
+		})
+	}
+	if page.Total != nil {
+		total := int64(*page.Total)
+		resp.Total = &total
+	}
+	return resp, nil
+}
@@ -0,0 +1,238 @@
+package controller
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/timestamppb"
+
+	"github.com/jjshen2000/simple-ads/adspb"
+)
+
+func newGRPCClient(t *testing.T) adspb.AdServiceClient {
+	lis := bufconn.Listen(1 << 20)
+	server := grpc.NewServer(grpc.UnaryInterceptor(AuthInterceptor))
+	adspb.RegisterAdServiceServer(server, NewAdServiceServer())
+	go server.Serve(lis)
+	t.Cleanup(server.Stop)
+
+	conn, err := grpc.Dial("bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) { return lis.DialContext(ctx) }),
+		grpc.WithTransportCredentials(insecure.NewCredentials()))
+	assert.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	return adspb.NewAdServiceClient(conn)
+}
+
+func newRESTRouter() *gin.Engine {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/api/v1/ad", CreateAdvertisement)
+	router.GET("/api/v1/ad", ListActiveAdvertisements)
+	router.GET("/api/v1/ad/:id", GetAdvertisement)
+	return router
+}
+
+func TestListQueryFromProto(t *testing.T) {
+	req := &adspb.ListActiveAdsRequest{
+		Limit:        10,
+		IncludeTotal: true,
+		Age:          20,
+		Country:      "TW",
+		OsVersion:    "16.4",
+		Device:       "tablet",
+		Keywords:     []string{"sedan", "suv"},
+		Category:     []string{"IAB2"},
+		UserId:       "customer-1",
+		Kv:           map[string]string{"tier": "gold"},
+		At:           timestamppb.New(time.Date(2031, 1, 1, 8, 30, 0, 0, time.UTC)),
+		Params:       map[string]string{"country": "JP", "lang": "zh-TW"},
+	}
+
+	assert.Equal(t, url.Values{
+		"limit":        {"10"},
+		"includeTotal": {"true"},
+		"age":          {"20"},
+		"country":      {"TW"},
+		"osVersion":    {"16.4"},
+		"device":       {"tablet"},
+		"keywords":     {"sedan,suv"},
+		"category":     {"IAB2"},
+		"userId":       {"customer-1"},
+		"kv.tier":      {"gold"},
+		"at":           {"2031-01-01T08:30:00Z"},
+		"lang":         {"zh-TW"},
+	}, listQueryFromProto(req))
+}
+
+func TestCreateParity(t *testing.T) {
+	client := newGRPCClient(t)
+	router := newRESTRouter()
+
+	testCases := []struct {
+		name string
+		ad   *adspb.Advertisement
+		code codes.Code
+	}{
+		{
+			name: "Success",
+			ad: &adspb.Advertisement{
+				Title:   "AD parity",
+				StartAt: timestamppb.New(time.Now().Add(-time.Hour)),
+				EndAt:   timestamppb.New(time.Now().Add(time.Hour)),
+				Conditions: []*adspb.Conditions{
+					{AgeStart: 20, AgeEnd: 30, Country: []string{"TW", "JP"}, Platform: []string{"ios"}},
+				},
+			},
+			code: codes.OK,
+		},
+		{
+			name: "Missing title",
+			ad: &adspb.Advertisement{
+				StartAt: timestamppb.New(time.Now()),
+				EndAt:   timestamppb.New(time.Now().Add(time.Hour)),
+			},
+			code: codes.InvalidArgument,
+		},
+		{
+			name: "Invalid country",
+			ad: &adspb.Advertisement{
+				Title:      "AD parity",
+				StartAt:    timestamppb.New(time.Now()),
+				EndAt:      timestamppb.New(time.Now().Add(time.Hour)),
+				Conditions: []*adspb.Conditions{{Country: []string{"UU"}}},
+			},
+			code: codes.InvalidArgument,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			payload, err := json.Marshal(adFromProto(tc.ad))
+			assert.NoError(t, err)
+			req := httptest.NewRequest("POST", "/api/v1/ad", bytes.NewReader(payload))
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			resp, err := client.CreateAd(context.Background(), &adspb.CreateAdRequest{Ad: tc.ad})
+			assert.Equal(t, tc.code, status.Code(err))
+
+			if tc.code != codes.OK {
+				assert.Equal(t, http.StatusBadRequest, w.Code)
+				var body map[string]string
+				assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+				assert.Equal(t, body["error"], status.Convert(err).Message())
+				return
+			}
+
+			assert.Equal(t, http.StatusCreated, w.Code)
+
+			// Both surfaces read back the same advertisement.
+			got, err := client.GetAd(context.Background(), &adspb.GetAdRequest{Id: resp.GetId()})
+			assert.NoError(t, err)
+
+			getReq := httptest.NewRequest("GET", "/api/v1/ad/"+strconv.FormatInt(resp.GetId(), 10), http.NoBody)
+			w = httptest.NewRecorder()
+			router.ServeHTTP(w, getReq)
+			assert.Equal(t, http.StatusOK, w.Code)
+
+			expected, err := json.Marshal(adFromProto(got))
+			assert.NoError(t, err)
+			var restAd map[string]interface{}
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &restAd))
+			delete(restAd, "id")
+			assert.JSONEq(t, string(expected), mustJSON(t, restAd))
+		})
+	}
+}
+
+func TestListParity(t *testing.T) {
+	client := newGRPCClient(t)
+	router := newRESTRouter()
+
+	testCases := []struct {
+		name  string
+		query url.Values
+		req   *adspb.ListActiveAdsRequest
+	}{
+		{
+			name:  "No filters",
+			query: url.Values{},
+			req:   &adspb.ListActiveAdsRequest{},
+		},
+		{
+			name:  "Filters with total",
+			query: url.Values{"age": {"25"}, "country": {"TW"}, "platform": {"ios"}, "limit": {"1"}, "includeTotal": {"true"}},
+			req:   &adspb.ListActiveAdsRequest{Age: 25, Country: "TW", Platform: "ios", Limit: 1, IncludeTotal: true},
+		},
+		{
+			name:  "Invalid gender",
+			query: url.Values{"gender": {"G"}},
+			req:   &adspb.ListActiveAdsRequest{Gender: "G"},
+		},
+		{
+			name:  "Invalid limit",
+			query: url.Values{"limit": {"101"}},
+			req:   &adspb.ListActiveAdsRequest{Limit: 101},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/api/v1/ad?"+tc.query.Encode(), http.NoBody)
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			var body struct {
+				Items []struct {
+					Title string    `json:"title"`
+					EndAt time.Time `json:"endAt"`
+				} `json:"items"`
+				NextCursor string `json:"nextCursor"`
+				Total      *int64 `json:"total"`
+				Error      string `json:"error"`
+			}
+			assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &body))
+
+			resp, err := client.ListActiveAds(context.Background(), tc.req)
+
+			if w.Code == http.StatusBadRequest {
+				assert.Equal(t, codes.InvalidArgument, status.Code(err))
+				assert.Equal(t, body.Error, status.Convert(err).Message())
+				return
+			}
+
+			assert.Equal(t, http.StatusOK, w.Code)
+			assert.NoError(t, err)
+			assert.Equal(t, body.NextCursor, resp.GetNextCursor())
+			assert.Equal(t, body.Total, resp.Total)
+			assert.Equal(t, len(body.Items), len(resp.GetItems()))
+			for i, item := range resp.GetItems() {
+				assert.Equal(t, body.Items[i].Title, item.GetTitle())
+				assert.True(t, body.Items[i].EndAt.Equal(item.GetEndAt().AsTime()))
+			}
+		})
+	}
+}
+
+func mustJSON(t *testing.T, v interface{}) string {
+	data, err := json.Marshal(v)
+	assert.NoError(t, err)
+	return string(data)
+}
@@ -0,0 +1,85 @@
+package controller
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/jjshen2000/simple-ads/models"
+)
+
+// maxKeywords bounds the keywords and categories taken from a request.
+const maxKeywords = 20
+
+var (
+	errInvalidKeywords = errors.New("invalid keywords")
+	errInvalidCategory = errors.New("invalid category")
+)
+
+// parseKeywords splits comma separated keywords and normalizes them, dropping
+// empty and repeated ones.
+func parseKeywords(s string) ([]string, error) {
+	var keywords []string
+	seen := map[string]bool{}
+	for _, keyword := range strings.Split(s, ",") {
+		keyword = models.NormalizeKeyword(keyword)
+		if keyword == "" || seen[keyword] {
+			continue
+		}
+		if len([]rune(keyword)) > 100 || len(keywords) == maxKeywords {
+			return nil, errInvalidKeywords
+		}
+		seen[keyword] = true
+		keywords = append(keywords, keyword)
+	}
+	if len(keywords) == 0 {
+		return nil, errInvalidKeywords
+	}
+	return keywords, nil
+}
+
+// parseCategories splits comma separated IAB content categories.
+func parseCategories(s string) ([]string, error) {
+	categories := strings.Split(s, ",")
+	if len(categories) > maxKeywords {
+		return nil, errInvalidCategory
+	}
+	for i, category := range categories {
+		categories[i] = strings.TrimSpace(category)
+		if !models.IsValidCategory(categories[i]) {
+			return nil, errInvalidCategory
+		}
+	}
+	return categories, nil
+}
+
+// categoryCandidates returns the condition categories eligible for the
+// categories of the content: each category and its parent, so that
+// "IAB1-2" content is eligible for "IAB1-2" and "IAB1" advertisements.
+func categoryCandidates(categories []string) []string {
+	var candidates []string
+	seen := map[string]bool{}
+	for _, category := range categories {
+		parent, _, _ := strings.Cut(category, "-")
+		for _, candidate := range []string{category, parent} {
+			if !seen[candidate] {
+				seen[candidate] = true
+				candidates = append(candidates, candidate)
+			}
+		}
+	}
+	return candidates
+}
+
+// keywordSubquery selects the keywords of condition ac among keywords,
+// either the excluded ones or those to include.
+func keywordSubquery(columns string, keywords []string, excluded bool) (query string, args []interface{}) {
+	query = "SELECT " + columns + " FROM condition_keyword AS ck WHERE ck.condition_id = ac.id AND "
+	if !excluded {
+		query += "NOT "
+	}
+	query += "ck.excluded AND ck.normalized IN (?" + strings.Repeat(", ?", len(keywords)-1) + ")"
+	for _, keyword := range keywords {
+		args = append(args, keyword)
+	}
+	return query, args
+}
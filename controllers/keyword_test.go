@@ -0,0 +1,29 @@
+package controller
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseKeywords(t *testing.T) {
+	keywords, err := parseKeywords(" Crème Brûlée ,SUV,,suv")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"creme brulee", "suv"}, keywords)
+
+	var tooMany []string
+	for i := 0; i <= maxKeywords; i++ {
+		tooMany = append(tooMany, strconv.Itoa(i))
+	}
+	for _, s := range []string{"", " , ", strings.Repeat("a", 101), strings.Join(tooMany, ",")} {
+		_, err := parseKeywords(s)
+		assert.ErrorIs(t, err, errInvalidKeywords, s)
+	}
+}
+
+func TestCategoryCandidates(t *testing.T) {
+	assert.Equal(t, []string{"IAB2-2", "IAB2", "IAB3", "IAB2-10"},
+		categoryCandidates([]string{"IAB2-2", "IAB3", "IAB2-10"}))
+}
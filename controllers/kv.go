@@ -0,0 +1,84 @@
+package controller
+
+import (
+	"database/sql"
+	"errors"
+	"net/url"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/jjshen2000/simple-ads/expr"
+)
+
+// Limits on the kv.* query parameters of a request.
+const (
+	maxKV          = 20
+	maxKVValueSize = 256
+)
+
+var kvKeyRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// parseKV returns the kv.<key> query parameters as an expression
+// environment, nil when there are none.
+func parseKV(q url.Values) (expr.Env, error) {
+	var env expr.Env
+	for param, values := range q {
+		key := strings.TrimPrefix(param, "kv.")
+		if key == param {
+			continue
+		}
+		if env == nil {
+			env = expr.Env{}
+		}
+		if !kvKeyRegexp.MatchString(key) || len(values) != 1 || len(env) == maxKV ||
+			utf8.RuneCountInString(values[0]) > maxKVValueSize {
+			return nil, errors.New("invalid kv")
+		}
+		env[key] = values[0]
+	}
+	return env, nil
+}
+
+// hasExpressions reports whether a condition has a targeting expression.
+func hasExpressions() bool {
+	targeting.RLock()
+	defer targeting.RUnlock()
+	return len(targeting.programs) > 0
+}
+
+// expressionHolds reports whether the expression of one of the conditions
+// ids holds for env. The expressions are evaluated here rather than in the
+// query, so that a request never binds the conditions it matches.
+func expressionHolds(ids []int, env expr.Env) bool {
+	targeting.RLock()
+	defer targeting.RUnlock()
+
+	for _, id := range ids {
+		if p, ok := targeting.programs[id]; ok && p.Eval(env) {
+			return true
+		}
+	}
+	return false
+}
+
+// exprColumns selects, per advertisement, whether a matching condition has
+// no expression and the IDs of the matching conditions with one, for
+// expressionHolds to check.
+const exprColumns = "MAX(ac.id IS NULL OR ac.expr IS NULL), GROUP_CONCAT(IF(ac.expr IS NULL, NULL, ac.id))"
+
+// exprEligible reports whether an advertisement selected with exprColumns
+// open and ids is eligible for env.
+func exprEligible(open bool, ids sql.NullString, env expr.Env) (bool, error) {
+	if open {
+		return true, nil
+	}
+	if !ids.Valid {
+		return false, nil
+	}
+	conditions, err := splitInts(ids.String)
+	if err != nil {
+		return false, err
+	}
+	return expressionHolds(conditions, env), nil
+}
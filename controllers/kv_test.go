@@ -0,0 +1,123 @@
+package controller
+
+import (
+	"database/sql"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jjshen2000/simple-ads/expr"
+)
+
+func TestParseKV(t *testing.T) {
+	env, err := parseKV(url.Values{"kv.tier": {"gold"}, "country": {"TW"}})
+	assert.NoError(t, err)
+	assert.Equal(t, expr.Env{"tier": "gold"}, env)
+
+	env, err = parseKV(url.Values{"country": {"TW"}})
+	assert.NoError(t, err)
+	assert.Nil(t, env)
+
+	tooMany := url.Values{}
+	for i := 0; i <= maxKV; i++ {
+		tooMany.Set(fmt.Sprintf("kv.k%d", i), "v")
+	}
+	for _, q := range []url.Values{tooMany, {"kv.": {"v"}}, {"kv.1st": {"v"}}, {"kv.tier": {"gold", "silver"}}} {
+		_, err := parseKV(q)
+		assert.EqualError(t, err, "invalid kv", q.Encode())
+	}
+}
+
+func TestExpressionHolds(t *testing.T) {
+	targeting.Lock()
+	programs := targeting.programs
+	targeting.programs = nil
+	targeting.Unlock()
+	defer func() {
+		targeting.Lock()
+		targeting.programs = programs
+		targeting.Unlock()
+	}()
+
+	assert.False(t, hasExpressions())
+
+	compiled := map[int]*expr.Program{}
+	for id, src := range map[int]string{1: `tier = "gold"`, 2: `NOT tier = "gold"`, 3: `tier IN ("gold", "silver")`} {
+		p, err := expr.Compile(src)
+		assert.NoError(t, err)
+		compiled[id] = p
+	}
+	targeting.Lock()
+	targeting.programs = compiled
+	targeting.Unlock()
+
+	assert.True(t, hasExpressions())
+	assert.True(t, expressionHolds([]int{2, 3}, expr.Env{"tier": "gold"}))
+	assert.False(t, expressionHolds([]int{2}, expr.Env{"tier": "gold"}))
+	assert.True(t, expressionHolds([]int{2}, nil))
+	// Conditions missing from the cache never hold.
+	assert.False(t, expressionHolds([]int{4}, expr.Env{"tier": "gold"}))
+
+	for _, tc := range []struct {
+		open     bool
+		ids      sql.NullString
+		eligible bool
+	}{
+		{true, sql.NullString{}, true},
+		{false, sql.NullString{}, false},
+		{false, sql.NullString{String: "2,3", Valid: true}, true},
+		{false, sql.NullString{String: "2", Valid: true}, false},
+	} {
+		eligible, err := exprEligible(tc.open, tc.ids, expr.Env{"tier": "gold"})
+		assert.NoError(t, err)
+		assert.Equal(t, tc.eligible, eligible, tc.ids.String)
+	}
+}
+
+func TestExprTargeting(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/api/v1/ad", CreateAdvertisement)
+	router.GET("/api/v1/ad", ListActiveAdvertisements)
+
+	serve := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	title := fmt.Sprintf("AD expr %d", time.Now().UnixNano())
+	start := time.Now().UTC().Add(-time.Hour).Format(time.RFC3339)
+	end := time.Now().UTC().Add(time.Hour).Format(time.RFC3339)
+	create := func(expression string) *httptest.ResponseRecorder {
+		return serve("POST", "/api/v1/ad", fmt.Sprintf(`{"title":%q,"startAt":%q,"endAt":%q,
+			"conditions":[{"expr":%q}]}`, title, start, end, expression))
+	}
+
+	w := create(`app_version >= "5.2" AND tier > "gold"`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	assert.Equal(t, `{"error":"conditions[0].expr: col 33: > compares numbers and versions such as \"5.2\", not \"gold\""}`, w.Body.String())
+
+	w = create(`app_version >= "5.2" AND tier IN ("gold", "platinum")`)
+	assert.Equal(t, http.StatusCreated, w.Code)
+	approveAdvertisement(t, createdID(t, w))
+
+	for query, eligible := range map[string]bool{
+		"kv.app_version=5.10&kv.tier=gold":   true,
+		"kv.app_version=5.1&kv.tier=gold":    false,
+		"kv.app_version=5.10&kv.tier=bronze": false,
+		"kv.tier=gold":                       false,
+	} {
+		w = serve("GET", "/api/v1/ad?limit=100&"+query, "")
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, eligible, strings.Contains(w.Body.String(), title), query)
+	}
+}
@@ -0,0 +1,87 @@
+package controller
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/text/language"
+)
+
+// maxLanguages bounds the preferred languages taken from a request.
+const maxLanguages = 8
+
+// wildcard is how "*" in Accept-Language parses.
+var wildcard = language.MustParse("mul")
+
+// acceptLanguage fills the lang parameter of q from the Accept-Language
+// header, unless the caller set it. A malformed header is ignored.
+func acceptLanguage(c *gin.Context, q url.Values) {
+	if q.Get("lang") != "" {
+		return
+	}
+	c.Writer.Header().Add("Vary", "Accept-Language")
+	header := c.GetHeader("Accept-Language")
+	if tags, err := parseLanguages(header); err == nil && len(tags) > 0 {
+		q.Set("lang", header)
+	}
+}
+
+// parseLanguages parses a single BCP 47 tag or a preference list in the
+// syntax of Accept-Language, most preferred first. Languages with q=0 and
+// "*" are dropped.
+func parseLanguages(s string) ([]language.Tag, error) {
+	tags, _, err := language.ParseAcceptLanguage(s)
+	if err != nil {
+		return nil, err
+	}
+
+	var languages []language.Tag
+	for _, tag := range tags {
+		if tag == language.Und || tag == wildcard {
+			continue
+		}
+		languages = append(languages, tag)
+		if len(languages) == maxLanguages {
+			break
+		}
+	}
+	return languages, nil
+}
+
+// languageCandidates returns the condition languages eligible for the
+// preferred languages: each tag with its trailing subtags removed one by
+// one, its language with the script, and its bare language. A "zh-TW"
+// viewer is thus eligible for "zh-TW", "zh-Hant" and "zh" advertisements.
+func languageCandidates(tags []language.Tag) []string {
+	var candidates []string
+	seen := map[string]bool{}
+	add := func(candidate string) {
+		if !seen[candidate] {
+			seen[candidate] = true
+			candidates = append(candidates, candidate)
+		}
+	}
+
+	for _, tag := range tags {
+		// Variants and extensions do not take part in matching.
+		base, script, region := tag.Raw()
+		tag, _ = language.Compose(base, script, region)
+
+		for s := tag.String(); s != ""; {
+			add(s)
+			i := strings.LastIndex(s, "-")
+			if i < 0 {
+				break
+			}
+			s = s[:i]
+		}
+
+		base, _ = tag.Base()
+		if script, confidence := tag.Script(); confidence != language.No {
+			add(base.String() + "-" + script.String())
+		}
+		add(base.String())
+	}
+	return candidates
+}
@@ -0,0 +1,102 @@
+package controller
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/text/language"
+)
+
+func TestParseLanguages(t *testing.T) {
+	testCases := []struct {
+		input  string
+		expect []language.Tag
+		err    bool
+	}{
+		{input: "zh-TW", expect: []language.Tag{language.MustParse("zh-TW")}},
+		{input: "en_us", expect: []language.Tag{language.AmericanEnglish}},
+		{
+			// Sorted by quality; q=0 and "*" are dropped.
+			input:  "en;q=0.5, zh-TW, fr;q=0, ja;q=0.8, *;q=0.1",
+			expect: []language.Tag{language.MustParse("zh-TW"), language.Japanese, language.English},
+		},
+		{input: "*"},
+		{input: "klingon-language", err: true},
+		{input: "en;q=high", err: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.input, func(t *testing.T) {
+			tags, err := parseLanguages(tc.input)
+			if tc.err {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expect, tags)
+		})
+	}
+}
+
+func TestLanguageCandidates(t *testing.T) {
+	testCases := []struct {
+		input  string
+		expect []string
+	}{
+		{input: "zh-TW", expect: []string{"zh-TW", "zh", "zh-Hant"}},
+		{input: "zh-Hant-TW", expect: []string{"zh-Hant-TW", "zh-Hant", "zh"}},
+		{input: "zh", expect: []string{"zh", "zh-Hans"}},
+		{input: "en-US-u-ca-gregory", expect: []string{"en-US", "en", "en-Latn"}},
+		{input: "pt-BR, pt;q=0.9, en;q=0.5", expect: []string{"pt-BR", "pt", "pt-Latn", "en", "en-Latn"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.input, func(t *testing.T) {
+			tags, err := parseLanguages(tc.input)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expect, languageCandidates(tags))
+		})
+	}
+}
+
+func TestParseListParamsLanguage(t *testing.T) {
+	testCases := []struct {
+		name      string
+		query     string
+		header    string
+		expect    []language.Tag
+		expectErr string
+	}{
+		{name: "Query", query: "lang=ja", header: "zh-TW", expect: []language.Tag{language.Japanese}},
+		{name: "Accept-Language", header: "zh-TW,zh;q=0.9", expect: []language.Tag{language.MustParse("zh-TW"), language.Chinese}},
+		{name: "Malformed header", header: "zh-TW;q=high"},
+		{name: "Wildcard header", header: "*"},
+		{name: "None"},
+		{name: "Invalid lang", query: "lang=klingon-language", expectErr: "invalid lang"},
+	}
+
+	gin.SetMode(gin.TestMode)
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodGet, "/api/v1/ad?"+tc.query, nil)
+			if tc.header != "" {
+				c.Request.Header.Set("Accept-Language", tc.header)
+			}
+
+			params, err := parseListParams(c)
+			if tc.expectErr != "" {
+				assert.EqualError(t, err, tc.expectErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expect, params.languages)
+			assert.Equal(t, tc.query == "", w.Header().Get("Vary") == "Accept-Language")
+		})
+	}
+}
@@ -0,0 +1,131 @@
+package controller
+
+import (
+	"database/sql"
+	"encoding/json"
+
+	"github.com/jmoiron/sqlx"
+	"golang.org/x/text/language"
+
+	dbpkg "github.com/jjshen2000/simple-ads/db"
+	"github.com/jjshen2000/simple-ads/models"
+)
+
+// nullString stores an empty string as NULL.
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
+
+// encodeLocalizations converts localizations to the value of the
+// localizations column.
+func encodeLocalizations(localizations []models.Localization) (interface{}, error) {
+	if len(localizations) == 0 {
+		return nil, nil
+	}
+	data, err := json.Marshal(localizations)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+// decodeLocalizations converts a stored localizations column back to the
+// localizations.
+func decodeLocalizations(data []byte) ([]models.Localization, error) {
+	if data == nil {
+		return nil, nil
+	}
+	var localizations []models.Localization
+	if err := json.Unmarshal(data, &localizations); err != nil {
+		return nil, err
+	}
+	return localizations, nil
+}
+
+// bestLocalization returns the index of the localization best matching
+// languages, or -1 when the default locale matches best or nothing matches.
+func bestLocalization(locale string, localizations []models.Localization, languages []language.Tag) int {
+	if len(localizations) == 0 || len(languages) == 0 {
+		return -1
+	}
+
+	supported := make([]language.Tag, 0, len(localizations)+1)
+	supported = append(supported, language.Make(locale))
+	for _, l := range localizations {
+		supported = append(supported, language.Make(l.Locale))
+	}
+
+	_, index, confidence := language.NewMatcher(supported).Match(languages...)
+	if confidence == language.No {
+		return -1
+	}
+	return index - 1
+}
+
+// loadContent replaces the title of each item with the variant best
+// matching languages and fills its locale and description, and its video
+// creative if withVideo.
+func loadContent(items []activeAd, languages []language.Tag, withVideo bool) error {
+	if len(items) == 0 {
+		return nil
+	}
+
+	ids := make([]int, 0, len(items))
+	for _, item := range items {
+		ids = append(ids, item.ID)
+	}
+	columns := "id, locale, description, localizations"
+	if withVideo {
+		columns += ", video"
+	}
+	query, args, err := sqlx.In("SELECT "+columns+" FROM advertisement WHERE id IN (?)", ids)
+	if err != nil {
+		return err
+	}
+
+	db := dbpkg.GetDB()
+	rows, err := db.Query(db.Rebind(query), args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	index := make(map[int]int, len(items))
+	for i, item := range items {
+		index[item.ID] = i
+	}
+	for rows.Next() {
+		var (
+			id                  int
+			locale, description sql.NullString
+			localizations       []byte
+			video               []byte
+		)
+		dest := []interface{}{&id, &locale, &description, &localizations}
+		if withVideo {
+			dest = append(dest, &video)
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return err
+		}
+
+		item := &items[index[id]]
+		item.Locale, item.Description = locale.String, description.String
+		if item.video, err = decodeVideo(video); err != nil {
+			return err
+		}
+
+		decoded, err := decodeLocalizations(localizations)
+		if err != nil {
+			return err
+		}
+		if i := bestLocalization(locale.String, decoded, languages); i >= 0 {
+			l := decoded[i]
+			item.Title, item.Locale, item.Description = l.Title, l.Locale, l.Description
+			if withVideo && l.Video != nil {
+				item.video = l.Video
+			}
+		}
+	}
+	return rows.Err()
+}
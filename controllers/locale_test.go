@@ -0,0 +1,46 @@
+package controller
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/text/language"
+
+	"github.com/jjshen2000/simple-ads/models"
+)
+
+func TestBestLocalization(t *testing.T) {
+	localizations := []models.Localization{
+		{Locale: "zh-TW", Title: "廣告"},
+		{Locale: "zh-CN", Title: "广告"},
+		{Locale: "ja", Title: "広告"},
+		{Locale: "pt", Title: "Anúncio"},
+	}
+
+	testCases := []struct {
+		name      string
+		languages string
+		expect    int
+	}{
+		{name: "Exact", languages: "ja", expect: 2},
+		{name: "Region", languages: "zh-CN", expect: 1},
+		{name: "Traditional script", languages: "zh-HK", expect: 0},
+		{name: "Base language", languages: "pt-BR", expect: 3},
+		{name: "Default locale", languages: "en-GB", expect: -1},
+		{name: "Preference order", languages: "fr, ja;q=0.8, zh-TW;q=0.5", expect: 2},
+		{name: "Default preferred", languages: "en, ja;q=0.5", expect: -1},
+		{name: "No match", languages: "ko", expect: -1},
+		{name: "No language", expect: -1},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			languages, err := parseLanguages(tc.languages)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expect, bestLocalization("en-US", localizations, languages))
+		})
+	}
+
+	languages := []language.Tag{language.Japanese}
+	assert.Equal(t, -1, bestLocalization("en", nil, languages))
+}
@@ -0,0 +1,44 @@
+package controller
+
+import (
+	"encoding/json"
+
+	"github.com/jjshen2000/simple-ads/models"
+	"github.com/jjshen2000/simple-ads/moderation"
+)
+
+// moderator checks advertisements when they are created or updated; nothing
+// is flagged until SetModerator.
+var moderator moderation.Checker = moderation.Pipeline{}
+
+// SetModerator replaces the checks run on advertisements. Flagged
+// advertisements are stored with their reasons and wait in pending_review.
+func SetModerator(c moderation.Checker) {
+	moderator = c
+}
+
+// encodeModerationReasons converts reasons to the value of the
+// moderation_reasons column, nil when there are none.
+func encodeModerationReasons(reasons []models.ModerationReason) (interface{}, error) {
+	if len(reasons) == 0 {
+		return nil, nil
+	}
+	data, err := json.Marshal(reasons)
+	if err != nil {
+		return nil, err
+	}
+	return string(data), nil
+}
+
+// decodeModerationReasons converts a stored moderation_reasons column back
+// to the reasons.
+func decodeModerationReasons(data []byte) ([]models.ModerationReason, error) {
+	if data == nil {
+		return nil, nil
+	}
+	var reasons []models.ModerationReason
+	if err := json.Unmarshal(data, &reasons); err != nil {
+		return nil, err
+	}
+	return reasons, nil
+}
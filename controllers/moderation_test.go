@@ -0,0 +1,72 @@
+package controller
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jjshen2000/simple-ads/models"
+	"github.com/jjshen2000/simple-ads/moderation"
+)
+
+func TestModeration(t *testing.T) {
+	words, err := moderation.NewWordChecker([]string{"scam"}, nil)
+	assert.NoError(t, err)
+	defer func(restore moderation.Checker) { moderator = restore }(moderator)
+	SetModerator(words)
+
+	ad := models.Advertisement{
+		Title:   fmt.Sprintf("AD moderation %d", time.Now().UnixNano()),
+		StartAt: time.Now().UTC().Add(-time.Hour),
+		EndAt:   time.Now().UTC().Add(time.Hour),
+	}
+	id, err := createAdvertisement(testOrigin, ad)
+	assert.NoError(t, err)
+	defer deleteAdvertisement(testOrigin, int(id))
+	approveAdvertisement(t, int(id))
+
+	// Flagged content goes back to review.
+	flagged := ad
+	flagged.Description = "Not a sc@m"
+	assert.NoError(t, updateAdvertisement(testOrigin, int(id), flagged))
+	loaded, err := getAdvertisement(int(id))
+	assert.NoError(t, err)
+	assert.Equal(t, models.StatusPendingReview, loaded.Status)
+	assert.Equal(t, []models.ModerationReason{
+		{Check: "bannedWord", Field: "description", Message: `contains "scam"`},
+	}, loaded.ModerationReasons)
+
+	// Clean content keeps the status and clears the reasons.
+	assert.NoError(t, updateAdvertisement(testOrigin, int(id), ad))
+	loaded, err = getAdvertisement(int(id))
+	assert.NoError(t, err)
+	assert.Equal(t, models.StatusPendingReview, loaded.Status)
+	assert.Nil(t, loaded.ModerationReasons)
+
+	// Edits of an approved advertisement go back to review once they change
+	// its content.
+	_, err = setAdvertisementStatus(testOrigin, int(id), models.StatusApproved)
+	assert.NoError(t, err)
+	extended := ad
+	extended.EndAt = ad.EndAt.Add(time.Hour)
+	assert.NoError(t, updateAdvertisement(testOrigin, int(id), extended))
+	loaded, err = getAdvertisement(int(id))
+	assert.NoError(t, err)
+	assert.Equal(t, models.StatusApproved, loaded.Status)
+	retitled := extended
+	retitled.Title += " v2"
+	assert.NoError(t, updateAdvertisement(testOrigin, int(id), retitled))
+	loaded, err = getAdvertisement(int(id))
+	assert.NoError(t, err)
+	assert.Equal(t, models.StatusPendingReview, loaded.Status)
+
+	flaggedID, err := createAdvertisement(testOrigin, flagged)
+	assert.NoError(t, err)
+	defer deleteAdvertisement(testOrigin, int(flaggedID))
+	loaded, err = getAdvertisement(int(flaggedID))
+	assert.NoError(t, err)
+	assert.Equal(t, models.StatusPendingReview, loaded.Status)
+	assert.Len(t, loaded.ModerationReasons, 1)
+}
@@ -0,0 +1,196 @@
+package controller
+
+import (
+	"fmt"
+	"html"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/jjshen2000/simple-ads/config"
+	"github.com/jjshen2000/simple-ads/models"
+	"github.com/jjshen2000/simple-ads/openrtb"
+	"github.com/jjshen2000/simple-ads/vast"
+)
+
+// bidQuery converts the targeting of a bid request to the query parameters
+// of GET /api/v1/ad, fetching one advertisement per impression.
+func bidQuery(t openrtb.Targeting, imps int) url.Values {
+	if imps > 100 {
+		imps = 100
+	}
+
+	q := url.Values{"limit": {strconv.Itoa(imps)}}
+	if t.Age != 0 {
+		q.Set("age", strconv.Itoa(t.Age))
+	}
+	if t.Gender != "" {
+		q.Set("gender", t.Gender)
+	}
+	if t.Country != "" {
+		q.Set("country", t.Country)
+	}
+	if t.Region != "" {
+		q.Set("region", t.Region)
+	}
+	if t.Platform != "" {
+		q.Set("platform", t.Platform)
+	}
+	// Exchanges send versions such as "17.1.2.1" or "14.0 beta"; the version
+	// is dropped unless it can be compared.
+	if version := truncateVersion(t.OSVersion); models.IsValidOSVersion(version) {
+		q.Set("osVersion", version)
+	}
+	if t.Device != "" {
+		q.Set("device", t.Device)
+	}
+	if tags, err := parseLanguages(t.Language); err == nil && len(tags) > 0 {
+		q.Set("lang", t.Language)
+	}
+	// Keywords and categories beyond the first maxKeywords are dropped, as
+	// are unknown categories, rather than failing the bid.
+	keywords := strings.Split(t.Keywords, ",")
+	if len(keywords) > maxKeywords {
+		keywords = keywords[:maxKeywords]
+	}
+	if _, err := parseKeywords(strings.Join(keywords, ",")); err == nil {
+		q.Set("keywords", strings.Join(keywords, ","))
+	}
+	var categories []string
+	for _, category := range t.Category {
+		if models.IsValidCategory(category) && len(categories) < maxKeywords {
+			categories = append(categories, category)
+		}
+	}
+	if len(categories) > 0 {
+		q.Set("category", strings.Join(categories, ","))
+	}
+	if t.UserID != "" && utf8.RuneCountInString(t.UserID) <= 256 {
+		q.Set("userId", t.UserID)
+	}
+	return q
+}
+
+// biddable reports whether the service may bid price on imp.
+func biddable(imp openrtb.Imp, price float64) bool {
+	if imp.BidFloorCur != "" && !strings.EqualFold(imp.BidFloorCur, openrtb.Currency) {
+		return imp.BidFloor == 0
+	}
+	return imp.BidFloor <= price
+}
+
+// buildBids assigns a distinct advertisement to each impression the service
+// may bid on, the first one that can fill it.
+func buildBids(req *openrtb.BidRequest, ads []activeAd, price float64) []openrtb.Bid {
+	var bids []openrtb.Bid
+	for _, imp := range req.Imp {
+		if !biddable(imp, price) {
+			continue
+		}
+
+		for i, ad := range ads {
+			bid, ok := fillImp(imp, ad)
+			if !ok {
+				continue
+			}
+			ads = append(ads[:i:i], ads[i+1:]...)
+			id := strconv.Itoa(ad.ID)
+			bid.ID = fmt.Sprintf("%s-%s", req.ID, imp.ID)
+			bid.ImpID, bid.Price, bid.AdID, bid.CrID = imp.ID, price, id, id
+			bids = append(bids, bid)
+			break
+		}
+	}
+	return bids
+}
+
+// fillImp renders ad for imp: as VAST when imp takes its video, or else as
+// HTML of the banner size. ok is false when ad fits neither.
+func fillImp(imp openrtb.Imp, ad activeAd) (bid openrtb.Bid, ok bool) {
+	if imp.Video != nil && ad.video != nil {
+		if video, ok := fitVideo(imp.Video, ad.video); ok {
+			if data, err := vast.New(vastAd(ad, video)).Marshal(); err == nil {
+				bid.AdM = string(data)
+				return bid, true
+			}
+		}
+	}
+	if imp.Banner != nil {
+		if w, h, ok := imp.Banner.Size(); ok {
+			bid.AdM = fmt.Sprintf(`<div style="width:%dpx;height:%dpx">%s</div>`, w, h, html.EscapeString(ad.Title))
+			bid.W, bid.H = w, h
+			return bid, true
+		}
+	}
+	return bid, false
+}
+
+// fitVideo returns video with only the media files the player accepts. ok is
+// false when it accepts none of them or the duration is out of its range.
+func fitVideo(v *openrtb.Video, video *models.Video) (*models.Video, bool) {
+	if (v.MinDuration > 0 && video.Duration < v.MinDuration) || (v.MaxDuration > 0 && video.Duration > v.MaxDuration) {
+		return nil, false
+	}
+	fitted := *video
+	fitted.MediaFiles = nil
+	for _, file := range video.MediaFiles {
+		if v.Accepts(file.Type) {
+			fitted.MediaFiles = append(fitted.MediaFiles, file)
+		}
+	}
+	return &fitted, len(fitted.MediaFiles) > 0
+}
+
+// Handler for OpenRTB 2.x bid requests
+//
+// Responds 204 without content when the service does not bid.
+func BidOpenRTB(c *gin.Context) {
+	req, err := openrtb.ParseBidRequest(c.Request.Body)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !req.AcceptsCurrency() {
+		c.Status(http.StatusNoContent)
+		return
+	}
+
+	// Targeting the list endpoint rejects is no reason to fail the
+	// exchange; the service just does not bid.
+	params, err := parseListQuery(bidQuery(req.Targeting(now()), len(req.Imp)))
+	if err != nil {
+		c.Status(http.StatusNoContent)
+		return
+	}
+	// Video creatives are loaded for video impressions, and only
+	// advertisements with one are listed when nothing else can be filled.
+	params.video = true
+	for _, imp := range req.Imp {
+		params.withVideo = params.withVideo || imp.Video != nil
+		params.video = params.video && imp.Video != nil && imp.Banner == nil
+	}
+
+	page, err := listActiveAdvertisements(params)
+	if err != nil {
+		c.JSON(errorResponse(err))
+		return
+	}
+
+	cfg := config.GetConfig()
+	bids := buildBids(req, page.Items, cfg.OpenRTB.BidPrice)
+	if len(bids) == 0 {
+		c.Status(http.StatusNoContent)
+		return
+	}
+
+	c.JSON(http.StatusOK, openrtb.BidResponse{
+		ID:      req.ID,
+		SeatBid: []openrtb.SeatBid{{Bid: bids, Seat: cfg.OpenRTB.Seat}},
+		Cur:     openrtb.Currency,
+	})
+}
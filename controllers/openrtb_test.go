@@ -0,0 +1,101 @@
+package controller
+
+import (
+	"net/url"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jjshen2000/simple-ads/models"
+	"github.com/jjshen2000/simple-ads/openrtb"
+)
+
+func TestBidQuery(t *testing.T) {
+	assert.Equal(t, url.Values{"limit": {"2"}}, bidQuery(openrtb.Targeting{}, 2))
+	assert.Equal(t, url.Values{
+		"limit":    {"100"},
+		"age":      {"34"},
+		"gender":   {"F"},
+		"country":  {"TW"},
+		"region":   {"TW-TPE"},
+		"platform": {"android"},
+	}, bidQuery(openrtb.Targeting{Age: 34, Gender: "F", Country: "TW", Region: "TW-TPE", Platform: "android"}, 150))
+	assert.Equal(t, url.Values{
+		"limit":     {"1"},
+		"platform":  {"ios"},
+		"osVersion": {"17.1.2"},
+		"device":    {"tablet"},
+		"lang":      {"ja"},
+		"keywords":  {"Sedan, electric vehicles"},
+		"category":  {"IAB2,IAB3-1"},
+		"userId":    {"customer-1"},
+	}, bidQuery(openrtb.Targeting{Platform: "ios", OSVersion: "17.1.2.1", Device: "tablet", Language: "ja",
+		Keywords: "Sedan, electric vehicles", Category: []string{"IAB2", "News", "IAB3-1"}, UserID: "customer-1"}, 1))
+	// An incomparable version or a malformed language is dropped rather than
+	// failing the bid.
+	assert.Equal(t, url.Values{
+		"limit":    {"1"},
+		"platform": {"android"},
+	}, bidQuery(openrtb.Targeting{Platform: "android", OSVersion: "14 beta", Language: "en-", Keywords: " , "}, 1))
+}
+
+func TestBuildBids(t *testing.T) {
+	banner := &openrtb.Banner{W: 300, H: 250}
+	req := &openrtb.BidRequest{
+		ID: "req",
+		Imp: []openrtb.Imp{
+			{ID: "1", BidFloor: 2, Banner: banner},
+			{ID: "2", BidFloor: 0.5, Banner: banner},
+			{ID: "3", BidFloor: 0.1, BidFloorCur: "EUR", Banner: banner},
+			{ID: "4", Banner: &openrtb.Banner{Format: []openrtb.Format{{W: 728, H: 90}}}},
+			{ID: "5", Banner: banner},
+		},
+	}
+	ads := []activeAd{{ID: 7, Title: "AD <7>"}, {ID: 9, Title: "AD 9"}}
+
+	assert.Equal(t, []openrtb.Bid{
+		{ID: "req-2", ImpID: "2", Price: 1, AdID: "7", CrID: "7", W: 300, H: 250,
+			AdM: `<div style="width:300px;height:250px">AD &lt;7&gt;</div>`},
+		{ID: "req-4", ImpID: "4", Price: 1, AdID: "9", CrID: "9", W: 728, H: 90,
+			AdM: `<div style="width:728px;height:90px">AD 9</div>`},
+	}, buildBids(req, ads, 1))
+	assert.Empty(t, buildBids(req, nil, 1))
+
+	// Impressions without a size or a format the ads have get no bid.
+	req.Imp = []openrtb.Imp{{ID: "1"}, {ID: "2", Banner: &openrtb.Banner{W: 300}}, {ID: "3", Native: []byte("{}")}}
+	assert.Empty(t, buildBids(req, ads, 1))
+}
+
+func TestBuildVideoBids(t *testing.T) {
+	video := &models.Video{
+		Duration:    15,
+		Impressions: []string{"https://example.com/imp"},
+		MediaFiles: []models.MediaFile{
+			{URL: "https://example.com/ad.webm", Type: "video/webm", Width: 640, Height: 360},
+			{URL: "https://example.com/ad.mp4", Type: "video/mp4", Width: 640, Height: 360},
+		},
+	}
+	req := &openrtb.BidRequest{
+		ID: "req",
+		Imp: []openrtb.Imp{
+			{ID: "1", Video: &openrtb.Video{Mimes: []string{"video/mp4"}, MaxDuration: 30}},
+			{ID: "2", Video: &openrtb.Video{MaxDuration: 10}},
+			{ID: "3", Video: &openrtb.Video{Mimes: []string{"video/mp4"}}, Banner: &openrtb.Banner{W: 320, H: 50}},
+		},
+	}
+	ads := []activeAd{{ID: 7, Title: "AD 7"}, {ID: 8, Title: "AD 8", video: video}}
+
+	bids := buildBids(req, ads, 1)
+	if !assert.Len(t, bids, 2) {
+		return
+	}
+	// The video ad goes to the first impression taking it, the other ad
+	// to the banner; the second impression only takes shorter videos.
+	assert.Equal(t, []string{"1", "8"}, []string{bids[0].ImpID, bids[0].AdID})
+	assert.Contains(t, bids[0].AdM, `<VAST version="4.2"`)
+	assert.Contains(t, bids[0].AdM, "https://example.com/ad.mp4")
+	assert.NotContains(t, bids[0].AdM, "ad.webm")
+	assert.Equal(t, []string{"3", "7"}, []string{bids[1].ImpID, bids[1].AdID})
+	assert.Equal(t, `<div style="width:320px;height:50px">AD 7</div>`, bids[1].AdM)
+	assert.Len(t, video.MediaFiles, 2)
+}
@@ -0,0 +1,112 @@
+package controller
+
+import (
+	"database/sql"
+	"errors"
+	"net/url"
+	"strconv"
+
+	"github.com/jjshen2000/simple-ads/models"
+)
+
+var platformMap = map[string]uint8{
+	"android": 1,
+	"ios":     2,
+	"web":     4,
+}
+
+// platformDimension targets conditions by the platform of the request,
+// stored as bits of platformMap.
+type platformDimension struct{}
+
+func init() {
+	registerDimension(platformDimension{})
+}
+
+func (platformDimension) name() string {
+	return "platform"
+}
+
+func (platformDimension) parse(q url.Values) (interface{}, error) {
+	platform := q.Get("platform")
+	if platform == "" {
+		return nil, nil
+	}
+	if !isValidPlatform(platform) {
+		return nil, errors.New("invalid platform")
+	}
+	return platform, nil
+}
+
+func (platformDimension) validate(models.Conditions) error {
+	return nil
+}
+
+func (platformDimension) columns(condition models.Conditions) []column {
+	return []column{{"platform", getPlatformBits(condition.Platform)}}
+}
+
+func (platformDimension) selects() []string {
+	return []string{"ac.platform"}
+}
+
+func (platformDimension) load(condition *models.Conditions, values []sql.NullString) error {
+	bits, err := strconv.ParseUint(values[0].String, 10, 8)
+	if err != nil {
+		return err
+	}
+	condition.Platform = getPlatforms(uint8(bits))
+	return nil
+}
+
+func (platformDimension) match(value interface{}) (string, []interface{}) {
+	platformMask := platformMap[value.(string)]
+	return "(ac.platform & ?) = ?", []interface{}{platformMask, platformMask}
+}
+
+func (platformDimension) untargeted() string {
+	return "ac.platform = 7"
+}
+
+// getPlatformBits returns bits value mapping from slice of platforms.
+//
+// If no platform is indicated in the slice, return 7 (111 in binary).
+// If the slice contains an invalid platform, return 0.
+func getPlatformBits(platforms []string) uint8 {
+	var platformBits uint8
+	for _, p := range platforms {
+		bit, found := platformMap[p]
+		if !found { // invalid
+			return 0
+		}
+		platformBits |= bit
+	}
+	if platformBits == 0 { // no specific platform is indicated
+		platformBits = 7
+	}
+	return platformBits
+}
+
+// getPlatforms is the inverse of getPlatformBits.
+//
+// If every platform is set, return nil since the condition does not restrict platforms.
+func getPlatforms(platformBits uint8) []string {
+	if platformBits == 7 {
+		return nil
+	}
+
+	var platforms []string
+	for _, p := range []string{"android", "ios", "web"} {
+		if platformBits&platformMap[p] != 0 {
+			platforms = append(platforms, p)
+		}
+	}
+	return platforms
+}
+
+// isValidPlatform checks if the given platform is valid.
+// It returns true if the platform is empty (indicating no platform specified),
+// or if the platform exists in the platformMap; otherwise, it returns false.
+func isValidPlatform(platform string) bool {
+	return platform == "" || platformMap[platform] != 0
+}
@@ -0,0 +1,307 @@
+package controller
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+
+	dbpkg "github.com/jjshen2000/simple-ads/db"
+	"github.com/jjshen2000/simple-ads/models"
+)
+
+var (
+	errRevisionNotFound = errors.New("revision not found")
+	errNotDeleted       = errors.New("advertisement is not deleted")
+)
+
+// The revisions taken of the advertisements existing before revisions have
+// this action and actor.
+const (
+	snapshotAction = "ad.snapshot"
+	snapshotActor  = "migration"
+)
+
+func init() {
+	// Migration 16 introduced revisions.
+	dbpkg.RegisterBackfill(16, seedRevisions)
+}
+
+// seedRevisions takes revision 1 of every advertisement without any, so that
+// the first change of those existing before revisions keeps what they were.
+func seedRevisions(tx *sqlx.Tx) error {
+	rows, err := tx.Query(selectAdvertisements(`a.deleted_at IS NULL AND NOT EXISTS
+		(SELECT 1 FROM advertisement_revision AS r WHERE r.advertisement_id = a.id)`))
+	if err != nil {
+		return &stepError{"select advertisements", err}
+	}
+	var ads []models.Advertisement
+	err = scanAdvertisements(rows, func(ad models.Advertisement) error {
+		ads = append(ads, ad)
+		return nil
+	})
+	rows.Close()
+	if err != nil {
+		return &stepError{"scan advertisements", err}
+	}
+
+	for _, ad := range ads {
+		content, err := json.Marshal(ad)
+		if err != nil {
+			return &stepError{"encode revision", err}
+		}
+		if _, err := tx.Exec(`INSERT INTO advertisement_revision (advertisement_id, revision, created_at, actor, action, content)
+			VALUES (?, 1, ?, ?, ?, ?)`, ad.ID, now(), snapshotActor, snapshotAction, content); err != nil {
+			return &stepError{"insert revision", err}
+		}
+	}
+	return nil
+}
+
+// recordAdvertisementChange takes a revision of advertisement id, appends
+// action on it to the audit log and queues its webhook events, inside tx
+// after the change. before is the
+// advertisement loaded before the change, nil when creating or restoring
+// it. The revision holds the advertisement loaded again from tx, or before
+// when deleting it.
+func recordAdvertisementChange(tx *sqlx.Tx, o origin, action string, id int, before *models.Advertisement) error {
+	var after *models.Advertisement
+	if action != auditAdDelete {
+		ad, err := loadAdvertisement(tx, id)
+		if err != nil {
+			return &stepError{"load advertisement", err}
+		}
+		after = &ad
+	}
+
+	snapshot := after
+	if snapshot == nil {
+		snapshot = before
+	}
+	content, err := json.Marshal(snapshot)
+	if err != nil {
+		return &stepError{"encode revision", err}
+	}
+	// Changes to an advertisement lock its row first, so revision numbers
+	// do not race.
+	insertRevision := `INSERT INTO advertisement_revision (advertisement_id, revision, created_at, actor, action, content)
+		SELECT ?, COALESCE(MAX(revision), 0) + 1, ?, ?, ?, ? FROM advertisement_revision WHERE advertisement_id = ?`
+	if _, err := tx.Exec(insertRevision, id, now(), o.actor, action, content, id); err != nil {
+		return &stepError{"insert revision", err}
+	}
+
+	// Typed nil pointers would encode as null rather than as no fields.
+	var beforeValue, afterValue interface{}
+	if before != nil {
+		beforeValue = before
+	}
+	if after != nil {
+		afterValue = after
+	}
+	if err := writeAudit(tx, o, action, auditEntityAd, id, beforeValue, afterValue); err != nil {
+		return err
+	}
+	return queueAdvertisementEvents(tx, action, before, after)
+}
+
+// listRevisions returns the revisions of advertisement id, deleted or not,
+// newest first.
+func listRevisions(id int) ([]models.Revision, error) {
+	db := dbpkg.GetDB()
+
+	var exists bool
+	if err := db.Get(&exists, "SELECT EXISTS(SELECT 1 FROM advertisement WHERE id = ?)", id); err != nil {
+		return nil, &stepError{"select advertisement", err}
+	}
+	if !exists {
+		return nil, errNotFound
+	}
+
+	rows, err := db.Query(`SELECT revision, created_at, actor, action, content FROM advertisement_revision
+		WHERE advertisement_id = ? ORDER BY revision DESC`, id)
+	if err != nil {
+		return nil, &stepError{"select revisions", err}
+	}
+	defer rows.Close()
+
+	revisions := []models.Revision{}
+	for rows.Next() {
+		var r models.Revision
+		var content []byte
+		if err := rows.Scan(&r.Revision, &r.CreatedAt, &r.Actor, &r.Action, &content); err != nil {
+			return nil, &stepError{"scan revision", err}
+		}
+		if err := json.Unmarshal(content, &r.Advertisement); err != nil {
+			return nil, &stepError{"decode revision", err}
+		}
+		revisions = append(revisions, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, &stepError{"select revisions", err}
+	}
+	return revisions, nil
+}
+
+// loadRevision reads revision of advertisement id.
+func loadRevision(q sqlx.Queryer, id, revision int) (ad models.Advertisement, err error) {
+	var content []byte
+	err = q.QueryRowx("SELECT content FROM advertisement_revision WHERE advertisement_id = ? AND revision = ?",
+		id, revision).Scan(&content)
+	if err == sql.ErrNoRows {
+		return ad, errRevisionNotFound
+	}
+	if err != nil {
+		return ad, &stepError{"select revision", err}
+	}
+	if err := json.Unmarshal(content, &ad); err != nil {
+		return ad, &stepError{"decode revision", err}
+	}
+	return ad, nil
+}
+
+// diffRevisions returns the top-level fields of advertisement id that
+// differ from revision from to revision to.
+func diffRevisions(id, from, to int) (map[string]models.AuditChange, error) {
+	db := dbpkg.GetDB()
+	before, err := loadRevision(db, id, from)
+	if err != nil {
+		return nil, err
+	}
+	after, err := loadRevision(db, id, to)
+	if err != nil {
+		return nil, err
+	}
+	changes, err := auditDiff(before, after)
+	if err != nil {
+		return nil, &stepError{"diff revisions", err}
+	}
+	return changes, nil
+}
+
+// restoreAdvertisement undeletes advertisement id with the status and
+// conditions it had when deleted.
+func restoreAdvertisement(o origin, id int) error {
+	tx := dbpkg.GetDB().MustBegin()
+	defer tx.Rollback()
+
+	var deletedAt sql.NullTime
+	err := tx.Get(&deletedAt, "SELECT deleted_at FROM advertisement WHERE id = ? FOR UPDATE", id)
+	if err == sql.ErrNoRows {
+		return errNotFound
+	}
+	if err != nil {
+		return &stepError{"select advertisement", err}
+	}
+	if !deletedAt.Valid {
+		return errNotDeleted
+	}
+
+	if _, err := tx.Exec("UPDATE advertisement SET deleted_at = NULL WHERE id = ?", id); err != nil {
+		return &stepError{"restore advertisement", err}
+	}
+	if err := recordAdvertisementChange(tx, o, auditAdRestore, id, nil); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return &stepError{"commit", err}
+	}
+	return nil
+}
+
+// restoreRevision replaces advertisement id with the content and conditions
+// of one of its revisions, as updateAdvertisement does, so the status is
+// kept and moderation checks the content again.
+func restoreRevision(o origin, id, revision int) error {
+	ad, err := loadRevision(dbpkg.GetDB(), id, revision)
+	if err != nil {
+		return err
+	}
+	return replaceAdvertisement(o, auditAdRevert, id, ad)
+}
+
+// parseRevision parses the query or path parameter name as a revision number.
+func parseRevision(value string) (int, bool) {
+	revision, err := strconv.Atoi(value)
+	return revision, err == nil && revision >= 1
+}
+
+// Handler for listing the revisions of an advertisement, newest first
+func ListAdvertisementRevisions(c *gin.Context) {
+	id, ok := parseAdID(c)
+	if !ok {
+		return
+	}
+
+	revisions, err := listRevisions(id)
+	if err != nil {
+		c.JSON(errorResponse(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"items": revisions})
+}
+
+// Handler for comparing two revisions of an advertisement
+func DiffAdvertisementRevisions(c *gin.Context) {
+	id, ok := parseAdID(c)
+	if !ok {
+		return
+	}
+	from, ok := parseRevision(c.Query("from"))
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid from"})
+		return
+	}
+	to, ok := parseRevision(c.Query("to"))
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid to"})
+		return
+	}
+
+	changes, err := diffRevisions(id, from, to)
+	if err != nil {
+		c.JSON(errorResponse(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"changes": changes})
+}
+
+// Handler for restoring a deleted advertisement
+func RestoreAdvertisement(c *gin.Context) {
+	id, ok := parseAdID(c)
+	if !ok {
+		return
+	}
+
+	if err := restoreAdvertisement(ginOrigin(c), id); err != nil {
+		c.JSON(errorResponse(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Advertisement restored successfully"})
+}
+
+// Handler for restoring an advertisement to one of its revisions
+func RestoreAdvertisementRevision(c *gin.Context) {
+	id, ok := parseAdID(c)
+	if !ok {
+		return
+	}
+	revision, ok := parseRevision(c.Param("revision"))
+	if !ok {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid revision"})
+		return
+	}
+
+	if err := restoreRevision(ginOrigin(c), id, revision); err != nil {
+		c.JSON(errorResponse(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Advertisement restored successfully"})
+}
@@ -0,0 +1,177 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	dbpkg "github.com/jjshen2000/simple-ads/db"
+	"github.com/jjshen2000/simple-ads/models"
+)
+
+func TestRevisions(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(RequestID(), func(c *gin.Context) { c.Set(actorKey, "editor") })
+	router.POST("/api/v1/ad", CreateAdvertisement)
+	router.GET("/api/v1/ad/:id", GetAdvertisement)
+	router.PUT("/api/v1/ad/:id", UpdateAdvertisement)
+	router.DELETE("/api/v1/ad/:id", DeleteAdvertisement)
+	router.GET("/api/v1/ad/:id/revisions", ListAdvertisementRevisions)
+	router.GET("/api/v1/ad/:id/revisions/diff", DiffAdvertisementRevisions)
+	router.POST("/api/v1/ad/:id/revisions/:revision/restore", RestoreAdvertisementRevision)
+	router.POST("/api/v1/ad/:id/restore", RestoreAdvertisement)
+
+	serve := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+	revisions := func(path string) []models.Revision {
+		w := serve("GET", path+"/revisions", "")
+		assert.Equal(t, http.StatusOK, w.Code)
+		var page struct{ Items []models.Revision }
+		assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &page))
+		return page.Items
+	}
+
+	start := time.Now().UTC().Add(-time.Hour).Format(time.RFC3339)
+	end := time.Now().UTC().Add(time.Hour).Format(time.RFC3339)
+	w := serve("POST", "/api/v1/ad", fmt.Sprintf(`{"title":"AD v1","startAt":%q,"endAt":%q,
+		"conditions":[{"country":["TW"]}]}`, start, end))
+	assert.Equal(t, http.StatusCreated, w.Code)
+	id := createdID(t, w)
+	path := fmt.Sprintf("/api/v1/ad/%d", id)
+	defer deleteAdvertisement(testOrigin, id)
+
+	w = serve("PUT", path, fmt.Sprintf(`{"title":"AD v2","startAt":%q,"endAt":%q,
+		"conditions":[{"country":["JP"]}]}`, start, end))
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = serve("GET", path+"/revisions/diff?from=1&to=2", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	var diff struct{ Changes map[string]models.AuditChange }
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &diff))
+	assert.Equal(t, []string{"conditions", "title"}, sortedKeys(diff.Changes))
+	assert.Equal(t, models.AuditChange{Before: json.RawMessage(`"AD v1"`), After: json.RawMessage(`"AD v2"`)},
+		diff.Changes["title"])
+
+	w = serve("GET", path+"/revisions/diff?from=1&to=9", "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, `{"error":"revision not found"}`, w.Body.String())
+
+	// Deleting is soft: the advertisement is gone but keeps its history.
+	w = serve("DELETE", path, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = serve("GET", path, "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	w = serve("POST", path+"/revisions/1/restore", "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	history := revisions(path)
+	if assert.Len(t, history, 3) {
+		assert.Equal(t, []int{3, 2, 1}, []int{history[0].Revision, history[1].Revision, history[2].Revision})
+		assert.Equal(t, "ad.delete", history[0].Action)
+		assert.Equal(t, "AD v2", history[0].Advertisement.Title)
+		assert.Equal(t, "editor", history[2].Actor)
+		assert.Equal(t, []string{"TW"}, history[2].Advertisement.Conditions[0].Country)
+	}
+
+	w = serve("POST", path+"/restore", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = serve("POST", path+"/restore", "")
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Equal(t, `{"error":"advertisement is not deleted"}`, w.Body.String())
+
+	w = serve("POST", path+"/revisions/1/restore", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = serve("GET", path, "")
+	var ad models.Advertisement
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &ad))
+	assert.Equal(t, "AD v1", ad.Title)
+	if assert.Len(t, ad.Conditions, 1) {
+		assert.Equal(t, []string{"TW"}, ad.Conditions[0].Country)
+	}
+	assert.Equal(t, models.StatusDraft, ad.Status)
+
+	history = revisions(path)
+	if assert.Len(t, history, 5) {
+		assert.Equal(t, "ad.revert", history[0].Action)
+		assert.Equal(t, "ad.restore", history[1].Action)
+	}
+
+	w = serve("GET", "/api/v1/ad/2147483647/revisions", "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestSeedRevisions(t *testing.T) {
+	id, err := createAdvertisement(testOrigin, models.Advertisement{
+		Title:      "AD legacy",
+		StartAt:    time.Now().UTC().Add(-time.Hour),
+		EndAt:      time.Now().UTC().Add(time.Hour),
+		Conditions: []models.Conditions{{Country: []string{"TW"}}},
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer deleteAdvertisement(testOrigin, int(id))
+
+	// An advertisement created before revisions has none.
+	db := dbpkg.GetDB()
+	_, err = db.Exec("DELETE FROM advertisement_revision WHERE advertisement_id = ?", id)
+	assert.NoError(t, err)
+	for i := 0; i < 2; i++ {
+		tx := db.MustBegin()
+		assert.NoError(t, seedRevisions(tx))
+		assert.NoError(t, tx.Commit())
+	}
+
+	history, err := listRevisions(int(id))
+	assert.NoError(t, err)
+	if assert.Len(t, history, 1) {
+		assert.Equal(t, 1, history[0].Revision)
+		assert.Equal(t, snapshotAction, history[0].Action)
+		assert.Equal(t, snapshotActor, history[0].Actor)
+		assert.Equal(t, "AD legacy", history[0].Advertisement.Title)
+		assert.Equal(t, []string{"TW"}, history[0].Advertisement.Conditions[0].Country)
+	}
+}
+
+func TestConcurrentDeletes(t *testing.T) {
+	id, err := createAdvertisement(testOrigin, models.Advertisement{
+		Title:   "AD deleted twice",
+		StartAt: time.Now().UTC().Add(-time.Hour),
+		EndAt:   time.Now().UTC().Add(time.Hour),
+	})
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	errs := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() { errs <- deleteAdvertisement(testOrigin, int(id)) }()
+	}
+	assert.ElementsMatch(t, []error{nil, errNotFound}, []error{<-errs, <-errs})
+
+	history, err := listRevisions(int(id))
+	assert.NoError(t, err)
+	assert.Len(t, history, 2)
+}
+
+func sortedKeys(changes map[string]models.AuditChange) []string {
+	keys := make([]string, 0, len(changes))
+	for key := range changes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,363 @@
+package controller
+
+import (
+	"database/sql"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/go-playground/validator/v10"
+
+	"github.com/jjshen2000/simple-ads/audience"
+	dbpkg "github.com/jjshen2000/simple-ads/db"
+	"github.com/jjshen2000/simple-ads/models"
+)
+
+// The functions in this file implement the advertisement operations shared
+// by the gin handlers and the gRPC server, so both behave identically.
+
+var errNotFound = errors.New("advertisement not found")
+
+// stepError records which statement of a write failed.
+type stepError struct {
+	step string
+	err  error
+}
+
+func (e *stepError) Error() string {
+	return e.step + ": " + e.err.Error()
+}
+
+func (e *stepError) Unwrap() error {
+	return e.err
+}
+
+// isInvalid reports whether err was caused by invalid input.
+func isInvalid(err error) bool {
+	var validationErrs validator.ValidationErrors
+	var exprErr *models.ExprError
+	var conditionErr *conditionError
+	return errors.As(err, &validationErrs) || errors.As(err, &exprErr) || errors.As(err, &conditionErr) ||
+		errors.Is(err, errUnknownAudience) || errors.Is(err, errInvalidStatus)
+}
+
+// errorResponse maps an error of the shared operations to an HTTP status and body.
+func errorResponse(err error) (int, gin.H) {
+	var se *stepError
+	var te *transitionError
+	switch {
+	case isInvalid(err):
+		return http.StatusBadRequest, gin.H{"error": err.Error()}
+	case errors.Is(err, errNotFound) || errors.Is(err, errRevisionNotFound) ||
+		errors.Is(err, errWebhookNotFound) || errors.Is(err, errDeadLetterNotFound):
+		return http.StatusNotFound, gin.H{"error": err.Error()}
+	case errors.As(err, &te) || errors.Is(err, errNotDeleted):
+		return http.StatusConflict, gin.H{"error": err.Error()}
+	case errors.As(err, &se):
+		return http.StatusInternalServerError, gin.H{"error(" + se.step + ")": se.err.Error()}
+	}
+	return http.StatusInternalServerError, gin.H{"error": err.Error()}
+}
+
+// createAdvertisement validates ad and stores it with its conditions as a
+// draft.
+func createAdvertisement(o origin, ad models.Advertisement) (int64, error) {
+	if err := validateAdvertisement(ad); err != nil {
+		return 0, err
+	}
+
+	tx := dbpkg.GetDB().MustBegin()
+
+	adID, err := insertAdvertisement(tx, ad)
+	if err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+	if err := recordAdvertisementChange(tx, o, auditAdCreate, int(adID), nil); err != nil {
+		tx.Rollback()
+		return 0, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, &stepError{"commit", err}
+	}
+	syncTargetingAfterWrite()
+	return adID, nil
+}
+
+// getAdvertisement reads an advertisement with its conditions.
+func getAdvertisement(id int) (models.Advertisement, error) {
+	ad, err := loadAdvertisement(dbpkg.GetDB(), id)
+	if err == sql.ErrNoRows {
+		return ad, errNotFound
+	}
+	if err != nil {
+		return ad, errors.New("Failed to fetch advertisement")
+	}
+	return ad, nil
+}
+
+// updateAdvertisement validates ad and replaces advertisement id and its conditions with it.
+// The status is kept unless moderation flags ad or the content of an
+// approved or paused advertisement changes, as editedStatus decides.
+func updateAdvertisement(o origin, id int, ad models.Advertisement) error {
+	return replaceAdvertisement(o, auditAdUpdate, id, ad)
+}
+
+// replaceAdvertisement updates advertisement id as updateAdvertisement does,
+// recording the change as action.
+func replaceAdvertisement(o origin, action string, id int, ad models.Advertisement) error {
+	if err := validateAdvertisement(ad); err != nil {
+		return err
+	}
+
+	video, err := encodeVideo(ad.Video)
+	if err != nil {
+		return &stepError{"encode video", err}
+	}
+	localizations, err := encodeLocalizations(ad.Localizations)
+	if err != nil {
+		return &stepError{"encode localizations", err}
+	}
+	reasons := moderator.Check(ad)
+	moderationReasons, err := encodeModerationReasons(reasons)
+	if err != nil {
+		return &stepError{"encode moderation reasons", err}
+	}
+
+	tx := dbpkg.GetDB().MustBegin()
+
+	var from string
+	err = tx.Get(&from, "SELECT status FROM advertisement WHERE id = ? AND deleted_at IS NULL FOR UPDATE", id)
+	if err == sql.ErrNoRows {
+		tx.Rollback()
+		return errNotFound
+	}
+	if err != nil {
+		tx.Rollback()
+		return &stepError{"select status", err}
+	}
+	before, err := loadAdvertisement(tx, id)
+	if err != nil {
+		tx.Rollback()
+		return &stepError{"load advertisement", err}
+	}
+	changed, err := contentChanged(before, ad)
+	if err != nil {
+		tx.Rollback()
+		return &stepError{"compare content", err}
+	}
+
+	updateAd := `UPDATE advertisement SET title = ?, start_at = ?, end_at = ?, video = ?,
+		locale = ?, description = ?, localizations = ?, moderation_reasons = ?,
+		status = ? WHERE id = ?`
+	_, err = tx.Exec(updateAd, ad.Title, ad.StartAt, ad.EndAt, video,
+		nullString(ad.Locale), nullString(ad.Description), localizations, moderationReasons,
+		editedStatus(from, len(reasons) > 0, changed), id)
+	if err != nil {
+		tx.Rollback()
+		return &stepError{"update advertisement", err}
+	}
+
+	if err := deleteConditions(tx, id); err != nil {
+		tx.Rollback()
+		return &stepError{"delete condition", err}
+	}
+
+	if err := insertConditions(tx, int64(id), ad.Conditions); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := recordAdvertisementChange(tx, o, action, id, &before); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return &stepError{"commit", err}
+	}
+	syncTargetingAfterWrite()
+	return nil
+}
+
+// deleteAdvertisement marks advertisement id as deleted. It keeps its
+// conditions so that restoreAdvertisement can bring it back.
+func deleteAdvertisement(o origin, id int) error {
+	tx := dbpkg.GetDB().MustBegin()
+
+	var status string
+	err := tx.Get(&status, "SELECT status FROM advertisement WHERE id = ? AND deleted_at IS NULL FOR UPDATE", id)
+	if err == sql.ErrNoRows {
+		tx.Rollback()
+		return errNotFound
+	}
+	if err != nil {
+		tx.Rollback()
+		return &stepError{"select status", err}
+	}
+	before, err := loadAdvertisement(tx, id)
+	if err != nil {
+		tx.Rollback()
+		return &stepError{"load advertisement", err}
+	}
+
+	if _, err := tx.Exec("UPDATE advertisement SET deleted_at = ? WHERE id = ? AND deleted_at IS NULL", now(), id); err != nil {
+		tx.Rollback()
+		return &stepError{"delete advertisement", err}
+	}
+
+	if err := recordAdvertisementChange(tx, o, auditAdDelete, id, &before); err != nil {
+		tx.Rollback()
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return &stepError{"commit", err}
+	}
+	return nil
+}
+
+// activeAd is an entry of the active advertisement list, in the variant
+// best matching the languages of the target.
+type activeAd struct {
+	ID          int       `json:"-"`
+	Title       string    `json:"title"`
+	EndAt       time.Time `json:"endAt"`
+	Locale      string    `json:"locale,omitempty"`
+	Description string    `json:"description,omitempty"`
+	// video is only loaded when listing video advertisements.
+	video *models.Video
+	// score is the number of keywords matched when listing by keywords.
+	score int
+}
+
+// activeAdPage is a page of the active advertisement list.
+type activeAdPage struct {
+	Items      []activeAd
+	NextCursor string
+	// Total is only set when params.includeTotal is true.
+	Total *int
+}
+
+// listActiveAdvertisements returns the page of active advertisements matching params.
+func listActiveAdvertisements(params listParams) (page activeAdPage, err error) {
+	if params.at.IsZero() {
+		params.at = now()
+	}
+	params.slots = localTimes(params.at, targetingTimezones())
+	if params.userID != "" {
+		params.audiences = audiences.Matching(audience.HashUserID(params.userID))
+	}
+	params.expressions = hasExpressions()
+
+	// Without expressions one query returns the page. With them, the rows
+	// are filtered here, and further rows are fetched after the last one
+	// until the page is full or none are left.
+	for {
+		scanned, last, err := scanActiveAdvertisements(&page, params)
+		if err != nil {
+			return page, err
+		}
+		if page.NextCursor != "" || scanned <= params.limit {
+			break
+		}
+		params.cursor = &last
+	}
+
+	if err := loadContent(page.Items, params.languages, params.video || params.withVideo); err != nil {
+		return page, errors.New("Failed to fetch content")
+	}
+
+	if params.includeTotal {
+		total, err := countActiveAdvertisements(params)
+		if err != nil {
+			return page, errors.New("Failed to count advertisements")
+		}
+		page.Total = &total
+	}
+
+	return page, nil
+}
+
+// scanActiveAdvertisements runs the list query of params, appending the
+// eligible advertisements to page until it holds params.limit of them and
+// setting page.NextCursor when more follow. It returns the number of rows
+// scanned and the position of the last one.
+func scanActiveAdvertisements(page *activeAdPage, params listParams) (scanned int, last cursor, err error) {
+	query, args := buildQuery(params)
+
+	rows, err := dbpkg.GetDB().Queryx(query, args...)
+	if err != nil {
+		return 0, last, errors.New("Failed to fetch advertisements")
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var ad activeAd
+		var open bool
+		var exprIDs sql.NullString
+		dest := []interface{}{&ad.ID, &ad.Title, &ad.EndAt}
+		if params.keywords != nil {
+			dest = append(dest, &ad.score)
+		}
+		if params.expressions {
+			dest = append(dest, &open, &exprIDs)
+		}
+		if err := rows.Scan(dest...); err != nil {
+			return scanned, last, errors.New("Failed to parse advertisement")
+		}
+		scanned++
+		last = cursor{endAt: ad.EndAt, id: ad.ID, score: ad.score}
+
+		if params.expressions {
+			eligible, err := exprEligible(open, exprIDs, params.kv)
+			if err != nil {
+				return scanned, last, errors.New("Failed to parse advertisement")
+			}
+			if !eligible {
+				continue
+			}
+		}
+
+		if len(page.Items) == params.limit {
+			end := page.Items[len(page.Items)-1]
+			page.NextCursor = encodeCursor(cursor{endAt: end.EndAt, id: end.ID, score: end.score})
+			break
+		}
+		page.Items = append(page.Items, ad)
+	}
+	return scanned, last, rows.Err()
+}
+
+// countActiveAdvertisements counts every advertisement matching params.
+func countActiveAdvertisements(params listParams) (total int, err error) {
+	db := dbpkg.GetDB()
+	query, args := buildCountQuery(params)
+	if !params.expressions {
+		err = db.Get(&total, query, args...)
+		return total, err
+	}
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return 0, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var open bool
+		var exprIDs sql.NullString
+		if err := rows.Scan(&open, &exprIDs); err != nil {
+			return 0, err
+		}
+		eligible, err := exprEligible(open, exprIDs, params.kv)
+		if err != nil {
+			return 0, err
+		}
+		if eligible {
+			total++
+		}
+	}
+	return total, rows.Err()
+}
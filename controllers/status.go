@@ -0,0 +1,121 @@
+package controller
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	dbpkg "github.com/jjshen2000/simple-ads/db"
+	"github.com/jjshen2000/simple-ads/models"
+)
+
+var errInvalidStatus = errors.New("invalid status")
+
+// transitionError is a status change the lifecycle does not allow.
+type transitionError struct {
+	from, to string
+}
+
+func (e *transitionError) Error() string {
+	return fmt.Sprintf("cannot change status from %s to %s", e.from, e.to)
+}
+
+// setAdvertisementStatus moves advertisement id to status to and returns its
+// previous status.
+func setAdvertisementStatus(o origin, id int, to string) (from string, err error) {
+	if !models.IsValidStatus(to) {
+		return "", errInvalidStatus
+	}
+
+	tx := dbpkg.GetDB().MustBegin()
+	defer tx.Rollback()
+
+	err = tx.Get(&from, "SELECT status FROM advertisement WHERE id = ? AND deleted_at IS NULL FOR UPDATE", id)
+	if err == sql.ErrNoRows {
+		return "", errNotFound
+	}
+	if err != nil {
+		return "", &stepError{"select status", err}
+	}
+	before, err := loadAdvertisement(tx, id)
+	if err != nil {
+		return from, &stepError{"load advertisement", err}
+	}
+	if !models.CanTransition(from, to) {
+		return from, &transitionError{from: from, to: to}
+	}
+
+	if _, err := tx.Exec("UPDATE advertisement SET status = ? WHERE id = ?", to, id); err != nil {
+		return from, &stepError{"update status", err}
+	}
+	if err := recordAdvertisementChange(tx, o, auditAdStatus, id, &before); err != nil {
+		return from, err
+	}
+	if err := tx.Commit(); err != nil {
+		return from, &stepError{"commit", err}
+	}
+	return from, nil
+}
+
+// editedStatus returns the status of an advertisement in status from once
+// edited. Edits flagged by moderation, and edits of the content of an
+// approved or paused advertisement, send it back to pending_review where the
+// lifecycle allows it; other edits keep the status.
+func editedStatus(from string, flagged, contentChanged bool) string {
+	review := flagged || contentChanged && (from == models.StatusApproved || from == models.StatusPaused)
+	if review && models.CanTransition(from, models.StatusPendingReview) {
+		return models.StatusPendingReview
+	}
+	return from
+}
+
+// contentChanged reports whether edited changes what advertisement before
+// shows viewers: its texts, locale, localizations or video.
+func contentChanged(before, edited models.Advertisement) (bool, error) {
+	if before.Title != edited.Title || before.Description != edited.Description || before.Locale != edited.Locale {
+		return true, nil
+	}
+	beforeVideo, err := encodeVideo(before.Video)
+	if err != nil {
+		return false, err
+	}
+	editedVideo, err := encodeVideo(edited.Video)
+	if err != nil {
+		return false, err
+	}
+	beforeLocalizations, err := encodeLocalizations(before.Localizations)
+	if err != nil {
+		return false, err
+	}
+	editedLocalizations, err := encodeLocalizations(edited.Localizations)
+	if err != nil {
+		return false, err
+	}
+	return beforeVideo != editedVideo || beforeLocalizations != editedLocalizations, nil
+}
+
+// Handler for changing the lifecycle status of an advertisement
+func SetAdvertisementStatus(c *gin.Context) {
+	id, ok := parseAdID(c)
+	if !ok {
+		return
+	}
+
+	var body struct {
+		Status string `json:"status"`
+	}
+	if err := c.BindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if _, err := setAdvertisementStatus(ginOrigin(c), id, body.Status); err != nil {
+		c.JSON(errorResponse(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"status": body.Status})
+}
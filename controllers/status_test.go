@@ -0,0 +1,134 @@
+package controller
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jjshen2000/simple-ads/models"
+)
+
+// approveAdvertisement reviews and approves draft id so that it is served.
+func approveAdvertisement(t *testing.T, id int) {
+	for _, status := range []string{models.StatusPendingReview, models.StatusApproved} {
+		_, err := setAdvertisementStatus(testOrigin, id, status)
+		assert.NoError(t, err)
+	}
+}
+
+// createdID returns the ID of the advertisement in the Location header of w.
+func createdID(t *testing.T, w *httptest.ResponseRecorder) int {
+	location := w.Header().Get("Location")
+	id, err := strconv.Atoi(location[strings.LastIndex(location, "/")+1:])
+	assert.NoError(t, err, location)
+	return id
+}
+
+func TestAdvertisementStatus(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.POST("/api/v1/ad", CreateAdvertisement)
+	router.GET("/api/v1/ad", ListActiveAdvertisements)
+	router.GET("/api/v1/ad/:id", GetAdvertisement)
+	router.POST("/api/v1/ad/:id/status", SetAdvertisementStatus)
+
+	serve := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	title := fmt.Sprintf("AD status %d", time.Now().UnixNano())
+	start := time.Now().UTC().Add(-time.Hour).Format(time.RFC3339)
+	end := time.Now().UTC().Add(time.Hour).Format(time.RFC3339)
+	w := serve("POST", "/api/v1/ad", fmt.Sprintf(`{"title":%q,"startAt":%q,"endAt":%q}`, title, start, end))
+	assert.Equal(t, http.StatusCreated, w.Code)
+	id := createdID(t, w)
+	defer deleteAdvertisement(testOrigin, id)
+
+	served := func() bool {
+		w := serve("GET", "/api/v1/ad?limit=100", "")
+		assert.Equal(t, http.StatusOK, w.Code)
+		return strings.Contains(w.Body.String(), title)
+	}
+	setStatus := func(status string) *httptest.ResponseRecorder {
+		return serve("POST", fmt.Sprintf("/api/v1/ad/%d/status", id), fmt.Sprintf(`{"status":%q}`, status))
+	}
+
+	w = serve("GET", fmt.Sprintf("/api/v1/ad/%d", id), "")
+	assert.Contains(t, w.Body.String(), `"status":"draft"`)
+	assert.False(t, served())
+
+	w = setStatus(models.StatusApproved)
+	assert.Equal(t, http.StatusConflict, w.Code)
+	assert.Equal(t, `{"error":"cannot change status from draft to approved"}`, w.Body.String())
+
+	for _, status := range []string{models.StatusPendingReview, models.StatusApproved} {
+		w = setStatus(status)
+		assert.Equal(t, http.StatusOK, w.Code)
+		assert.Equal(t, `{"status":"`+status+`"}`, w.Body.String())
+	}
+	assert.True(t, served())
+
+	assert.Equal(t, http.StatusOK, setStatus(models.StatusPaused).Code)
+	assert.False(t, served())
+
+	assert.Equal(t, http.StatusOK, setStatus(models.StatusArchived).Code)
+	assert.Equal(t, http.StatusConflict, setStatus(models.StatusApproved).Code)
+
+	assert.Equal(t, http.StatusBadRequest, setStatus("live").Code)
+	w = serve("POST", "/api/v1/ad/2147483647/status", `{"status":"approved"}`)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func TestEditedStatus(t *testing.T) {
+	testCases := []struct {
+		from             string
+		flagged, changed bool
+		expected         string
+	}{
+		{from: models.StatusApproved, expected: models.StatusApproved},
+		{from: models.StatusApproved, changed: true, expected: models.StatusPendingReview},
+		{from: models.StatusPaused, changed: true, expected: models.StatusPendingReview},
+		{from: models.StatusDraft, changed: true, expected: models.StatusDraft},
+		{from: models.StatusDraft, flagged: true, expected: models.StatusPendingReview},
+		{from: models.StatusRejected, flagged: true, changed: true, expected: models.StatusRejected},
+		{from: models.StatusArchived, flagged: true, changed: true, expected: models.StatusArchived},
+	}
+	for _, tc := range testCases {
+		assert.Equal(t, tc.expected, editedStatus(tc.from, tc.flagged, tc.changed),
+			fmt.Sprintf("%s flagged=%v changed=%v", tc.from, tc.flagged, tc.changed))
+	}
+}
+
+func TestContentChanged(t *testing.T) {
+	ad := models.Advertisement{Title: "AD", Locale: "en",
+		Localizations: []models.Localization{{Locale: "ja", Title: "広告"}}}
+
+	retargeted := ad
+	retargeted.Conditions = []models.Conditions{{Country: []string{"TW"}}}
+	retargeted.EndAt = time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	changed, err := contentChanged(ad, retargeted)
+	assert.NoError(t, err)
+	assert.False(t, changed)
+
+	translated := ad
+	translated.Localizations = []models.Localization{{Locale: "ja", Title: "こうこく"}}
+	changed, err = contentChanged(ad, translated)
+	assert.NoError(t, err)
+	assert.True(t, changed)
+
+	withVideo := ad
+	withVideo.Video = &models.Video{Duration: 15}
+	changed, err = contentChanged(ad, withVideo)
+	assert.NoError(t, err)
+	assert.True(t, changed)
+}
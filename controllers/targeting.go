@@ -0,0 +1,119 @@
+package controller
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+
+	dbpkg "github.com/jjshen2000/simple-ads/db"
+	"github.com/jjshen2000/simple-ads/expr"
+)
+
+// targeting holds what ListActiveAdvertisements needs to know about every
+// targeting condition, so that it does not scan them per request. Changes of
+// conditions bump the version in targeting_version, and SyncTargeting
+// reloads the cache when its version is behind.
+var targeting = struct {
+	sync.RWMutex
+	version   int64
+	timezones []string
+	// programs holds the compiled expressions by condition ID.
+	programs map[int]*expr.Program
+}{}
+
+// targetingTimezones returns the time zones of the conditions with a
+// schedule.
+func targetingTimezones() []string {
+	targeting.RLock()
+	defer targeting.RUnlock()
+	return targeting.timezones
+}
+
+// bumpTargeting marks the conditions as changed inside tx, which
+// insertConditions and deleteConditions do.
+func bumpTargeting(tx *sqlx.Tx) error {
+	_, err := tx.Exec("UPDATE targeting_version SET version = version + 1 WHERE id = 1")
+	return err
+}
+
+// SyncTargeting reloads the targeting cache unless it holds the stored
+// version.
+func SyncTargeting() error {
+	db := dbpkg.GetDB()
+
+	// The version is read first, so the cache is never newer than it claims.
+	var version int64
+	if err := db.Get(&version, "SELECT version FROM targeting_version WHERE id = 1"); err != nil {
+		return err
+	}
+	targeting.RLock()
+	held := targeting.version
+	targeting.RUnlock()
+	if held == version {
+		return nil
+	}
+
+	var timezones []string
+	if err := db.Select(&timezones, "SELECT DISTINCT timezone FROM advertisement_condition WHERE timezone IS NOT NULL"); err != nil {
+		return err
+	}
+
+	var conditions []struct {
+		ID   int    `db:"id"`
+		Expr string `db:"expr"`
+	}
+	if err := db.Select(&conditions, "SELECT id, expr FROM advertisement_condition WHERE expr IS NOT NULL"); err != nil {
+		return err
+	}
+	programs := make(map[int]*expr.Program, len(conditions))
+	for _, condition := range conditions {
+		// An expression that does not compile, which validation prevents,
+		// never matches.
+		p, err := expr.Compile(condition.Expr)
+		if err != nil {
+			continue
+		}
+		programs[condition.ID] = p
+	}
+
+	targeting.Lock()
+	defer targeting.Unlock()
+	if targeting.version < version {
+		targeting.version, targeting.timezones, targeting.programs = version, timezones, programs
+	}
+	return nil
+}
+
+// syncTargetingAfterWrite reloads the targeting cache once a change of
+// conditions is committed. On failure the watcher catches up.
+func syncTargetingAfterWrite() {
+	if err := SyncTargeting(); err != nil {
+		log.Println("Failed to sync targeting:", err)
+	}
+}
+
+// WatchTargeting loads the targeting cache, then syncs it every interval
+// with the changes of other instances, until ctx is cancelled.
+func WatchTargeting(ctx context.Context, interval time.Duration) error {
+	if err := SyncTargeting(); err != nil {
+		return err
+	}
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			if err := SyncTargeting(); err != nil {
+				log.Println("Failed to sync targeting:", err)
+			}
+		}
+	}()
+	return nil
+}
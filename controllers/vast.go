@@ -0,0 +1,98 @@
+package controller
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/jjshen2000/simple-ads/models"
+	"github.com/jjshen2000/simple-ads/vast"
+)
+
+// newAdServingID returns a random identifier for one serving of an ad.
+func newAdServingID() string {
+	raw := make([]byte, 16)
+	rand.Read(raw)
+	return hex.EncodeToString(raw)
+}
+
+// vastAd renders the video creative of an active advertisement.
+func vastAd(ad activeAd, video *models.Video) vast.Ad {
+	id := strconv.Itoa(ad.ID)
+
+	linear := vast.Linear{Duration: vast.Duration(time.Duration(video.Duration) * time.Second)}
+	for _, event := range video.Tracking {
+		linear.TrackingEvents = append(linear.TrackingEvents, vast.Tracking{Event: event.Event, URL: event.URL})
+	}
+	for _, file := range video.MediaFiles {
+		delivery := file.Delivery
+		if delivery == "" {
+			delivery = "progressive"
+		}
+		linear.MediaFiles = append(linear.MediaFiles, vast.MediaFile{
+			Delivery: delivery,
+			Type:     file.Type,
+			Width:    file.Width,
+			Height:   file.Height,
+			Bitrate:  file.Bitrate,
+			URL:      file.URL,
+		})
+	}
+	if video.ClickThrough != "" {
+		linear.VideoClicks = &vast.VideoClicks{ClickThrough: vast.ClickThrough{URL: video.ClickThrough}}
+	}
+
+	inline := vast.InLine{
+		AdSystem:    vast.AdSystem{Name: "simple-ads"},
+		AdServingID: newAdServingID(),
+		AdTitle:     ad.Title,
+		Creatives: []vast.Creative{{
+			ID:            id,
+			AdID:          id,
+			UniversalAdID: vast.UniversalAdID{IDRegistry: "simple-ads", ID: id},
+			Linear:        linear,
+		}},
+	}
+	for _, url := range video.Impressions {
+		inline.Impressions = append(inline.Impressions, vast.Impression{URL: url})
+	}
+
+	return vast.Ad{ID: id, InLine: inline}
+}
+
+// Handler for serving active video advertisements as VAST
+//
+// Accepts the query parameters of ListActiveAdvertisements and responds with
+// an empty VAST document when nothing matches.
+func GetVAST(c *gin.Context) {
+	params, err := parseListParams(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	params.video = true
+
+	page, err := listActiveAdvertisements(params)
+	if err != nil {
+		c.JSON(errorResponse(err))
+		return
+	}
+
+	doc := vast.New()
+	for _, ad := range page.Items {
+		if ad.video != nil {
+			doc.Ads = append(doc.Ads, vastAd(ad, ad.video))
+		}
+	}
+
+	data, err := doc.Marshal()
+	if err != nil {
+		c.JSON(errorResponse(err))
+		return
+	}
+	c.Data(http.StatusOK, "application/xml; charset=utf-8", data)
+}
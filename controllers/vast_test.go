@@ -0,0 +1,33 @@
+package controller
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jjshen2000/simple-ads/models"
+	"github.com/jjshen2000/simple-ads/vast"
+)
+
+func TestVastAd(t *testing.T) {
+	video := &models.Video{
+		Duration:     30,
+		ClickThrough: "https://example.com/landing",
+		MediaFiles:   []models.MediaFile{{URL: "https://cdn.example.com/1.mp4", Type: "video/mp4", Width: 640, Height: 360}},
+		Impressions:  []string{"https://track.example.com/imp"},
+		Tracking:     []models.TrackingEvent{{Event: "midpoint", URL: "https://track.example.com/mid"}},
+	}
+
+	ad := vastAd(activeAd{ID: 3, Title: "AD 3"}, video)
+	assert.Equal(t, "3", ad.ID)
+	assert.Equal(t, "AD 3", ad.InLine.AdTitle)
+	assert.Len(t, ad.InLine.AdServingID, 32)
+	assert.Equal(t, []vast.Impression{{URL: "https://track.example.com/imp"}}, ad.InLine.Impressions)
+	assert.Equal(t, vast.Linear{
+		TrackingEvents: []vast.Tracking{{Event: "midpoint", URL: "https://track.example.com/mid"}},
+		Duration:       vast.Duration(30 * time.Second),
+		MediaFiles:     []vast.MediaFile{{Delivery: "progressive", Type: "video/mp4", Width: 640, Height: 360, URL: "https://cdn.example.com/1.mp4"}},
+		VideoClicks:    &vast.VideoClicks{ClickThrough: vast.ClickThrough{URL: "https://example.com/landing"}},
+	}, ad.InLine.Creatives[0].Linear)
+}
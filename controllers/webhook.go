@@ -0,0 +1,592 @@
+package controller
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/jmoiron/sqlx"
+
+	dbpkg "github.com/jjshen2000/simple-ads/db"
+	"github.com/jjshen2000/simple-ads/models"
+	"github.com/jjshen2000/simple-ads/webhook"
+)
+
+var (
+	errWebhookNotFound    = errors.New("webhook not found")
+	errDeadLetterNotFound = errors.New("dead letter not found")
+)
+
+// deliveryBatch is how many due deliveries an instance claims at a time.
+const deliveryBatch = 10
+
+// maxLastError bounds the stored error of a failed attempt, in characters.
+const maxLastError = 1024
+
+// webhookDelivery holds how deliveries are sent and retried.
+var webhookDelivery = struct {
+	client      *http.Client
+	maxAttempts int
+	backoff     webhook.Backoff
+}{
+	client:      &http.Client{Timeout: 10 * time.Second},
+	maxAttempts: 8,
+	backoff:     webhook.Backoff{Base: 10 * time.Second, Max: time.Hour},
+}
+
+// SetWebhookDelivery sets how long an attempt may take, how many attempts a
+// delivery gets before it becomes a dead letter and how they are spaced.
+func SetWebhookDelivery(timeout time.Duration, maxAttempts int, backoff webhook.Backoff) {
+	webhookDelivery.client = &http.Client{Timeout: timeout}
+	webhookDelivery.maxAttempts = maxAttempts
+	webhookDelivery.backoff = backoff
+}
+
+// WatchWebhooks queues the events of start and end times and sends the due
+// deliveries every interval in the background, until ctx is cancelled.
+func WatchWebhooks(ctx context.Context, interval time.Duration) {
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			if err := scanSchedule(); err != nil {
+				log.Println("Failed to scan advertisement schedule:", err)
+			}
+			if err := deliverWebhooks(ctx); err != nil && ctx.Err() == nil {
+				log.Println("Failed to deliver webhooks:", err)
+			}
+		}
+	}()
+}
+
+// actionEvents maps the audit actions on advertisements to their events.
+var actionEvents = map[string]string{
+	auditAdCreate:  models.EventAdCreated,
+	auditAdUpdate:  models.EventAdUpdated,
+	auditAdStatus:  models.EventAdUpdated,
+	auditAdRevert:  models.EventAdUpdated,
+	auditAdRestore: models.EventAdUpdated,
+	auditAdDelete:  models.EventAdDeleted,
+}
+
+// queueAdvertisementEvents queues the events of action on an advertisement,
+// inside tx after the change. before and after are as recordAdvertisementChange
+// has them.
+func queueAdvertisementEvents(tx *sqlx.Tx, action string, before, after *models.Advertisement) error {
+	event, ok := actionEvents[action]
+	if !ok {
+		return nil
+	}
+	ad := after
+	if ad == nil {
+		ad = before
+	}
+	if err := queueEvent(tx, event, action, *ad); err != nil {
+		return err
+	}
+
+	if action == auditAdStatus && activates(*before, *after, now()) {
+		return queueEvent(tx, models.EventAdActivated, action, *after)
+	}
+	return nil
+}
+
+// activates reports whether a status change from before to after at time at
+// approves an advertisement within its active period. The schedule scan only
+// sees start times passing, so such approvals are activations of their own.
+func activates(before, after models.Advertisement, at time.Time) bool {
+	return before.Status != models.StatusApproved && after.Status == models.StatusApproved &&
+		!at.Before(after.StartAt) && at.Before(after.EndAt)
+}
+
+// subscribers returns the IDs of the webhooks subscribed to event.
+func subscribers(q sqlx.Queryer, event string) ([]int, error) {
+	var ids []int
+	if err := sqlx.Select(q, &ids, "SELECT id FROM webhook WHERE FIND_IN_SET(?, events) ORDER BY id", event); err != nil {
+		return nil, &stepError{"select webhooks", err}
+	}
+	return ids, nil
+}
+
+// queueEvent queues a delivery of event about ad to every webhook subscribed
+// to it. action is the audit action behind the event, if any.
+func queueEvent(tx *sqlx.Tx, event, action string, ad models.Advertisement) error {
+	webhookIDs, err := subscribers(tx, event)
+	if err != nil {
+		return err
+	}
+	return queueDeliveries(tx, webhookIDs, models.WebhookPayload{Event: event, At: now(), Action: action, Advertisement: ad})
+}
+
+// queueDeliveries queues payload to each of webhookIDs, due now.
+func queueDeliveries(tx *sqlx.Tx, webhookIDs []int, payload models.WebhookPayload) error {
+	if len(webhookIDs) == 0 {
+		return nil
+	}
+	data, err := json.Marshal(payload)
+	if err != nil {
+		return &stepError{"encode payload", err}
+	}
+	for _, id := range webhookIDs {
+		if _, err := tx.Exec(`INSERT INTO webhook_delivery (uid, webhook_id, event, payload, next_attempt_at)
+			VALUES (?, ?, ?, ?, ?)`, requestID(""), id, payload.Event, data, now()); err != nil {
+			return &stepError{"insert delivery", err}
+		}
+	}
+	return nil
+}
+
+// scanSchedule queues ad.activated for the approved advertisements whose
+// start time passed since the previous scan, and ad.expired for the approved
+// or paused ones whose end time did. The single row of webhook_schedule
+// keeps instances from scanning the same period twice.
+func scanSchedule() error {
+	tx := dbpkg.GetDB().MustBegin()
+	defer tx.Rollback()
+
+	var from time.Time
+	if err := tx.Get(&from, "SELECT scanned_until FROM webhook_schedule WHERE id = 1 FOR UPDATE"); err != nil {
+		return &stepError{"select schedule", err}
+	}
+	until := now()
+	if !until.After(from) {
+		return nil
+	}
+
+	scans := []struct {
+		event, query string
+		args         []interface{}
+	}{
+		{models.EventAdActivated, `SELECT id FROM advertisement WHERE status = ? AND deleted_at IS NULL
+			AND start_at > ? AND start_at <= ? AND end_at > ? ORDER BY id`,
+			[]interface{}{models.StatusApproved, from, until, until}},
+		{models.EventAdExpired, `SELECT id FROM advertisement WHERE status IN (?, ?) AND deleted_at IS NULL
+			AND end_at > ? AND end_at <= ? ORDER BY id`,
+			[]interface{}{models.StatusApproved, models.StatusPaused, from, until}},
+	}
+	for _, scan := range scans {
+		webhookIDs, err := subscribers(tx, scan.event)
+		if err != nil {
+			return err
+		}
+		if len(webhookIDs) == 0 {
+			continue
+		}
+		var adIDs []int
+		if err := tx.Select(&adIDs, scan.query, scan.args...); err != nil {
+			return &stepError{"select advertisements", err}
+		}
+		for _, id := range adIDs {
+			ad, err := loadAdvertisement(tx, id)
+			if err != nil {
+				return &stepError{"load advertisement", err}
+			}
+			payload := models.WebhookPayload{Event: scan.event, At: now(), Advertisement: ad}
+			if err := queueDeliveries(tx, webhookIDs, payload); err != nil {
+				return err
+			}
+		}
+	}
+
+	if _, err := tx.Exec("UPDATE webhook_schedule SET scanned_until = ? WHERE id = 1", until); err != nil {
+		return &stepError{"update schedule", err}
+	}
+	if err := tx.Commit(); err != nil {
+		return &stepError{"commit", err}
+	}
+	return nil
+}
+
+// claimedDelivery is a delivery claimed for sending.
+type claimedDelivery struct {
+	id        int64
+	webhookID int
+	attempts  int
+	webhook.Delivery
+}
+
+// deliverWebhooks sends the due deliveries, a batch at a time. An instance
+// claims a batch before sending it, pushing its next attempt past the time
+// sending can take, so that a claim left by a crashed instance lapses. The
+// deliveries of each webhook are sent in order, concurrently with those of
+// the others, so that a slow endpoint only delays its own. Deliveries
+// interrupted by cancelling ctx are left to their claim lapsing.
+func deliverWebhooks(ctx context.Context) error {
+	for ctx.Err() == nil {
+		batch, err := claimDeliveries()
+		if err != nil {
+			return err
+		}
+		var byWebhook [][]claimedDelivery
+		index := map[int]int{}
+		for _, d := range batch {
+			i, ok := index[d.webhookID]
+			if !ok {
+				i = len(byWebhook)
+				index[d.webhookID] = i
+				byWebhook = append(byWebhook, nil)
+			}
+			byWebhook[i] = append(byWebhook[i], d)
+		}
+
+		var wg sync.WaitGroup
+		errs := make([]error, len(byWebhook))
+		for i, deliveries := range byWebhook {
+			wg.Add(1)
+			go func(i int, deliveries []claimedDelivery) {
+				defer wg.Done()
+				for _, d := range deliveries {
+					sendErr := webhook.Send(ctx, webhookDelivery.client, d.Delivery, now())
+					if ctx.Err() != nil {
+						return
+					}
+					if err := settleDelivery(d, sendErr); err != nil {
+						errs[i] = err
+						return
+					}
+				}
+			}(i, deliveries)
+		}
+		wg.Wait()
+		for _, err := range errs {
+			if err != nil {
+				return err
+			}
+		}
+		if len(batch) < deliveryBatch {
+			return nil
+		}
+	}
+	return ctx.Err()
+}
+
+// claimDeliveries claims up to deliveryBatch due deliveries.
+func claimDeliveries() ([]claimedDelivery, error) {
+	db := dbpkg.GetDB()
+	claim := requestID("")
+	lease := now().Add(deliveryBatch*webhookDelivery.client.Timeout + time.Minute)
+	if _, err := db.Exec(`UPDATE webhook_delivery SET claim = ?, next_attempt_at = ?
+		WHERE next_attempt_at <= ? ORDER BY next_attempt_at, id LIMIT ?`, claim, lease, now(), deliveryBatch); err != nil {
+		return nil, &stepError{"claim deliveries", err}
+	}
+
+	rows, err := db.Query(`SELECT d.id, d.webhook_id, d.uid, d.event, d.payload, d.attempts, w.url, w.secret
+		FROM webhook_delivery d JOIN webhook w ON w.id = d.webhook_id WHERE d.claim = ? ORDER BY d.id`, claim)
+	if err != nil {
+		return nil, &stepError{"select deliveries", err}
+	}
+	defer rows.Close()
+
+	var batch []claimedDelivery
+	for rows.Next() {
+		var d claimedDelivery
+		if err := rows.Scan(&d.id, &d.webhookID, &d.ID, &d.Event, &d.Payload, &d.attempts, &d.URL, &d.Secret); err != nil {
+			return nil, &stepError{"scan delivery", err}
+		}
+		batch = append(batch, d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, &stepError{"select deliveries", err}
+	}
+	return batch, nil
+}
+
+// settleDelivery removes d once sent. Otherwise it schedules its next
+// attempt, or moves it to the dead letters after the last one.
+func settleDelivery(d claimedDelivery, sendErr error) error {
+	db := dbpkg.GetDB()
+	if sendErr == nil {
+		if _, err := db.Exec("DELETE FROM webhook_delivery WHERE id = ?", d.id); err != nil {
+			return &stepError{"delete delivery", err}
+		}
+		return nil
+	}
+
+	attempts := d.attempts + 1
+	lastError := sendErr.Error()
+	if len([]rune(lastError)) > maxLastError {
+		lastError = string([]rune(lastError)[:maxLastError])
+	}
+	if attempts < webhookDelivery.maxAttempts {
+		next := now().Add(webhookDelivery.backoff.Delay(attempts))
+		if _, err := db.Exec(`UPDATE webhook_delivery SET attempts = ?, next_attempt_at = ?, last_error = ?, claim = NULL
+			WHERE id = ?`, attempts, next, lastError, d.id); err != nil {
+			return &stepError{"update delivery", err}
+		}
+		return nil
+	}
+
+	tx := db.MustBegin()
+	defer tx.Rollback()
+	if _, err := tx.Exec(`INSERT INTO webhook_dead_letter (uid, webhook_id, event, payload, attempts, last_error, failed_at)
+		SELECT uid, webhook_id, event, payload, ?, ?, ? FROM webhook_delivery WHERE id = ?`,
+		attempts, lastError, now(), d.id); err != nil {
+		return &stepError{"insert dead letter", err}
+	}
+	if _, err := tx.Exec("DELETE FROM webhook_delivery WHERE id = ?", d.id); err != nil {
+		return &stepError{"delete delivery", err}
+	}
+	if err := tx.Commit(); err != nil {
+		return &stepError{"commit", err}
+	}
+	return nil
+}
+
+// replayDeadLetter queues dead letter id again with its delivery ID, due now.
+func replayDeadLetter(o origin, id int64) error {
+	tx := dbpkg.GetDB().MustBegin()
+	defer tx.Rollback()
+
+	var letter models.DeadLetter
+	err := tx.QueryRowx("SELECT uid, webhook_id, event FROM webhook_dead_letter WHERE id = ? FOR UPDATE", id).
+		Scan(&letter.DeliveryID, &letter.WebhookID, &letter.Event)
+	if err == sql.ErrNoRows {
+		return errDeadLetterNotFound
+	}
+	if err != nil {
+		return &stepError{"select dead letter", err}
+	}
+
+	if _, err := tx.Exec(`INSERT INTO webhook_delivery (uid, webhook_id, event, payload, next_attempt_at)
+		SELECT uid, webhook_id, event, payload, ? FROM webhook_dead_letter WHERE id = ?`, now(), id); err != nil {
+		return &stepError{"insert delivery", err}
+	}
+	if _, err := tx.Exec("DELETE FROM webhook_dead_letter WHERE id = ?", id); err != nil {
+		return &stepError{"delete dead letter", err}
+	}
+	if err := writeAudit(tx, o, auditWebhookReplay, auditEntityWebhook, letter.WebhookID, nil,
+		gin.H{"deadLetterId": id, "deliveryId": letter.DeliveryID, "event": letter.Event}); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return &stepError{"commit", err}
+	}
+	return nil
+}
+
+// deleteWebhook deletes webhook id with its queued and dead deliveries.
+func deleteWebhook(o origin, id int) error {
+	tx := dbpkg.GetDB().MustBegin()
+	defer tx.Rollback()
+
+	before, err := loadWebhook(tx, id)
+	if err != nil {
+		return err
+	}
+	for _, table := range []string{"webhook_delivery", "webhook_dead_letter"} {
+		if _, err := tx.Exec("DELETE FROM "+table+" WHERE webhook_id = ?", id); err != nil {
+			return &stepError{"delete " + table, err}
+		}
+	}
+	if _, err := tx.Exec("DELETE FROM webhook WHERE id = ?", id); err != nil {
+		return &stepError{"delete webhook", err}
+	}
+	if err := writeAudit(tx, o, auditWebhookDelete, auditEntityWebhook, id, before, nil); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return &stepError{"commit", err}
+	}
+	return nil
+}
+
+// loadWebhook reads webhook id, locking it, without its secret.
+func loadWebhook(tx *sqlx.Tx, id int) (w models.Webhook, err error) {
+	var events string
+	err = tx.QueryRowx("SELECT id, url, events, created_at FROM webhook WHERE id = ? FOR UPDATE", id).
+		Scan(&w.ID, &w.URL, &events, &w.CreatedAt)
+	if err == sql.ErrNoRows {
+		return w, errWebhookNotFound
+	}
+	if err != nil {
+		return w, &stepError{"select webhook", err}
+	}
+	w.Events = strings.Split(events, ",")
+	return w, nil
+}
+
+// Handler for registering a webhook. The secret signing its deliveries is
+// generated unless given, and only returned here.
+func CreateWebhook(c *gin.Context) {
+	var body struct {
+		URL    string   `json:"url" binding:"required,url,max=2048"`
+		Events []string `json:"events" binding:"required,min=1,dive,oneof=ad.created ad.updated ad.deleted ad.activated ad.expired ad.budget_exhausted"`
+		Secret string   `json:"secret" binding:"omitempty,min=16,max=64"`
+	}
+	if err := c.ShouldBindJSON(&body); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if u, err := url.Parse(body.URL); err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "url must be http or https"})
+		return
+	}
+	if body.Secret == "" {
+		raw := make([]byte, 32)
+		if _, err := rand.Read(raw); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to generate secret"})
+			return
+		}
+		body.Secret = hex.EncodeToString(raw)
+	}
+	var events []string
+	seen := make(map[string]bool)
+	for _, event := range body.Events {
+		if !seen[event] {
+			seen[event] = true
+			events = append(events, event)
+		}
+	}
+
+	tx := dbpkg.GetDB().MustBegin()
+	defer tx.Rollback()
+
+	w := models.Webhook{URL: body.URL, Events: events, CreatedAt: now().Truncate(time.Second)}
+	result, err := tx.Exec("INSERT INTO webhook (url, events, secret, created_at) VALUES (?, ?, ?, ?)",
+		w.URL, strings.Join(w.Events, ","), body.Secret, w.CreatedAt)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error(insert webhook)": err.Error()})
+		return
+	}
+	id, _ := result.LastInsertId()
+	w.ID = int(id)
+	// The audit log never holds the secret.
+	if err := writeAudit(tx, ginOrigin(c), auditWebhookCreate, auditEntityWebhook, w.ID, nil, w); err != nil {
+		c.JSON(errorResponse(err))
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error(commit)": err.Error()})
+		return
+	}
+
+	w.Secret = body.Secret
+	c.JSON(http.StatusCreated, w)
+}
+
+// Handler for listing the webhooks, without their secrets
+func ListWebhooks(c *gin.Context) {
+	rows, err := dbpkg.GetDB().Query("SELECT id, url, events, created_at FROM webhook ORDER BY id")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch webhooks"})
+		return
+	}
+	defer rows.Close()
+
+	items := []models.Webhook{}
+	for rows.Next() {
+		var w models.Webhook
+		var events string
+		if err := rows.Scan(&w.ID, &w.URL, &events, &w.CreatedAt); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse webhooks"})
+			return
+		}
+		w.Events = strings.Split(events, ",")
+		items = append(items, w)
+	}
+	if err := rows.Err(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch webhooks"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"items": items})
+}
+
+// Handler for deleting a webhook with its queued and dead deliveries
+func DeleteWebhook(c *gin.Context) {
+	id, ok := parseAdID(c)
+	if !ok {
+		return
+	}
+
+	if err := deleteWebhook(ginOrigin(c), id); err != nil {
+		c.JSON(errorResponse(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Webhook deleted successfully"})
+}
+
+// Handler for listing the dead letters, newest first, optionally of one
+// webhook
+func ListDeadLetters(c *gin.Context) {
+	query := "SELECT id, uid, webhook_id, event, payload, attempts, COALESCE(last_error, ''), failed_at FROM webhook_dead_letter"
+	var args []interface{}
+	if value := c.Query("webhookId"); value != "" {
+		webhookID, err := strconv.Atoi(value)
+		if err != nil || webhookID < 1 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "invalid webhookId"})
+			return
+		}
+		query += " WHERE webhook_id = ?"
+		args = append(args, webhookID)
+	}
+	limit := 20
+	if value := c.Query("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > 100 {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "limit must be between 1 and 100"})
+			return
+		}
+		limit = n
+	}
+	query += " ORDER BY id DESC LIMIT ?"
+	args = append(args, limit)
+
+	rows, err := dbpkg.GetDB().Query(query, args...)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch dead letters"})
+		return
+	}
+	defer rows.Close()
+
+	items := []models.DeadLetter{}
+	for rows.Next() {
+		var d models.DeadLetter
+		var payload []byte
+		if err := rows.Scan(&d.ID, &d.DeliveryID, &d.WebhookID, &d.Event, &payload, &d.Attempts, &d.LastError,
+			&d.FailedAt); err != nil {
+			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse dead letters"})
+			return
+		}
+		d.Payload = payload
+		items = append(items, d)
+	}
+	if err := rows.Err(); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch dead letters"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"items": items})
+}
+
+// Handler for replaying a dead letter: its delivery is queued again
+func ReplayDeadLetter(c *gin.Context) {
+	id, ok := parseAdID(c)
+	if !ok {
+		return
+	}
+
+	if err := replayDeadLetter(ginOrigin(c), int64(id)); err != nil {
+		c.JSON(errorResponse(err))
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Dead letter queued again"})
+}
@@ -0,0 +1,210 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	dbpkg "github.com/jjshen2000/simple-ads/db"
+	"github.com/jjshen2000/simple-ads/models"
+	"github.com/jjshen2000/simple-ads/webhook"
+)
+
+func TestActivates(t *testing.T) {
+	at := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	ad := models.Advertisement{StartAt: at.Add(-time.Hour), EndAt: at.Add(time.Hour), Status: models.StatusApproved}
+	pending := ad
+	pending.Status = models.StatusPendingReview
+
+	assert.True(t, activates(pending, ad, at))
+	assert.True(t, activates(pending, ad, ad.StartAt))
+	assert.False(t, activates(ad, ad, at))
+	assert.False(t, activates(pending, pending, at))
+	assert.False(t, activates(pending, ad, ad.StartAt.Add(-time.Second)))
+	assert.False(t, activates(pending, ad, ad.EndAt))
+}
+
+// received is a delivery as a receiver got it.
+type received struct {
+	event, delivery string
+	verified        bool
+	payload         models.WebhookPayload
+}
+
+func TestWebhooks(t *testing.T) {
+	const secret = "0123456789abcdef"
+	var mu sync.Mutex
+	var got []received
+	status := http.StatusOK
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		timestamp, _ := strconv.ParseInt(r.Header.Get(webhook.HeaderTimestamp), 10, 64)
+		d := received{
+			event:    r.Header.Get(webhook.HeaderEvent),
+			delivery: r.Header.Get(webhook.HeaderDelivery),
+			verified: webhook.Verify(secret, timestamp, body, r.Header.Get(webhook.HeaderSignature)),
+		}
+		json.Unmarshal(body, &d.payload)
+		mu.Lock()
+		defer mu.Unlock()
+		got = append(got, d)
+		w.WriteHeader(status)
+		io.WriteString(w, "receiver down")
+	}))
+	defer receiver.Close()
+	setStatus := func(code int) {
+		mu.Lock()
+		defer mu.Unlock()
+		status = code
+	}
+	// deliver sends the due deliveries and returns those about advertisement
+	// id that the receiver got.
+	deliver := func(id int) []received {
+		assert.NoError(t, deliverWebhooks(context.Background()))
+		mu.Lock()
+		defer mu.Unlock()
+		var about []received
+		for _, d := range got {
+			if d.payload.Advertisement.ID == id {
+				about = append(about, d)
+			}
+		}
+		got = nil
+		return about
+	}
+	events := func(deliveries []received) []string {
+		var events []string
+		for _, d := range deliveries {
+			assert.True(t, d.verified, d.event)
+			assert.Equal(t, d.event, d.payload.Event)
+			events = append(events, d.event)
+		}
+		return events
+	}
+
+	delivery := webhookDelivery
+	defer func() { webhookDelivery = delivery }()
+	webhookDelivery.client = receiver.Client()
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(RequestID(), func(c *gin.Context) { c.Set(actorKey, "integrator") })
+	router.POST("/api/v1/ad", CreateAdvertisement)
+	router.POST("/api/v1/ad/:id/status", SetAdvertisementStatus)
+	router.POST("/api/v1/webhook", CreateWebhook)
+	router.GET("/api/v1/webhook", ListWebhooks)
+	router.DELETE("/api/v1/webhook/:id", DeleteWebhook)
+	router.GET("/api/v1/webhook/dead-letter", ListDeadLetters)
+	router.POST("/api/v1/webhook/dead-letter/:id/replay", ReplayDeadLetter)
+
+	serve := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	w := serve("POST", "/api/v1/webhook", `{"url":"ftp://example.com","events":["ad.created"]}`)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+	w = serve("POST", "/api/v1/webhook", fmt.Sprintf(`{"url":%q,"events":["ad.launched"]}`, receiver.URL))
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	w = serve("POST", "/api/v1/webhook", fmt.Sprintf(`{"url":%q,"secret":%q,
+		"events":["ad.created","ad.updated","ad.activated","ad.expired","ad.created"]}`, receiver.URL, secret))
+	assert.Equal(t, http.StatusCreated, w.Code)
+	var hook models.Webhook
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &hook))
+	assert.Equal(t, secret, hook.Secret)
+	assert.Equal(t, []string{"ad.created", "ad.updated", "ad.activated", "ad.expired"}, hook.Events)
+	defer deleteWebhook(testOrigin, hook.ID)
+
+	w = serve("GET", "/api/v1/webhook", "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.NotContains(t, w.Body.String(), secret)
+
+	start := time.Now().UTC().Add(-time.Hour).Format(time.RFC3339)
+	end := time.Now().UTC().Add(time.Hour).Format(time.RFC3339)
+	w = serve("POST", "/api/v1/ad", fmt.Sprintf(`{"title":"AD hooked","startAt":%q,"endAt":%q}`, start, end))
+	assert.Equal(t, http.StatusCreated, w.Code)
+	id := createdID(t, w)
+	path := fmt.Sprintf("/api/v1/ad/%d", id)
+	defer deleteAdvertisement(testOrigin, id)
+
+	deliveries := deliver(id)
+	assert.Equal(t, []string{"ad.created"}, events(deliveries))
+	assert.Equal(t, "AD hooked", deliveries[0].payload.Advertisement.Title)
+
+	// Approving an advertisement within its active period activates it.
+	serve("POST", path+"/status", `{"status":"pending_review"}`)
+	serve("POST", path+"/status", `{"status":"approved"}`)
+	deliveries = deliver(id)
+	assert.Equal(t, []string{"ad.updated", "ad.updated", "ad.activated"}, events(deliveries))
+	assert.Equal(t, "ad.status", deliveries[1].payload.Action)
+	assert.Equal(t, models.StatusApproved, deliveries[2].payload.Advertisement.Status)
+
+	// A delivery failing every attempt becomes a dead letter.
+	setStatus(http.StatusServiceUnavailable)
+	webhookDelivery.maxAttempts = 2
+	webhookDelivery.backoff = webhook.Backoff{}
+	serve("POST", path+"/status", `{"status":"paused"}`)
+	failed := deliver(id)
+	failed = append(failed, deliver(id)...)
+	assert.Equal(t, []string{"ad.updated", "ad.updated"}, events(failed))
+	assert.Equal(t, failed[0].delivery, failed[1].delivery)
+	assert.Empty(t, deliver(id))
+
+	w = serve("GET", fmt.Sprintf("/api/v1/webhook/dead-letter?webhookId=%d", hook.ID), "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	var page struct{ Items []models.DeadLetter }
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &page))
+	if !assert.Len(t, page.Items, 1) {
+		return
+	}
+	letter := page.Items[0]
+	assert.Equal(t, failed[0].delivery, letter.DeliveryID)
+	assert.Equal(t, "ad.updated", letter.Event)
+	assert.Equal(t, 2, letter.Attempts)
+	assert.Equal(t, "503 Service Unavailable: receiver down", letter.LastError)
+
+	// Replaying queues it again with the same delivery ID.
+	setStatus(http.StatusOK)
+	replay := fmt.Sprintf("/api/v1/webhook/dead-letter/%d/replay", letter.ID)
+	w = serve("POST", replay, "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	deliveries = deliver(id)
+	assert.Equal(t, []string{"ad.updated"}, events(deliveries))
+	assert.Equal(t, letter.DeliveryID, deliveries[0].delivery)
+	assert.Equal(t, models.StatusPaused, deliveries[0].payload.Advertisement.Status)
+	w = serve("POST", replay, "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+	assert.Equal(t, `{"error":"dead letter not found"}`, w.Body.String())
+
+	// Scanning the schedule finds the end time passing.
+	var scannedUntil time.Time
+	db := dbpkg.GetDB()
+	assert.NoError(t, db.Get(&scannedUntil, "SELECT scanned_until FROM webhook_schedule WHERE id = 1"))
+	defer db.Exec("UPDATE webhook_schedule SET scanned_until = ? WHERE id = 1", scannedUntil)
+	defer func(saved func() time.Time) { now = saved }(now)
+	db.Exec("UPDATE webhook_schedule SET scanned_until = ? WHERE id = 1", time.Now().UTC())
+	now = func() time.Time { return time.Now().UTC().Add(2 * time.Hour) }
+	assert.NoError(t, scanSchedule())
+	deliveries = deliver(id)
+	assert.Equal(t, []string{"ad.expired"}, events(deliveries))
+	assert.Empty(t, deliveries[0].payload.Action)
+
+	w = serve("DELETE", fmt.Sprintf("/api/v1/webhook/%d", hook.ID), "")
+	assert.Equal(t, http.StatusOK, w.Code)
+	w = serve("DELETE", fmt.Sprintf("/api/v1/webhook/%d", hook.ID), "")
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
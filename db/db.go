@@ -3,57 +3,293 @@ package db
 import (
 	"fmt"
 	"log"
-	"strings"
+	"sync"
 
 	"github.com/jjshen2000/simple-ads/config"
 	"github.com/jmoiron/sqlx"
 )
 
-var db *sqlx.DB
-
-var schema = `
-DROP TABLE IF EXISTS condition_country;
+var (
+	db      *sqlx.DB
+	connect sync.Once
+)
 
-DROP TABLE IF EXISTS advertisement_condition;
+// migrations lists the schema changes in the order they are applied. A
+// released migration must never be edited; append a new one instead.
+var migrations = [][]string{
+	// 1: advertisements and their targeting conditions
+	{
+		`CREATE TABLE IF NOT EXISTS advertisement (
+			id INT AUTO_INCREMENT PRIMARY KEY,
+			title VARCHAR(255) NOT NULL,
+			start_at DATETIME NOT NULL,
+			end_at DATETIME NOT NULL,
+			INDEX idx_start_at (start_at),
+			INDEX idx_end_at (end_at)
+		)`,
+		`CREATE TABLE IF NOT EXISTS advertisement_condition (
+			id INT AUTO_INCREMENT PRIMARY KEY,
+			advertisement_id INT NOT NULL,
+			age_start TINYINT UNSIGNED, -- 0-100
+			age_end TINYINT UNSIGNED,   -- 0-100
+			gender CHAR(2),             -- M, F, MF
+			unlimited_country BOOL,
+			platform TINYINT UNSIGNED,  -- bit-wise 'android', 'ios', 'web'
+			INDEX idx_advertisement_id (advertisement_id),
+			FOREIGN KEY (advertisement_id) REFERENCES advertisement(id)
+		)`,
+		`CREATE TABLE IF NOT EXISTS condition_country (
+			condition_id INT,
+			country_code CHAR(2), -- ISO-3166 alpha 2 code
+			KEY (condition_id, country_code),
+			FOREIGN KEY (condition_id) REFERENCES advertisement_condition(id)
+		)`,
+	},
+	// 2: API keys for the admin API
+	{
+		`CREATE TABLE api_key (
+			id INT AUTO_INCREMENT PRIMARY KEY,
+			name VARCHAR(255) NOT NULL,
+			key_hash CHAR(64) NOT NULL, -- hex SHA-256 of the key
+			created_at DATETIME NOT NULL,
+			UNIQUE KEY uk_key_hash (key_hash)
+		)`,
+	},
+	// 3: video creatives served as VAST
+	{
+		`ALTER TABLE advertisement ADD COLUMN video JSON NULL`,
+	},
+	// 4: weekly schedules of conditions
+	{
+		`ALTER TABLE advertisement_condition
+			ADD COLUMN timezone VARCHAR(64) NULL -- IANA name, NULL when not scheduled`,
+		`CREATE TABLE condition_schedule (
+			condition_id INT NOT NULL,
+			days TINYINT UNSIGNED NOT NULL,       -- bit-wise Sunday to Saturday
+			start_hour TINYINT UNSIGNED NOT NULL, -- 0-23, local time
+			end_hour TINYINT UNSIGNED NOT NULL,   -- 1-24, exclusive
+			KEY (condition_id),
+			FOREIGN KEY (condition_id) REFERENCES advertisement_condition(id)
+		)`,
+	},
+	// 5: sub-country geo targeting; unlimited_country now means no country,
+	// region or city is targeted
+	{
+		`CREATE TABLE condition_region (
+			condition_id INT,
+			region_code VARCHAR(6), -- ISO-3166-2 code, e.g. US-CA
+			KEY (condition_id, region_code),
+			FOREIGN KEY (condition_id) REFERENCES advertisement_condition(id)
+		)`,
+		`CREATE TABLE condition_city (
+			condition_id INT,
+			city_id VARCHAR(20), -- GeoNames ID
+			KEY (condition_id, city_id),
+			FOREIGN KEY (condition_id) REFERENCES advertisement_condition(id)
+		)`,
+	},
+	// 6: OS version and device type targeting
+	{
+		`ALTER TABLE advertisement_condition
+			ADD COLUMN min_os_version BIGINT UNSIGNED NULL, -- major*1000000 + minor*1000 + patch
+			ADD COLUMN max_os_version BIGINT UNSIGNED NULL, -- missing components are 999
+			ADD COLUMN device TINYINT UNSIGNED NOT NULL DEFAULT 15, -- bit-wise 'phone', 'tablet', 'desktop', 'tv'
+			ADD INDEX idx_os_version (min_os_version, max_os_version)`,
+	},
+	// 7: language targeting
+	{
+		`ALTER TABLE advertisement_condition
+			ADD COLUMN unlimited_language BOOL NOT NULL DEFAULT TRUE`,
+		`CREATE TABLE condition_language (
+			condition_id INT,
+			language_tag VARCHAR(35), -- BCP 47, e.g. zh-TW
+			KEY (condition_id, language_tag),
+			FOREIGN KEY (condition_id) REFERENCES advertisement_condition(id)
+		)`,
+	},
+	// 8: localized content
+	{
+		`ALTER TABLE advertisement
+			ADD COLUMN locale VARCHAR(35) NULL, -- BCP 47 tag of title, description and video
+			ADD COLUMN description TEXT NULL,
+			ADD COLUMN localizations JSON NULL`,
+	},
+	// 9: keyword and content category targeting
+	{
+		`ALTER TABLE advertisement_condition
+			ADD COLUMN unlimited_keyword BOOL NOT NULL DEFAULT TRUE, -- no keyword to include
+			ADD COLUMN unlimited_category BOOL NOT NULL DEFAULT TRUE`,
+		`CREATE TABLE condition_keyword (
+			condition_id INT,
+			keyword VARCHAR(100),    -- as entered
+			normalized VARCHAR(100), -- case folded without accents
+			excluded BOOL NOT NULL,
+			KEY (condition_id, excluded, normalized),
+			FOREIGN KEY (condition_id) REFERENCES advertisement_condition(id)
+		)`,
+		`CREATE TABLE condition_category (
+			condition_id INT,
+			category VARCHAR(10), -- IAB content category, e.g. IAB1-2
+			KEY (condition_id, category),
+			FOREIGN KEY (condition_id) REFERENCES advertisement_condition(id)
+		)`,
+	},
+	// 10: audiences of hashed user IDs
+	{
+		`CREATE TABLE audience (
+			id INT AUTO_INCREMENT PRIMARY KEY,
+			name VARCHAR(255) NOT NULL,
+			size INT NOT NULL,
+			version INT NOT NULL, -- incremented when the members are replaced
+			updated_at DATETIME NOT NULL
+		)`,
+		`CREATE TABLE audience_chunk (
+			audience_id INT NOT NULL,
+			seq INT NOT NULL,
+			hashes MEDIUMBLOB NOT NULL, -- sorted SHA-256 hashes, 32 bytes each
+			PRIMARY KEY (audience_id, seq),
+			FOREIGN KEY (audience_id) REFERENCES audience(id)
+		)`,
+		`ALTER TABLE advertisement_condition
+			ADD COLUMN unlimited_audience BOOL NOT NULL DEFAULT TRUE -- no audience to include`,
+		`CREATE TABLE condition_audience (
+			condition_id INT,
+			audience_id INT NOT NULL,
+			excluded BOOL NOT NULL,
+			KEY (condition_id, excluded, audience_id),
+			FOREIGN KEY (condition_id) REFERENCES advertisement_condition(id),
+			FOREIGN KEY (audience_id) REFERENCES audience(id)
+		)`,
+	},
+	// 11: targeting expressions over the kv parameters of a request
+	{
+		`ALTER TABLE advertisement_condition
+			ADD COLUMN expr TEXT NULL -- NULL when the condition has no expression`,
+	},
+	// 12: other genders and open-ended age ranges
+	{
+		`ALTER TABLE advertisement_condition
+			ADD COLUMN genders TINYINT UNSIGNED NOT NULL DEFAULT 7 -- bit-wise 'M', 'F', 'O'`,
+		`UPDATE advertisement_condition SET genders = CASE gender WHEN 'M' THEN 1 WHEN 'F' THEN 2 ELSE 7 END`,
+		`ALTER TABLE advertisement_condition DROP COLUMN gender`,
+		// Ages used to end at 100 or 0, which now mean no upper bound, and
+		// to start at 0, which is now 1.
+		`UPDATE advertisement_condition SET age_end = NULL WHERE age_end >= 100 OR age_end = 0`,
+		`UPDATE advertisement_condition SET age_start = 1 WHERE age_start = 0`,
+	},
+	// 13: lifecycle status of advertisements; existing ones stay served
+	{
+		`ALTER TABLE advertisement
+			ADD COLUMN status VARCHAR(20) NOT NULL DEFAULT 'approved', -- see models.Status*
+			ADD INDEX idx_status_end_at (status, end_at)`,
+		`ALTER TABLE advertisement ALTER COLUMN status SET DEFAULT 'draft'`,
+	},
+	// 14: reasons moderation flagged advertisements for review
+	{
+		`ALTER TABLE advertisement ADD COLUMN moderation_reasons JSON NULL`,
+	},
+	// 15: audit log of admin changes; records outlive what they describe
+	{
+		`CREATE TABLE audit_log (
+			id BIGINT AUTO_INCREMENT PRIMARY KEY,
+			at DATETIME(6) NOT NULL,
+			actor VARCHAR(255) NOT NULL,
+			request_id VARCHAR(64) NOT NULL,
+			action VARCHAR(32) NOT NULL, -- e.g. ad.update
+			entity VARCHAR(32) NOT NULL, -- advertisement, audience or api_key
+			entity_id INT NOT NULL,
+			changes JSON NOT NULL, -- {"field": {"before": ..., "after": ...}}
+			KEY (entity, entity_id, at),
+			KEY (actor, at),
+			KEY (at)
+		)`,
+	},
+	// 16: revisions of advertisements and soft deletes
+	{
+		`ALTER TABLE advertisement ADD COLUMN deleted_at DATETIME NULL -- NULL unless deleted`,
+		`CREATE TABLE advertisement_revision (
+			advertisement_id INT NOT NULL,
+			revision INT NOT NULL, -- 1, 2, ... per advertisement
+			created_at DATETIME(6) NOT NULL,
+			actor VARCHAR(255) NOT NULL,
+			action VARCHAR(32) NOT NULL, -- the audit action taking it
+			content JSON NOT NULL, -- the advertisement with its conditions
+			PRIMARY KEY (advertisement_id, revision)
+		)`,
+		// Existing advertisements get revision 1 from a backfill registered by
+		// the controllers, which read them.
+	},
+	// 17: webhooks with their queued and dead deliveries
+	{
+		`CREATE TABLE webhook (
+			id INT AUTO_INCREMENT PRIMARY KEY,
+			url VARCHAR(2048) NOT NULL,
+			events VARCHAR(255) NOT NULL, -- comma separated, e.g. ad.created,ad.expired
+			secret VARCHAR(64) NOT NULL,
+			created_at DATETIME NOT NULL
+		)`,
+		`CREATE TABLE webhook_delivery (
+			id BIGINT AUTO_INCREMENT PRIMARY KEY,
+			uid CHAR(32) NOT NULL, -- sent to receivers, kept by replays
+			webhook_id INT NOT NULL,
+			event VARCHAR(32) NOT NULL,
+			payload JSON NOT NULL,
+			attempts INT NOT NULL DEFAULT 0,
+			next_attempt_at DATETIME(6) NOT NULL,
+			claim VARCHAR(32) NULL, -- set by the instance sending it
+			last_error VARCHAR(1024) NULL,
+			KEY (next_attempt_at),
+			KEY (claim),
+			FOREIGN KEY (webhook_id) REFERENCES webhook(id)
+		)`,
+		`CREATE TABLE webhook_dead_letter (
+			id BIGINT AUTO_INCREMENT PRIMARY KEY,
+			uid CHAR(32) NOT NULL,
+			webhook_id INT NOT NULL,
+			event VARCHAR(32) NOT NULL,
+			payload JSON NOT NULL,
+			attempts INT NOT NULL,
+			last_error VARCHAR(1024) NULL,
+			failed_at DATETIME(6) NOT NULL,
+			KEY (webhook_id, failed_at),
+			FOREIGN KEY (webhook_id) REFERENCES webhook(id)
+		)`,
+		// Start and end times up to scanned_until have been notified.
+		`CREATE TABLE webhook_schedule (
+			id TINYINT PRIMARY KEY, -- a single row
+			scanned_until DATETIME(6) NOT NULL
+		)`,
+		`INSERT INTO webhook_schedule (id, scanned_until) VALUES (1, UTC_TIMESTAMP(6))`,
+	},
+	// 18: version of the targeting conditions held in memory by each instance
+	{
+		`CREATE TABLE targeting_version (
+			id TINYINT PRIMARY KEY, -- a single row
+			version BIGINT NOT NULL -- bumped by every change of a condition
+		)`,
+		`INSERT INTO targeting_version (id, version) VALUES (1, 1)`,
+	},
+}
 
-DROP TABLE IF EXISTS advertisement;
+// backfills holds the steps run after the statements of a migration, by
+// version, for data changes SQL cannot express. A backfill runs against the
+// schema of its version.
+var backfills = map[int]func(tx *sqlx.Tx) error{}
 
-CREATE TABLE advertisement (
-    id INT AUTO_INCREMENT PRIMARY KEY,
-    title VARCHAR(255) NOT NULL,
-    start_at DATETIME NOT NULL,
-    end_at DATETIME NOT NULL
-)
+// RegisterBackfill runs fn in a transaction after the statements of
+// migration version, before the version is recorded. The packages owning
+// the data register their backfills from init.
+func RegisterBackfill(version int, fn func(tx *sqlx.Tx) error) {
+	backfills[version] = fn
+}
 
-CREATE TABLE advertisement_condition (
-    id INT AUTO_INCREMENT PRIMARY KEY,
-    advertisement_id INT NOT NULL,
-    age_start TINYINT UNSIGNED, -- 0-100
-    age_end TINYINT UNSIGNED,   -- 0-100
-    gender CHAR(2),             -- M, F, MF
-	unlimited_country BOOL,
-    platform TINYINT UNSIGNED,  -- bit-wise 'android', 'ios', 'web'
-    FOREIGN KEY (advertisement_id) REFERENCES advertisement(id)
-);
-
-CREATE TABLE condition_country (
-    condition_id INT,
-    country_code CHAR(2), -- ISO-3166 alpha 2 code
-    KEY (condition_id, country_code),
-    FOREIGN KEY (condition_id) REFERENCES advertisement_condition(id)
-);
-
-CREATE INDEX idx_start_at ON advertisement (start_at);
-
-CREATE INDEX idx_end_at ON advertisement (end_at);
-
-CREATE INDEX idx_advertisement_id ON advertisement_condition (advertisement_id);
-`
-
-func init() {
-	// Connect to MySQL database
+// open connects to MySQL and applies the pending migrations unless
+// AutoMigrate is off.
+func open() {
 	cfg := config.GetConfig()
-	dsn := fmt.Sprintf("%s:%s@%s(%s:%d)/%s",
+	// DATETIME columns hold UTC and are read back as time.Time. The default
+	// GROUP_CONCAT limit of 1024 bytes would truncate long keyword lists.
+	dsn := fmt.Sprintf("%s:%s@%s(%s:%d)/%s?parseTime=true&loc=UTC&group_concat_max_len=65536",
 		cfg.Database.Username,
 		cfg.Database.Password,
 		cfg.Database.Network,
@@ -67,13 +303,87 @@ func init() {
 	}
 	db = dbcoon
 
-	queries := strings.Split(schema, "\n\n")
-
-	for _, query := range queries {
-		db.Exec(query)
+	if cfg.Database.AutoMigrate {
+		if _, err := migrate(); err != nil {
+			log.Fatalln("Failed to migrate database:", err)
+		}
 	}
 }
 
+// GetDB returns the database, connecting to it on first use so that
+// packages importing this one build and test without MySQL.
 func GetDB() *sqlx.DB {
+	connect.Do(open)
 	return db
 }
+
+// LatestVersion returns the schema version after every migration is applied.
+func LatestVersion() int {
+	return len(migrations)
+}
+
+// CurrentVersion returns the schema version of the connected database.
+func CurrentVersion() (int, error) {
+	GetDB()
+	return currentVersion()
+}
+
+func currentVersion() (int, error) {
+	if _, err := db.Exec(`CREATE TABLE IF NOT EXISTS schema_migration (
+		version INT PRIMARY KEY,
+		applied_at DATETIME NOT NULL
+	)`); err != nil {
+		return 0, err
+	}
+
+	var version int
+	err := db.Get(&version, "SELECT COALESCE(MAX(version), 0) FROM schema_migration")
+	return version, err
+}
+
+// Migrate applies every pending migration in order and returns the versions it applied.
+func Migrate() (applied []int, err error) {
+	GetDB()
+	return migrate()
+}
+
+func migrate() (applied []int, err error) {
+	current, err := currentVersion()
+	if err != nil {
+		return nil, err
+	}
+
+	for i := current; i < len(migrations); i++ {
+		version := i + 1
+		// MySQL commits DDL implicitly, so each statement takes effect on its own
+		// and the version is recorded once all of them succeeded.
+		for _, statement := range migrations[i] {
+			if _, err := db.Exec(statement); err != nil {
+				return applied, fmt.Errorf("migration %d: %w", version, err)
+			}
+		}
+		if backfill, ok := backfills[version]; ok {
+			if err := runBackfill(backfill); err != nil {
+				return applied, fmt.Errorf("migration %d: %w", version, err)
+			}
+		}
+		if _, err := db.Exec("INSERT INTO schema_migration (version, applied_at) VALUES (?, UTC_TIMESTAMP())", version); err != nil {
+			return applied, fmt.Errorf("migration %d: %w", version, err)
+		}
+		applied = append(applied, version)
+	}
+	return applied, nil
+}
+
+// runBackfill runs backfill in a transaction.
+func runBackfill(backfill func(tx *sqlx.Tx) error) error {
+	tx, err := db.Beginx()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	if err := backfill(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
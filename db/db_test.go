@@ -0,0 +1,63 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"testing"
+
+	_ "github.com/go-sql-driver/mysql"
+	"github.com/stretchr/testify/assert"
+)
+
+// TestAgeMigration runs migration 12 on a temporary advertisement_condition
+// with the columns it had before, which hides the real table on its
+// connection.
+func TestAgeMigration(t *testing.T) {
+	ctx := context.Background()
+	conn, err := GetDB().Connx(ctx)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer conn.Close()
+
+	_, err = conn.ExecContext(ctx, `CREATE TEMPORARY TABLE advertisement_condition (
+		id INT AUTO_INCREMENT PRIMARY KEY,
+		age_start TINYINT UNSIGNED,
+		age_end TINYINT UNSIGNED,
+		gender CHAR(2)
+	)`)
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer conn.ExecContext(ctx, "DROP TEMPORARY TABLE advertisement_condition")
+
+	_, err = conn.ExecContext(ctx, `INSERT INTO advertisement_condition (age_start, age_end, gender)
+		VALUES (0, 100, 'M'), (0, 0, 'F'), (18, 65, 'MF'), (20, 0, NULL), (1, 120, 'F')`)
+	if !assert.NoError(t, err) {
+		return
+	}
+
+	for _, statement := range migrations[11] {
+		_, err := conn.ExecContext(ctx, statement)
+		if !assert.NoError(t, err, statement) {
+			return
+		}
+	}
+
+	type row struct {
+		AgeStart int           `db:"age_start"`
+		AgeEnd   sql.NullInt64 `db:"age_end"`
+		Genders  int           `db:"genders"`
+	}
+	var rows []row
+	err = conn.SelectContext(ctx, &rows, "SELECT age_start, age_end, genders FROM advertisement_condition ORDER BY id")
+	assert.NoError(t, err)
+	open := sql.NullInt64{}
+	assert.Equal(t, []row{
+		{1, open, 1},
+		{1, open, 2},
+		{18, sql.NullInt64{Int64: 65, Valid: true}, 7},
+		{20, open, 7},
+		{1, open, 2},
+	}, rows)
+}
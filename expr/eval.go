@@ -0,0 +1,221 @@
+package expr
+
+import (
+	"fmt"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// versionRegexp matches a dotted version of up to four components.
+var versionRegexp = regexp.MustCompile(`^[0-9]{1,9}(\.[0-9]{1,9}){0,3}$`)
+
+// check assigns the kind of each comparison and rejects comparisons that
+// cannot hold, such as ordering booleans, and keys compared as different
+// kinds. A key compared as a string and as a version is fine.
+func check(root node) error {
+	kinds := map[string]kind{}
+	var walk func(node) error
+	walk = func(n node) error {
+		switch n := n.(type) {
+		case *logical:
+			if err := walk(n.left); err != nil {
+				return err
+			}
+			return walk(n.right)
+		case *negation:
+			return walk(n.x)
+		case *comparison:
+			k, err := comparisonKind(n)
+			if err != nil {
+				return err
+			}
+			if prev, ok := kinds[n.key]; ok && compatible(prev) != compatible(k) {
+				return &Error{Pos: n.pos, Msg: fmt.Sprintf("%s is compared as a %s here but as a %s before", n.key, k, prev)}
+			}
+			kinds[n.key] = k
+		}
+		return nil
+	}
+	return walk(root)
+}
+
+// compatible maps versions to strings, which compare with the same values.
+func compatible(k kind) kind {
+	if k == kindVersion {
+		return kindString
+	}
+	return k
+}
+
+// comparisonKind returns how n compares values: as the kind of its literals,
+// or as versions when ordering strings.
+func comparisonKind(n *comparison) (kind, error) {
+	k := n.values[0].kind
+	for _, v := range n.values[1:] {
+		if v.kind != k {
+			return 0, &Error{Pos: v.pos, Msg: fmt.Sprintf("%s in a list of %ss", v.kind, k)}
+		}
+	}
+
+	switch n.op {
+	case "<", "<=", ">", ">=":
+		v := n.values[0]
+		switch v.kind {
+		case kindBool:
+			return 0, &Error{Pos: v.pos, Msg: fmt.Sprintf("booleans cannot be compared with %s", n.op)}
+		case kindString:
+			if !versionRegexp.MatchString(v.str) {
+				return 0, &Error{Pos: v.pos, Msg: fmt.Sprintf(`%s compares numbers and versions such as "5.2", not %s`, n.op, v)}
+			}
+			return kindVersion, nil
+		}
+	}
+	return k, nil
+}
+
+// compile turns a checked syntax tree into a function.
+func compile(n node) func(Env) bool {
+	switch n := n.(type) {
+	case *logical:
+		left, right := compile(n.left), compile(n.right)
+		if n.op == "AND" {
+			return func(env Env) bool { return left(env) && right(env) }
+		}
+		return func(env Env) bool { return left(env) || right(env) }
+	case *negation:
+		x := compile(n.x)
+		return func(env Env) bool { return !x(env) }
+	case *comparison:
+		return compileComparison(n)
+	}
+	panic(fmt.Sprintf("expr: unknown node %T", n))
+}
+
+func compileComparison(n *comparison) func(Env) bool {
+	k, _ := comparisonKind(n)
+	key := n.key
+
+	// test holds the comparison of a value already converted to the kind.
+	var test func(value interface{}) bool
+	switch n.op {
+	case "IN", "NOT IN":
+		set := map[interface{}]bool{}
+		for _, v := range n.values {
+			set[literalValue(v)] = true
+		}
+		negate := n.op == "NOT IN"
+		test = func(value interface{}) bool { return set[value] != negate }
+	case "=":
+		want := literalValue(n.values[0])
+		test = func(value interface{}) bool { return value == want }
+	case "!=":
+		want := literalValue(n.values[0])
+		test = func(value interface{}) bool { return value != want }
+	default:
+		op := n.op
+		if k == kindVersion {
+			want := parseVersion(n.values[0].str)
+			test = func(value interface{}) bool { return ordered(op, compareVersions(value.([]int), want)) }
+		} else {
+			want := n.values[0].num
+			test = func(value interface{}) bool { return ordered(op, compareNumbers(value.(float64), want)) }
+		}
+	}
+
+	return func(env Env) bool {
+		raw, ok := env[key]
+		if !ok {
+			return false
+		}
+		value, ok := convert(raw, k)
+		return ok && test(value)
+	}
+}
+
+// literalValue returns the value of l as convert returns values of its kind.
+func literalValue(l literal) interface{} {
+	switch l.kind {
+	case kindNumber:
+		return l.num
+	case kindBool:
+		return l.b
+	}
+	return l.str
+}
+
+// convert parses a value of the environment as kind k.
+func convert(raw string, k kind) (interface{}, bool) {
+	switch k {
+	case kindNumber:
+		num, err := strconv.ParseFloat(strings.TrimSpace(raw), 64)
+		if num == 0 {
+			num = 0 // -0 equals 0
+		}
+		return num, err == nil && !math.IsNaN(num) && !math.IsInf(num, 0)
+	case kindBool:
+		b, err := strconv.ParseBool(strings.TrimSpace(raw))
+		return b, err == nil
+	case kindVersion:
+		if !versionRegexp.MatchString(raw) {
+			return nil, false
+		}
+		return parseVersion(raw), true
+	}
+	return raw, true
+}
+
+// parseVersion splits a version matching versionRegexp into components.
+func parseVersion(v string) []int {
+	parts := strings.Split(v, ".")
+	components := make([]int, len(parts))
+	for i, part := range parts {
+		components[i], _ = strconv.Atoi(part)
+	}
+	return components
+}
+
+// compareVersions compares component by component, missing components
+// being 0, so "5.2" equals "5.2.0".
+func compareVersions(a, b []int) int {
+	for i := 0; i < len(a) || i < len(b); i++ {
+		var x, y int
+		if i < len(a) {
+			x = a[i]
+		}
+		if i < len(b) {
+			y = b[i]
+		}
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+func compareNumbers(a, b float64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// ordered reports whether a comparison result satisfies op.
+func ordered(op string, cmp int) bool {
+	switch op {
+	case "<":
+		return cmp < 0
+	case "<=":
+		return cmp <= 0
+	case ">":
+		return cmp > 0
+	}
+	return cmp >= 0
+}
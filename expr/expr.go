@@ -0,0 +1,199 @@
+// Package expr implements the boolean expression language of targeting
+// conditions, evaluated against the key-value pairs of a request, such as
+//
+//	app_version >= "5.2" AND tier IN ("gold", "platinum")
+//
+// A comparison is a key, an operator (=, !=, <, <=, >, >=, IN or NOT IN) and
+// literal values: "strings", numbers and true or false. Comparisons combine
+// with AND, OR, NOT and parentheses; keywords are case insensitive.
+//
+// The literal decides how a value is compared: as a number, a boolean, a
+// string, or with <, <=, > and >= and a string such as "5.2", as a dotted
+// version, so that "5.10" is above "5.2". A comparison of a missing key or of
+// a value not of the literal's type is false, so is its != and NOT IN.
+package expr
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Limits on the source of an expression.
+const (
+	MaxLength = 1000
+	maxDepth  = 32
+	maxValues = 100
+)
+
+// Env holds the values of the keys an expression refers to.
+type Env map[string]string
+
+// Error is a syntax or type error at a byte offset of the source.
+type Error struct {
+	Pos int
+	Msg string
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("col %d: %s", e.Pos+1, e.Msg)
+}
+
+// Program is a compiled expression. It is safe for concurrent use.
+type Program struct {
+	root node
+	eval func(Env) bool
+}
+
+// Compile parses and type checks src.
+func Compile(src string) (*Program, error) {
+	if len(src) > MaxLength {
+		return nil, &Error{Pos: MaxLength, Msg: fmt.Sprintf("expression longer than %d characters", MaxLength)}
+	}
+	root, err := parse(src)
+	if err != nil {
+		return nil, err
+	}
+	if err := check(root); err != nil {
+		return nil, err
+	}
+	return &Program{root: root, eval: compile(root)}, nil
+}
+
+// Eval reports whether env satisfies the expression.
+func (p *Program) Eval(env Env) bool {
+	return p.eval(env)
+}
+
+// String returns the expression in canonical form, which compiles to an
+// equivalent program.
+func (p *Program) String() string {
+	return p.root.String()
+}
+
+// Keys returns the keys the expression refers to, sorted.
+func (p *Program) Keys() []string {
+	seen := map[string]bool{}
+	var walk func(node)
+	walk = func(n node) {
+		switch n := n.(type) {
+		case *logical:
+			walk(n.left)
+			walk(n.right)
+		case *negation:
+			walk(n.x)
+		case *comparison:
+			seen[n.key] = true
+		}
+	}
+	walk(p.root)
+
+	keys := make([]string, 0, len(seen))
+	for key := range seen {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// node is an expression of the syntax tree.
+type node interface {
+	String() string
+}
+
+// logical is an AND or OR of two expressions.
+type logical struct {
+	op          string
+	left, right node
+}
+
+// precedence is 1 for OR and 2 for AND, which binds tighter.
+func (n *logical) precedence() int {
+	if n.op == "OR" {
+		return 1
+	}
+	return 2
+}
+
+// String parenthesizes an operand only where precedence or left
+// associativity would group it differently.
+func (n *logical) String() string {
+	left, right := n.left.String(), n.right.String()
+	if l, ok := n.left.(*logical); ok && l.precedence() < n.precedence() {
+		left = "(" + left + ")"
+	}
+	if r, ok := n.right.(*logical); ok && r.precedence() <= n.precedence() {
+		right = "(" + right + ")"
+	}
+	return left + " " + n.op + " " + right
+}
+
+// negation is NOT of an expression.
+type negation struct {
+	x node
+}
+
+func (n *negation) String() string {
+	if _, ok := n.x.(*logical); ok {
+		return "NOT (" + n.x.String() + ")"
+	}
+	return "NOT " + n.x.String()
+}
+
+// comparison compares the value of key with literals. IN and NOT IN take
+// any number of values, the other operators one.
+type comparison struct {
+	pos    int
+	key    string
+	op     string
+	values []literal
+}
+
+func (n *comparison) String() string {
+	if n.op != "IN" && n.op != "NOT IN" {
+		return n.key + " " + n.op + " " + n.values[0].String()
+	}
+	values := make([]string, len(n.values))
+	for i, v := range n.values {
+		values[i] = v.String()
+	}
+	return n.key + " " + n.op + " (" + strings.Join(values, ", ") + ")"
+}
+
+// kind is the type of a literal, or of the key it is compared with.
+type kind int
+
+const (
+	kindString kind = iota
+	kindNumber
+	kindBool
+	kindVersion
+)
+
+func (k kind) String() string {
+	return [...]string{"string", "number", "boolean", "version"}[k]
+}
+
+type literal struct {
+	pos  int
+	kind kind
+	str  string
+	num  float64
+	b    bool
+}
+
+func (l literal) String() string {
+	switch l.kind {
+	case kindNumber:
+		return strconv.FormatFloat(l.num, 'f', -1, 64)
+	case kindBool:
+		return strconv.FormatBool(l.b)
+	}
+	return quote(l.str)
+}
+
+// quote returns s as a string literal.
+func quote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
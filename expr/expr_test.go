@@ -0,0 +1,168 @@
+package expr
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEval(t *testing.T) {
+	env := Env{"app_version": "5.10", "tier": "gold", "visits": "12", "beta": "true", "name": "Ann"}
+
+	testCases := []struct {
+		src      string
+		expected bool
+	}{
+		{`app_version >= "5.2" AND tier IN ("gold", "platinum")`, true},
+		{`app_version < "5.2"`, false},
+		{`app_version > "5.9.9"`, true},
+		{`app_version = "5.10"`, true},
+		{`app_version >= "5.10.0"`, true},
+		{`tier NOT IN ("gold", "platinum")`, false},
+		{`tier != "silver"`, true},
+		{`visits > 10 and visits <= 12.5`, true},
+		{`visits = 12.0`, true},
+		{`visits IN (1, 2, 3)`, false},
+		{`beta = true`, true},
+		{`beta != false`, true},
+		{`NOT beta = true OR name = "Ann"`, true},
+		{`NOT (beta = true OR name = "Ann")`, false},
+		{`tier = "silver" OR tier = "gold" AND visits > 100`, false},
+		{`(tier = "silver" OR tier = "gold") AND visits > 10`, true},
+		// A missing key or a value of another kind fails every comparison.
+		{`country = "TW"`, false},
+		{`country != "TW"`, false},
+		{`country NOT IN ("TW")`, false},
+		{`NOT country = "TW"`, true},
+		{`name > 3`, false},
+		{`name != 3`, false},
+		{`tier > "1"`, false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.src, func(t *testing.T) {
+			p, err := Compile(tc.src)
+			if assert.NoError(t, err) {
+				assert.Equal(t, tc.expected, p.Eval(env))
+			}
+		})
+	}
+}
+
+func TestCompileErrors(t *testing.T) {
+	testCases := []struct {
+		src string
+		err string
+	}{
+		{``, `col 1: expected a key, found end of expression`},
+		{`tier = `, `col 8: expected a value, found end of expression`},
+		{`tier == "gold"`, `col 7: expected a value, found "="`},
+		{`tier = gold`, `col 8: expected a value, found "gold"`},
+		{`tier = "gold`, `col 8: unterminated string`},
+		{`tier = "go\ld"`, `col 11: unknown escape, only \" and \\ are allowed`},
+		{`tier IN "gold"`, `col 9: expected "(" after IN, found string "gold"`},
+		{`tier IN ("gold" "silver")`, `col 17: expected "," or ")", found string "silver"`},
+		{`tier NOT "gold"`, `col 10: expected IN after NOT, found string "gold"`},
+		{`tier "gold"`, `col 6: expected an operator after tier, found string "gold"`},
+		{`(tier = "gold"`, `col 15: expected ")", found end of expression`},
+		{`tier = "gold" visits = 1`, `col 15: expected AND, OR or end of expression, found "visits"`},
+		{`and = 1`, `col 1: expected a key, found "and"`},
+		{`!beta = true`, `col 1: unexpected "!", use != or NOT`},
+		{`tier = 'gold'`, `col 8: unexpected '\''`},
+		{`app_version >= 5.2.1`, `col 16: malformed number "5.2.1", quote versions such as "5.2"`},
+		{`visits > 1.`, `col 10: malformed number "1."`},
+		{`visits > 1` + strings.Repeat("0", 400), `col 10: number 1` + strings.Repeat("0", 400) + ` out of range`},
+		{`beta > true`, `col 8: booleans cannot be compared with >`},
+		{`tier > "gold"`, `col 8: > compares numbers and versions such as "5.2", not "gold"`},
+		{`tier IN ("gold", 1)`, `col 18: number in a list of strings`},
+		{`visits > 1 AND visits = "many"`, `col 16: visits is compared as a string here but as a number before`},
+		{strings.Repeat("(", 40) + `a = 1` + strings.Repeat(")", 40), `col 33: expression nested deeper than 32 levels`},
+		{strings.Repeat("a", MaxLength+1), `col 1001: expression longer than 1000 characters`},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.src, func(t *testing.T) {
+			_, err := Compile(tc.src)
+			assert.EqualError(t, err, tc.err)
+		})
+	}
+
+	// A key may be compared as a string and as a version.
+	_, err := Compile(`app_version = "beta" OR app_version >= "5.2"`)
+	assert.NoError(t, err)
+}
+
+func TestString(t *testing.T) {
+	testCases := map[string]string{
+		`app_version>="5.2" and tier in ("gold","platinum")`: `app_version >= "5.2" AND tier IN ("gold", "platinum")`,
+		`((a = 1))`:                           `a = 1`,
+		`a = 1 OR b = 2 AND c = 3`:            `a = 1 OR b = 2 AND c = 3`,
+		`(a = 1 OR b = 2) AND c = 3`:          `(a = 1 OR b = 2) AND c = 3`,
+		`a = 1 AND (b = 2 AND c = 3)`:         `a = 1 AND (b = 2 AND c = 3)`,
+		`not not (a = 1 or b = -0)`:           `NOT NOT (a = 1 OR b = 0)`,
+		`a not in (007, 1.50)`:                `a NOT IN (7, 1.5)`,
+		`name = "say \"hi\" \\ bye"`:          `name = "say \"hi\" \\ bye"`,
+		`v >= "1.0" AND v < "2" OR v = "dev"`: `v >= "1.0" AND v < "2" OR v = "dev"`,
+	}
+	for src, expected := range testCases {
+		p, err := Compile(src)
+		if !assert.NoError(t, err, src) {
+			continue
+		}
+		assert.Equal(t, expected, p.String())
+	}
+}
+
+func TestKeys(t *testing.T) {
+	p, err := Compile(`tier = "gold" OR NOT (visits > 1 AND tier != "x")`)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"tier", "visits"}, p.Keys())
+}
+
+// FuzzCompile checks that any input either fails with an Error or compiles
+// to a program whose canonical form compiles to the same canonical form and
+// evaluates alike.
+func FuzzCompile(f *testing.F) {
+	for _, seed := range []string{
+		`app_version >= "5.2" AND tier IN ("gold", "platinum")`,
+		`NOT (a = 1 OR b != -2.5) AND c NOT IN (true, false)`,
+		`name = "say \"hi\""`,
+		`((((a = 1))))`,
+		`a = 1 OR b = 2 AND c = 3`,
+		`x > 1e5`,
+		`a IN (`,
+	} {
+		f.Add(seed, "1")
+	}
+
+	f.Fuzz(func(t *testing.T, src, value string) {
+		p, err := Compile(src)
+		if err != nil {
+			if _, ok := err.(*Error); !ok {
+				t.Fatalf("Compile(%q) returned %T: %v", src, err, err)
+			}
+			return
+		}
+
+		canonical := p.String()
+		root, err := parse(canonical)
+		if err != nil {
+			t.Fatalf("canonical form %q of %q does not parse: %v", canonical, src, err)
+		}
+		if err := check(root); err != nil {
+			t.Fatalf("canonical form %q of %q does not check: %v", canonical, src, err)
+		}
+		if again := root.String(); again != canonical {
+			t.Fatalf("canonical form %q of %q became %q", canonical, src, again)
+		}
+
+		env := Env{}
+		for _, key := range p.Keys() {
+			env[key] = value
+		}
+		if p.Eval(env) != compile(root)(env) {
+			t.Fatalf("%q and its canonical form %q disagree on %v", src, canonical, env)
+		}
+	})
+}
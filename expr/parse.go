@@ -0,0 +1,336 @@
+package expr
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+type tokenType int
+
+const (
+	tokenEOF tokenType = iota
+	tokenIdent
+	tokenString
+	tokenNumber
+	tokenOp // = != < <= > >=
+	tokenLParen
+	tokenRParen
+	tokenComma
+)
+
+type token struct {
+	typ  tokenType
+	pos  int
+	text string // the identifier or operator, or the unquoted string
+}
+
+// describe names the token in error messages.
+func (t token) describe() string {
+	switch t.typ {
+	case tokenEOF:
+		return "end of expression"
+	case tokenString:
+		return "string " + quote(t.text)
+	}
+	return strconv.Quote(t.text)
+}
+
+// keyword reports whether t is the keyword word, in any case.
+func (t token) keyword(word string) bool {
+	return t.typ == tokenIdent && strings.EqualFold(t.text, word)
+}
+
+func isKeyword(ident string) bool {
+	switch strings.ToUpper(ident) {
+	case "AND", "OR", "NOT", "IN", "TRUE", "FALSE":
+		return true
+	}
+	return false
+}
+
+func isIdentStart(c byte) bool {
+	return c == '_' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+}
+
+func isDigit(c byte) bool {
+	return '0' <= c && c <= '9'
+}
+
+// lex splits src into tokens ending with tokenEOF.
+func lex(src string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(src); {
+		c := src[i]
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '(':
+			tokens = append(tokens, token{tokenLParen, i, "("})
+			i++
+		case c == ')':
+			tokens = append(tokens, token{tokenRParen, i, ")"})
+			i++
+		case c == ',':
+			tokens = append(tokens, token{tokenComma, i, ","})
+			i++
+		case c == '=':
+			tokens = append(tokens, token{tokenOp, i, "="})
+			i++
+		case c == '!' || c == '<' || c == '>':
+			op := string(c)
+			if i+1 < len(src) && src[i+1] == '=' {
+				op += "="
+			}
+			if op == "!" {
+				return nil, &Error{Pos: i, Msg: `unexpected "!", use != or NOT`}
+			}
+			tokens = append(tokens, token{tokenOp, i, op})
+			i += len(op)
+		case c == '"':
+			s, n, err := lexString(src, i)
+			if err != nil {
+				return nil, err
+			}
+			tokens = append(tokens, token{tokenString, i, s})
+			i += n
+		case isDigit(c) || c == '-' || c == '.':
+			start := i
+			if c == '-' {
+				i++
+			}
+			digits := i
+			for i < len(src) && isDigit(src[i]) {
+				i++
+			}
+			if i < len(src) && src[i] == '.' {
+				i++
+				for i < len(src) && isDigit(src[i]) {
+					i++
+				}
+			}
+			if i < len(src) && src[i] == '.' {
+				for i < len(src) && (isDigit(src[i]) || src[i] == '.') {
+					i++
+				}
+				return nil, &Error{Pos: start, Msg: fmt.Sprintf(`malformed number %q, quote versions such as "5.2"`, src[start:i])}
+			}
+			text := src[start:i]
+			if i == digits || text[len(text)-1] == '.' || src[digits] == '.' {
+				return nil, &Error{Pos: start, Msg: fmt.Sprintf("malformed number %q", text)}
+			}
+			tokens = append(tokens, token{tokenNumber, start, text})
+		case isIdentStart(c):
+			start := i
+			for i < len(src) && (isIdentStart(src[i]) || isDigit(src[i])) {
+				i++
+			}
+			tokens = append(tokens, token{tokenIdent, start, src[start:i]})
+		default:
+			r, _ := utf8.DecodeRuneInString(src[i:])
+			return nil, &Error{Pos: i, Msg: fmt.Sprintf("unexpected %q", r)}
+		}
+	}
+	return append(tokens, token{tokenEOF, len(src), ""}), nil
+}
+
+// lexString reads the string literal at src[start], returning its value and
+// length in src.
+func lexString(src string, start int) (string, int, error) {
+	var b strings.Builder
+	for i := start + 1; i < len(src); i++ {
+		switch src[i] {
+		case '"':
+			if !utf8.ValidString(b.String()) {
+				return "", 0, &Error{Pos: start, Msg: "string is not valid UTF-8"}
+			}
+			return b.String(), i + 1 - start, nil
+		case '\\':
+			if i+1 == len(src) || (src[i+1] != '"' && src[i+1] != '\\') {
+				return "", 0, &Error{Pos: i, Msg: `unknown escape, only \" and \\ are allowed`}
+			}
+			i++
+		}
+		b.WriteByte(src[i])
+	}
+	return "", 0, &Error{Pos: start, Msg: "unterminated string"}
+}
+
+// parser is a recursive descent parser of the grammar
+//
+//	or         = and { "OR" and }
+//	and        = not { "AND" not }
+//	not        = "NOT" not | "(" or ")" | comparison
+//	comparison = key op value | key [ "NOT" ] "IN" "(" value { "," value } ")"
+type parser struct {
+	tokens []token
+	next   int
+	depth  int
+}
+
+func parse(src string) (node, error) {
+	tokens, err := lex(src)
+	if err != nil {
+		return nil, err
+	}
+	p := &parser{tokens: tokens}
+	n, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.typ != tokenEOF {
+		return nil, p.unexpected(t, "AND, OR or end of expression")
+	}
+	return n, nil
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.next]
+}
+
+func (p *parser) advance() token {
+	t := p.tokens[p.next]
+	if t.typ != tokenEOF {
+		p.next++
+	}
+	return t
+}
+
+func (p *parser) unexpected(t token, expected string) error {
+	return &Error{Pos: t.pos, Msg: fmt.Sprintf("expected %s, found %s", expected, t.describe())}
+}
+
+func (p *parser) parseOr() (node, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().keyword("OR") {
+		p.advance()
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &logical{op: "OR", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseAnd() (node, error) {
+	left, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek().keyword("AND") {
+		p.advance()
+		right, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		left = &logical{op: "AND", left: left, right: right}
+	}
+	return left, nil
+}
+
+func (p *parser) parseNot() (node, error) {
+	t := p.peek()
+	if p.depth == maxDepth {
+		return nil, &Error{Pos: t.pos, Msg: fmt.Sprintf("expression nested deeper than %d levels", maxDepth)}
+	}
+	p.depth++
+	defer func() { p.depth-- }()
+
+	switch {
+	case t.keyword("NOT"):
+		p.advance()
+		x, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return &negation{x: x}, nil
+	case t.typ == tokenLParen:
+		p.advance()
+		x, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if t := p.advance(); t.typ != tokenRParen {
+			return nil, p.unexpected(t, `")"`)
+		}
+		return x, nil
+	}
+	return p.parseComparison()
+}
+
+func (p *parser) parseComparison() (node, error) {
+	key := p.advance()
+	if key.typ != tokenIdent || isKeyword(key.text) {
+		return nil, p.unexpected(key, "a key")
+	}
+	n := &comparison{pos: key.pos, key: key.text}
+
+	t := p.advance()
+	switch {
+	case t.typ == tokenOp:
+		n.op = t.text
+		v, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		n.values = []literal{v}
+		return n, nil
+	case t.keyword("NOT"):
+		if t := p.advance(); !t.keyword("IN") {
+			return nil, p.unexpected(t, "IN after NOT")
+		}
+		n.op = "NOT IN"
+	case t.keyword("IN"):
+		n.op = "IN"
+	default:
+		return nil, p.unexpected(t, "an operator after "+key.text)
+	}
+
+	if t := p.advance(); t.typ != tokenLParen {
+		return nil, p.unexpected(t, `"(" after `+n.op)
+	}
+	for {
+		v, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		if len(n.values) == maxValues {
+			return nil, &Error{Pos: v.pos, Msg: fmt.Sprintf("more than %d values", maxValues)}
+		}
+		n.values = append(n.values, v)
+
+		t := p.advance()
+		if t.typ == tokenRParen {
+			return n, nil
+		}
+		if t.typ != tokenComma {
+			return nil, p.unexpected(t, `"," or ")"`)
+		}
+	}
+}
+
+func (p *parser) parseValue() (literal, error) {
+	t := p.advance()
+	switch {
+	case t.typ == tokenString:
+		return literal{pos: t.pos, kind: kindString, str: t.text}, nil
+	case t.typ == tokenNumber:
+		num, err := strconv.ParseFloat(t.text, 64)
+		if err != nil || math.IsInf(num, 0) {
+			return literal{}, &Error{Pos: t.pos, Msg: fmt.Sprintf("number %s out of range", t.text)}
+		}
+		if num == 0 {
+			num = 0 // no negative zero
+		}
+		return literal{pos: t.pos, kind: kindNumber, num: num}, nil
+	case t.keyword("TRUE"), t.keyword("FALSE"):
+		return literal{pos: t.pos, kind: kindBool, b: t.keyword("TRUE")}, nil
+	}
+	return literal{}, p.unexpected(t, "a value")
+}
@@ -0,0 +1,74 @@
+// Package geoip resolves client IP addresses to locations with a local
+// MaxMind-format (mmdb) database such as GeoLite2-City.
+package geoip
+
+import (
+	"net"
+	"strconv"
+
+	"github.com/oschwald/maxminddb-golang"
+)
+
+// Location is where an IP address is. Empty fields are unknown.
+type Location struct {
+	// Country is an ISO 3166-1 alpha-2 code.
+	Country string
+	// Region is an ISO 3166-2 code such as "US-CA".
+	Region string
+	// City is a GeoNames ID.
+	City string
+}
+
+// record is the part of a GeoIP2/GeoLite2 City or Country record in use.
+type record struct {
+	Country struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"country"`
+	Subdivisions []struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"subdivisions"`
+	City struct {
+		GeoNameID uint `maxminddb:"geoname_id"`
+	} `maxminddb:"city"`
+}
+
+// Resolver looks up IP addresses in an mmdb file.
+type Resolver struct {
+	db *maxminddb.Reader
+}
+
+// Open opens the mmdb file at path.
+func Open(path string) (*Resolver, error) {
+	db, err := maxminddb.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return &Resolver{db: db}, nil
+}
+
+// Close releases the database.
+func (r *Resolver) Close() error {
+	return r.db.Close()
+}
+
+// Lookup returns the location of ip. An address missing from the database
+// has an empty location.
+func (r *Resolver) Lookup(ip net.IP) (Location, error) {
+	var rec record
+	if err := r.db.Lookup(ip, &rec); err != nil {
+		return Location{}, err
+	}
+
+	loc := Location{Country: rec.Country.ISOCode}
+	if loc.Country == "" {
+		return loc, nil
+	}
+	// The most specific subdivision comes last; the first is the region.
+	if len(rec.Subdivisions) > 0 && rec.Subdivisions[0].ISOCode != "" {
+		loc.Region = loc.Country + "-" + rec.Subdivisions[0].ISOCode
+	}
+	if rec.City.GeoNameID != 0 {
+		loc.City = strconv.FormatUint(uint64(rec.City.GeoNameID), 10)
+	}
+	return loc, nil
+}
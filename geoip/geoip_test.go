@@ -0,0 +1,44 @@
+package geoip
+
+import (
+	"net"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// testdata/city-test.mmdb was written with github.com/maxmind/mmdbwriter and
+// holds a few networks in the layout of GeoIP2-City.
+func TestLookup(t *testing.T) {
+	r, err := Open("testdata/city-test.mmdb")
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer r.Close()
+
+	testCases := []struct {
+		ip       string
+		expected Location
+	}{
+		{ip: "1.160.10.240", expected: Location{Country: "TW", Region: "TW-TPE", City: "1668341"}},
+		{ip: "216.160.83.58", expected: Location{Country: "US", Region: "US-WA", City: "5803556"}},
+		{ip: "89.160.20.120", expected: Location{Country: "SE", Region: "SE-E", City: "2694762"}},
+		{ip: "2.125.160.217", expected: Location{Country: "GB"}},
+		{ip: "2001:218::1", expected: Location{Country: "JP", Region: "JP-13", City: "1850147"}},
+		{ip: "8.8.8.8", expected: Location{}},
+		{ip: "127.0.0.1", expected: Location{}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.ip, func(t *testing.T) {
+			loc, err := r.Lookup(net.ParseIP(tc.ip))
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, loc)
+		})
+	}
+}
+
+func TestOpenMissing(t *testing.T) {
+	_, err := Open("testdata/missing.mmdb")
+	assert.Error(t, err)
+}
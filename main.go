@@ -1,16 +1,63 @@
 package main
 
 import (
+	"context"
 	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"google.golang.org/grpc"
 
 	"github.com/jjshen2000/simple-ads/config"
 	"github.com/jjshen2000/simple-ads/routes"
 )
 
+// shutdownTimeout bounds how long requests in flight may finish on shutdown.
+const shutdownTimeout = 10 * time.Second
+
 func main() {
+	// Interrupting the process stops the background loops and the servers.
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
 	router := routes.SetupRoutes()
+	routes.Start(ctx)
 	cfg := config.GetConfig()
-	router.Run(fmt.Sprintf("%s:%d", cfg.Server.IP, cfg.Server.Port))
-}
 
+	var grpcServer *grpc.Server
+	if cfg.Server.GRPCPort != 0 {
+		lis, err := net.Listen("tcp", fmt.Sprintf("%s:%d", cfg.Server.IP, cfg.Server.GRPCPort))
+		if err != nil {
+			log.Fatalln("Failed to listen for gRPC:", err)
+		}
+		grpcServer = routes.SetupGRPC()
+		go func() {
+			if err := grpcServer.Serve(lis); err != nil {
+				log.Fatalln("gRPC server stopped:", err)
+			}
+		}()
+	}
+
+	server := &http.Server{Addr: fmt.Sprintf("%s:%d", cfg.Server.IP, cfg.Server.Port), Handler: router}
+	go func() {
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			log.Fatalln("HTTP server stopped:", err)
+		}
+	}()
 
+	<-ctx.Done()
+	stop()
+	shutdown, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancel()
+	if err := server.Shutdown(shutdown); err != nil {
+		log.Println("Failed to shut down HTTP server:", err)
+	}
+	if grpcServer != nil {
+		grpcServer.GracefulStop()
+	}
+}
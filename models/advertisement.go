@@ -5,17 +5,59 @@ import (
 )
 
 type Advertisement struct {
-	ID         int          `db:"id"`
+	ID         int          `db:"id" json:"id,omitempty"`
 	Title      string       `db:"title" json:"title" validate:"required,max=255"`
 	StartAt    time.Time    `db:"start_at" json:"startAt" validate:"required"`
 	EndAt      time.Time    `db:"end_at"  json:"endAt" validate:"required,gtfield=StartAt"`
-	Conditions []Conditions `db:"created_at" json:"conditions" validate:"omitempty"`
+	Conditions []Conditions `db:"created_at" json:"conditions" validate:"omitempty,dive"`
+	Video      *Video       `db:"video" json:"video,omitempty" validate:"omitempty"`
+	// Locale is the BCP 47 tag of Title, Description and Video. It is
+	// required with Localizations, which carry the content in other locales.
+	Locale        string         `db:"locale" json:"locale,omitempty" validate:"omitempty,languageTag"`
+	Description   string         `db:"description" json:"description,omitempty" validate:"max=1000"`
+	Localizations []Localization `db:"localizations" json:"localizations,omitempty" validate:"omitempty,dive"`
+	// Status is the lifecycle status, one of the Status constants. It is
+	// ignored on writes and changes through transitions only.
+	Status string `db:"status" json:"status,omitempty"`
+	// ModerationReasons is why moderation flagged the advertisement when it
+	// was last written; it is ignored on writes.
+	ModerationReasons []ModerationReason `db:"moderation_reasons" json:"moderationReasons,omitempty"`
 }
 
+// MaxAge is the oldest age a request or a condition may specify.
+const MaxAge = 120
+
 type Conditions struct {
-	AgeStart int      `db:"age_start" json:"ageStart" validate:"omitempty,min=1,max=100,default=1"`
-	AgeEnd   int      `db:"age_end" json:"ageEnd" validate:"omitempty,min=1,max=100,default=100"`
-	Gender   []string `db:"gender" json:"gender" validate:"omitempty,max=2,dive,oneof=M F"`
-	Country  []string `db:"country" json:"country" validate:"omitempty,dive,validCountryCode"`
-	Platform []string `db:"platform" json:"platform" validate:"omitempty,dive,oneof=android ios web"`
-}
\ No newline at end of file
+	AgeStart int `db:"age_start" json:"ageStart" validate:"omitempty,min=1,max=120"` // 0 means 1
+	// AgeEnd is inclusive; 0 means no upper bound, so AgeStart 65 alone
+	// targets 65+.
+	AgeEnd int `db:"age_end" json:"ageEnd" validate:"omitempty,min=1,max=120"`
+	// Gender lists "M", "F" and "O" for other genders.
+	Gender   []string  `db:"gender" json:"gender" validate:"omitempty,max=3,dive,oneof=M F O"`
+	Country  []string  `db:"country" json:"country" validate:"omitempty,dive,validCountryCode"`
+	Region   []string  `db:"region" json:"region" validate:"omitempty,dive,validSubdivisionCode"`
+	City     []string  `db:"city" json:"city" validate:"omitempty,dive,numeric,max=20"` // GeoNames ID
+	Platform []string  `db:"platform" json:"platform" validate:"omitempty,dive,oneof=android ios web"`
+	Schedule *Schedule `db:"schedule" json:"schedule,omitempty" validate:"omitempty"`
+	// The OS version bounds are inclusive; missing components of MaxOSVersion
+	// are unbounded, so "16" covers every 16.x.
+	MinOSVersion string   `db:"min_os_version" json:"minOSVersion,omitempty" validate:"omitempty,osVersion"`
+	MaxOSVersion string   `db:"max_os_version" json:"maxOSVersion,omitempty" validate:"omitempty,osVersion"`
+	Device       []string `db:"device" json:"device" validate:"omitempty,dive,oneof=phone tablet desktop tv"`
+	// Language lists BCP 47 tags; "zh" also matches "zh-TW" viewers.
+	Language []string `db:"language" json:"language" validate:"omitempty,dive,languageTag"`
+	// Keywords and Category match the context of the page or app screen.
+	// Keywords compare ignoring case and accents; a target with any of
+	// ExcludeKeywords never matches.
+	Keywords        []string `db:"keywords" json:"keywords" validate:"omitempty,max=50,dive,keyword"`
+	ExcludeKeywords []string `db:"exclude_keywords" json:"excludeKeywords" validate:"omitempty,max=50,dive,keyword"`
+	Category        []string `db:"category" json:"category" validate:"omitempty,dive,iabCategory"`
+	// Audience and ExcludeAudience list audience IDs; the user must belong
+	// to one of Audience and to none of ExcludeAudience.
+	Audience        []int `db:"audience" json:"audience" validate:"omitempty,max=20,dive,min=1"`
+	ExcludeAudience []int `db:"exclude_audience" json:"excludeAudience" validate:"omitempty,max=20,dive,min=1"`
+	// Expr is a targeting expression over the kv.* parameters of the
+	// request, such as `app_version >= "5.2" AND tier IN ("gold")`; see
+	// package expr.
+	Expr string `db:"expr" json:"expr,omitempty"`
+}
@@ -0,0 +1,14 @@
+package models
+
+import (
+	"time"
+)
+
+// Audience is a set of users, such as existing customers, known by the
+// SHA-256 hashes of their IDs. The members are uploaded separately.
+type Audience struct {
+	ID        int       `db:"id" json:"id"`
+	Name      string    `db:"name" json:"name"`
+	Size      int       `db:"size" json:"size"`
+	UpdatedAt time.Time `db:"updated_at" json:"updatedAt"`
+}
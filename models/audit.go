@@ -0,0 +1,29 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// AuditRecord is an admin change, as appended to the audit log in the
+// transaction making it.
+type AuditRecord struct {
+	ID        int64     `json:"id"`
+	At        time.Time `json:"at"`
+	Actor     string    `json:"actor"`
+	RequestID string    `json:"requestId"`
+	// Action names the change, such as "ad.update".
+	Action string `json:"action"`
+	// Entity is "advertisement", "audience" or "api_key".
+	Entity   string `json:"entity"`
+	EntityID int    `json:"entityId"`
+	// Changes holds the top-level fields that changed, by JSON name.
+	Changes map[string]AuditChange `json:"changes"`
+}
+
+// AuditChange is the value of a field before and after a change, absent
+// when the field did not exist.
+type AuditChange struct {
+	Before json.RawMessage `json:"before,omitempty"`
+	After  json.RawMessage `json:"after,omitempty"`
+}
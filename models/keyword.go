@@ -0,0 +1,32 @@
+package models
+
+import (
+	"regexp"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+)
+
+// categoryRegexp matches the IAB content categories used by OpenRTB 2.5,
+// such as "IAB1" or its subcategory "IAB1-2".
+var categoryRegexp = regexp.MustCompile(`^IAB[0-9]{1,2}(-[0-9]{1,2})?$`)
+
+// IsValidCategory reports whether category is an IAB content category.
+func IsValidCategory(category string) bool {
+	return categoryRegexp.MatchString(category)
+}
+
+// NormalizeKeyword folds case and strips accents and surrounding spaces so
+// that "Café " and "cafe" compare equal. Runs of spaces become one.
+func NormalizeKeyword(keyword string) string {
+	t := transform.Chain(norm.NFD, runes.Remove(runes.In(unicode.Mn)), norm.NFC)
+	stripped, _, err := transform.String(t, keyword)
+	if err != nil {
+		stripped = keyword
+	}
+	return strings.Join(strings.Fields(cases.Fold().String(stripped)), " ")
+}
@@ -0,0 +1,53 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalizeKeyword(t *testing.T) {
+	testCases := []struct {
+		keyword string
+		expect  string
+	}{
+		{keyword: "Café", expect: "cafe"},
+		{keyword: "  CRÈME   Brûlée ", expect: "creme brulee"},
+		{keyword: "Straße", expect: "strasse"},
+		{keyword: "São Paulo", expect: "sao paulo"},
+		{keyword: "咖啡", expect: "咖啡"},
+		{keyword: "   ", expect: ""},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.keyword, func(t *testing.T) {
+			assert.Equal(t, tc.expect, NormalizeKeyword(tc.keyword))
+		})
+	}
+}
+
+func TestValidateContext(t *testing.T) {
+	testCases := []struct {
+		name      string
+		condition Conditions
+		valid     bool
+	}{
+		{name: "Keywords", condition: Conditions{Keywords: []string{"coffee", "Café"}, ExcludeKeywords: []string{"decaf"}}, valid: true},
+		{name: "Categories", condition: Conditions{Category: []string{"IAB8", "IAB8-5"}}, valid: true},
+		{name: "Blank keyword", condition: Conditions{Keywords: []string{" "}}},
+		{name: "Comma", condition: Conditions{ExcludeKeywords: []string{"tea, coffee"}}},
+		{name: "Lowercase category", condition: Conditions{Category: []string{"iab8"}}},
+		{name: "Unknown category", condition: Conditions{Category: []string{"IAB8-5-1"}}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := GetValidate().Struct(tc.condition)
+			if tc.valid {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+}
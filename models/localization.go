@@ -0,0 +1,11 @@
+package models
+
+// Localization is the content of an advertisement in a locale other than its
+// default one.
+type Localization struct {
+	Locale      string `json:"locale" validate:"required,languageTag"`
+	Title       string `json:"title" validate:"required,max=255"`
+	Description string `json:"description,omitempty" validate:"max=1000"`
+	// Video replaces the video creative of the advertisement, if set.
+	Video *Video `json:"video,omitempty" validate:"omitempty"`
+}
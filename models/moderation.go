@@ -0,0 +1,11 @@
+package models
+
+// ModerationReason is why the moderation of an advertisement flagged it for
+// review.
+type ModerationReason struct {
+	// Check names the check, such as "bannedWord".
+	Check string `json:"check"`
+	// Field is the path of the offending field, such as "localizations[0].title".
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
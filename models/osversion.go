@@ -0,0 +1,64 @@
+package models
+
+import (
+	"errors"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// OS versions are stored as major*1000000 + minor*1000 + patch so that they
+// compare as integers.
+var osVersionRegexp = regexp.MustCompile(`^\d{1,6}(\.\d{1,3}){0,2}$`)
+
+var errInvalidOSVersion = errors.New("invalid OS version")
+
+// IsValidOSVersion reports whether v is a dotted version with at most three
+// components, such as "16" or "16.4.1".
+func IsValidOSVersion(v string) bool {
+	return osVersionRegexp.MatchString(v)
+}
+
+// EncodeOSVersion converts v to its sortable integer. Missing components are
+// 0, so "16" is 16.0.0.
+func EncodeOSVersion(v string) (uint64, error) {
+	return encodeOSVersion(v, 0)
+}
+
+// EncodeMaxOSVersion is EncodeOSVersion with missing components 999, so that
+// an upper bound of "16" covers every 16.x.
+func EncodeMaxOSVersion(v string) (uint64, error) {
+	return encodeOSVersion(v, 999)
+}
+
+func encodeOSVersion(v string, missing uint64) (uint64, error) {
+	if !IsValidOSVersion(v) {
+		return 0, errInvalidOSVersion
+	}
+	parts := strings.Split(v, ".")
+	var n uint64
+	for i := 0; i < 3; i++ {
+		component := missing
+		if i < len(parts) {
+			component, _ = strconv.ParseUint(parts[i], 10, 64)
+		}
+		n = n*1000 + component
+	}
+	return n, nil
+}
+
+// DecodeOSVersion converts a sortable integer back to a version, omitting
+// trailing components equal to missing, which is 0 for a lower bound and 999
+// for an upper bound.
+func DecodeOSVersion(n, missing uint64) string {
+	parts := []uint64{n / 1000000, n / 1000 % 1000, n % 1000}
+	end := 3
+	for end > 1 && parts[end-1] == missing {
+		end--
+	}
+	versions := make([]string, end)
+	for i := range versions {
+		versions[i] = strconv.FormatUint(parts[i], 10)
+	}
+	return strings.Join(versions, ".")
+}
@@ -0,0 +1,60 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEncodeOSVersion(t *testing.T) {
+	testCases := []struct {
+		version string
+		min     uint64
+		max     uint64
+		err     bool
+	}{
+		{version: "16", min: 16000000, max: 16999999},
+		{version: "16.4", min: 16004000, max: 16004999},
+		{version: "16.4.1", min: 16004001, max: 16004001},
+		{version: "14541.0.0", min: 14541000000, max: 14541000000},
+		{version: "", err: true},
+		{version: "16.", err: true},
+		{version: "16.1000", err: true},
+		{version: "16.4.1.2", err: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.version, func(t *testing.T) {
+			min, err := EncodeOSVersion(tc.version)
+			max, maxErr := EncodeMaxOSVersion(tc.version)
+			if tc.err {
+				assert.Error(t, err)
+				assert.Error(t, maxErr)
+				return
+			}
+			assert.NoError(t, err)
+			assert.NoError(t, maxErr)
+			assert.Equal(t, tc.min, min)
+			assert.Equal(t, tc.max, max)
+		})
+	}
+}
+
+func TestOSVersionOrder(t *testing.T) {
+	// Components compare numerically, not as strings.
+	versions := []string{"9", "9.3.5", "10", "10.0.1", "10.2", "16.10", "17"}
+	for i := 1; i < len(versions); i++ {
+		lower, _ := EncodeOSVersion(versions[i-1])
+		higher, _ := EncodeOSVersion(versions[i])
+		assert.Less(t, lower, higher, "%s < %s", versions[i-1], versions[i])
+	}
+}
+
+func TestDecodeOSVersion(t *testing.T) {
+	for _, version := range []string{"16", "16.4", "16.4.1", "16.0.1"} {
+		min, _ := EncodeOSVersion(version)
+		max, _ := EncodeMaxOSVersion(version)
+		assert.Equal(t, version, DecodeOSVersion(min, 0))
+		assert.Equal(t, version, DecodeOSVersion(max, 999))
+	}
+}
@@ -0,0 +1,19 @@
+package models
+
+import (
+	"time"
+)
+
+// Revision is an immutable snapshot of an advertisement with its
+// conditions, taken by each change to it. Revisions are numbered from 1 per
+// advertisement.
+type Revision struct {
+	Revision  int       `json:"revision"`
+	CreatedAt time.Time `json:"createdAt"`
+	Actor     string    `json:"actor"`
+	// Action is the audit action taking the revision, such as "ad.update".
+	Action string `json:"action"`
+	// Advertisement is the advertisement after the change, or before it when
+	// deleted.
+	Advertisement Advertisement `json:"advertisement"`
+}
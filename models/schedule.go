@@ -0,0 +1,55 @@
+package models
+
+import (
+	"time"
+	// Schedules name IANA timezones, which must not depend on the host.
+	_ "time/tzdata"
+)
+
+// weekdays maps the day names of a Window to time.Weekday.
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday,
+	"mon": time.Monday,
+	"tue": time.Tuesday,
+	"wed": time.Wednesday,
+	"thu": time.Thursday,
+	"fri": time.Friday,
+	"sat": time.Saturday,
+}
+
+// Schedule restricts a condition to weekly time windows in a timezone.
+type Schedule struct {
+	// Timezone is an IANA name such as "Asia/Taipei".
+	Timezone string   `json:"timezone" validate:"required,timezone"`
+	Windows  []Window `json:"windows" validate:"required,min=1,dive"`
+}
+
+// Window covers the hours [StartHour, EndHour) of the listed days in the
+// local time of the schedule.
+type Window struct {
+	Days      []string `json:"days" validate:"required,min=1,dive,oneof=sun mon tue wed thu fri sat"`
+	StartHour int      `json:"startHour" validate:"min=0,max=23"`
+	EndHour   int      `json:"endHour" validate:"min=1,max=24,gtfield=StartHour"`
+}
+
+// DayBits converts day names to a bitmask with bit i set for time.Weekday(i).
+func DayBits(days []string) uint8 {
+	var bits uint8
+	for _, day := range days {
+		if wd, ok := weekdays[day]; ok {
+			bits |= 1 << wd
+		}
+	}
+	return bits
+}
+
+// Days converts a bitmask of DayBits back to day names, from Sunday on.
+func Days(bits uint8) []string {
+	var days []string
+	for _, name := range []string{"sun", "mon", "tue", "wed", "thu", "fri", "sat"} {
+		if bits&(1<<weekdays[name]) != 0 {
+			days = append(days, name)
+		}
+	}
+	return days
+}
@@ -0,0 +1,43 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDayBits(t *testing.T) {
+	assert.Equal(t, uint8(0b0111110), DayBits([]string{"mon", "tue", "wed", "thu", "fri"}))
+	assert.Equal(t, uint8(0b1000001), DayBits([]string{"sat", "sun"}))
+	assert.Equal(t, []string{"sun", "sat"}, Days(DayBits([]string{"sat", "sun"})))
+	assert.Nil(t, Days(0))
+}
+
+func TestValidateSchedule(t *testing.T) {
+	valid := Schedule{
+		Timezone: "Asia/Taipei",
+		Windows:  []Window{{Days: []string{"mon"}, StartHour: 11, EndHour: 14}},
+	}
+	assert.NoError(t, GetValidate().Struct(valid))
+
+	testCases := map[string]Schedule{
+		"Unknown timezone": {Timezone: "Mars/Olympus", Windows: valid.Windows},
+		"Local timezone":   {Timezone: "Local", Windows: valid.Windows},
+		"No windows":       {Timezone: "Asia/Taipei"},
+		"Unknown day":      {Timezone: "Asia/Taipei", Windows: []Window{{Days: []string{"monday"}, StartHour: 11, EndHour: 14}}},
+		"Empty window":     {Timezone: "Asia/Taipei", Windows: []Window{{Days: []string{"mon"}, StartHour: 14, EndHour: 14}}},
+		"Hour past 24":     {Timezone: "Asia/Taipei", Windows: []Window{{Days: []string{"mon"}, StartHour: 20, EndHour: 25}}},
+	}
+	for name, schedule := range testCases {
+		assert.Error(t, GetValidate().Struct(schedule), name)
+	}
+
+	ad := Advertisement{
+		Title:      "AD",
+		StartAt:    time.Now(),
+		EndAt:      time.Now().Add(time.Hour),
+		Conditions: []Conditions{{Schedule: &Schedule{Timezone: "Mars/Olympus", Windows: valid.Windows}}},
+	}
+	assert.Error(t, GetValidate().Struct(ad), "conditions are validated")
+}
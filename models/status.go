@@ -0,0 +1,41 @@
+package models
+
+// The lifecycle statuses of an advertisement. Only approved advertisements
+// are served; new ones start as drafts.
+const (
+	StatusDraft         = "draft"
+	StatusPendingReview = "pending_review"
+	StatusApproved      = "approved"
+	StatusRejected      = "rejected"
+	StatusPaused        = "paused"
+	StatusArchived      = "archived"
+)
+
+// statusTransitions lists the statuses each status may move to. Approved and
+// paused advertisements go back to review when their content is edited.
+// Archived is final.
+var statusTransitions = map[string][]string{
+	StatusDraft:         {StatusPendingReview, StatusArchived},
+	StatusPendingReview: {StatusApproved, StatusRejected, StatusDraft},
+	StatusApproved:      {StatusPaused, StatusArchived, StatusPendingReview},
+	StatusRejected:      {StatusDraft, StatusArchived},
+	StatusPaused:        {StatusApproved, StatusArchived, StatusPendingReview},
+	StatusArchived:      nil,
+}
+
+// IsValidStatus reports whether status is one of the lifecycle statuses.
+func IsValidStatus(status string) bool {
+	_, ok := statusTransitions[status]
+	return ok
+}
+
+// CanTransition reports whether an advertisement may move from status from
+// to status to.
+func CanTransition(from, to string) bool {
+	for _, next := range statusTransitions[from] {
+		if next == to {
+			return true
+		}
+	}
+	return false
+}
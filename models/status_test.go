@@ -0,0 +1,33 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCanTransition(t *testing.T) {
+	testCases := []struct {
+		from, to string
+		expected bool
+	}{
+		{from: StatusDraft, to: StatusPendingReview, expected: true},
+		{from: StatusDraft, to: StatusApproved, expected: false},
+		{from: StatusPendingReview, to: StatusApproved, expected: true},
+		{from: StatusPendingReview, to: StatusRejected, expected: true},
+		{from: StatusRejected, to: StatusDraft, expected: true},
+		{from: StatusApproved, to: StatusPaused, expected: true},
+		{from: StatusPaused, to: StatusApproved, expected: true},
+		{from: StatusApproved, to: StatusApproved, expected: false},
+		{from: StatusApproved, to: StatusPendingReview, expected: true},
+		{from: StatusRejected, to: StatusPendingReview, expected: false},
+		{from: StatusArchived, to: StatusDraft, expected: false},
+		{from: "live", to: StatusApproved, expected: false},
+	}
+
+	for _, tc := range testCases {
+		assert.Equal(t, tc.expected, CanTransition(tc.from, tc.to), tc.from+" -> "+tc.to)
+	}
+	assert.True(t, IsValidStatus(StatusArchived))
+	assert.False(t, IsValidStatus("live"))
+}
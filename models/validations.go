@@ -1,21 +1,142 @@
 package models
 
 import (
-    "github.com/go-playground/validator/v10"
+	"fmt"
+	"strings"
+
 	"github.com/biter777/countries"
+	"github.com/go-playground/validator/v10"
+	"golang.org/x/text/language"
+
+	"github.com/jjshen2000/simple-ads/expr"
 )
 
 var validate *validator.Validate
 
 func init() {
-    validate = validator.New()
-    validate.RegisterValidation("validCountryCode", validCountryCodeValidator)
+	validate = validator.New()
+	validate.RegisterValidation("validCountryCode", validCountryCodeValidator)
+	validate.RegisterValidation("validSubdivisionCode", validSubdivisionCodeValidator)
+	validate.RegisterValidation("osVersion", osVersionValidator)
+	validate.RegisterValidation("languageTag", languageTagValidator)
+	validate.RegisterValidation("keyword", keywordValidator)
+	validate.RegisterValidation("iabCategory", iabCategoryValidator)
+	validate.RegisterStructValidation(conditionsStructValidator, Conditions{})
+	validate.RegisterStructValidation(advertisementStructValidator, Advertisement{})
 }
 
-// custom validation function to validate country code
+// custom validation function to validate ISO 3166-1 alpha-2 country code such as "TW"
 func validCountryCodeValidator(fl validator.FieldLevel) bool {
-    code := fl.Field().String()
-    return countries.ByName(code) != countries.Unknown
+	return IsValidCountry(fl.Field().String())
+}
+
+// IsValidCountry reports whether code is an ISO 3166-1 alpha-2 code. Names
+// and alpha-3 codes, which countries.ByName also accepts, are rejected, as
+// conditions are stored and matched by alpha-2 code.
+func IsValidCountry(code string) bool {
+	country := countries.ByName(code)
+	return country != countries.Unknown && country.Alpha2() == code
+}
+
+// custom validation function to validate ISO 3166-2 subdivision code such as "US-CA"
+func validSubdivisionCodeValidator(fl validator.FieldLevel) bool {
+	return IsValidSubdivision(fl.Field().String())
+}
+
+// IsValidSubdivision reports whether code is an ISO 3166-2 subdivision code
+// known to the bundled countries dataset.
+func IsValidSubdivision(code string) bool {
+	return countries.SubdivisionCode(code).IsValid()
+}
+
+// custom validation function to validate OS version such as "16.4.1"
+func osVersionValidator(fl validator.FieldLevel) bool {
+	return IsValidOSVersion(fl.Field().String())
+}
+
+// custom validation function to validate BCP 47 language tag such as "zh-TW"
+func languageTagValidator(fl validator.FieldLevel) bool {
+	tag, err := language.Parse(fl.Field().String())
+	return err == nil && tag != language.Und
+}
+
+// custom validation function to validate keyword, which is at most 100
+// characters once normalized and has no comma
+func keywordValidator(fl validator.FieldLevel) bool {
+	keyword := NormalizeKeyword(fl.Field().String())
+	return keyword != "" && len([]rune(keyword)) <= 100 && !strings.Contains(keyword, ",")
+}
+
+// custom validation function to validate IAB content category such as "IAB1-2"
+func iabCategoryValidator(fl validator.FieldLevel) bool {
+	return IsValidCategory(fl.Field().String())
+}
+
+// conditionsStructValidator rejects a minOSVersion above the maxOSVersion.
+func conditionsStructValidator(sl validator.StructLevel) {
+	condition := sl.Current().Interface().(Conditions)
+	if condition.MinOSVersion == "" || condition.MaxOSVersion == "" {
+		return
+	}
+	min, minErr := EncodeOSVersion(condition.MinOSVersion)
+	max, maxErr := EncodeMaxOSVersion(condition.MaxOSVersion)
+	if minErr == nil && maxErr == nil && min > max {
+		sl.ReportError(condition.MaxOSVersion, "MaxOSVersion", "maxOSVersion", "gtefield", "MinOSVersion")
+	}
+}
+
+// advertisementStructValidator requires a locale with localizations and
+// rejects two variants in the same locale.
+func advertisementStructValidator(sl validator.StructLevel) {
+	ad := sl.Current().Interface().(Advertisement)
+	if len(ad.Localizations) == 0 {
+		return
+	}
+	if ad.Locale == "" {
+		sl.ReportError(ad.Locale, "Locale", "locale", "required_with", "Localizations")
+		return
+	}
+
+	seen := map[string]bool{language.Make(ad.Locale).String(): true}
+	for i, l := range ad.Localizations {
+		locale := language.Make(l.Locale).String()
+		if seen[locale] {
+			sl.ReportError(l.Locale, fmt.Sprintf("Localizations[%d].Locale", i), "locale", "unique", "")
+		}
+		seen[locale] = true
+	}
+}
+
+// ExprError is a condition expression that does not compile.
+type ExprError struct {
+	Condition int // index in Conditions
+	Err       error
+}
+
+func (e *ExprError) Error() string {
+	return fmt.Sprintf("conditions[%d].expr: %v", e.Condition, e.Err)
+}
+
+func (e *ExprError) Unwrap() error {
+	return e.Err
+}
+
+// ValidateAdvertisement validates ad against its struct tags, then compiles
+// the expression of each condition so that syntax and type errors are
+// reported with their position.
+func ValidateAdvertisement(ad Advertisement) error {
+	if err := validate.Struct(ad); err != nil {
+		return err
+	}
+	for i, condition := range ad.Conditions {
+		if condition.Expr == "" {
+			continue
+		}
+		if _, err := expr.Compile(condition.Expr); err != nil {
+			return &ExprError{Condition: i, Err: err}
+		}
+	}
+	return nil
 }
 
 func GetValidate() *validator.Validate {
@@ -0,0 +1,152 @@
+package models
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateGeo(t *testing.T) {
+	testCases := []struct {
+		name      string
+		condition Conditions
+		valid     bool
+	}{
+		{name: "Region", condition: Conditions{Region: []string{"US-CA", "TW-TPE"}}, valid: true},
+		{name: "Country", condition: Conditions{Country: []string{"TW", "JP"}}, valid: true},
+		{name: "Country name", condition: Conditions{Country: []string{"Taiwan"}}},
+		{name: "Alpha-3 country", condition: Conditions{Country: []string{"TWN"}}},
+		{name: "Lowercase country", condition: Conditions{Country: []string{"tw"}}},
+		{name: "City", condition: Conditions{City: []string{"5391959"}}, valid: true},
+		{name: "Lowercase region", condition: Conditions{Region: []string{"us-ca"}}},
+		{name: "Unknown region", condition: Conditions{Region: []string{"US-XX"}}},
+		{name: "Country as region", condition: Conditions{Region: []string{"US"}}},
+		{name: "City name", condition: Conditions{City: []string{"San Francisco"}}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := GetValidate().Struct(tc.condition)
+			if tc.valid {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+}
+
+func TestValidateDevice(t *testing.T) {
+	testCases := []struct {
+		name      string
+		condition Conditions
+		valid     bool
+	}{
+		{name: "OS versions", condition: Conditions{MinOSVersion: "16", MaxOSVersion: "17.4.1"}, valid: true},
+		{name: "Same major", condition: Conditions{MinOSVersion: "16.4", MaxOSVersion: "16"}, valid: true},
+		{name: "Device", condition: Conditions{Device: []string{"phone", "tablet"}}, valid: true},
+		{name: "Reversed OS versions", condition: Conditions{MinOSVersion: "17", MaxOSVersion: "16.9"}},
+		{name: "Four components", condition: Conditions{MinOSVersion: "16.4.1.2"}},
+		{name: "Prefixed", condition: Conditions{MaxOSVersion: "v16"}},
+		{name: "Unknown device", condition: Conditions{Device: []string{"watch"}}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := GetValidate().Struct(tc.condition)
+			if tc.valid {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+}
+
+func TestValidateLanguage(t *testing.T) {
+	testCases := []struct {
+		name      string
+		condition Conditions
+		valid     bool
+	}{
+		{name: "Languages", condition: Conditions{Language: []string{"zh", "zh-TW", "en-Latn-US"}}, valid: true},
+		{name: "Underscore", condition: Conditions{Language: []string{"en_US"}}, valid: true},
+		{name: "Undetermined", condition: Conditions{Language: []string{"und"}}},
+		{name: "Malformed", condition: Conditions{Language: []string{"klingon-language"}}},
+		{name: "Empty", condition: Conditions{Language: []string{""}}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := GetValidate().Struct(tc.condition)
+			if tc.valid {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+}
+
+func TestValidateLocalizations(t *testing.T) {
+	base := func(locale string, localizations ...Localization) Advertisement {
+		return Advertisement{
+			Title:         "AD",
+			StartAt:       time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+			EndAt:         time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC),
+			Locale:        locale,
+			Localizations: localizations,
+		}
+	}
+
+	testCases := []struct {
+		name  string
+		ad    Advertisement
+		valid bool
+	}{
+		{name: "Default only", ad: base("en"), valid: true},
+		{name: "Localized", ad: base("en", Localization{Locale: "zh-TW", Title: "廣告"}, Localization{Locale: "ja", Title: "広告"}), valid: true},
+		{name: "Missing default locale", ad: base("", Localization{Locale: "zh-TW", Title: "廣告"})},
+		{name: "Same as default", ad: base("en", Localization{Locale: "en", Title: "AD"})},
+		{name: "Duplicate", ad: base("en", Localization{Locale: "zh-tw", Title: "廣告"}, Localization{Locale: "zh-TW", Title: "廣告"})},
+		{name: "Missing title", ad: base("en", Localization{Locale: "ja"})},
+		{name: "Invalid locale", ad: base("en", Localization{Locale: "japanese!", Title: "広告"})},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			err := GetValidate().Struct(tc.ad)
+			if tc.valid {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+}
+
+func TestValidateAdvertisementExpr(t *testing.T) {
+	ad := Advertisement{
+		Title:   "AD",
+		StartAt: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+		EndAt:   time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC),
+		Conditions: []Conditions{
+			{Expr: `tier IN ("gold", "platinum")`},
+			{Expr: `app_version >= 5.2.1`},
+		},
+	}
+
+	err := ValidateAdvertisement(ad)
+	var exprErr *ExprError
+	if assert.ErrorAs(t, err, &exprErr) {
+		assert.Equal(t, 1, exprErr.Condition)
+		assert.EqualError(t, err, `conditions[1].expr: col 16: malformed number "5.2.1", quote versions such as "5.2"`)
+	}
+
+	ad.Conditions[1].Expr = `app_version >= "5.2.1"`
+	assert.NoError(t, ValidateAdvertisement(ad))
+
+	ad.Title = ""
+	assert.Error(t, ValidateAdvertisement(ad), "struct tags are validated first")
+}
@@ -0,0 +1,27 @@
+package models
+
+// Video is the linear video creative of an advertisement, served as VAST.
+type Video struct {
+	// Duration of the creative in seconds.
+	Duration     int             `json:"duration" validate:"required,min=1,max=3600"`
+	ClickThrough string          `json:"clickThrough,omitempty" validate:"omitempty,url"`
+	MediaFiles   []MediaFile     `json:"mediaFiles" validate:"required,min=1,dive"`
+	Impressions  []string        `json:"impressions" validate:"required,min=1,dive,url"`
+	Tracking     []TrackingEvent `json:"tracking,omitempty" validate:"omitempty,dive"`
+}
+
+// MediaFile is one encoding of a video creative.
+type MediaFile struct {
+	URL      string `json:"url" validate:"required,url"`
+	Type     string `json:"type" validate:"required,startswith=video/|eq=application/javascript"`
+	Width    int    `json:"width" validate:"required,min=1"`
+	Height   int    `json:"height" validate:"required,min=1"`
+	Bitrate  int    `json:"bitrate,omitempty" validate:"omitempty,min=1"` // kbps
+	Delivery string `json:"delivery,omitempty" validate:"omitempty,oneof=progressive streaming"`
+}
+
+// TrackingEvent is a URL the player requests when event occurs.
+type TrackingEvent struct {
+	Event string `json:"event" validate:"required,oneof=creativeView start firstQuartile midpoint thirdQuartile complete mute unmute pause resume rewind skip fullscreen exitFullscreen closeLinear"`
+	URL   string `json:"url" validate:"required,url"`
+}
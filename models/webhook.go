@@ -0,0 +1,65 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// The events a webhook subscribes to.
+const (
+	EventAdCreated = "ad.created"
+	// EventAdUpdated follows updates, status changes and restores.
+	EventAdUpdated = "ad.updated"
+	EventAdDeleted = "ad.deleted"
+	// EventAdActivated follows an approved advertisement reaching its
+	// start time, or being approved within its active period.
+	EventAdActivated = "ad.activated"
+	// EventAdExpired follows an approved or paused advertisement reaching
+	// its end time.
+	EventAdExpired = "ad.expired"
+	// EventAdBudgetExhausted is reserved for budgets, which advertisements
+	// do not have yet; it is never sent.
+	EventAdBudgetExhausted = "ad.budget_exhausted"
+)
+
+// Events lists every event, in the order of the constants.
+var Events = []string{EventAdCreated, EventAdUpdated, EventAdDeleted,
+	EventAdActivated, EventAdExpired, EventAdBudgetExhausted}
+
+// Webhook is a URL receiving the events it subscribes to.
+type Webhook struct {
+	ID     int      `json:"id"`
+	URL    string   `json:"url"`
+	Events []string `json:"events"`
+	// Secret keys the signatures of deliveries. It is only returned when the
+	// webhook is created.
+	Secret    string    `json:"secret,omitempty"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+// WebhookPayload is the body of a delivery.
+type WebhookPayload struct {
+	Event string    `json:"event"`
+	At    time.Time `json:"at"`
+	// Action is the audit action behind the event, such as "ad.status" for
+	// ad.updated; empty for ad.activated and ad.expired.
+	Action string `json:"action,omitempty"`
+	// Advertisement is the advertisement after the event, or before it when
+	// deleted.
+	Advertisement Advertisement `json:"advertisement"`
+}
+
+// DeadLetter is a delivery that failed every attempt. Replaying it queues it
+// again.
+type DeadLetter struct {
+	ID int64 `json:"id"`
+	// DeliveryID is the X-Webhook-Delivery header of the delivery, which
+	// replays keep.
+	DeliveryID string          `json:"deliveryId"`
+	WebhookID  int             `json:"webhookId"`
+	Event      string          `json:"event"`
+	Payload    json.RawMessage `json:"payload"`
+	Attempts   int             `json:"attempts"`
+	LastError  string          `json:"lastError"`
+	FailedAt   time.Time       `json:"failedAt"`
+}
@@ -0,0 +1,61 @@
+package moderation
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/jjshen2000/simple-ads/models"
+)
+
+// DomainChecker flags landing pages on denied domains or, when domains are
+// allowed, on any other.
+type DomainChecker struct {
+	allowed, denied []string
+}
+
+// NewDomainChecker returns a checker of the click-through URLs of the videos
+// of advertisements. A domain covers its subdomains.
+func NewDomainChecker(allowed, denied []string) *DomainChecker {
+	normalize := func(domains []string) []string {
+		var normalized []string
+		for _, d := range domains {
+			normalized = append(normalized, strings.TrimSuffix(strings.ToLower(strings.TrimSpace(d)), "."))
+		}
+		return normalized
+	}
+	return &DomainChecker{allowed: normalize(allowed), denied: normalize(denied)}
+}
+
+// within reports whether host is one of domains or a subdomain of one.
+func within(host string, domains []string) bool {
+	for _, d := range domains {
+		if host == d || strings.HasSuffix(host, "."+d) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *DomainChecker) Check(ad models.Advertisement) []models.ModerationReason {
+	var reasons []models.ModerationReason
+	for _, f := range landingPages(ad) {
+		u, err := url.Parse(f.value)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+			reasons = append(reasons, models.ModerationReason{Check: "landingPage", Field: f.path,
+				Message: "not an http or https URL"})
+			continue
+		}
+
+		host := strings.TrimSuffix(strings.ToLower(u.Hostname()), ".")
+		switch {
+		case within(host, c.denied):
+			reasons = append(reasons, models.ModerationReason{Check: "deniedDomain", Field: f.path,
+				Message: fmt.Sprintf("%s is denied", host)})
+		case len(c.allowed) > 0 && !within(host, c.allowed):
+			reasons = append(reasons, models.ModerationReason{Check: "deniedDomain", Field: f.path,
+				Message: fmt.Sprintf("%s is not allowed", host)})
+		}
+	}
+	return reasons
+}
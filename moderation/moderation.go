@@ -0,0 +1,59 @@
+// Package moderation checks the content of advertisements before they are
+// served, such as titles with banned words or landing pages on denied
+// domains. Advertisements with reasons wait for a human review.
+package moderation
+
+import (
+	"fmt"
+
+	"github.com/jjshen2000/simple-ads/models"
+)
+
+// Checker inspects an advertisement and returns why it needs a review,
+// nothing when it looks fine.
+type Checker interface {
+	Check(ad models.Advertisement) []models.ModerationReason
+}
+
+// Pipeline runs every checker in order and collects their reasons.
+type Pipeline []Checker
+
+func (p Pipeline) Check(ad models.Advertisement) []models.ModerationReason {
+	var reasons []models.ModerationReason
+	for _, c := range p {
+		reasons = append(reasons, c.Check(ad)...)
+	}
+	return reasons
+}
+
+// field is a field of an advertisement and its path.
+type field struct {
+	path  string
+	value string
+}
+
+// textFields returns the titles and descriptions of ad and its localizations.
+func textFields(ad models.Advertisement) []field {
+	fields := []field{{"title", ad.Title}, {"description", ad.Description}}
+	for i, l := range ad.Localizations {
+		fields = append(fields,
+			field{fmt.Sprintf("localizations[%d].title", i), l.Title},
+			field{fmt.Sprintf("localizations[%d].description", i), l.Description})
+	}
+	return fields
+}
+
+// landingPages returns the click-through URLs of the videos of ad and its
+// localizations.
+func landingPages(ad models.Advertisement) []field {
+	var fields []field
+	if ad.Video != nil && ad.Video.ClickThrough != "" {
+		fields = append(fields, field{"video.clickThrough", ad.Video.ClickThrough})
+	}
+	for i, l := range ad.Localizations {
+		if l.Video != nil && l.Video.ClickThrough != "" {
+			fields = append(fields, field{fmt.Sprintf("localizations[%d].video.clickThrough", i), l.Video.ClickThrough})
+		}
+	}
+	return fields
+}
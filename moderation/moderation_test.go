@@ -0,0 +1,107 @@
+package moderation
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jjshen2000/simple-ads/models"
+)
+
+func TestWordChecker(t *testing.T) {
+	c, err := NewWordChecker([]string{"scam", "free money"}, []string{`\bcasino\b`})
+	assert.NoError(t, err)
+
+	testCases := []struct {
+		title   string
+		flagged bool
+	}{
+		{title: "Spring sale", flagged: false},
+		{title: "Not a SCAM!", flagged: true},
+		{title: "Not a sc@m", flagged: true},
+		{title: "s.c.a.m alert", flagged: true},
+		{title: "s c a m alert", flagged: true},
+		{title: "scaaam", flagged: true},
+		{title: "ｓｃａｍ", flagged: true},            // fullwidth
+		{title: "sc\u200bam", flagged: true},      // zero-width space
+		{title: "ѕсаm", flagged: true},            // Cyrillic look-alikes
+		{title: "scám", flagged: true},            // accent
+		{title: "scampi special", flagged: false}, // whole words only
+		{title: "Free   m0ney inside", flagged: true},
+		{title: "Free offer, money back", flagged: false},
+		{title: "CASINO night", flagged: true},
+		{title: "Casinos", flagged: false},
+	}
+
+	for _, tc := range testCases {
+		reasons := c.Check(models.Advertisement{Title: tc.title})
+		assert.Equal(t, tc.flagged, len(reasons) > 0, tc.title)
+	}
+
+	reasons := c.Check(models.Advertisement{
+		Title:         "Deals",
+		Localizations: []models.Localization{{Locale: "de", Title: "Angebote", Description: "Kein Scam"}},
+	})
+	assert.Equal(t, []models.ModerationReason{
+		{Check: "bannedWord", Field: "localizations[0].description", Message: `contains "scam"`},
+	}, reasons)
+
+	_, err = NewWordChecker(nil, []string{"("})
+	assert.Error(t, err)
+	_, err = NewWordChecker([]string{"..."}, nil)
+	assert.EqualError(t, err, `banned word "..." has no letters`)
+}
+
+func TestStretches(t *testing.T) {
+	assert.True(t, stretches("bad", "bad"))
+	assert.True(t, stretches("baaadd", "bad"))
+	assert.False(t, stretches("as", "ass"))
+	assert.False(t, stretches("bads", "bad"))
+	assert.False(t, stretches("ba", "bad"))
+}
+
+func TestDomainChecker(t *testing.T) {
+	c := NewDomainChecker([]string{"example.com", "shop.example.org"}, []string{"evil.example.com"})
+
+	testCases := []struct {
+		url     string
+		reasons []models.ModerationReason
+	}{
+		{url: "https://example.com/landing"},
+		{url: "https://www.Example.com./landing"},
+		{url: "http://shop.example.org"},
+		{
+			url:     "https://evil.example.com/phish",
+			reasons: []models.ModerationReason{{Check: "deniedDomain", Field: "video.clickThrough", Message: "evil.example.com is denied"}},
+		},
+		{
+			url:     "https://example.org",
+			reasons: []models.ModerationReason{{Check: "deniedDomain", Field: "video.clickThrough", Message: "example.org is not allowed"}},
+		},
+		{
+			url:     "https://notexample.com",
+			reasons: []models.ModerationReason{{Check: "deniedDomain", Field: "video.clickThrough", Message: "notexample.com is not allowed"}},
+		},
+		{
+			url:     "javascript:alert(1)",
+			reasons: []models.ModerationReason{{Check: "landingPage", Field: "video.clickThrough", Message: "not an http or https URL"}},
+		},
+	}
+
+	for _, tc := range testCases {
+		ad := models.Advertisement{Video: &models.Video{ClickThrough: tc.url}}
+		assert.Equal(t, tc.reasons, c.Check(ad), tc.url)
+	}
+
+	assert.Nil(t, NewDomainChecker(nil, nil).Check(models.Advertisement{Video: &models.Video{ClickThrough: "https://any.example"}}))
+}
+
+func TestPipeline(t *testing.T) {
+	words, err := NewWordChecker([]string{"scam"}, nil)
+	assert.NoError(t, err)
+	p := Pipeline{words, NewDomainChecker(nil, []string{"evil.example.com"})}
+
+	reasons := p.Check(models.Advertisement{Title: "scam", Video: &models.Video{ClickThrough: "https://evil.example.com"}})
+	assert.Len(t, reasons, 2)
+	assert.Nil(t, Pipeline{}.Check(models.Advertisement{Title: "scam"}))
+}
@@ -0,0 +1,178 @@
+package moderation
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+
+	"golang.org/x/text/cases"
+	"golang.org/x/text/runes"
+	"golang.org/x/text/transform"
+	"golang.org/x/text/unicode/norm"
+
+	"github.com/jjshen2000/simple-ads/models"
+)
+
+// homoglyphs maps letters of other scripts that look like Latin ones.
+var homoglyphs = map[rune]rune{
+	'а': 'a', 'в': 'b', 'е': 'e', 'к': 'k', 'м': 'm', 'н': 'h', 'о': 'o', 'р': 'p',
+	'с': 'c', 'т': 't', 'у': 'y', 'х': 'x', 'і': 'i', 'ј': 'j', 'ѕ': 's',
+	'α': 'a', 'β': 'b', 'ε': 'e', 'ι': 'i', 'κ': 'k', 'ν': 'v', 'ο': 'o', 'ρ': 'p', 'τ': 't', 'υ': 'u',
+}
+
+// leet maps digits and symbols standing for letters.
+var leet = map[rune]rune{
+	'0': 'o', '1': 'i', '3': 'e', '4': 'a', '5': 's', '7': 't', '8': 'b',
+	'@': 'a', '$': 's', '!': 'i', '|': 'i',
+}
+
+// fold normalizes text against obfuscation: compatibility characters such as
+// fullwidth letters become plain ones, accents and invisible characters such
+// as zero-width spaces are dropped, case is folded and look-alike letters of
+// other scripts become Latin ones.
+func fold(text string) string {
+	t := transform.Chain(norm.NFKD, runes.Remove(runes.In(unicode.Mn)), runes.Remove(runes.In(unicode.Cf)), norm.NFC)
+	folded, _, err := transform.String(t, text)
+	if err != nil {
+		folded = text
+	}
+	return strings.Map(func(r rune) rune {
+		if latin, ok := homoglyphs[r]; ok {
+			return latin
+		}
+		return r
+	}, cases.Fold().String(folded))
+}
+
+// tokenize splits folded text into words after reading digits and symbols
+// within words as the letters they stand for; "!" ending a sentence is not
+// an "i". Runs of single letters, as in "b.a.d" or "b a d", are joined into
+// one word.
+func tokenize(folded string) []string {
+	var words []string
+	for _, field := range strings.FieldsFunc(folded, func(r rune) bool {
+		_, ok := leet[r]
+		return !ok && !unicode.IsLetter(r)
+	}) {
+		word := strings.Map(func(r rune) rune {
+			if letter, ok := leet[r]; ok {
+				return letter
+			}
+			return r
+		}, strings.Trim(field, "!|"))
+		if word != "" {
+			words = append(words, word)
+		}
+	}
+
+	var tokens []string
+	for i := 0; i < len(words); i++ {
+		j := i
+		for j < len(words) && len([]rune(words[j])) == 1 {
+			j++
+		}
+		if j-i > 1 {
+			tokens = append(tokens, strings.Join(words[i:j], ""))
+			i = j - 1
+			continue
+		}
+		tokens = append(tokens, words[i])
+	}
+	return tokens
+}
+
+// stretches reports whether token is word with letters repeated, as "baaad"
+// is "bad". Each run of a letter must be at least as long as in word.
+func stretches(token, word string) bool {
+	t, w := []rune(token), []rune(word)
+	i, j := 0, 0
+	for j < len(w) {
+		r := w[j]
+		wn := 0
+		for j < len(w) && w[j] == r {
+			j++
+			wn++
+		}
+		tn := 0
+		for i < len(t) && t[i] == r {
+			i++
+			tn++
+		}
+		if tn < wn {
+			return false
+		}
+	}
+	return i == len(t)
+}
+
+// WordChecker flags texts with banned words or matching banned patterns.
+type WordChecker struct {
+	// words holds the tokens of each banned word or phrase.
+	words    [][]string
+	patterns []*regexp.Regexp
+}
+
+// NewWordChecker returns a checker of the titles and descriptions of
+// advertisements. Words and phrases match whole words, however obfuscated:
+// "B@d", "b.a.d" and "baaad" all contain "bad". Patterns are regular
+// expressions matched against the text with case folded, accents and
+// invisible characters dropped and look-alike letters made Latin.
+func NewWordChecker(words, patterns []string) (*WordChecker, error) {
+	c := &WordChecker{}
+	for _, word := range words {
+		tokens := tokenize(fold(word))
+		if len(tokens) == 0 {
+			return nil, fmt.Errorf("banned word %q has no letters", word)
+		}
+		c.words = append(c.words, tokens)
+	}
+	for _, pattern := range patterns {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, fmt.Errorf("banned pattern %q: %w", pattern, err)
+		}
+		c.patterns = append(c.patterns, re)
+	}
+	return c, nil
+}
+
+func (c *WordChecker) Check(ad models.Advertisement) []models.ModerationReason {
+	var reasons []models.ModerationReason
+	for _, f := range textFields(ad) {
+		if f.value == "" {
+			continue
+		}
+		folded := fold(f.value)
+		if word := c.bannedWord(tokenize(folded)); word != nil {
+			reasons = append(reasons, models.ModerationReason{Check: "bannedWord", Field: f.path,
+				Message: fmt.Sprintf("contains %q", strings.Join(word, " "))})
+		}
+		for _, re := range c.patterns {
+			if re.MatchString(folded) {
+				reasons = append(reasons, models.ModerationReason{Check: "bannedPattern", Field: f.path,
+					Message: fmt.Sprintf("matches %q", re.String())})
+			}
+		}
+	}
+	return reasons
+}
+
+// bannedWord returns the first banned word found in tokens, nil if none.
+func (c *WordChecker) bannedWord(tokens []string) []string {
+	for _, word := range c.words {
+		for i := 0; i+len(word) <= len(tokens); i++ {
+			found := true
+			for j, w := range word {
+				if !stretches(tokens[i+j], w) {
+					found = false
+					break
+				}
+			}
+			if found {
+				return word
+			}
+		}
+	}
+	return nil
+}
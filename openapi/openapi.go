@@ -0,0 +1,98 @@
+// Package openapi embeds the OpenAPI 3 document describing the HTTP API and
+// validates incoming requests against it.
+package openapi
+
+import (
+	"context"
+	_ "embed"
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/getkin/kin-openapi/openapi3"
+	"github.com/getkin/kin-openapi/openapi3filter"
+	"github.com/getkin/kin-openapi/routers"
+	"github.com/getkin/kin-openapi/routers/gorillamux"
+	"github.com/gin-gonic/gin"
+)
+
+//go:embed openapi.json
+var spec []byte
+
+// Spec returns the OpenAPI document as JSON.
+func Spec() []byte {
+	return spec
+}
+
+// Load parses and validates the OpenAPI document.
+func Load() (*openapi3.T, error) {
+	doc, err := openapi3.NewLoader().LoadFromData(spec)
+	if err != nil {
+		return nil, err
+	}
+	if err := doc.Validate(context.Background()); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// Handler serves the OpenAPI document.
+func Handler(c *gin.Context) {
+	c.Data(http.StatusOK, "application/json", spec)
+}
+
+// Validator returns a middleware rejecting requests whose parameters or JSON
+// body do not match the OpenAPI document. Requests for undocumented routes
+// are passed through, and authentication is left to the middleware before
+// it. Read-only properties, such as the status of a fetched advertisement
+// sent back in an update, are ignored as the handlers ignore them.
+func Validator() gin.HandlerFunc {
+	doc, err := Load()
+	if err != nil {
+		panic("openapi: " + err.Error())
+	}
+	// Match requests regardless of the host they were sent to.
+	doc.Servers = nil
+
+	router, err := gorillamux.NewRouter(doc)
+	if err != nil {
+		panic("openapi: " + err.Error())
+	}
+
+	return func(c *gin.Context) {
+		route, pathParams, err := router.FindRoute(c.Request)
+		if errors.Is(err, routers.ErrPathNotFound) || errors.Is(err, routers.ErrMethodNotAllowed) {
+			return
+		}
+		if err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+
+		input := &openapi3filter.RequestValidationInput{
+			Request:    c.Request,
+			PathParams: pathParams,
+			Route:      route,
+			Options: &openapi3filter.Options{
+				AuthenticationFunc: openapi3filter.NoopAuthenticationFunc,
+				// Bulk files are streamed and checked record by record by the handler.
+				ExcludeRequestBody:         !isJSON(c.ContentType()),
+				ExcludeReadOnlyValidations: true,
+				MultiError:                 false,
+			},
+		}
+		if err := openapi3filter.ValidateRequest(c.Request.Context(), input); err != nil {
+			c.AbortWithStatusJSON(http.StatusBadRequest, gin.H{"error": validationMessage(err)})
+			return
+		}
+	}
+}
+
+func isJSON(contentType string) bool {
+	return contentType == "application/json"
+}
+
+// validationMessage shortens the error of kin-openapi to its first line.
+func validationMessage(err error) string {
+	return strings.SplitN(err.Error(), "\n", 2)[0]
+}
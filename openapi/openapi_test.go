@@ -0,0 +1,184 @@
+package openapi
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jjshen2000/simple-ads/models"
+)
+
+func TestLoad(t *testing.T) {
+	_, err := Load()
+	assert.NoError(t, err)
+}
+
+// jsonFields returns the JSON field names of a struct and those whose
+// validate tag starts with "required".
+func jsonFields(typ reflect.Type) (fields, required []string) {
+	for i := 0; i < typ.NumField(); i++ {
+		field := typ.Field(i)
+		name := strings.Split(field.Tag.Get("json"), ",")[0]
+		if name == "" {
+			name = field.Name
+		}
+		if name == "-" {
+			continue
+		}
+		fields = append(fields, name)
+		if strings.HasPrefix(field.Tag.Get("validate"), "required") {
+			required = append(required, name)
+		}
+	}
+	sort.Strings(fields)
+	sort.Strings(required)
+	return fields, required
+}
+
+func TestSchemasMatchModels(t *testing.T) {
+	doc, err := Load()
+	assert.NoError(t, err)
+
+	for name, model := range map[string]interface{}{
+		"Advertisement":    models.Advertisement{},
+		"Conditions":       models.Conditions{},
+		"Schedule":         models.Schedule{},
+		"Window":           models.Window{},
+		"Video":            models.Video{},
+		"MediaFile":        models.MediaFile{},
+		"TrackingEvent":    models.TrackingEvent{},
+		"Localization":     models.Localization{},
+		"Audience":         models.Audience{},
+		"ModerationReason": models.ModerationReason{},
+		"AuditRecord":      models.AuditRecord{},
+		"AuditChange":      models.AuditChange{},
+		"Revision":         models.Revision{},
+		"Webhook":          models.Webhook{},
+		"WebhookPayload":   models.WebhookPayload{},
+		"DeadLetter":       models.DeadLetter{},
+	} {
+		t.Run(name, func(t *testing.T) {
+			schema := doc.Components.Schemas[name]
+			if !assert.NotNil(t, schema, "missing schema") {
+				return
+			}
+
+			var properties []string
+			for property := range schema.Value.Properties {
+				properties = append(properties, property)
+			}
+			sort.Strings(properties)
+			specRequired := append([]string(nil), schema.Value.Required...)
+			sort.Strings(specRequired)
+
+			fields, required := jsonFields(reflect.TypeOf(model))
+			assert.Equal(t, fields, properties, "properties")
+			assert.Equal(t, required, specRequired, "required")
+		})
+	}
+}
+
+func TestValidator(t *testing.T) {
+	testCases := []struct {
+		name        string
+		method      string
+		path        string
+		contentType string
+		body        string
+		statusCode  int
+	}{
+		{name: "Valid query", method: "GET", path: "/api/v1/ad?limit=10&platform=ios", statusCode: http.StatusOK},
+		{name: "Limit out of range", method: "GET", path: "/api/v1/ad?limit=0", statusCode: http.StatusBadRequest},
+		{name: "Unknown platform", method: "GET", path: "/api/v1/ad?platform=tv", statusCode: http.StatusBadRequest},
+		{name: "Invalid path parameter", method: "GET", path: "/api/v1/ad/abc", statusCode: http.StatusBadRequest},
+		{name: "Shared parameter", method: "GET", path: "/api/v1/vast?gender=X", statusCode: http.StatusBadRequest},
+		{name: "Undocumented route", method: "GET", path: "/healthz", statusCode: http.StatusOK},
+		{
+			name:        "Valid body",
+			method:      "POST",
+			path:        "/api/v1/ad",
+			contentType: "application/json",
+			body:        `{"title":"AD","startAt":"2023-12-10T03:00:00Z","endAt":"2024-12-31T16:00:00Z"}`,
+			statusCode:  http.StatusOK,
+		},
+		{
+			name:        "Read-only fields ignored",
+			method:      "PUT",
+			path:        "/api/v1/ad/1",
+			contentType: "application/json",
+			body: `{"id":1,"title":"AD","startAt":"2023-12-10T03:00:00Z","endAt":"2024-12-31T16:00:00Z","status":"approved",
+				"moderationReasons":[{"check":"bannedWord","field":"title","message":"contains \"scam\""}]}`,
+			statusCode: http.StatusOK,
+		},
+		{
+			name:        "Unknown status",
+			method:      "POST",
+			path:        "/api/v1/ad/1/status",
+			contentType: "application/json",
+			body:        `{"status":"live"}`,
+			statusCode:  http.StatusBadRequest,
+		},
+		{
+			name:        "Missing title",
+			method:      "POST",
+			path:        "/api/v1/ad",
+			contentType: "application/json",
+			body:        `{"startAt":"2023-12-10T03:00:00Z","endAt":"2024-12-31T16:00:00Z"}`,
+			statusCode:  http.StatusBadRequest,
+		},
+		{
+			name:        "Invalid video",
+			method:      "POST",
+			path:        "/api/v1/ad",
+			contentType: "application/json",
+			body:        `{"title":"AD","startAt":"2023-12-10T03:00:00Z","endAt":"2024-12-31T16:00:00Z","video":{"duration":15,"mediaFiles":[]}}`,
+			statusCode:  http.StatusBadRequest,
+		},
+		{
+			name:        "Streamed body",
+			method:      "POST",
+			path:        "/api/v1/ad/bulk",
+			contentType: "text/csv",
+			body:        "title,startAt,endAt\n",
+			statusCode:  http.StatusOK,
+		},
+	}
+
+	gin.SetMode(gin.TestMode)
+	router := gin.New()
+	router.Use(Validator())
+	ok := func(c *gin.Context) { c.Status(http.StatusOK) }
+	router.GET("/api/v1/ad", ok)
+	router.POST("/api/v1/ad", func(c *gin.Context) {
+		// The body is still readable after validation.
+		var ad models.Advertisement
+		if err := c.BindJSON(&ad); err == nil && ad.Title == "AD" {
+			c.Status(http.StatusOK)
+		}
+	})
+	router.GET("/api/v1/ad/:id", ok)
+	router.PUT("/api/v1/ad/:id", ok)
+	router.POST("/api/v1/ad/:id/status", ok)
+	router.GET("/api/v1/vast", ok)
+	router.POST("/api/v1/ad/bulk", ok)
+	router.GET("/healthz", ok)
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(tc.method, tc.path, strings.NewReader(tc.body))
+			if tc.contentType != "" {
+				req.Header.Set("Content-Type", tc.contentType)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tc.statusCode, w.Code, w.Body.String())
+		})
+	}
+}
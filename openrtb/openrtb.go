@@ -0,0 +1,318 @@
+// Package openrtb implements the subset of OpenRTB 2.5/2.6 bid requests and
+// responses the service needs to act as a demand source.
+package openrtb
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/biter777/countries"
+)
+
+// BidRequest is an OpenRTB 2.x bid request. Unused fields are omitted.
+type BidRequest struct {
+	ID     string   `json:"id"`
+	Imp    []Imp    `json:"imp"`
+	Site   *Site    `json:"site,omitempty"`
+	App    *App     `json:"app,omitempty"`
+	Device *Device  `json:"device,omitempty"`
+	User   *User    `json:"user,omitempty"`
+	Test   int      `json:"test,omitempty"`
+	TMax   int      `json:"tmax,omitempty"`
+	Cur    []string `json:"cur,omitempty"`
+}
+
+type Imp struct {
+	ID          string          `json:"id"`
+	Banner      *Banner         `json:"banner,omitempty"`
+	Video       *Video          `json:"video,omitempty"`
+	Native      json.RawMessage `json:"native,omitempty"`
+	BidFloor    float64         `json:"bidfloor,omitempty"`
+	BidFloorCur string          `json:"bidfloorcur,omitempty"`
+}
+
+type Banner struct {
+	W      int      `json:"w,omitempty"`
+	H      int      `json:"h,omitempty"`
+	Format []Format `json:"format,omitempty"` // allowed sizes, since 2.5
+}
+
+type Format struct {
+	W int `json:"w,omitempty"`
+	H int `json:"h,omitempty"`
+}
+
+// Size returns the size of the banner: w and h, or else the first allowed
+// size. ok is false when the banner has no size.
+func (b *Banner) Size() (w, h int, ok bool) {
+	if b.W > 0 && b.H > 0 {
+		return b.W, b.H, true
+	}
+	for _, f := range b.Format {
+		if f.W > 0 && f.H > 0 {
+			return f.W, f.H, true
+		}
+	}
+	return 0, 0, false
+}
+
+type Video struct {
+	Mimes       []string `json:"mimes,omitempty"`
+	MinDuration int      `json:"minduration,omitempty"` // seconds
+	MaxDuration int      `json:"maxduration,omitempty"` // seconds
+	W           int      `json:"w,omitempty"`
+	H           int      `json:"h,omitempty"`
+}
+
+// Accepts reports whether the player takes media of mime type, which any
+// type is when mimes is empty.
+func (v *Video) Accepts(mime string) bool {
+	if len(v.Mimes) == 0 {
+		return true
+	}
+	for _, m := range v.Mimes {
+		if strings.EqualFold(m, mime) {
+			return true
+		}
+	}
+	return false
+}
+
+type Site struct {
+	ID       string   `json:"id,omitempty"`
+	Domain   string   `json:"domain,omitempty"`
+	Page     string   `json:"page,omitempty"`
+	Cat      []string `json:"cat,omitempty"`      // IAB content categories
+	Keywords string   `json:"keywords,omitempty"` // comma separated
+}
+
+type App struct {
+	ID       string   `json:"id,omitempty"`
+	Bundle   string   `json:"bundle,omitempty"`
+	Cat      []string `json:"cat,omitempty"`
+	Keywords string   `json:"keywords,omitempty"`
+}
+
+type Device struct {
+	UA         string `json:"ua,omitempty"`
+	IP         string `json:"ip,omitempty"`
+	Geo        *Geo   `json:"geo,omitempty"`
+	OS         string `json:"os,omitempty"`
+	OSV        string `json:"osv,omitempty"`
+	DeviceType int    `json:"devicetype,omitempty"`
+	Language   string `json:"language,omitempty"` // ISO-639-1
+	LangB      string `json:"langb,omitempty"`    // BCP 47, since 2.6
+}
+
+type Geo struct {
+	Country string `json:"country,omitempty"` // ISO-3166-1 alpha-3
+	Region  string `json:"region,omitempty"`
+	City    string `json:"city,omitempty"`
+}
+
+type User struct {
+	ID       string `json:"id,omitempty"`
+	BuyerUID string `json:"buyeruid,omitempty"` // the user ID of the buyer, i.e. the service
+	YOB      int    `json:"yob,omitempty"`
+	Gender   string `json:"gender,omitempty"` // M, F or O
+	Geo      *Geo   `json:"geo,omitempty"`
+}
+
+// BidResponse is an OpenRTB 2.x bid response.
+type BidResponse struct {
+	ID      string    `json:"id"`
+	SeatBid []SeatBid `json:"seatbid,omitempty"`
+	BidID   string    `json:"bidid,omitempty"`
+	Cur     string    `json:"cur,omitempty"`
+}
+
+type SeatBid struct {
+	Bid  []Bid  `json:"bid"`
+	Seat string `json:"seat,omitempty"`
+}
+
+type Bid struct {
+	ID    string  `json:"id"`
+	ImpID string  `json:"impid"`
+	Price float64 `json:"price"`
+	AdID  string  `json:"adid,omitempty"`
+	CrID  string  `json:"crid,omitempty"`
+	AdM   string  `json:"adm,omitempty"`
+	W     int     `json:"w,omitempty"`
+	H     int     `json:"h,omitempty"`
+}
+
+// Currency is the only currency the service bids in.
+const Currency = "USD"
+
+// ParseBidRequest decodes and checks the fields every bid request must carry.
+func ParseBidRequest(r io.Reader) (*BidRequest, error) {
+	var req BidRequest
+	if err := json.NewDecoder(r).Decode(&req); err != nil {
+		return nil, err
+	}
+
+	if req.ID == "" {
+		return nil, errors.New("missing id")
+	}
+	if len(req.Imp) == 0 {
+		return nil, errors.New("missing imp")
+	}
+	for i, imp := range req.Imp {
+		if imp.ID == "" {
+			return nil, fmt.Errorf("missing imp[%d].id", i)
+		}
+	}
+	return &req, nil
+}
+
+// AcceptsCurrency reports whether the exchange accepts bids in Currency.
+func (r *BidRequest) AcceptsCurrency() bool {
+	if len(r.Cur) == 0 {
+		return true
+	}
+	for _, cur := range r.Cur {
+		if strings.EqualFold(cur, Currency) {
+			return true
+		}
+	}
+	return false
+}
+
+// Targeting holds the targeting dimensions of the list endpoint derived from
+// a bid request. Empty values mean unknown.
+type Targeting struct {
+	Age      int
+	Gender   string
+	Country  string
+	Region   string
+	Platform string
+	// OSVersion is device.osv as sent, known only with the platform.
+	OSVersion string
+	Device    string
+	// Language is device.langb, or else device.language, as sent.
+	Language string
+	// Keywords and Category are those of the site or app, as sent.
+	Keywords string
+	Category []string
+	// UserID is user.buyeruid, matched against audiences.
+	UserID string
+}
+
+// maxAge is the oldest age the list endpoint accepts.
+const maxAge = 120
+
+// Targeting maps the bid request onto the targeting dimensions, computing
+// the age from user.yob as of now.
+func (r *BidRequest) Targeting(now time.Time) Targeting {
+	var t Targeting
+
+	if r.User != nil {
+		if r.User.YOB > 0 {
+			if age := now.Year() - r.User.YOB; age >= 1 && age <= maxAge {
+				t.Age = age
+			}
+		}
+		t.UserID = r.User.BuyerUID
+		switch strings.ToUpper(r.User.Gender) {
+		case "M":
+			t.Gender = "M"
+		case "F":
+			t.Gender = "F"
+		case "O":
+			t.Gender = "O"
+		}
+	}
+
+	if r.Device != nil && r.Device.Geo != nil {
+		t.Country = alpha2(r.Device.Geo.Country)
+		t.Region = subdivision(t.Country, r.Device.Geo.Region)
+	}
+	if t.Country == "" && r.User != nil && r.User.Geo != nil {
+		t.Country = alpha2(r.User.Geo.Country)
+		t.Region = subdivision(t.Country, r.User.Geo.Region)
+	}
+
+	if r.Device != nil {
+		t.Platform = platform(r.Device.OS)
+		if t.Platform != "" {
+			t.OSVersion = strings.TrimSpace(r.Device.OSV)
+		}
+		t.Device = deviceType(r.Device.DeviceType)
+		t.Language = r.Device.LangB
+		if t.Language == "" {
+			t.Language = r.Device.Language
+		}
+	}
+	if t.Platform == "" && r.Site != nil {
+		t.Platform = "web"
+	}
+
+	switch {
+	case r.Site != nil:
+		t.Keywords, t.Category = r.Site.Keywords, r.Site.Cat
+	case r.App != nil:
+		t.Keywords, t.Category = r.App.Keywords, r.App.Cat
+	}
+	return t
+}
+
+// alpha2 converts an ISO-3166-1 alpha-3 code to alpha-2, or returns "".
+func alpha2(alpha3 string) string {
+	if len(alpha3) != 3 {
+		return ""
+	}
+	country := countries.ByName(alpha3)
+	if country == countries.Unknown || !strings.EqualFold(country.Alpha3(), alpha3) {
+		return ""
+	}
+	return country.Alpha2()
+}
+
+// subdivision converts geo.region, either a full ISO-3166-2 code or the part
+// after the country prefix such as "CA" in the USA, to a full code within
+// country, or returns "".
+func subdivision(country, region string) string {
+	if country == "" || region == "" {
+		return ""
+	}
+	code := strings.ToUpper(region)
+	if !strings.Contains(code, "-") {
+		code = country + "-" + code
+	}
+	if !strings.HasPrefix(code, country+"-") || !countries.SubdivisionCode(code).IsValid() {
+		return ""
+	}
+	return code
+}
+
+// platform maps device.os onto the platforms of the service.
+func platform(os string) string {
+	switch strings.ToLower(strings.TrimSpace(os)) {
+	case "android":
+		return "android"
+	case "ios", "ipados", "iphone os":
+		return "ios"
+	}
+	return ""
+}
+
+// deviceType maps device.devicetype onto the device types of the service.
+// "Mobile/Tablet" and "Connected Device" are too vague to map.
+func deviceType(devicetype int) string {
+	switch devicetype {
+	case 2: // Personal Computer
+		return "desktop"
+	case 3, 7: // Connected TV, Set Top Box
+		return "tv"
+	case 4:
+		return "phone"
+	case 5:
+		return "tablet"
+	}
+	return ""
+}
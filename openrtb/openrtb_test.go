@@ -0,0 +1,134 @@
+package openrtb
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFixtures(t *testing.T) {
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+
+	testCases := []struct {
+		fixture        string
+		expectedErr    string
+		imps           int
+		targeting      Targeting
+		acceptCurrency bool
+	}{
+		{
+			fixture: "banner_site.json",
+			imps:    1,
+			targeting: Targeting{Country: "US", Region: "US-CA", Platform: "web", Language: "en",
+				Keywords: "sedan,electric vehicles", Category: []string{"IAB3-1"}},
+			acceptCurrency: true,
+		},
+		{
+			fixture: "app_android.json",
+			imps:    1,
+			targeting: Targeting{Age: 34, Gender: "F", Country: "TW", Platform: "android", OSVersion: "12", Device: "phone", Language: "zh-Hant-TW",
+				Category: []string{"IAB15-10"}, UserID: "customer-1"},
+			acceptCurrency: true,
+		},
+		{
+			// yob out of range is unknown; device geo wins over user geo.
+			fixture:        "video_ios.json",
+			imps:           2,
+			targeting:      Targeting{Gender: "O", Country: "JP", Platform: "ios", OSVersion: "16.5", Device: "phone"},
+			acceptCurrency: true,
+		},
+		{
+			// An unknown device country falls back to user geo.
+			fixture:   "site_eur_user_geo.json",
+			imps:      1,
+			targeting: Targeting{Age: 39, Gender: "M", Country: "DE", Platform: "web"},
+		},
+		{
+			fixture:     "missing_imp.json",
+			expectedErr: "missing imp",
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.fixture, func(t *testing.T) {
+			f, err := os.Open(filepath.Join("testdata", tc.fixture))
+			if !assert.NoError(t, err) {
+				return
+			}
+			defer f.Close()
+
+			req, err := ParseBidRequest(f)
+			if tc.expectedErr != "" {
+				assert.EqualError(t, err, tc.expectedErr)
+				return
+			}
+
+			assert.NoError(t, err)
+			assert.Len(t, req.Imp, tc.imps)
+			assert.Equal(t, tc.targeting, req.Targeting(now))
+			assert.Equal(t, tc.acceptCurrency, req.AcceptsCurrency())
+		})
+	}
+}
+
+func TestSubdivision(t *testing.T) {
+	testCases := []struct {
+		country, region, expected string
+	}{
+		{"US", "CA", "US-CA"},
+		{"US", "us-ca", "US-CA"},
+		{"TW", "TPE", "TW-TPE"},
+		{"TW", "US-CA", ""},
+		{"US", "XX", ""},
+		{"", "CA", ""},
+		{"US", "", ""},
+	}
+
+	for _, tc := range testCases {
+		assert.Equal(t, tc.expected, subdivision(tc.country, tc.region), tc.country+" "+tc.region)
+	}
+}
+
+func TestAlpha2(t *testing.T) {
+	testCases := map[string]string{
+		"TWN": "TW",
+		"usa": "US",
+		"GBR": "GB",
+		"TW":  "",
+		"XXX": "",
+		"":    "",
+	}
+
+	for alpha3, expected := range testCases {
+		assert.Equal(t, expected, alpha2(alpha3), alpha3)
+	}
+}
+
+func TestImpFormats(t *testing.T) {
+	f, err := os.Open(filepath.Join("testdata", "video_ios.json"))
+	if !assert.NoError(t, err) {
+		return
+	}
+	defer f.Close()
+	req, err := ParseBidRequest(f)
+	assert.NoError(t, err)
+
+	video := req.Imp[0].Video
+	if assert.NotNil(t, video) {
+		assert.Equal(t, 30, video.MaxDuration)
+		assert.True(t, video.Accepts("VIDEO/MP4"))
+		assert.False(t, video.Accepts("video/webm"))
+	}
+	assert.Nil(t, req.Imp[0].Banner)
+	w, h, ok := req.Imp[1].Banner.Size()
+	assert.Equal(t, []interface{}{300, 250, true}, []interface{}{w, h, ok})
+
+	w, h, ok = (&Banner{Format: []Format{{}, {W: 728, H: 90}}}).Size()
+	assert.Equal(t, []interface{}{728, 90, true}, []interface{}{w, h, ok})
+	_, _, ok = (&Banner{W: 300}).Size()
+	assert.False(t, ok)
+	assert.True(t, (&Video{}).Accepts("video/webm"))
+}
@@ -0,0 +1,14 @@
+package routes
+
+import (
+	"google.golang.org/grpc"
+
+	"github.com/jjshen2000/simple-ads/adspb"
+	controller "github.com/jjshen2000/simple-ads/controllers"
+)
+
+func SetupGRPC() *grpc.Server {
+	server := grpc.NewServer(grpc.UnaryInterceptor(controller.AuthInterceptor))
+	adspb.RegisterAdServiceServer(server, controller.NewAdServiceServer())
+	return server
+}
@@ -1,23 +1,153 @@
 package routes
 
 import (
+	"context"
+	"log"
+	"time"
+
 	"github.com/gin-gonic/gin"
 
+	"github.com/jjshen2000/simple-ads/config"
 	controller "github.com/jjshen2000/simple-ads/controllers"
+	"github.com/jjshen2000/simple-ads/geoip"
+	"github.com/jjshen2000/simple-ads/moderation"
+	"github.com/jjshen2000/simple-ads/openapi"
+	"github.com/jjshen2000/simple-ads/webhook"
 )
 
+// Start loads the audiences and targeting conditions into memory and starts
+// the background loops keeping them in sync and delivering webhooks until ctx
+// is cancelled. The binary calls it once before serving; SetupRoutes only
+// registers routes.
+func Start(ctx context.Context) {
+	cfg := config.GetConfig()
+	if err := controller.WatchAudiences(ctx, seconds(cfg.Audience.RefreshSeconds, 60)); err != nil {
+		log.Fatalln("Failed to load audiences:", err)
+	}
+	if err := controller.WatchTargeting(ctx, seconds(cfg.Targeting.RefreshSeconds, 60)); err != nil {
+		log.Fatalln("Failed to load targeting:", err)
+	}
+	controller.WatchWebhooks(ctx, seconds(cfg.Webhook.PollSeconds, 5))
+}
+
 func SetupRoutes() *gin.Engine {
+	cfg := config.GetConfig()
 	router := gin.Default()
+	if err := router.SetTrustedProxies(cfg.Server.TrustedProxies); err != nil {
+		log.Fatalln("Invalid trusted proxies:", err)
+	}
+	if cfg.GeoIP.Database != "" {
+		resolver, err := geoip.Open(cfg.GeoIP.Database)
+		if err != nil {
+			log.Fatalln("Failed to open GeoIP database:", err)
+		}
+		controller.SetGeoResolver(resolver)
+	}
+	if err := controller.SetUnknownPolicy(cfg.Targeting.Unknown); err != nil {
+		log.Fatalln("Invalid targeting config:", err)
+	}
+	words, err := moderation.NewWordChecker(cfg.Moderation.BannedWords, cfg.Moderation.BannedPatterns)
+	if err != nil {
+		log.Fatalln("Invalid moderation config:", err)
+	}
+	controller.SetModerator(moderation.Pipeline{words,
+		moderation.NewDomainChecker(cfg.Moderation.AllowedDomains, cfg.Moderation.DeniedDomains)})
+	controller.SetWebhookDelivery(seconds(cfg.Webhook.TimeoutSeconds, 10), orInt(cfg.Webhook.MaxAttempts, 8),
+		webhook.Backoff{Base: seconds(cfg.Webhook.BackoffSeconds, 10), Max: seconds(cfg.Webhook.MaxBackoffSeconds, 3600)})
+	router.Use(controller.RequestID())
+	registerRoutes(router)
+	return router
+}
+
+// registerRoutes registers the handlers of the API on router. Requests to
+// the admin API are authenticated before they are validated, so that only
+// callers with a key learn why a request does not match the document.
+func registerRoutes(router *gin.Engine) {
+	validate := openapi.Validator()
+	auth := []gin.HandlerFunc{controller.RequireAPIKey(), validate}
+
+	// Public API: OpenAPI document
+	router.GET("/openapi.json", openapi.Handler)
+
+	// Public API: OpenRTB 2.x bid requests
+	router.POST("/openrtb2/bid", validate, controller.BidOpenRTB)
 
 	v1 := router.Group("/api/v1")
 	{
-		ad := v1.Group("ad")
+		ad := v1.Group("ad", auth...)
 		// Admin API: Create Advertisement
 		ad.POST("", controller.CreateAdvertisement)
 
+		// Admin API: Import Advertisements in bulk
+		ad.POST("/bulk", controller.ImportAdvertisements)
+
+		// Admin API: Export Advertisements
+		ad.GET("/export", controller.ExportAdvertisements)
+
+		// Admin API: Get, Update and Delete Advertisement
+		ad.GET("/:id", controller.GetAdvertisement)
+		ad.PUT("/:id", controller.UpdateAdvertisement)
+		ad.DELETE("/:id", controller.DeleteAdvertisement)
+
+		// Admin API: Change the lifecycle status of an Advertisement
+		ad.POST("/:id/status", controller.SetAdvertisementStatus)
+
+		// Admin API: Revisions of an Advertisement, and restoring deleted ones
+		ad.GET("/:id/revisions", controller.ListAdvertisementRevisions)
+		ad.GET("/:id/revisions/diff", controller.DiffAdvertisementRevisions)
+		ad.POST("/:id/revisions/:revision/restore", controller.RestoreAdvertisementRevision)
+		ad.POST("/:id/restore", controller.RestoreAdvertisement)
+
 		// Public API: List Active Advertisements
-		ad.GET("", controller.ListActiveAdvertisements)
+		v1.GET("/ad", validate, controller.ListActiveAdvertisements)
+
+		audience := v1.Group("audience", auth...)
+		// Admin API: Create Audience from hashed user IDs
+		audience.POST("", controller.CreateAudience)
+
+		// Admin API: Get, Replace and Delete Audience
+		audience.GET("/:id", controller.GetAudience)
+		audience.PUT("/:id", controller.ReplaceAudience)
+		audience.DELETE("/:id", controller.DeleteAudience)
+
+		// Public API: Active video advertisements as VAST
+		v1.GET("/vast", validate, controller.GetVAST)
+
+		admin := v1.Group("admin", auth...)
+		// Admin API: Schema Migrations
+		admin.GET("/migrations", controller.GetMigrations)
+		admin.POST("/migrations", controller.ApplyMigrations)
+
+		// Admin API: Mint API Key
+		admin.POST("/keys", controller.MintAPIKey)
+
+		// Admin API: Report
+		admin.GET("/report", controller.GetReport)
+
+		// Admin API: Audit log of admin changes
+		v1.Group("audit", auth...).GET("", controller.GetAuditLog)
+
+		hook := v1.Group("webhook", auth...)
+		// Admin API: Register, List and Delete Webhooks
+		hook.POST("", controller.CreateWebhook)
+		hook.GET("", controller.ListWebhooks)
+		hook.DELETE("/:id", controller.DeleteWebhook)
+
+		// Admin API: Deliveries that failed every attempt, and replaying them
+		hook.GET("/dead-letter", controller.ListDeadLetters)
+		hook.POST("/dead-letter/:id/replay", controller.ReplayDeadLetter)
 	}
+}
 
-	return router
+// seconds returns n seconds, or fallback seconds when n is zero.
+func seconds(n, fallback int) time.Duration {
+	return time.Duration(orInt(n, fallback)) * time.Second
+}
+
+// orInt returns n, or fallback when n is zero.
+func orInt(n, fallback int) int {
+	if n == 0 {
+		return fallback
+	}
+	return n
 }
@@ -0,0 +1,39 @@
+package routes
+
+import (
+	"regexp"
+	"sort"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/jjshen2000/simple-ads/openapi"
+)
+
+var ginParam = regexp.MustCompile(`:(\w+)`)
+
+// TestRoutesMatchOpenAPI fails when a route is added without documenting it,
+// or the document describes a route that is not served.
+func TestRoutesMatchOpenAPI(t *testing.T) {
+	doc, err := openapi.Load()
+	assert.NoError(t, err)
+
+	var documented []string
+	for path, item := range doc.Paths {
+		for method := range item.Operations() {
+			documented = append(documented, method+" "+path)
+		}
+	}
+	sort.Strings(documented)
+
+	router := gin.New()
+	registerRoutes(router)
+	var served []string
+	for _, route := range router.Routes() {
+		served = append(served, route.Method+" "+ginParam.ReplaceAllString(route.Path, "{$1}"))
+	}
+	sort.Strings(served)
+
+	assert.Equal(t, documented, served)
+}
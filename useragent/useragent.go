@@ -0,0 +1,180 @@
+// Package useragent infers the platform, OS version and device type of a
+// client from its User-Agent and User-Agent Client Hints headers.
+package useragent
+
+import (
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// DeviceType is the form factor of a device.
+type DeviceType string
+
+const (
+	Phone   DeviceType = "phone"
+	Tablet  DeviceType = "tablet"
+	Desktop DeviceType = "desktop"
+	TV      DeviceType = "tv"
+)
+
+// Info describes a client. Empty fields are unknown.
+type Info struct {
+	// Platform is "android", "ios" or "web" as in advertisement conditions.
+	Platform string
+	// OSVersion is the dotted version of the operating system, e.g. "17.1".
+	OSVersion string
+	Device    DeviceType
+}
+
+var (
+	botRegexp = regexp.MustCompile(`(?i)(bot|spider|crawler)[/\-;]|slurp|facebookexternalhit|lighthouse|^(curl|wget|python-requests|go-http-client)/`)
+
+	windowsPhoneRegexp = regexp.MustCompile(`Windows Phone(?: OS)? (\d+(?:\.\d+)*)`)
+	iosDeviceRegexp    = regexp.MustCompile(`iPhone|iPad|iPod`)
+	iosVersionRegexp   = regexp.MustCompile(`(?:CPU (?:iPhone )?OS|iPhone OS|iOS) (\d+(?:[_.]\d+)*)`)
+	iosAppRegexp       = regexp.MustCompile(`CFNetwork/[\d.]+ Darwin/`)
+	androidRegexp      = regexp.MustCompile(`Android(?:[ /](\d+(?:\.\d+)*))?`)
+	// Chrome reports Android 10 on model "K" for every version since 110.
+	reducedAndroidRegexp = regexp.MustCompile(`Android 10; K\)`)
+	tvRegexp             = regexp.MustCompile(`(?i)smart-?tv|android tv|googletv|\bAFT[A-Z]|bravia|web0s|hbbtv|\broku|apple ?tv|\btvos\b|crkey|\bTizen[^;)]*\bTV\b`)
+	kaiOSRegexp          = regexp.MustCompile(`KAIOS/(\d+(?:\.\d+)*)`)
+	windowsRegexp        = regexp.MustCompile(`Windows NT (\d+\.\d+)`)
+	macRegexp            = regexp.MustCompile(`Mac OS X (\d+(?:[_.]\d+)*)`)
+	chromeOSRegexp       = regexp.MustCompile(`CrOS \w+ (\d+(?:\.\d+)*)`)
+	desktopLinuxRegexp   = regexp.MustCompile(`X11; (?:Ubuntu; |Fedora; )?(?:Linux|FreeBSD|OpenBSD)`)
+)
+
+// Parse infers the client from a User-Agent header. Crawlers and unknown
+// clients yield an empty Info.
+func Parse(ua string) Info {
+	info, _ := parse(ua)
+	return info
+}
+
+// parse is Parse that also tells whether ua is a crawler.
+func parse(ua string) (info Info, bot bool) {
+	if ua == "" {
+		return info, false
+	}
+	if botRegexp.MatchString(ua) {
+		return info, true
+	}
+
+	// Windows Phone pretends to be Android and iPhone, so it goes first.
+	if m := windowsPhoneRegexp.FindStringSubmatch(ua); m != nil {
+		return Info{Platform: "web", OSVersion: m[1], Device: Phone}, false
+	}
+
+	tv := tvRegexp.MatchString(ua)
+
+	if !tv && (iosDeviceRegexp.MatchString(ua) || iosAppRegexp.MatchString(ua)) {
+		info.Platform = "ios"
+		if m := iosVersionRegexp.FindStringSubmatch(ua); m != nil {
+			info.OSVersion = strings.ReplaceAll(m[1], "_", ".")
+		}
+		switch {
+		case strings.Contains(ua, "iPad"):
+			info.Device = Tablet
+		case strings.Contains(ua, "iPhone"), strings.Contains(ua, "iPod"):
+			info.Device = Phone
+		}
+		return info, false
+	}
+
+	if m := androidRegexp.FindStringSubmatch(ua); m != nil {
+		info.Platform = "android"
+		if !reducedAndroidRegexp.MatchString(ua) {
+			info.OSVersion = m[1]
+		}
+		switch {
+		case tv:
+			info.Device = TV
+		case strings.Contains(ua, "Mobile"):
+			info.Device = Phone
+		case strings.Contains(ua, "Dalvik/"):
+			// The HTTP client of apps says nothing about the form factor.
+		default:
+			// Android browsers omit "Mobile" on tablets.
+			info.Device = Tablet
+		}
+		return info, false
+	}
+
+	if tv {
+		return Info{Device: TV}, false
+	}
+
+	if m := kaiOSRegexp.FindStringSubmatch(ua); m != nil {
+		return Info{Platform: "web", OSVersion: m[1], Device: Phone}, false
+	}
+
+	if !strings.HasPrefix(ua, "Mozilla/") {
+		return info, false
+	}
+	info = Info{Platform: "web", Device: Desktop}
+	if m := windowsRegexp.FindStringSubmatch(ua); m != nil {
+		info.OSVersion = m[1]
+	} else if m := macRegexp.FindStringSubmatch(ua); m != nil {
+		info.OSVersion = strings.ReplaceAll(m[1], "_", ".")
+	} else if m := chromeOSRegexp.FindStringSubmatch(ua); m != nil {
+		info.OSVersion = m[1]
+	} else if !desktopLinuxRegexp.MatchString(ua) {
+		return Info{}, false
+	}
+	return info, false
+}
+
+// FromHeader infers the client from the User-Agent header and the
+// Sec-CH-UA-Platform, Sec-CH-UA-Platform-Version and Sec-CH-UA-Mobile client
+// hints, which win because browsers freeze parts of the User-Agent.
+func FromHeader(h http.Header) Info {
+	info, bot := parse(h.Get("User-Agent"))
+	if bot {
+		return Info{}
+	}
+
+	platform, ok := hintString(h.Get("Sec-CH-UA-Platform"))
+	if !ok {
+		return info
+	}
+	switch platform {
+	case "Android":
+		if info.Platform != "android" {
+			info = Info{Platform: "android"}
+		}
+	case "iOS":
+		if info.Platform != "ios" {
+			info = Info{Platform: "ios"}
+		}
+	case "Windows", "macOS", "Linux", "Chrome OS", "Chromium OS":
+		if info.Platform != "web" || info.Device != Desktop {
+			info = Info{Platform: "web", Device: Desktop}
+		}
+	default:
+		return info
+	}
+
+	// Windows reports a platform version unrelated to its NT version.
+	if version, ok := hintString(h.Get("Sec-CH-UA-Platform-Version")); ok && version != "" && platform != "Windows" {
+		info.OSVersion = version
+	}
+	switch h.Get("Sec-CH-UA-Mobile") {
+	case "?1":
+		info.Device = Phone
+	case "?0":
+		if info.Platform == "android" && info.Device != TV {
+			info.Device = Tablet
+		}
+	}
+	return info
+}
+
+// hintString decodes a client hint holding a structured header string.
+func hintString(value string) (string, bool) {
+	value = strings.TrimSpace(value)
+	if len(value) < 2 || value[0] != '"' || value[len(value)-1] != '"' {
+		return "", false
+	}
+	return strings.ReplaceAll(value[1:len(value)-1], `\"`, `"`), true
+}
@@ -0,0 +1,343 @@
+package useragent
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+	testCases := []struct {
+		name string
+		ua   string
+		info Info
+	}{
+		// iOS
+		{
+			name: "Safari iPhone",
+			ua:   "Mozilla/5.0 (iPhone; CPU iPhone OS 17_1_2 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.1.2 Mobile/15E148 Safari/604.1",
+			info: Info{Platform: "ios", OSVersion: "17.1.2", Device: Phone},
+		},
+		{
+			name: "Chrome iPhone",
+			ua:   "Mozilla/5.0 (iPhone; CPU iPhone OS 16_6 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) CriOS/119.0.6045.169 Mobile/15E148 Safari/604.1",
+			info: Info{Platform: "ios", OSVersion: "16.6", Device: Phone},
+		},
+		{
+			name: "Safari iPad",
+			ua:   "Mozilla/5.0 (iPad; CPU OS 15_7 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/15.6.1 Mobile/15E148 Safari/604.1",
+			info: Info{Platform: "ios", OSVersion: "15.7", Device: Tablet},
+		},
+		{
+			name: "iPod touch",
+			ua:   "Mozilla/5.0 (iPod touch; CPU iPhone OS 12_5_7 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/12.1.2 Mobile/15E148 Safari/604.1",
+			info: Info{Platform: "ios", OSVersion: "12.5.7", Device: Phone},
+		},
+		{
+			name: "Old iPhone OS",
+			ua:   "Mozilla/5.0 (iPhone; U; CPU iPhone OS 3_0 like Mac OS X; en-us) AppleWebKit/528.18 (KHTML, like Gecko) Version/4.0 Mobile/7A341 Safari/528.16",
+			info: Info{Platform: "ios", OSVersion: "3.0", Device: Phone},
+		},
+		{
+			name: "Facebook in-app iPhone",
+			ua:   "Mozilla/5.0 (iPhone; CPU iPhone OS 17_0 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Mobile/15E148 [FBAN/FBIOS;FBAV/439.0.0.29.115;FBBV/540174375;FBDV/iPhone14,5;FBMD/iPhone;FBSN/iOS;FBSV/17.0;FBSS/3;FBCR/;FBID/phone;FBLC/en_US;FBOP/80]",
+			info: Info{Platform: "ios", OSVersion: "17.0", Device: Phone},
+		},
+		{
+			name: "iOS app",
+			ua:   "Instagram 309.0.0.28.113 (iPhone15,2; iOS 17_1_1; en_US; en; scale=3.00; 1179x2556; 541635890)",
+			info: Info{Platform: "ios", OSVersion: "17.1.1", Device: Phone},
+		},
+		{
+			name: "iOS networking",
+			ua:   "MyApp/2.3.1 CFNetwork/1474 Darwin/23.0.0",
+			info: Info{Platform: "ios"},
+		},
+
+		// Android
+		{
+			name: "Chrome Android phone",
+			ua:   "Mozilla/5.0 (Linux; Android 13; SM-S911B) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/112.0.0.0 Mobile Safari/537.36",
+			info: Info{Platform: "android", OSVersion: "13", Device: Phone},
+		},
+		{
+			name: "Chrome Android reduced",
+			ua:   "Mozilla/5.0 (Linux; Android 10; K) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Mobile Safari/537.36",
+			info: Info{Platform: "android", Device: Phone},
+		},
+		{
+			name: "Chrome Android tablet",
+			ua:   "Mozilla/5.0 (Linux; Android 12; SM-X700) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/119.0.0.0 Safari/537.36",
+			info: Info{Platform: "android", OSVersion: "12", Device: Tablet},
+		},
+		{
+			name: "Firefox Android",
+			ua:   "Mozilla/5.0 (Android 14; Mobile; rv:120.0) Gecko/120.0 Firefox/120.0",
+			info: Info{Platform: "android", OSVersion: "14", Device: Phone},
+		},
+		{
+			name: "Samsung Internet",
+			ua:   "Mozilla/5.0 (Linux; Android 11; SAMSUNG SM-A515F) AppleWebKit/537.36 (KHTML, like Gecko) SamsungBrowser/23.0 Chrome/115.0.0.0 Mobile Safari/537.36",
+			info: Info{Platform: "android", OSVersion: "11", Device: Phone},
+		},
+		{
+			name: "Android WebView",
+			ua:   "Mozilla/5.0 (Linux; Android 9; Pixel 3 Build/PQ1A.181105.017.A1; wv) AppleWebKit/537.36 (KHTML, like Gecko) Version/4.0 Chrome/70.0.3538.110 Mobile Safari/537.36",
+			info: Info{Platform: "android", OSVersion: "9", Device: Phone},
+		},
+		{
+			name: "Old Android",
+			ua:   "Mozilla/5.0 (Linux; U; Android 4.0.3; ko-kr; LG-L160L Build/IML74K) AppleWebkit/534.30 (KHTML, like Gecko) Version/4.0 Mobile Safari/534.30",
+			info: Info{Platform: "android", OSVersion: "4.0.3", Device: Phone},
+		},
+		{
+			name: "Android app",
+			ua:   "Dalvik/2.1.0 (Linux; U; Android 13; Pixel 7 Build/TQ3A.230901.001)",
+			info: Info{Platform: "android", OSVersion: "13"},
+		},
+		{
+			name: "Cubot phone",
+			ua:   "Mozilla/5.0 (Linux; Android 11; CUBOT X30) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/96.0.4664.45 Mobile Safari/537.36",
+			info: Info{Platform: "android", OSVersion: "11", Device: Phone},
+		},
+		{
+			name: "Fire TV",
+			ua:   "Mozilla/5.0 (Linux; Android 9; AFTMM Build/PS7233) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/88.0.4324.152 Mobile Safari/537.36",
+			info: Info{Platform: "android", OSVersion: "9", Device: TV},
+		},
+		{
+			name: "Android TV",
+			ua:   "Mozilla/5.0 (Linux; Android 10; BRAVIA 4K VH2 Build/QTG3.200305.006.S292; wv) AppleWebKit/537.36 (KHTML, like Gecko) Version/4.0 Chrome/81.0.4044.138 Safari/537.36",
+			info: Info{Platform: "android", OSVersion: "10", Device: TV},
+		},
+
+		// Desktop
+		{
+			name: "Chrome Windows",
+			ua:   "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36",
+			info: Info{Platform: "web", OSVersion: "10.0", Device: Desktop},
+		},
+		{
+			name: "Edge Windows",
+			ua:   "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/119.0.0.0 Safari/537.36 Edg/119.0.2151.72",
+			info: Info{Platform: "web", OSVersion: "10.0", Device: Desktop},
+		},
+		{
+			name: "Internet Explorer",
+			ua:   "Mozilla/5.0 (Windows NT 6.1; WOW64; Trident/7.0; rv:11.0) like Gecko",
+			info: Info{Platform: "web", OSVersion: "6.1", Device: Desktop},
+		},
+		{
+			name: "Safari macOS",
+			ua:   "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.1 Safari/605.1.15",
+			info: Info{Platform: "web", OSVersion: "10.15.7", Device: Desktop},
+		},
+		{
+			name: "Firefox macOS",
+			ua:   "Mozilla/5.0 (Macintosh; Intel Mac OS X 14.1; rv:120.0) Gecko/20100101 Firefox/120.0",
+			info: Info{Platform: "web", OSVersion: "14.1", Device: Desktop},
+		},
+		{
+			name: "Firefox Linux",
+			ua:   "Mozilla/5.0 (X11; Linux x86_64; rv:109.0) Gecko/20100101 Firefox/115.0",
+			info: Info{Platform: "web", Device: Desktop},
+		},
+		{
+			name: "Firefox Ubuntu",
+			ua:   "Mozilla/5.0 (X11; Ubuntu; Linux x86_64; rv:120.0) Gecko/20100101 Firefox/120.0",
+			info: Info{Platform: "web", Device: Desktop},
+		},
+		{
+			name: "Chrome OS",
+			ua:   "Mozilla/5.0 (X11; CrOS x86_64 14541.0.0) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36",
+			info: Info{Platform: "web", OSVersion: "14541.0.0", Device: Desktop},
+		},
+
+		// Others
+		{
+			name: "Windows Phone",
+			ua:   "Mozilla/5.0 (Mobile; Windows Phone 8.1; Android 4.0; ARM; Trident/7.0; Touch; rv:11.0; IEMobile/11.0; NOKIA; Lumia 635) like iPhone OS 7_0_3 Mac OS X AppleWebKit/537 (KHTML, like Gecko) Mobile Safari/537",
+			info: Info{Platform: "web", OSVersion: "8.1", Device: Phone},
+		},
+		{
+			name: "KaiOS",
+			ua:   "Mozilla/5.0 (Mobile; Nokia_8110_4G; rv:48.0) Gecko/48.0 Firefox/48.0 KAIOS/2.5",
+			info: Info{Platform: "web", OSVersion: "2.5", Device: Phone},
+		},
+		{
+			name: "Tizen TV",
+			ua:   "Mozilla/5.0 (SMART-TV; LINUX; Tizen 6.0) AppleWebKit/537.36 (KHTML, like Gecko) 76.0.3809.146/6.0 TV Safari/537.36",
+			info: Info{Device: TV},
+		},
+		{
+			name: "webOS TV",
+			ua:   "Mozilla/5.0 (Web0S; Linux/SmartTV) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/79.0.3945.79 Safari/537.36 WebAppManager",
+			info: Info{Device: TV},
+		},
+		{
+			name: "Roku",
+			ua:   "Roku/DVP-12.0 (12.0.0.4182-88)",
+			info: Info{Device: TV},
+		},
+		{
+			name: "Apple TV",
+			ua:   "AppleCoreMedia/1.0.0.20K71 (Apple TV; U; CPU OS 16_1 like Mac OS X; en_us)",
+			info: Info{Device: TV},
+		},
+		{
+			name: "Chromecast",
+			ua:   "Mozilla/5.0 (X11; Linux armv7l) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/87.0.4280.141 Safari/537.36 CrKey/1.56.500000 DeviceType/Chromecast",
+			info: Info{Device: TV},
+		},
+		{
+			name: "PlayStation",
+			ua:   "Mozilla/5.0 (PlayStation; PlayStation 5/2.26) AppleWebKit/605.1.15 (KHTML, like Gecko)",
+		},
+
+		// Crawlers and tools
+		{
+			name: "Googlebot smartphone",
+			ua:   "Mozilla/5.0 (Linux; Android 6.0.1; Nexus 5X Build/MMB29P) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/119.0.6045.199 Mobile Safari/537.36 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)",
+		},
+		{
+			name: "Bingbot",
+			ua:   "Mozilla/5.0 (compatible; bingbot/2.0; +http://www.bing.com/bingbot.htm)",
+		},
+		{
+			name: "AdsBot",
+			ua:   "AdsBot-Google (+http://www.google.com/adsbot.html)",
+		},
+		{
+			name: "Baidu",
+			ua:   "Mozilla/5.0 (compatible; Baiduspider/2.0; +http://www.baidu.com/search/spider.html)",
+		},
+		{
+			name: "Facebook preview",
+			ua:   "facebookexternalhit/1.1 (+http://www.facebook.com/externalhit_uatext.php)",
+		},
+		{
+			name: "curl",
+			ua:   "curl/8.4.0",
+		},
+		{
+			name: "Go client",
+			ua:   "Go-http-client/1.1",
+		},
+		{name: "Empty"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.info, Parse(tc.ua))
+		})
+	}
+}
+
+func TestFromHeader(t *testing.T) {
+	const (
+		reducedAndroid = "Mozilla/5.0 (Linux; Android 10; K) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Mobile Safari/537.36"
+		reducedTablet  = "Mozilla/5.0 (Linux; Android 10; K) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36"
+		macChrome      = "Mozilla/5.0 (Macintosh; Intel Mac OS X 10_15_7) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36"
+		windowsChrome  = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Safari/537.36"
+	)
+
+	testCases := []struct {
+		name   string
+		header map[string]string
+		info   Info
+	}{
+		{
+			name:   "User-Agent only",
+			header: map[string]string{"User-Agent": reducedAndroid},
+			info:   Info{Platform: "android", Device: Phone},
+		},
+		{
+			name: "Android phone hints",
+			header: map[string]string{
+				"User-Agent":                 reducedAndroid,
+				"Sec-CH-UA-Platform":         `"Android"`,
+				"Sec-CH-UA-Platform-Version": `"14.0.0"`,
+				"Sec-CH-UA-Mobile":           "?1",
+			},
+			info: Info{Platform: "android", OSVersion: "14.0.0", Device: Phone},
+		},
+		{
+			name: "Android tablet hints",
+			header: map[string]string{
+				"User-Agent":         reducedTablet,
+				"Sec-CH-UA-Platform": `"Android"`,
+				"Sec-CH-UA-Mobile":   "?0",
+			},
+			info: Info{Platform: "android", Device: Tablet},
+		},
+		{
+			name: "macOS hints",
+			header: map[string]string{
+				"User-Agent":                 macChrome,
+				"Sec-CH-UA-Platform":         `"macOS"`,
+				"Sec-CH-UA-Platform-Version": `"14.1.0"`,
+				"Sec-CH-UA-Mobile":           "?0",
+			},
+			info: Info{Platform: "web", OSVersion: "14.1.0", Device: Desktop},
+		},
+		{
+			name: "Windows hints",
+			header: map[string]string{
+				"User-Agent":                 windowsChrome,
+				"Sec-CH-UA-Platform":         `"Windows"`,
+				"Sec-CH-UA-Platform-Version": `"15.0.0"`,
+			},
+			info: Info{Platform: "web", OSVersion: "10.0", Device: Desktop},
+		},
+		{
+			name: "Hints contradict User-Agent",
+			header: map[string]string{
+				"User-Agent":         windowsChrome,
+				"Sec-CH-UA-Platform": `"Android"`,
+				"Sec-CH-UA-Mobile":   "?1",
+			},
+			info: Info{Platform: "android", Device: Phone},
+		},
+		{
+			name: "Hints without User-Agent",
+			header: map[string]string{
+				"Sec-CH-UA-Platform": `"Linux"`,
+			},
+			info: Info{Platform: "web", Device: Desktop},
+		},
+		{
+			name: "Unknown platform hint",
+			header: map[string]string{
+				"User-Agent":         macChrome,
+				"Sec-CH-UA-Platform": `"Unknown"`,
+			},
+			info: Info{Platform: "web", OSVersion: "10.15.7", Device: Desktop},
+		},
+		{
+			name: "Malformed hint",
+			header: map[string]string{
+				"User-Agent":         macChrome,
+				"Sec-CH-UA-Platform": "Android",
+			},
+			info: Info{Platform: "web", OSVersion: "10.15.7", Device: Desktop},
+		},
+		{
+			name: "Crawler with hints",
+			header: map[string]string{
+				"User-Agent":         "Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)",
+				"Sec-CH-UA-Platform": `"Android"`,
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			h := http.Header{}
+			for key, value := range tc.header {
+				h.Set(key, value)
+			}
+			assert.Equal(t, tc.info, FromHeader(h))
+		})
+	}
+}
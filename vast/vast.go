@@ -0,0 +1,123 @@
+// Package vast renders linear video advertisements as VAST 4.2 documents.
+package vast
+
+import (
+	"encoding/xml"
+	"fmt"
+	"time"
+)
+
+// Version is the VAST version of the rendered documents.
+const Version = "4.2"
+
+// Namespace is the XML namespace of VAST 4.x.
+const Namespace = "http://www.iab.com/VAST"
+
+// VAST is the root of a VAST document. A document without ads tells the
+// player that nothing matched.
+type VAST struct {
+	XMLName xml.Name `xml:"VAST"`
+	Version string   `xml:"version,attr"`
+	XMLNS   string   `xml:"xmlns,attr"`
+	Ads     []Ad     `xml:"Ad"`
+}
+
+type Ad struct {
+	ID     string `xml:"id,attr"`
+	InLine InLine `xml:"InLine"`
+}
+
+// InLine is an ad served directly rather than wrapped. The field order
+// follows the element order of the VAST 4.2 specification.
+type InLine struct {
+	AdSystem    AdSystem     `xml:"AdSystem"`
+	Impressions []Impression `xml:"Impression"`
+	AdServingID string       `xml:"AdServingId"`
+	AdTitle     string       `xml:"AdTitle"`
+	Creatives   []Creative   `xml:"Creatives>Creative"`
+}
+
+type AdSystem struct {
+	Version string `xml:"version,attr,omitempty"`
+	Name    string `xml:",chardata"`
+}
+
+type Impression struct {
+	ID  string `xml:"id,attr,omitempty"`
+	URL string `xml:",cdata"`
+}
+
+type Creative struct {
+	ID            string        `xml:"id,attr,omitempty"`
+	AdID          string        `xml:"adId,attr,omitempty"`
+	UniversalAdID UniversalAdID `xml:"UniversalAdId"`
+	Linear        Linear        `xml:"Linear"`
+}
+
+type UniversalAdID struct {
+	IDRegistry string `xml:"idRegistry,attr"`
+	ID         string `xml:",chardata"`
+}
+
+type Linear struct {
+	TrackingEvents []Tracking   `xml:"TrackingEvents>Tracking"`
+	Duration       Duration     `xml:"Duration"`
+	MediaFiles     []MediaFile  `xml:"MediaFiles>MediaFile"`
+	VideoClicks    *VideoClicks `xml:"VideoClicks"`
+}
+
+type Tracking struct {
+	Event string `xml:"event,attr"`
+	URL   string `xml:",cdata"`
+}
+
+type MediaFile struct {
+	Delivery string `xml:"delivery,attr"` // progressive or streaming
+	Type     string `xml:"type,attr"`
+	Width    int    `xml:"width,attr"`
+	Height   int    `xml:"height,attr"`
+	Bitrate  int    `xml:"bitrate,attr,omitempty"` // kbps
+	URL      string `xml:",cdata"`
+}
+
+type VideoClicks struct {
+	ClickThrough ClickThrough `xml:"ClickThrough"`
+}
+
+type ClickThrough struct {
+	URL string `xml:",cdata"`
+}
+
+// Duration is written as HH:MM:SS.mmm.
+type Duration time.Duration
+
+func (d Duration) MarshalText() ([]byte, error) {
+	ms := time.Duration(d).Milliseconds()
+	return []byte(fmt.Sprintf("%02d:%02d:%02d.%03d", ms/3600000, ms/60000%60, ms/1000%60, ms%1000)), nil
+}
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	var h, m, s, ms int64
+	if _, err := fmt.Sscanf(string(text), "%d:%d:%d.%d", &h, &m, &s, &ms); err != nil {
+		if _, err := fmt.Sscanf(string(text), "%d:%d:%d", &h, &m, &s); err != nil {
+			return fmt.Errorf("invalid duration %q", text)
+		}
+	}
+	*d = Duration(time.Duration(h)*time.Hour + time.Duration(m)*time.Minute +
+		time.Duration(s)*time.Second + time.Duration(ms)*time.Millisecond)
+	return nil
+}
+
+// New returns a document holding ads.
+func New(ads ...Ad) *VAST {
+	return &VAST{Version: Version, XMLNS: Namespace, Ads: ads}
+}
+
+// Marshal encodes the document with an XML declaration.
+func (v *VAST) Marshal() ([]byte, error) {
+	data, err := xml.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return append([]byte(xml.Header), data...), nil
+}
@@ -0,0 +1,123 @@
+package vast
+
+import (
+	"bytes"
+	"encoding/xml"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// schemaFile is the IAB VAST 4.2 XSD, vendored with make vast-xsd.
+var schemaFile = filepath.Join("testdata", "vast_4.2.xsd")
+
+// validate checks data against the IAB VAST 4.2 XSD with xmllint. It skips
+// when xmllint is not installed.
+func validate(t *testing.T, data []byte) error {
+	t.Helper()
+	xmllint, err := exec.LookPath("xmllint")
+	if err != nil {
+		t.Skip("xmllint not installed")
+	}
+	if _, err := os.Stat(schemaFile); err != nil {
+		t.Skipf("%s missing, run make vast-xsd: %v", schemaFile, err)
+	}
+
+	cmd := exec.Command(xmllint, "--noout", "--schema", schemaFile, "-")
+	cmd.Stdin = bytes.NewReader(data)
+	if out, err := cmd.CombinedOutput(); err != nil {
+		return fmt.Errorf("%v: %s", err, out)
+	}
+	return nil
+}
+
+func sampleAd() Ad {
+	return Ad{
+		ID: "7",
+		InLine: InLine{
+			AdSystem:    AdSystem{Version: "1.0", Name: "simple-ads"},
+			Impressions: []Impression{{ID: "1", URL: "https://track.example.com/imp?ad=7"}},
+			AdServingID: "c0ffee",
+			AdTitle:     "Lunch <deal>",
+			Creatives: []Creative{{
+				ID:            "7",
+				AdID:          "7",
+				UniversalAdID: UniversalAdID{IDRegistry: "simple-ads", ID: "7"},
+				Linear: Linear{
+					TrackingEvents: []Tracking{
+						{Event: "start", URL: "https://track.example.com/start?ad=7"},
+						{Event: "complete", URL: "https://track.example.com/complete?ad=7&a=b"},
+					},
+					Duration: Duration(15500 * time.Millisecond),
+					MediaFiles: []MediaFile{
+						{Delivery: "progressive", Type: "video/mp4", Width: 1280, Height: 720, Bitrate: 2000, URL: "https://cdn.example.com/7.mp4"},
+					},
+					VideoClicks: &VideoClicks{ClickThrough: ClickThrough{URL: "https://example.com/lunch"}},
+				},
+			}},
+		},
+	}
+}
+
+func TestMarshal(t *testing.T) {
+	testCases := []struct {
+		name   string
+		vast   *VAST
+		golden string
+	}{
+		{name: "Empty", vast: New(), golden: "empty.xml"},
+		{name: "InLine", vast: New(sampleAd()), golden: "inline.xml"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			data, err := tc.vast.Marshal()
+			assert.NoError(t, err)
+
+			expected, err := os.ReadFile(filepath.Join("testdata", tc.golden))
+			assert.NoError(t, err)
+			assert.Equal(t, string(expected), string(data)+"\n")
+
+			var decoded VAST
+			assert.NoError(t, xml.Unmarshal(data, &decoded))
+			decoded.XMLName = xml.Name{}
+			decoded.XMLNS = Namespace
+			assert.Equal(t, tc.vast.Ads, decoded.Ads)
+
+			assert.NoError(t, validate(t, data))
+		})
+	}
+}
+
+func TestValidateRejects(t *testing.T) {
+	data := []byte(`<VAST xmlns="` + Namespace + `" version="4.2"><Bogus/></VAST>`)
+	assert.Error(t, validate(t, data))
+}
+
+func TestDuration(t *testing.T) {
+	for _, tc := range []struct {
+		text string
+		d    time.Duration
+	}{
+		{"00:00:15.000", 15 * time.Second},
+		{"01:02:03.004", time.Hour + 2*time.Minute + 3*time.Second + 4*time.Millisecond},
+	} {
+		text, err := Duration(tc.d).MarshalText()
+		assert.NoError(t, err)
+		assert.Equal(t, tc.text, string(text))
+
+		var d Duration
+		assert.NoError(t, d.UnmarshalText(text))
+		assert.Equal(t, tc.d, time.Duration(d))
+	}
+
+	var d Duration
+	assert.NoError(t, d.UnmarshalText([]byte("00:00:30")))
+	assert.Equal(t, 30*time.Second, time.Duration(d))
+	assert.Error(t, d.UnmarshalText([]byte("30s")))
+}
@@ -0,0 +1,104 @@
+// Package webhook signs and sends webhook deliveries and schedules their
+// retries. Queuing deliveries is left to the caller.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Headers of a delivery. The signature covers the timestamp so that a
+// captured delivery cannot be replayed later by someone else.
+const (
+	HeaderEvent     = "X-Webhook-Event"
+	HeaderDelivery  = "X-Webhook-Delivery"
+	HeaderTimestamp = "X-Webhook-Timestamp"
+	HeaderSignature = "X-Webhook-Signature"
+)
+
+// Sign returns the signature of body sent at timestamp, in Unix seconds:
+// "sha256=" followed by the hex HMAC-SHA256 of "<timestamp>.<body>" keyed by
+// secret.
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10)))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify reports whether signature is the signature of body sent at
+// timestamp, comparing in constant time. Receivers should also reject old
+// timestamps.
+func Verify(secret string, timestamp int64, body []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, timestamp, body)), []byte(signature))
+}
+
+// Backoff spaces the attempts of a delivery exponentially: Base after the
+// first failure, doubling after each one up to Max.
+type Backoff struct {
+	Base, Max time.Duration
+}
+
+// Delay returns how long to wait after failed attempt n, counted from 1.
+func (b Backoff) Delay(n int) time.Duration {
+	delay := b.Base
+	for i := 1; i < n && delay < b.Max; i++ {
+		delay *= 2
+	}
+	if delay > b.Max {
+		delay = b.Max
+	}
+	return delay
+}
+
+// Delivery is an event to post to the URL of a webhook. Its ID stays the
+// same across attempts, so receivers can drop duplicates.
+type Delivery struct {
+	ID      string
+	Event   string
+	URL     string
+	Secret  string
+	Payload []byte
+}
+
+// maxErrorBody bounds how much of a failed response ends up in its error.
+const maxErrorBody = 256
+
+// Send posts d with its signature at time at. Any response but a 2xx is an
+// error; the caller retries.
+func Send(ctx context.Context, client *http.Client, d Delivery, at time.Time) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, d.URL, bytes.NewReader(d.Payload))
+	if err != nil {
+		return err
+	}
+	timestamp := at.Unix()
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "simple-ads-webhook/1")
+	req.Header.Set(HeaderEvent, d.Event)
+	req.Header.Set(HeaderDelivery, d.ID)
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(timestamp, 10))
+	req.Header.Set(HeaderSignature, Sign(d.Secret, timestamp, d.Payload))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBody))
+		return fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(body)))
+	}
+	io.Copy(io.Discard, resp.Body)
+	return nil
+}
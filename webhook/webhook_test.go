@@ -0,0 +1,65 @@
+package webhook
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSign(t *testing.T) {
+	body := []byte(`{"event":"ad.created"}`)
+	signature := Sign("secret", 1700000000, body)
+	assert.Equal(t, "sha256=5d2cbdaa0c2153721c29f409e7c28be1515dfe5d25d809d58b2c0d746806f0e2", signature)
+
+	assert.True(t, Verify("secret", 1700000000, body, signature))
+	assert.False(t, Verify("other", 1700000000, body, signature))
+	assert.False(t, Verify("secret", 1700000001, body, signature))
+	assert.False(t, Verify("secret", 1700000000, []byte(`{"event":"ad.expired"}`), signature))
+}
+
+func TestBackoff(t *testing.T) {
+	b := Backoff{Base: 10 * time.Second, Max: time.Minute}
+	var delays []time.Duration
+	for n := 1; n <= 5; n++ {
+		delays = append(delays, b.Delay(n))
+	}
+	assert.Equal(t, []time.Duration{10 * time.Second, 20 * time.Second, 40 * time.Second, time.Minute, time.Minute}, delays)
+	assert.Equal(t, time.Minute, b.Delay(1000))
+}
+
+func TestSend(t *testing.T) {
+	var got *http.Request
+	var gotBody []byte
+	status := http.StatusNoContent
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+		gotBody, _ = io.ReadAll(r.Body)
+		w.WriteHeader(status)
+		io.WriteString(w, "busy\n")
+	}))
+	defer receiver.Close()
+
+	at := time.Unix(1700000000, 0)
+	d := Delivery{ID: "0123abcd", Event: "ad.created", URL: receiver.URL, Secret: "secret", Payload: []byte(`{"event":"ad.created"}`)}
+	assert.NoError(t, Send(context.Background(), receiver.Client(), d, at))
+
+	assert.Equal(t, "POST", got.Method)
+	assert.Equal(t, "application/json", got.Header.Get("Content-Type"))
+	assert.Equal(t, "ad.created", got.Header.Get(HeaderEvent))
+	assert.Equal(t, "0123abcd", got.Header.Get(HeaderDelivery))
+	timestamp, err := strconv.ParseInt(got.Header.Get(HeaderTimestamp), 10, 64)
+	assert.NoError(t, err)
+	assert.True(t, Verify("secret", timestamp, gotBody, got.Header.Get(HeaderSignature)))
+
+	status = http.StatusServiceUnavailable
+	assert.EqualError(t, Send(context.Background(), receiver.Client(), d, at), "503 Service Unavailable: busy")
+
+	d.URL = "http://127.0.0.1:0"
+	assert.Error(t, Send(context.Background(), receiver.Client(), d, at))
+}